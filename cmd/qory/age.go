@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// parseAge parses a relative age such as "30d", "2w" or any Go duration
+// ("36h", "90m"). Days and weeks are not supported by time.ParseDuration
+// but are by far the most useful units for session housekeeping.
+func parseAge(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": day, "w": 7 * day}
+	for suffix, unit := range units {
+		if num, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(num)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (e.g. 30d, 2w, 12h)", value)
+	}
+	return d, nil
+}
+
+// parseTimeBound parses either a calendar date ("2024-05-31", local time) or
+// an age relative to now. With endOfDay set, a date means the end of that day,
+// so that it can be used as an inclusive upper bound.
+func parseTimeBound(value string, now time.Time, endOfDay bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		if endOfDay {
+			t = t.Add(day - time.Nanosecond)
+		}
+		return t, nil
+	}
+
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (e.g. 2024-05-31, 30d, 12h)", value)
+	}
+	return now.Add(-age), nil
+}
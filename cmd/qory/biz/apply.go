@@ -0,0 +1,233 @@
+package biz
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dtrugman/qory/lib/patch"
+)
+
+// applyInstructions asks the model to answer with edits to files, in a form
+// patch.Parse understands.
+func applyInstructions(files []string) string {
+	return "Reply with the changes to make to " + strings.Join(files, ", ") + ".\n" +
+		"Give the changes to each file either as a unified diff (--- a/path, +++ b/path and @@ hunks " +
+		"with three lines of context), or as search/replace blocks that quote the lines to replace exactly:\n\n" +
+		"path/to/file\n" +
+		"<<<<<<< SEARCH\n" +
+		"lines to replace\n" +
+		"=======\n" +
+		"lines to replace them with\n" +
+		">>>>>>> REPLACE\n\n" +
+		"Use the paths as given above. To create a file, diff it against /dev/null, " +
+		"giving it a path relative to the current directory."
+}
+
+// applyEdits shows the edits proposed in answer one file at a time, and writes
+// those confirm accepts. It returns the unified diff of the edits applied.
+// Only the input files of the question may be edited, and new files created
+// under the working directory (see checkEditPath). Edits that can't be applied
+// are reported and skipped, and make for an error once all edits have been
+// offered.
+func applyEdits(answer string, files []string, confirm func(question string) (bool, error)) (string, error) {
+	edits := patch.Parse(answer)
+	if len(edits) == 0 {
+		fmt.Fprintln(os.Stderr, "The answer proposes no edits")
+		return "", nil
+	}
+
+	inputs := make(map[string]bool, len(files))
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil {
+			inputs[abs] = true
+		}
+	}
+
+	var applied strings.Builder
+	failed := 0
+	for _, e := range edits {
+		if err := checkEditPath(e, inputs); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipped %s: %v\n", e.Path, err)
+			failed++
+			continue
+		}
+		diff, err := editDiff(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipped %s: %v\n", e.Path, err)
+			failed++
+			continue
+		}
+		if diff.text == "" {
+			fmt.Fprintf(os.Stderr, "Skipped %s: no changes\n", e.Path)
+			continue
+		}
+
+		printDiff(diff.text)
+		question := fmt.Sprintf("Apply these changes to %s?", e.Path)
+		if e.Delete {
+			question = fmt.Sprintf("Delete %s?", e.Path)
+		}
+		ok, err := confirm(question)
+		if err != nil {
+			return applied.String(), err
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Skipped %s\n", e.Path)
+			continue
+		}
+
+		if err := diff.write(); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipped %s: %v\n", e.Path, err)
+			failed++
+			continue
+		}
+		applied.WriteString(diff.text)
+		fmt.Fprintf(os.Stderr, "Applied %s\n", e.Path)
+	}
+
+	if failed > 0 {
+		return applied.String(), fmt.Errorf("%d of %d proposed edits could not be applied", failed, len(edits))
+	}
+	return applied.String(), nil
+}
+
+// checkEditPath refuses edits to anything but the input files, so that an
+// answer steered by its inputs can't reach other files. New files may be
+// created too, under the working directory and without following symlinks
+// out of it.
+func checkEditPath(e patch.Edit, inputs map[string]bool) error {
+	abs, err := filepath.Abs(e.Path)
+	if err != nil {
+		return err
+	}
+	if inputs[abs] {
+		return nil
+	}
+
+	notInput := errors.New("not one of the input files")
+	if e.Delete {
+		return notInput
+	}
+	if _, err := os.Lstat(e.Path); !errors.Is(err, os.ErrNotExist) {
+		return notInput
+	}
+	if !filepath.IsLocal(e.Path) || !inWorkDir(abs) {
+		return errors.New("new files must be created under the current directory")
+	}
+	return nil
+}
+
+// inWorkDir reports whether the closest existing ancestor of abs resolves to
+// a directory within the working directory.
+func inWorkDir(abs string) bool {
+	wd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return false
+	}
+
+	dir := filepath.Dir(abs)
+	for {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(wd, real)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// fileDiff is an edit applied in memory, ready to be written out.
+type fileDiff struct {
+	path    string
+	content string
+	delete  bool
+	text    string
+}
+
+// editDiff applies e to the current content of its file.
+func editDiff(e patch.Edit) (fileDiff, error) {
+	from, to := diffLabel("a", e.Path), diffLabel("b", e.Path)
+
+	old, err := os.ReadFile(e.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		if e.Delete {
+			return fileDiff{}, fmt.Errorf("%s doesn't exist", e.Path)
+		}
+		from = patch.DevNull
+	} else if err != nil {
+		return fileDiff{}, err
+	}
+	if e.Delete {
+		to = patch.DevNull
+	}
+
+	content, err := e.Apply(string(old))
+	if err != nil {
+		return fileDiff{}, err
+	}
+	return fileDiff{
+		path:    e.Path,
+		content: content,
+		delete:  e.Delete,
+		text:    patch.Diff(from, to, string(old), content),
+	}, nil
+}
+
+func (d fileDiff) write() error {
+	if d.delete {
+		return os.Remove(d.path)
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(d.path, []byte(d.content), 0o644)
+}
+
+// diffLabel names path in a diff header, with the a/ or b/ prefix git uses
+// for relative paths.
+func diffLabel(side string, path string) string {
+	path = filepath.ToSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return side + "/" + path
+}
+
+// printDiff prints a unified diff to stderr, colored when stderr is a
+// terminal.
+func printDiff(diff string) {
+	r := lipgloss.NewRenderer(os.Stderr)
+	header := r.NewStyle().Bold(true)
+	hunk := r.NewStyle().Foreground(lipgloss.Color("86"))
+	added := r.NewStyle().Foreground(lipgloss.Color("114"))
+	removed := r.NewStyle().Foreground(lipgloss.Color("203"))
+
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+			line = header.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			line = hunk.Render(line)
+		case strings.HasPrefix(line, "+"):
+			line = added.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = removed.Render(line)
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
@@ -0,0 +1,172 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// answering returns a Confirm function that gives the answers in order, and
+// records the questions asked.
+func answering(asked *[]string, answers ...bool) func(string) (bool, error) {
+	return func(question string) (bool, error) {
+		*asked = append(*asked, question)
+		if len(answers) == 0 {
+			return false, errors.New("unexpected question")
+		}
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+}
+
+func Test_applyEdits_WritesConfirmedFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	kept := "kept.txt"
+	changed := "changed.txt"
+	created := filepath.Join("sub", "new.txt")
+	require.NoError(t, os.WriteFile(kept, []byte("one\n"), 0o644))
+	require.NoError(t, os.WriteFile(changed, []byte("one\ntwo\n"), 0o644))
+
+	answer := "--- a/" + kept + "\n+++ b/" + kept + "\n@@ -1 +1 @@\n-one\n+uno\n\n" +
+		changed + "\n<<<<<<< SEARCH\ntwo\n=======\ndos\n>>>>>>> REPLACE\n\n" +
+		"--- /dev/null\n+++ " + created + "\n@@ -0,0 +1 @@\n+hello\n"
+
+	var asked []string
+	patch, err := applyEdits(answer, []string{kept, changed}, answering(&asked, false, true, true))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"Apply these changes to " + kept + "?",
+		"Apply these changes to " + changed + "?",
+		"Apply these changes to " + created + "?",
+	}, asked)
+	assert.Equal(t, "--- a/"+changed+"\n+++ b/"+changed+"\n@@ -1,2 +1,2 @@\n one\n-two\n+dos\n"+
+		"--- /dev/null\n+++ b/sub/new.txt\n@@ -0,0 +1 @@\n+hello\n", patch)
+
+	for path, want := range map[string]string{kept: "one\n", changed: "one\ndos\n", created: "hello\n"} {
+		got, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(got), path)
+	}
+}
+
+func Test_applyEdits_ReportsEditsThatDontMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, os.WriteFile(path, []byte("one\n"), 0o644))
+
+	answer := path + "\n<<<<<<< SEARCH\nthree\n=======\ntres\n>>>>>>> REPLACE\n"
+
+	var asked []string
+	patch, err := applyEdits(answer, []string{path}, answering(&asked))
+	assert.EqualError(t, err, "1 of 1 proposed edits could not be applied")
+	assert.Empty(t, patch)
+	assert.Empty(t, asked)
+}
+
+func Test_applyEdits_RefusesPathsOutsideInputs(t *testing.T) {
+	outside := t.TempDir()
+	other := filepath.Join(outside, "other.txt")
+	require.NoError(t, os.WriteFile(other, []byte("one\n"), 0o644))
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("input.txt", []byte("one\n"), 0o644))
+	require.NoError(t, os.WriteFile("sibling.txt", []byte("one\n"), 0o644))
+	require.NoError(t, os.Symlink(outside, "link"))
+
+	created := func(path string) string {
+		return "--- /dev/null\n+++ " + path + "\n@@ -0,0 +1 @@\n+hello\n\n"
+	}
+	answer := "--- " + other + "\n+++ " + other + "\n@@ -1 +1 @@\n-one\n+uno\n\n" +
+		"--- a/sibling.txt\n+++ b/sibling.txt\n@@ -1 +1 @@\n-one\n+uno\n\n" +
+		created(filepath.Join(outside, "new.txt")) +
+		created("../escaped.txt") +
+		created("link/new.txt")
+
+	var asked []string
+	patch, err := applyEdits(answer, []string{"input.txt"}, answering(&asked))
+	assert.EqualError(t, err, "5 of 5 proposed edits could not be applied")
+	assert.Empty(t, patch)
+	assert.Empty(t, asked)
+
+	got, err := os.ReadFile(other)
+	require.NoError(t, err)
+	assert.Equal(t, "one\n", string(got))
+	assert.NoFileExists(t, filepath.Join(outside, "new.txt"))
+	assert.NoFileExists(t, "../escaped.txt")
+}
+
+func Test_applyEdits_NoEdits(t *testing.T) {
+	var asked []string
+	patch, err := applyEdits("Looks fine to me.", nil, answering(&asked))
+	require.NoError(t, err)
+	assert.Empty(t, patch)
+	assert.Empty(t, asked)
+}
+
+func Test_QueryNew_AppliesEditsAndRecordsPatch(t *testing.T) {
+	path := writeTemp(t, "one\n")
+	answer := "--- " + path + "\n+++ " + path + "\n@@ -1 +1 @@\n-one\n+uno\n"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	asksForEdits := mock.MatchedBy(func(messages []message.Message) bool {
+		return len(messages) == 1 && strings.Contains(messages[0].Content, "Reply with the changes to make to "+path+".")
+	})
+	client.On("Query", mock.Anything, asksForEdits).Return(message.NewAssistantMessage(answer), nil)
+
+	recordsPatch := mock.MatchedBy(func(s session.Session) bool {
+		return s.Messages[len(s.Messages)-1].Patch == "--- "+path+"\n+++ "+path+"\n@@ -1 +1 @@\n-one\n+uno\n"
+	})
+	sm.On("Store", mock.AnythingOfType("string"), recordsPatch).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	var asked []string
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{"translate", path}, QueryOptions{
+		Title:   "Spanish",
+		Apply:   true,
+		Confirm: answering(&asked, true),
+	})
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "uno\n", string(got))
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_ApplyRequiresFiles(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	conf.On("InputFormat").Return(string(config.DefaultInputFormat), config.OriginDefault, nil)
+	conf.On("InputMode").Return(string(config.DefaultInputMode), config.OriginDefault, nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{"add", "a", "ping", "endpoint"}, QueryOptions{Apply: true})
+	assert.EqualError(t, err, "there are no files to apply edits to; pass them as inputs or with --file")
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
@@ -0,0 +1,130 @@
+package biz
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+	"github.com/google/uuid"
+)
+
+// Chat is a session kept open across several turns, as in the interactive
+// chat mode. Every turn goes through the same path as a one-shot query and is
+// persisted as soon as it completes.
+type Chat struct {
+	q    *Qory
+	id   string
+	sess session.Session
+	opts QueryOptions
+}
+
+// OpenChat opens the session with the given ID, starting it if it does not
+// exist yet. An empty ID starts a new session with a generated ID.
+func (q *Qory) OpenChat(id string, opts QueryOptions) (*Chat, error) {
+	c := &Chat{q: q, id: id, sess: session.NewSession(), opts: opts}
+	if id == "" {
+		c.id = uuid.NewString()
+		return c, nil
+	}
+
+	sess, err := q.sm.Load(id)
+	if errors.Is(err, session.ErrNotFound) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.sess = sess
+	return c, nil
+}
+
+// OpenLastChat opens the most recently updated session.
+func (q *Qory) OpenLastChat(opts QueryOptions) (*Chat, error) {
+	id, err := q.sm.Last()
+	if err != nil {
+		return nil, err
+	}
+	return q.OpenChat(id, opts)
+}
+
+// ID returns the ID the session is stored under.
+func (c *Chat) ID() string {
+	return c.id
+}
+
+// Session returns the conversation so far.
+func (c *Chat) Session() session.Session {
+	return c.sess
+}
+
+// Model returns the model the next turn will be answered by.
+func (c *Chat) Model() (string, error) {
+	defaults, err := c.q.defaultParams()
+	if err != nil {
+		return "", err
+	}
+	return defaults.Merge(c.sess.Params.Merge(c.opts.Params)).Model, nil
+}
+
+// SetModel switches the model for the following turns. Like --model, the
+// choice is recorded in the session.
+func (c *Chat) SetModel(model string) {
+	c.opts.Params.Model = model
+}
+
+// Send asks the next question, built from inputs like a one-shot query.
+func (c *Chat) Send(ctx context.Context, inputs []string) error {
+	return c.q.runQueryInner(ctx, c.id, &c.sess, inputs, c.opts)
+}
+
+// Retry discards the latest answer and asks the same question again.
+func (c *Chat) Retry(ctx context.Context) error {
+	return c.q.retryTurn(ctx, c.id, &c.sess, c.opts)
+}
+
+// Undo removes the latest question together with its answer.
+func (c *Chat) Undo() error {
+	if err := undoTurn(&c.sess); err != nil {
+		return err
+	}
+	return c.q.persistEdit(c.id, c.sess)
+}
+
+// SetSystemPrompt replaces the system prompt of the session; an empty prompt
+// removes it.
+func (c *Chat) SetSystemPrompt(prompt string) error {
+	msgs := c.sess.Messages
+	if len(msgs) > 0 && msgs[0].Role == message.RoleSystem {
+		msgs = msgs[1:]
+	}
+	if prompt != "" {
+		msgs = append([]message.Message{message.NewSystemMessage(prompt)}, msgs...)
+	}
+	c.sess.Messages = msgs
+	return c.q.persistEdit(c.id, c.sess)
+}
+
+// Save stores the session under a new, human-chosen ID. Named sessions are
+// never removed by history-size cleanup.
+func (c *Chat) Save(id string) error {
+	if id == c.id {
+		return nil
+	}
+
+	if c.sess.Turns() == 0 {
+		if _, err := c.q.sm.Load(id); err == nil {
+			return session.ErrExists
+		} else if !errors.Is(err, session.ErrNotFound) {
+			return err
+		}
+		c.id = id
+		return nil
+	}
+
+	if err := c.q.sm.Rename(c.id, id); err != nil {
+		return err
+	}
+	c.id = id
+	return nil
+}
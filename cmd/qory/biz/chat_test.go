@@ -0,0 +1,214 @@
+package biz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func makeChatSession() session.Session {
+	sess := session.NewSession()
+	sess.AddMessage(message.NewUserMessage("first"))
+	sess.AddMessage(message.NewAssistantMessage("answer one"))
+	sess.AddMessage(message.NewUserMessage("second"))
+	sess.AddMessage(message.NewAssistantMessage("answer two"))
+	return sess
+}
+
+func Test_OpenChat_StartsMissingSession(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Load", "notes").Return(session.Session{}, session.ErrNotFound)
+
+	q := NewQory(conf, client, sm)
+	c, err := q.OpenChat("notes", QueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "notes", c.ID())
+	assert.Empty(t, c.Session().Messages)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Chat_SendKeepsConversation(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	first := []message.Message{message.NewUserMessage("hi")}
+	client.On("Query", generation.Params{Model: "gpt-4o"}, first).
+		Return(message.NewAssistantMessage("hello"), nil)
+	second := []message.Message{
+		message.NewUserMessage("hi"),
+		message.NewAssistantMessage("hello"),
+		message.NewUserMessage("bye"),
+	}
+	client.On("Query", generation.Params{Model: "gpt-4o"}, second).
+		Return(message.NewAssistantMessage("goodbye"), nil)
+	sm.On("Store", "chat", mock.AnythingOfType("session.Session")).Return(nil).Twice()
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil).Twice()
+
+	q := NewQory(conf, client, sm)
+	c := &Chat{q: q, id: "chat", sess: session.NewSession()}
+	require.NoError(t, c.Send(context.Background(), []string{"hi"}))
+	require.NoError(t, c.Send(context.Background(), []string{"bye"}))
+	assert.Len(t, c.Session().Messages, 4)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Chat_SetModelAppliesToNextTurn(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+
+	q := NewQory(conf, client, sm)
+	c := &Chat{q: q, id: "chat", sess: session.NewSession()}
+	c.SetModel("gpt-4o-mini")
+	model, err := c.Model()
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", model)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Chat_RetryReplacesLastAnswer(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	sess := makeChatSession()
+	client.On("Query", generation.Params{Model: "gpt-4o"}, sess.Messages[:3]).
+		Return(message.NewAssistantMessage("better answer"), nil)
+
+	expected := makeChatSession()
+	expected.Messages[3] = message.NewAssistantMessage("better answer")
+	sm.On("Store", "chat", expected).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	c := &Chat{q: q, id: "chat", sess: sess}
+	require.NoError(t, c.Retry(context.Background()))
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Chat_UndoRemovesLastExchange(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expected := session.NewSession()
+	expected.AddMessage(message.NewUserMessage("first"))
+	expected.AddMessage(message.NewAssistantMessage("answer one"))
+	sm.On("Store", "chat", expected).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	c := &Chat{q: q, id: "chat", sess: makeChatSession()}
+	require.NoError(t, c.Undo())
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Chat_UndoLastExchangeDeletesSession(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Delete", "chat").Return(nil)
+
+	sess := session.NewSession()
+	sess.AddMessage(message.NewUserMessage("only"))
+	q := NewQory(conf, client, sm)
+	c := &Chat{q: q, id: "chat", sess: sess}
+	require.NoError(t, c.Undo())
+	assert.ErrorIs(t, c.Undo(), ErrNothingToUndo)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Chat_SetSystemPromptReplacesExisting(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sess := session.NewSession()
+	sess.AddMessage(message.NewSystemMessage("old"))
+	sess.AddMessage(message.NewUserMessage("q"))
+
+	expected := session.NewSession()
+	expected.AddMessage(message.NewSystemMessage("new"))
+	expected.AddMessage(message.NewUserMessage("q"))
+	sm.On("Store", "chat", expected).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	c := &Chat{q: q, id: "chat", sess: sess}
+	require.NoError(t, c.SetSystemPrompt("new"))
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Chat_SaveRenamesStoredSession(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Rename", "chat", "named").Return(nil)
+
+	q := NewQory(conf, client, sm)
+	c := &Chat{q: q, id: "chat", sess: makeChatSession()}
+	require.NoError(t, c.Save("named"))
+	assert.Equal(t, "named", c.ID())
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Chat_SaveBeforeFirstTurnRejectsExistingID(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Load", "taken").Return(session.Session{}, nil)
+
+	q := NewQory(conf, client, sm)
+	c := &Chat{q: q, id: "chat", sess: session.NewSession()}
+	assert.ErrorIs(t, c.Save("taken"), session.ErrExists)
+	assert.Equal(t, "chat", c.ID())
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
@@ -0,0 +1,131 @@
+package biz
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dtrugman/qory/lib/markdown"
+)
+
+// CodeSelection picks code blocks out of an answer.
+type CodeSelection struct {
+	// Index is the position of the only block to pick, counting from 1, or 0
+	// to pick all blocks.
+	Index int
+
+	// Lang, when set, picks only blocks in this language. Index then counts
+	// among those blocks.
+	Lang string
+}
+
+// pick returns the blocks of answer sel selects.
+func (sel CodeSelection) pick(answer string) ([]markdown.CodeBlock, error) {
+	all := markdown.CodeBlocks(answer)
+	blocks := all
+	if sel.Lang != "" {
+		blocks = nil
+		for _, b := range all {
+			if b.IsLang(sel.Lang) {
+				blocks = append(blocks, b)
+			}
+		}
+	}
+
+	kind := "code"
+	if sel.Lang != "" {
+		kind = sel.Lang + " code"
+	}
+	switch {
+	case len(blocks) == 0:
+		return nil, fmt.Errorf("the answer has no %s blocks", kind)
+	case sel.Index > len(blocks):
+		return nil, fmt.Errorf("the answer has only %d %s blocks", len(blocks), kind)
+	case sel.Index > 0:
+		return blocks[sel.Index-1 : sel.Index], nil
+	}
+	return blocks, nil
+}
+
+// extractCode prints or writes the code blocks of answer, as opts say.
+func extractCode(answer string, opts QueryOptions) error {
+	if !opts.PrintCode && opts.WriteBlocks == "" {
+		return nil
+	}
+	blocks, err := opts.Blocks.pick(answer)
+	if err != nil {
+		return err
+	}
+	if opts.PrintCode {
+		printBlocks(blocks)
+	}
+	if opts.WriteBlocks != "" {
+		overwrite := func(path string) (bool, error) {
+			if opts.Overwrite {
+				return true, nil
+			}
+			if opts.Confirm == nil {
+				return false, fmt.Errorf("%s already exists; pass --overwrite to replace it", path)
+			}
+			return opts.Confirm(fmt.Sprintf("Overwrite %s?", path))
+		}
+		return writeBlocks(opts.WriteBlocks, blocks, overwrite)
+	}
+	return nil
+}
+
+// printBlocks prints the code of blocks, separated by blank lines.
+func printBlocks(blocks []markdown.CodeBlock) {
+	codes := make([]string, len(blocks))
+	for i, b := range blocks {
+		codes[i] = b.Code
+	}
+	fmt.Print(strings.Join(codes, "\n"))
+}
+
+// writeBlocks writes each block to dir, in the file its fence names or in
+// block-N.<ext>, and lists the files written on stderr. A block naming the
+// same file as an earlier one falls back to block-N.<ext>. Existing files are
+// only replaced if overwrite says so; the files it declines are skipped.
+func writeBlocks(dir string, blocks []markdown.CodeBlock, overwrite func(path string) (bool, error)) error {
+	var errs []error
+	written := map[string]bool{}
+	for i, b := range blocks {
+		name, hinted := b.FileName(i + 1)
+		if b.Path != "" && !hinted {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring path %q of block %d, which points outside of %s\n", b.Path, i+1, dir)
+		}
+		if written[name] {
+			b.Path = ""
+			name, _ = b.FileName(i + 1)
+			fmt.Fprintf(os.Stderr, "Warning: block %d names the same file as an earlier block, writing it to %s instead\n", i+1, name)
+		}
+
+		path := filepath.Join(dir, name)
+		if _, err := os.Lstat(path); err == nil && !written[name] {
+			ok, err := overwrite(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Skipped %s\n", path)
+				continue
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.WriteFile(path, []byte(b.Code), 0o644); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		written[name] = true
+		fmt.Fprintf(os.Stderr, "Wrote %s (%d lines)\n", path, strings.Count(b.Code, "\n"))
+	}
+	return errors.Join(errs...)
+}
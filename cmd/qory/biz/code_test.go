@@ -0,0 +1,119 @@
+package biz
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const codeAnswer = "First:\n```go main.go\npackage main\n```\nThen:\n```sh\necho hi\n```\nAnd:\n```go\nvar x = 1\n```\n"
+
+func Test_CodeSelection_Pick(t *testing.T) {
+	blocks, err := CodeSelection{}.pick(codeAnswer)
+	require.NoError(t, err)
+	assert.Len(t, blocks, 3)
+
+	blocks, err = CodeSelection{Index: 2}.pick(codeAnswer)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, "echo hi\n", blocks[0].Code)
+
+	blocks, err = CodeSelection{Index: 2, Lang: "golang"}.pick(codeAnswer)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, "var x = 1\n", blocks[0].Code)
+}
+
+func Test_CodeSelection_PickErrors(t *testing.T) {
+	_, err := CodeSelection{}.pick("no code here")
+	assert.EqualError(t, err, "the answer has no code blocks")
+
+	_, err = CodeSelection{Lang: "rust"}.pick(codeAnswer)
+	assert.EqualError(t, err, "the answer has no rust code blocks")
+
+	_, err = CodeSelection{Index: 4}.pick(codeAnswer)
+	assert.EqualError(t, err, "the answer has only 3 code blocks")
+}
+
+func Test_writeBlocks(t *testing.T) {
+	dir := t.TempDir()
+	blocks, err := CodeSelection{}.pick(codeAnswer + "```py ../../evil.py\nboom\n```\n")
+	require.NoError(t, err)
+
+	require.NoError(t, writeBlocks(dir, blocks, refuseOverwrite(t)))
+
+	for name, want := range map[string]string{
+		"main.go":    "package main\n",
+		"block-2.sh": "echo hi\n",
+		"block-3.go": "var x = 1\n",
+		"block-4.py": "boom\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+		assert.Equal(t, want, string(got), name)
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "..", "..", "evil.py"))
+}
+
+// refuseOverwrite returns an overwrite function that fails the test.
+func refuseOverwrite(t *testing.T) func(string) (bool, error) {
+	return func(path string) (bool, error) {
+		t.Errorf("unexpected overwrite of %s", path)
+		return false, nil
+	}
+}
+
+func Test_writeBlocks_AsksBeforeOverwriting(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept.go")
+	replaced := filepath.Join(dir, "replaced.go")
+	require.NoError(t, os.WriteFile(kept, []byte("old\n"), 0o644))
+	require.NoError(t, os.WriteFile(replaced, []byte("old\n"), 0o644))
+
+	blocks, err := CodeSelection{}.pick("```go kept.go\nnew\n```\n\n```go replaced.go\nnew\n```\n")
+	require.NoError(t, err)
+
+	var asked []string
+	require.NoError(t, writeBlocks(dir, blocks, func(path string) (bool, error) {
+		asked = append(asked, path)
+		return path == replaced, nil
+	}))
+
+	assert.Equal(t, []string{kept, replaced}, asked)
+	for path, want := range map[string]string{kept: "old\n", replaced: "new\n"} {
+		got, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(got), path)
+	}
+}
+
+func Test_writeBlocks_SamePathTwice(t *testing.T) {
+	dir := t.TempDir()
+	blocks, err := CodeSelection{}.pick("```go main.go\nfirst\n```\n\n```go main.go\nsecond\n```\n")
+	require.NoError(t, err)
+
+	require.NoError(t, writeBlocks(dir, blocks, refuseOverwrite(t)))
+
+	for name, want := range map[string]string{"main.go": "first\n", "block-2.go": "second\n"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+		assert.Equal(t, want, string(got), name)
+	}
+}
+
+func Test_extractCode_RefusesOverwriteWithoutConfirm(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0o644))
+
+	err := extractCode("```go main.go\nnew\n```\n", QueryOptions{WriteBlocks: dir})
+	assert.ErrorContains(t, err, "pass --overwrite")
+
+	require.NoError(t, extractCode("```go main.go\nnew\n```\n", QueryOptions{WriteBlocks: dir, Overwrite: true}))
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", string(got))
+}
@@ -0,0 +1,125 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+	"github.com/dtrugman/qory/lib/window"
+)
+
+const summaryPrompt = "Summarize the conversation below so that it can be continued without it. " +
+	"Keep every decision, fact, name, number and piece of code that may matter later; " +
+	"drop pleasantries and repetition. Reply with the summary only."
+
+// ContextSizes returns the context size table used to budget prompts: the
+// built-in defaults overridden by the user's configured table, if any.
+func (q *Qory) ContextSizes() (window.Sizes, error) {
+	sizes := window.DefaultSizes()
+
+	raw, origin, err := q.conf.ContextSizes()
+	if err != nil {
+		return nil, fmt.Errorf("get context sizes failed: %w", err)
+	}
+	if origin == config.OriginNotSet {
+		return sizes, nil
+	}
+
+	overrides, err := window.ParseSizes(raw)
+	if err != nil {
+		return nil, err
+	}
+	return sizes.Merge(overrides), nil
+}
+
+// fitContext returns the messages of sess to send to the model, compacted
+// with the configured strategy when they would not fit its context window.
+// Summarizing records the summary in sess; the messages themselves are never
+// removed from the session. Models of unknown context size are sent the
+// whole conversation.
+func (q *Qory) fitContext(ctx context.Context, sess *session.Session, params generation.Params) ([]message.Message, error) {
+	strategy, _, err := q.conf.ContextStrategy()
+	if err != nil {
+		return nil, fmt.Errorf("get context strategy failed: %w", err)
+	}
+	if strategy == config.ContextOff {
+		return sess.Messages, nil
+	}
+
+	sizes, err := q.ContextSizes()
+	if err != nil {
+		return nil, err
+	}
+	size, ok := sizes.Lookup(params.Model)
+	if !ok {
+		return sess.Messages, nil
+	}
+	var maxTokens int64
+	if params.MaxTokens != nil {
+		maxTokens = *params.MaxTokens
+	}
+	budget := window.Budget(size, maxTokens)
+
+	fixed, turns := sess.Context()
+	drop := window.Trim(fixed, turns, budget)
+	if drop > 0 && strategy == config.ContextSummarize {
+		through := len(sess.Messages) - len(turns) + drop
+		if q.summarize(ctx, sess, params.Model, through, budget) {
+			fmt.Fprintf(os.Stderr, "Note: summarized %d earlier messages to fit the %d-token context of %s\n",
+				drop, size, params.Model)
+			fixed, turns = sess.Context()
+			drop = window.Trim(fixed, turns, budget)
+		}
+	}
+	if drop > 0 {
+		fmt.Fprintf(os.Stderr, "Note: left out %d earlier messages to fit the %d-token context of %s\n",
+			drop, size, params.Model)
+	}
+
+	messages := make([]message.Message, 0, len(fixed)+len(turns)-drop)
+	messages = append(messages, fixed...)
+	return append(messages, turns[drop:]...), nil
+}
+
+// summarize condenses the first through messages of sess, on top of its
+// current summary, into a new summary. Like titling it is best-effort: a
+// failure is reported as a warning and false is returned, leaving sess
+// untouched.
+func (q *Qory) summarize(ctx context.Context, sess *session.Session, model string, through int, budget int) bool {
+	_, turns := sess.Context()
+	covered := len(sess.Messages) - len(turns)
+
+	var transcript strings.Builder
+	if sess.Summary != nil && sess.Summary.Through == covered {
+		fmt.Fprintf(&transcript, "Summary of what came before: %s\n\n", strings.TrimSpace(sess.Summary.Text))
+	}
+	for _, m := range sess.Messages[covered:through] {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", m.Role, strings.TrimSpace(m.Text()))
+	}
+
+	// The part to summarize may itself exceed the context; keep its tail,
+	// which the conversation is more likely to build on.
+	text := transcript.String()
+	if maxBytes := budget * 3; len(text) > maxBytes {
+		text = strings.ToValidUTF8(text[len(text)-maxBytes:], "")
+	}
+
+	request := []message.Message{
+		message.NewSystemMessage(summaryPrompt),
+		message.NewUserMessage(text),
+	}
+	response, err := q.client.Query(ctx, generation.Params{Model: model}, request, io.Discard)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: summarize earlier messages: %v\n", err)
+		return false
+	}
+
+	sess.Summary = &session.Summary{Text: strings.TrimSpace(response.Content), Through: through}
+	return true
+}
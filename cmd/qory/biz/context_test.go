@@ -0,0 +1,159 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// makeLongSession returns a session whose first two turns do not fit the
+// context of the "tiny" model next to the third.
+func makeLongSession() session.Session {
+	long := strings.Repeat("word ", 40)
+	sess := session.NewSession()
+	sess.AddMessage(message.NewSystemMessage("be brief"))
+	sess.AddMessage(message.NewUserMessage("q1 " + long))
+	sess.AddMessage(message.NewAssistantMessage("a1 " + long))
+	sess.AddMessage(message.NewUserMessage("q2 " + long))
+	sess.AddMessage(message.NewAssistantMessage("a2 " + long))
+	sess.AddMessage(message.NewUserMessage("q3"))
+	return sess
+}
+
+func expectTinyContext(conf *MockConfig, strategy string) {
+	conf.On("ContextStrategy").Return(strategy, config.OriginUser, nil)
+	conf.On("ContextSizes").Return(`{"tiny": 200}`, config.OriginUser, nil)
+}
+
+func Test_FitContext_FitsUnchanged(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectTinyContext(conf, config.ContextTruncate)
+
+	sess := makeChatSession()
+	q := NewQory(conf, client, sm)
+	messages, err := q.fitContext(context.Background(), &sess, generation.Params{Model: "tiny"})
+	require.NoError(t, err)
+	assert.Equal(t, sess.Messages, messages)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_FitContext_TruncateKeepsSystemPrompt(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectTinyContext(conf, config.ContextTruncate)
+
+	sess := makeLongSession()
+	q := NewQory(conf, client, sm)
+	messages, err := q.fitContext(context.Background(), &sess, generation.Params{Model: "tiny"})
+	require.NoError(t, err)
+	assert.Equal(t, []message.Message{sess.Messages[0], sess.Messages[3], sess.Messages[4], sess.Messages[5]}, messages)
+	assert.Len(t, sess.Messages, 6)
+	assert.Nil(t, sess.Summary)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_FitContext_UnknownModelSendsEverything(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectTinyContext(conf, config.ContextTruncate)
+
+	sess := makeLongSession()
+	q := NewQory(conf, client, sm)
+	messages, err := q.fitContext(context.Background(), &sess, generation.Params{Model: "huge"})
+	require.NoError(t, err)
+	assert.Equal(t, sess.Messages, messages)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_FitContext_OffSendsEverything(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	conf.On("ContextStrategy").Return(config.ContextOff, config.OriginUser, nil)
+
+	sess := makeLongSession()
+	q := NewQory(conf, client, sm)
+	messages, err := q.fitContext(context.Background(), &sess, generation.Params{Model: "tiny"})
+	require.NoError(t, err)
+	assert.Equal(t, sess.Messages, messages)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_FitContext_SummarizeStoresSummary(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectTinyContext(conf, config.ContextSummarize)
+
+	sess := makeLongSession()
+	client.On("Query", generation.Params{Model: "tiny"}, mock.MatchedBy(func(msgs []message.Message) bool {
+		return len(msgs) == 2 && msgs[0].Content == summaryPrompt &&
+			strings.Contains(msgs[1].Content, "q1") && !strings.Contains(msgs[1].Content, "q2")
+	})).Return(message.NewAssistantMessage("asked q1"), nil)
+
+	q := NewQory(conf, client, sm)
+	messages, err := q.fitContext(context.Background(), &sess, generation.Params{Model: "tiny"})
+	require.NoError(t, err)
+
+	assert.Equal(t, &session.Summary{Text: "asked q1", Through: 3}, sess.Summary)
+	require.Len(t, messages, 5)
+	assert.Equal(t, sess.Messages[0], messages[0])
+	assert.Contains(t, messages[1].Content, "asked q1")
+	assert.Equal(t, sess.Messages[3:], messages[2:])
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_FitContext_SummarizeFailureFallsBackToTruncate(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectTinyContext(conf, config.ContextSummarize)
+
+	sess := makeLongSession()
+	client.On("Query", generation.Params{Model: "tiny"}, mock.Anything).
+		Return(message.Message{}, errors.New("provider down"))
+
+	q := NewQory(conf, client, sm)
+	messages, err := q.fitContext(context.Background(), &sess, generation.Params{Model: "tiny"})
+	require.NoError(t, err)
+	assert.Nil(t, sess.Summary)
+	assert.Equal(t, []message.Message{sess.Messages[0], sess.Messages[3], sess.Messages[4], sess.Messages[5]}, messages)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
@@ -0,0 +1,60 @@
+package biz
+
+import (
+	"fmt"
+
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/util"
+)
+
+// defaultParams collects the generation parameters configured as defaults.
+// Parameters that are not configured are left unset.
+func (q *Qory) defaultParams() (generation.Params, error) {
+	var params generation.Params
+
+	model, _, err := q.conf.Model()
+	if err != nil {
+		return params, fmt.Errorf("get model failed: %w", err)
+	}
+	params.Model = model
+
+	temperature, origin, err := q.conf.Temperature()
+	if err != nil {
+		return params, fmt.Errorf("get temperature failed: %w", err)
+	}
+	if origin != config.OriginNotSet {
+		params.Temperature = util.Ptr(temperature)
+	}
+
+	topP, origin, err := q.conf.TopP()
+	if err != nil {
+		return params, fmt.Errorf("get top_p failed: %w", err)
+	}
+	if origin != config.OriginNotSet {
+		params.TopP = util.Ptr(topP)
+	}
+
+	maxTokens, origin, err := q.conf.MaxTokens()
+	if err != nil {
+		return params, fmt.Errorf("get max tokens failed: %w", err)
+	}
+	if origin != config.OriginNotSet {
+		params.MaxTokens = util.Ptr(maxTokens)
+	}
+
+	seed, origin, err := q.conf.Seed()
+	if err != nil {
+		return params, fmt.Errorf("get seed failed: %w", err)
+	}
+	if origin != config.OriginNotSet {
+		params.Seed = util.Ptr(seed)
+	}
+
+	params.ReasoningEffort, _, err = q.conf.ReasoningEffort()
+	if err != nil {
+		return params, fmt.Errorf("get reasoning effort failed: %w", err)
+	}
+
+	return params, nil
+}
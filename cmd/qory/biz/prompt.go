@@ -1,41 +1,253 @@
 package biz
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"strings"
+
+	"github.com/dtrugman/qory/lib/input"
+	"github.com/dtrugman/qory/lib/message"
 )
 
+const (
+	// StdinArg marks where piped input goes among the inputs.
+	StdinArg = "-"
+
+	// maxInputBytes caps the total size of the files included in a question.
+	maxInputBytes = 2 << 20
+)
+
+// promptOptions control how buildUserPrompt interprets and renders inputs.
+type promptOptions struct {
+	// Stdin is the piped input, if any.
+	Stdin string
+
+	Format     input.Format
+	Mode       input.Mode
+	Extraction input.Extraction
+}
+
+// userPrompt is a question built from CLI inputs.
+type userPrompt struct {
+	Text   string
+	Images []message.Image
+
+	// Files are the paths of the text files included, whole or in part, in
+	// the order they were included. Documents and piped input are not files
+	// in this sense.
+	Files []string
+}
+
 // buildUserPrompt converts a list of CLI inputs into a single prompt string.
 // Each element is treated as a file path first; if the file can be read its
-// contents become a separate newline-delimited part. Consecutive plain-text
-// arguments are joined with spaces into a single part.
+// contents, marked up with its path as opts.Format says, become a separate
+// newline-delimited part. PDF and DOCX files, and HTML files if
+// opts.Extraction says so, contribute their text; other binary files are an
+// error. Directories and globs are expanded into
+// the text files they cover (see input.Expand), and the files included that
+// way are listed on stderr. Consecutive plain-text arguments are joined with
+// spaces into a single part. Images (png, jpg, gif, webp) are not part of
+// the text; they are returned as attachments instead.
+//
+// References (@path, @path:from-to) always name files; outside of
+// input.ModeGuess they are the only inputs treated as files. A reference to a
+// missing file is sent as text, unless in input.ModeStrict.
+//
+// Piped input, if any, becomes a marked up part placed at the first StdinArg,
+// or after all other inputs. It is left as is when it is the only input.
 //
-// Examples:
+// Examples, with the plain format:
 //
 //	["how", "are", "you"]        → "how are you"
 //	["explain", "file.txt"]      → "explain\n<file contents>"
 //	["file1.txt", "file2.txt"]   → "<file1 contents>\n<file2 contents>"
-func buildUserPrompt(inputs []string) string {
-	var parts []string
-	var textTokens []string
-
-	flushText := func() {
-		if len(textTokens) > 0 {
-			parts = append(parts, strings.Join(textTokens, " "))
-			textTokens = nil
-		}
+//	["explain", "-"] + stdin     → "explain\nInput from stdin:\n<stdin>"
+//	["review", "src/"]           → "review\n<src/a.go contents>\n<src/b.go contents>"
+//	["fix", "@main.go:10-20"]    → "fix\n<lines 10 to 20 of main.go>"
+//	["what is this", "shot.png"] → "what is this" + shot.png attached
+//
+// An error is returned when a file named on its own doesn't fit in what is
+// left of maxInputBytes; the files of directories and globs are left out
+// instead.
+func buildUserPrompt(inputs []string, opts promptOptions) (userPrompt, error) {
+	if !slices.ContainsFunc(inputs, func(arg string) bool { return arg != StdinArg }) {
+		return userPrompt{Text: opts.Stdin}, nil
 	}
 
+	b := promptBuilder{opts: opts, budget: &input.Budget{Remaining: maxInputBytes}}
 	for _, arg := range inputs {
-		bytes, err := os.ReadFile(arg)
-		if err == nil {
-			flushText()
-			parts = append(parts, string(bytes))
-		} else {
-			textTokens = append(textTokens, arg)
+		if err := b.add(arg); err != nil {
+			return userPrompt{}, err
 		}
 	}
-	flushText()
+	b.flushText()
+	b.addStdin()
 
-	return strings.Join(parts, "\n")
+	return userPrompt{Text: strings.Join(b.parts, "\n"), Images: b.images, Files: b.files}, nil
+}
+
+type promptBuilder struct {
+	opts   promptOptions
+	budget *input.Budget
+
+	parts      []string
+	images     []message.Image
+	files      []string
+	textTokens []string
+	stdinUsed  bool
+}
+
+func (b *promptBuilder) add(arg string) error {
+	if arg == StdinArg {
+		b.flushText()
+		b.addStdin()
+		return nil
+	}
+
+	if strings.HasPrefix(arg, input.RefPrefix+input.RefPrefix) {
+		b.textTokens = append(b.textTokens, arg[len(input.RefPrefix):])
+		return nil
+	}
+
+	ref, isRef, err := input.ParseRef(arg)
+	if err != nil {
+		return err
+	}
+	if isRef {
+		found, err := b.addRef(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		if !found {
+			if b.opts.Mode == input.ModeStrict {
+				return fmt.Errorf("%s: no such file or directory", arg)
+			}
+			b.textTokens = append(b.textTokens, arg)
+		}
+		return nil
+	}
+
+	if b.opts.Mode != input.ModeGuess {
+		b.textTokens = append(b.textTokens, arg)
+		return nil
+	}
+
+	found, err := b.addRef(input.Ref{Path: arg})
+	if errors.Is(err, input.ErrTooLarge) || errors.Is(err, input.ErrBinary) ||
+		errors.Is(err, input.ErrExtract) || errors.Is(err, message.ErrImageTooLarge) {
+		return err
+	}
+	if err != nil || !found {
+		b.textTokens = append(b.textTokens, arg)
+	}
+	return nil
+}
+
+// addRef includes the file, directory or glob ref points to. found is false
+// when there is nothing at ref.Path.
+func (b *promptBuilder) addRef(ref input.Ref) (found bool, err error) {
+	if _, isImage := message.ImageMediaType(ref.Path); isImage {
+		return b.addImage(ref)
+	}
+
+	if ref.Lines == nil {
+		files, expanded, err := b.opts.Extraction.Expand(ref.Path, b.budget)
+		if err != nil {
+			return true, err
+		}
+		if expanded {
+			b.flushText()
+			reportIncluded(ref.Path, files)
+			for _, f := range files {
+				b.parts = append(b.parts, b.opts.Format.File(f.Path, string(f.Content)))
+				b.addFile(f.Path)
+			}
+			return true, nil
+		}
+	}
+
+	content, err := b.opts.Extraction.ReadFile(ref.Path, b.budget)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+
+	text := string(content)
+	if ref.Lines != nil {
+		if text, err = ref.Lines.Slice(text); err != nil {
+			return true, err
+		}
+	}
+
+	b.flushText()
+	b.parts = append(b.parts, b.opts.Format.Excerpt(ref.Path, ref.Lines, text))
+	b.addFile(ref.Path)
+	return true, nil
+}
+
+// addFile records that the text file at path is part of the question.
+func (b *promptBuilder) addFile(path string) {
+	if !b.opts.Extraction.IsDocument(path) && !slices.Contains(b.files, path) {
+		b.files = append(b.files, path)
+	}
+}
+
+// addImage attaches the image ref points to.
+func (b *promptBuilder) addImage(ref input.Ref) (found bool, err error) {
+	if ref.Lines != nil {
+		return true, errors.New("line ranges only apply to text files")
+	}
+	img, err := message.AttachImage(ref.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	b.flushText()
+	b.images = append(b.images, img)
+	return true, nil
+}
+
+func (b *promptBuilder) flushText() {
+	if len(b.textTokens) > 0 {
+		b.parts = append(b.parts, strings.Join(b.textTokens, " "))
+		b.textTokens = nil
+	}
+}
+
+func (b *promptBuilder) addStdin() {
+	if !b.stdinUsed && b.opts.Stdin != "" {
+		b.parts = append(b.parts, b.opts.Format.Stdin(b.opts.Stdin))
+	}
+	b.stdinUsed = true
+}
+
+// reportIncluded lists on stderr the files a directory or glob expanded to.
+func reportIncluded(arg string, files []input.File) {
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Included no files from %s\n", arg)
+		return
+	}
+
+	var size int
+	for _, f := range files {
+		size += len(f.Content)
+	}
+	fmt.Fprintf(os.Stderr, "Included %d files (%s) from %s:\n", len(files), formatBytes(size), arg)
+	for _, f := range files {
+		fmt.Fprintf(os.Stderr, "  %s\n", f.Path)
+	}
+}
+
+// formatBytes renders n bytes in a human-friendly unit.
+func formatBytes(n int) string {
+	if n < 1<<10 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
 }
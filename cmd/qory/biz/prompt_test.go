@@ -3,8 +3,10 @@ package biz
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/dtrugman/qory/lib/input"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,55 +24,236 @@ func writeTemp(t *testing.T, content string) string {
 	return f.Name()
 }
 
+// plainOpts renders inputs as they are, guessing which ones are files.
+func plainOpts(stdin string) promptOptions {
+	return promptOptions{Stdin: stdin, Format: input.FormatPlain, Mode: input.ModeGuess}
+}
+
 func Test_buildUserPrompt_TextOnly(t *testing.T) {
-	result := buildUserPrompt([]string{"how", "are", "you"})
-	assert.Equal(t, "how are you", result)
+	prompt, err := buildUserPrompt([]string{"how", "are", "you"}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "how are you", prompt.Text)
 }
 
 func Test_buildUserPrompt_SingleText(t *testing.T) {
-	result := buildUserPrompt([]string{"hello"})
-	assert.Equal(t, "hello", result)
+	prompt, err := buildUserPrompt([]string{"hello"}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", prompt.Text)
 }
 
 func Test_buildUserPrompt_Empty(t *testing.T) {
-	result := buildUserPrompt([]string{})
-	assert.Equal(t, "", result)
+	prompt, err := buildUserPrompt([]string{}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "", prompt.Text)
 }
 
 func Test_buildUserPrompt_SingleFile(t *testing.T) {
 	path := writeTemp(t, "file content")
-	result := buildUserPrompt([]string{path})
-	assert.Equal(t, "file content", result)
+	prompt, err := buildUserPrompt([]string{path}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "file content", prompt.Text)
 }
 
 func Test_buildUserPrompt_TextThenFile(t *testing.T) {
 	path := writeTemp(t, "file content")
-	result := buildUserPrompt([]string{"explain", path})
-	assert.Equal(t, "explain\nfile content", result)
+	prompt, err := buildUserPrompt([]string{"explain", path}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "explain\nfile content", prompt.Text)
 }
 
 func Test_buildUserPrompt_FileThenText(t *testing.T) {
 	path := writeTemp(t, "file content")
-	result := buildUserPrompt([]string{path, "summarize", "briefly"})
-	assert.Equal(t, "file content\nsummarize briefly", result)
+	prompt, err := buildUserPrompt([]string{path, "summarize", "briefly"}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "file content\nsummarize briefly", prompt.Text)
 }
 
 func Test_buildUserPrompt_MultipleFiles(t *testing.T) {
 	path1 := writeTemp(t, "first file")
 	path2 := writeTemp(t, "second file")
-	result := buildUserPrompt([]string{path1, path2})
-	assert.Equal(t, "first file\nsecond file", result)
+	prompt, err := buildUserPrompt([]string{path1, path2}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "first file\nsecond file", prompt.Text)
 }
 
 func Test_buildUserPrompt_TextBetweenFiles(t *testing.T) {
 	path1 := writeTemp(t, "file one")
 	path2 := writeTemp(t, "file two")
-	result := buildUserPrompt([]string{path1, "compare", "these", path2})
-	assert.Equal(t, "file one\ncompare these\nfile two", result)
+	prompt, err := buildUserPrompt([]string{path1, "compare", "these", path2}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "file one\ncompare these\nfile two", prompt.Text)
 }
 
 func Test_buildUserPrompt_NonExistentPathTreatedAsText(t *testing.T) {
 	nonExistent := filepath.Join(t.TempDir(), "does-not-exist.txt")
-	result := buildUserPrompt([]string{"review", nonExistent})
-	assert.Equal(t, "review "+nonExistent, result)
+	prompt, err := buildUserPrompt([]string{"review", nonExistent}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "review "+nonExistent, prompt.Text)
+}
+
+func Test_buildUserPrompt_StdinOnly(t *testing.T) {
+	for _, inputs := range [][]string{nil, {"-"}} {
+		prompt, err := buildUserPrompt(inputs, plainOpts("piped question"))
+		require.NoError(t, err)
+		assert.Equal(t, "piped question", prompt.Text)
+	}
+}
+
+func Test_buildUserPrompt_StdinAfterText(t *testing.T) {
+	prompt, err := buildUserPrompt([]string{"why", "is", "this", "crashing"}, plainOpts("panic: oops\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "why is this crashing\nInput from stdin:\npanic: oops\n", prompt.Text)
+}
+
+func Test_buildUserPrompt_StdinAtDash(t *testing.T) {
+	prompt, err := buildUserPrompt([]string{"compare", "-", "with", "the", "spec"}, plainOpts("log"))
+	require.NoError(t, err)
+	assert.Equal(t, "compare\nInput from stdin:\nlog\nwith the spec", prompt.Text)
+}
+
+func Test_buildUserPrompt_StdinUsedOnce(t *testing.T) {
+	prompt, err := buildUserPrompt([]string{"-", "and", "-"}, plainOpts("log"))
+	require.NoError(t, err)
+	assert.Equal(t, "Input from stdin:\nlog\nand", prompt.Text)
+}
+
+func Test_buildUserPrompt_Directory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.log"), []byte("noise"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n"), 0o644))
+
+	prompt, err := buildUserPrompt([]string{"review", dir}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "review\npackage a", prompt.Text)
+}
+
+func Test_buildUserPrompt_ListsFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a"), 0o644))
+	path := writeTemp(t, "one\ntwo\n")
+
+	prompt, err := buildUserPrompt([]string{"review", dir, "@" + path + ":2", path, "-"}, plainOpts("log"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a.go"), path}, prompt.Files)
+}
+
+func Test_buildUserPrompt_GlobWithoutMatchesIsText(t *testing.T) {
+	prompt, err := buildUserPrompt([]string{"what", "is", "2*3?"}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "what is 2*3?", prompt.Text)
+}
+
+func Test_buildUserPrompt_TooLarge(t *testing.T) {
+	path := writeTemp(t, strings.Repeat("a", maxInputBytes+1))
+	_, err := buildUserPrompt([]string{path}, plainOpts(""))
+	assert.ErrorIs(t, err, input.ErrTooLarge)
+}
+
+func Test_buildUserPrompt_MarkdownFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.py")
+	require.NoError(t, os.WriteFile(path, []byte("print(1)\n"), 0o644))
+
+	prompt, err := buildUserPrompt([]string{"explain", path},
+		promptOptions{Stdin: "log", Format: input.FormatMarkdown, Mode: input.ModeGuess})
+	require.NoError(t, err)
+	assert.Equal(t, "explain\n"+input.DisplayPath(path)+"\n```python\nprint(1)\n```\nInput from stdin:\n```\nlog\n```", prompt.Text)
+}
+
+func Test_buildUserPrompt_RefWithLines(t *testing.T) {
+	path := writeTemp(t, "one\ntwo\nthree\nfour\n")
+
+	prompt, err := buildUserPrompt([]string{"fix", "@" + path + ":2-3"}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "fix\ntwo\nthree\n", prompt.Text)
+
+	prompt, err = buildUserPrompt([]string{"@" + path + ":3-"}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "three\nfour\n", prompt.Text)
+
+	_, err = buildUserPrompt([]string{"@" + path + ":9"}, plainOpts(""))
+	assert.Error(t, err)
+}
+
+func Test_buildUserPrompt_ExplicitModeOnlyReadsRefs(t *testing.T) {
+	path := writeTemp(t, "file content")
+	opts := plainOpts("")
+	opts.Mode = input.ModeExplicit
+
+	prompt, err := buildUserPrompt([]string{path, "@" + path}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, path+"\nfile content", prompt.Text)
+}
+
+func Test_buildUserPrompt_MissingRef(t *testing.T) {
+	missing := "@" + filepath.Join(t.TempDir(), "typo.go")
+
+	prompt, err := buildUserPrompt([]string{"look at", missing}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "look at "+missing, prompt.Text)
+
+	opts := plainOpts("")
+	opts.Mode = input.ModeStrict
+	_, err = buildUserPrompt([]string{"look at", missing}, opts)
+	assert.ErrorContains(t, err, "no such file")
+}
+
+func Test_buildUserPrompt_EscapedRefIsText(t *testing.T) {
+	opts := plainOpts("")
+	opts.Mode = input.ModeStrict
+
+	prompt, err := buildUserPrompt([]string{"ask", "@@john"}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "ask @john", prompt.Text)
+}
+
+func Test_buildUserPrompt_AttachesImages(t *testing.T) {
+	dir := t.TempDir()
+	shot := filepath.Join(dir, "shot.png")
+	require.NoError(t, os.WriteFile(shot, []byte("pixels"), 0o600))
+
+	prompt, err := buildUserPrompt([]string{"what is", shot, "and", "@" + shot}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "what is\nand", prompt.Text)
+	require.Len(t, prompt.Images, 2)
+	assert.Equal(t, shot, prompt.Images[0].Path)
+	assert.Equal(t, "image/png", prompt.Images[0].MediaType)
+
+	_, err = buildUserPrompt([]string{"@" + shot + ":2"}, plainOpts(""))
+	assert.Error(t, err)
+}
+
+func Test_buildUserPrompt_MissingImageIsText(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "gone.png")
+
+	prompt, err := buildUserPrompt([]string{"see", missing}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "see "+missing, prompt.Text)
+	assert.Empty(t, prompt.Images)
+}
+
+func Test_buildUserPrompt_BinaryFileIsAnError(t *testing.T) {
+	blob := filepath.Join(t.TempDir(), "core.dump")
+	require.NoError(t, os.WriteFile(blob, []byte{0, 1, 2, 3}, 0o600))
+
+	_, err := buildUserPrompt([]string{"why", blob}, plainOpts(""))
+	assert.ErrorIs(t, err, input.ErrBinary)
+}
+
+func Test_buildUserPrompt_DocumentText(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "page.html")
+	require.NoError(t, os.WriteFile(page, []byte("<h1>Title</h1><p>Body</p>"), 0o600))
+
+	prompt, err := buildUserPrompt([]string{"summarize", page}, plainOpts(""))
+	require.NoError(t, err)
+	assert.Equal(t, "summarize\n<h1>Title</h1><p>Body</p>", prompt.Text)
+	assert.Equal(t, []string{page}, prompt.Files)
+
+	opts := plainOpts("")
+	opts.Extraction.HTML = true
+	prompt, err = buildUserPrompt([]string{"summarize", page}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "summarize\n# Title\n\nBody", prompt.Text)
+	assert.Empty(t, prompt.Files)
 }
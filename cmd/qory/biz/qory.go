@@ -1,12 +1,22 @@
 package biz
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
 
 	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/input"
+	"github.com/dtrugman/qory/lib/markdown"
 	"github.com/dtrugman/qory/lib/message"
 	"github.com/dtrugman/qory/lib/session"
+	"github.com/dtrugman/qory/lib/tool"
+	"github.com/dtrugman/qory/lib/usage"
 	"github.com/google/uuid"
 )
 
@@ -14,6 +24,15 @@ import (
 type Config interface {
 	GetConfigSubdir(name string) (string, error)
 
+	Profile() (string, config.Origin)
+	UseProfile(string) error
+	Profiles() ([]string, error)
+	AddProfile(string) error
+	RemoveProfile(string) error
+	DefaultProfile() (string, config.Origin, error)
+	SetDefaultProfile(string) error
+	UnsetDefaultProfile() error
+
 	Editor() (string, config.Origin, error)
 	SetEditor(string) error
 	UnsetEditor() error
@@ -22,10 +41,22 @@ type Config interface {
 	SetHistorySize(string) error
 	UnsetHistorySize() error
 
+	RetryAttempts() (int, config.Origin, error)
+	SetRetryAttempts(string) error
+	UnsetRetryAttempts() error
+
+	RetryDelay() (time.Duration, config.Origin, error)
+	SetRetryDelay(string) error
+	UnsetRetryDelay() error
+
 	Mode() (string, config.Origin, error)
 	SetMode(string) error
 	UnsetMode() error
 
+	Provider() (string, config.Origin, error)
+	SetProvider(string) error
+	UnsetProvider() error
+
 	APIKey() (string, config.Origin, error)
 	SetAPIKey(string) error
 	UnsetAPIKey() error
@@ -38,15 +69,63 @@ type Config interface {
 	SetModel(string) error
 	UnsetModel() error
 
+	TitleModel() (string, config.Origin, error)
+	SetTitleModel(string) error
+	UnsetTitleModel() error
+
 	Prompt() (string, config.Origin, error)
 	SetPrompt(string) error
 	UnsetPrompt() error
+
+	Temperature() (float64, config.Origin, error)
+	SetTemperature(string) error
+	UnsetTemperature() error
+
+	TopP() (float64, config.Origin, error)
+	SetTopP(string) error
+	UnsetTopP() error
+
+	MaxTokens() (int64, config.Origin, error)
+	SetMaxTokens(string) error
+	UnsetMaxTokens() error
+
+	Seed() (int64, config.Origin, error)
+	SetSeed(string) error
+	UnsetSeed() error
+
+	ReasoningEffort() (string, config.Origin, error)
+	SetReasoningEffort(string) error
+	UnsetReasoningEffort() error
+
+	Prices() (string, config.Origin, error)
+	SetPrices(string) error
+	UnsetPrices() error
+
+	InputFormat() (string, config.Origin, error)
+	SetInputFormat(string) error
+	UnsetInputFormat() error
+
+	InputMode() (string, config.Origin, error)
+	SetInputMode(string) error
+	UnsetInputMode() error
+
+	ContextStrategy() (string, config.Origin, error)
+	SetContextStrategy(string) error
+	UnsetContextStrategy() error
+
+	ContextSizes() (string, config.Origin, error)
+	SetContextSizes(string) error
+	UnsetContextSizes() error
 }
 
 // Client is the interface for querying the language model.
 type Client interface {
 	AvailableModels() ([]string, error)
-	Query(model string, messages []message.Message) (string, error)
+	// Query streams the answer to out as it arrives and returns it once complete.
+	Query(ctx context.Context, params generation.Params, messages []message.Message, out io.Writer) (message.Message, error)
+	// QueryTools is Query letting the model call tools. It returns the tool
+	// calls and their results that led to the answer, followed by the answer.
+	QueryTools(ctx context.Context, params generation.Params, tools []tool.Tool, messages []message.Message, out io.Writer) ([]message.Message, error)
 }
 
 // SessionManager is the interface for persisting chat sessions.
@@ -54,11 +133,69 @@ type SessionManager interface {
 	Load(id string) (session.Session, error)
 	Store(id string, s session.Session) error
 	Delete(id string) error
+	Rename(oldID, newID string) error
+	Search(opts session.SearchOptions) ([]session.SearchResult, error)
 	Enum(limit int) ([]session.SessionPreview, error)
 	Last() (string, error)
 	Cleanup(limit int) error
 }
 
+// QueryOptions tunes a single query invocation.
+type QueryOptions struct {
+	// Params overrides the generation parameters recorded in the session and
+	// the configured defaults. Whatever is set here is recorded in the session.
+	Params generation.Params
+
+	// ShowUsage prints the token usage and estimated cost of the answer to stderr.
+	ShowUsage bool
+
+	// Title, when set, replaces the human-readable title of the session.
+	Title string
+
+	// Stdin is input piped into qory. It is included in the question where
+	// the inputs hold StdinArg ("-"), or after them.
+	Stdin string
+
+	// ExplicitInputs only treats references (@path) as files, even if the
+	// configured input mode would guess which inputs are files.
+	ExplicitInputs bool
+
+	// HTMLText sends the text of HTML inputs rather than their markup.
+	HTMLText bool
+
+	// Render renders the markdown of the answer for a terminal as it
+	// streams, rather than printing it as is.
+	Render bool
+
+	// PrintCode prints only the code blocks of the answer that Blocks
+	// selects, once the answer is complete, instead of the answer itself.
+	PrintCode bool
+
+	// WriteBlocks, when set, is a directory to write the code blocks of the
+	// answer that Blocks selects to.
+	WriteBlocks string
+
+	// Blocks selects code blocks for PrintCode and WriteBlocks.
+	Blocks CodeSelection
+
+	// Overwrite lets WriteBlocks replace existing files without asking
+	// Confirm first.
+	Overwrite bool
+
+	// Apply asks the model to answer with edits to the files in the
+	// question, then shows each edit and writes it to its file if Confirm
+	// accepts it. The edits applied are recorded in the session.
+	Apply bool
+
+	// Confirm asks the user a yes or no question. Apply requires it, and
+	// WriteBlocks asks it before replacing files.
+	Confirm func(question string) (bool, error)
+
+	// Tools are the tools the model may call while answering. The calls and
+	// their results are recorded in the session.
+	Tools []tool.Tool
+}
+
 // Qory is the application object. All business logic lives here; Cobra
 // command handlers are thin shims that delegate to these methods.
 type Qory struct {
@@ -78,13 +215,27 @@ func (q *Qory) GetConfig() Config {
 
 // runQueryInner is the shared query execution path. It appends the user prompt
 // to sess, queries the model, and persists the updated session under sessionID.
-func (q *Qory) runQueryInner(sessionID string, sess session.Session, inputs []string) error {
-	modelName, _, err := q.conf.Model()
+// If ctx is cancelled mid-stream, the user turn and the partial answer (flagged
+// as interrupted) are still persisted before the cancellation error is returned.
+func (q *Qory) runQueryInner(ctx context.Context, sessionID string, sess *session.Session, inputs []string, opts QueryOptions) error {
+	promptOpts, err := q.promptOptions(opts)
 	if err != nil {
-		return fmt.Errorf("get model failed: %w", err)
+		return err
+	}
+	prompt, err := buildUserPrompt(inputs, promptOpts)
+	if err != nil {
+		return err
 	}
-	if modelName == "" {
-		return fmt.Errorf("model is not set")
+	if opts.Apply {
+		if len(prompt.Files) == 0 {
+			return errors.New("there are no files to apply edits to; pass them as inputs or with --file")
+		}
+		prompt.Text += "\n" + applyInstructions(prompt.Files)
+	}
+
+	params, err := q.resolveParams(sess, opts)
+	if err != nil {
+		return err
 	}
 
 	if len(sess.Messages) == 0 {
@@ -97,18 +248,131 @@ func (q *Qory) runQueryInner(sessionID string, sess session.Session, inputs []st
 		}
 	}
 
-	userPrompt := buildUserPrompt(inputs)
-	sess.AddMessage(message.NewUserMessage(userPrompt))
+	question := message.NewUserMessage(prompt.Text)
+	question.Images = prompt.Images
+	sess.AddMessage(question)
+
+	return q.answer(ctx, sessionID, sess, params, prompt.Files, opts)
+}
+
+// promptOptions returns how the inputs of a query are to be interpreted and
+// rendered.
+func (q *Qory) promptOptions(opts QueryOptions) (promptOptions, error) {
+	rawFormat, _, err := q.conf.InputFormat()
+	if err != nil {
+		return promptOptions{}, fmt.Errorf("get input format failed: %w", err)
+	}
+	format, err := input.ParseFormat(rawFormat)
+	if err != nil {
+		return promptOptions{}, err
+	}
+
+	rawMode, _, err := q.conf.InputMode()
+	if err != nil {
+		return promptOptions{}, fmt.Errorf("get input mode failed: %w", err)
+	}
+	mode, err := input.ParseMode(rawMode)
+	if err != nil {
+		return promptOptions{}, err
+	}
+	if opts.ExplicitInputs && mode == input.ModeGuess {
+		mode = input.ModeExplicit
+	}
+
+	return promptOptions{Stdin: opts.Stdin, Format: format, Mode: mode, Extraction: input.Extraction{HTML: opts.HTMLText}}, nil
+}
+
+// resolveParams records the parameters chosen for this query in sess and
+// returns the parameters to query with.
+func (q *Qory) resolveParams(sess *session.Session, opts QueryOptions) (generation.Params, error) {
+	defaults, err := q.defaultParams()
+	if err != nil {
+		return generation.Params{}, err
+	}
+
+	// Explicitly chosen parameters stick to the session; configured defaults
+	// only fill in whatever neither the session nor this query specifies. The
+	// format only applies to this query.
+	recorded := opts.Params
+	recorded.Format = nil
+	sess.Params = sess.Params.Merge(recorded)
+	params := defaults.Merge(sess.Params)
+	params.Format = opts.Params.Format
+	if opts.Title != "" {
+		sess.Title = opts.Title
+	}
+	if params.Model == "" {
+		return generation.Params{}, fmt.Errorf("model is not set")
+	}
+	return params, nil
+}
+
+// answer queries the model with the conversation in sess, which must end with
+// a user message, then appends the answer and persists the session. files are
+// the input files of the question, the only ones opts.Apply may edit.
+func (q *Qory) answer(ctx context.Context, sessionID string, sess *session.Session, params generation.Params, files []string, opts QueryOptions) error {
+	firstExchange := countRole(sess.Messages, message.RoleUser) == 1
 
-	response, err := q.client.Query(modelName, sess.Messages)
+	messages, err := q.fitContext(ctx, sess, params)
 	if err != nil {
 		return err
 	}
 
-	sess.AddMessage(message.NewAssistantMessage(response))
+	// A new session is titled from its question while it is answered.
+	var waitTitle func() string
+	if firstExchange && sess.Title == "" {
+		var stopTitle context.CancelFunc
+		waitTitle, stopTitle = q.titleLater(ctx, slices.Clone(sess.Messages))
+		defer stopTitle()
+	}
+
+	var responses []message.Message
+	var queryErr error
+	if opts.PrintCode {
+		responses, queryErr = q.query(ctx, params, opts.Tools, messages, io.Discard)
+	} else if opts.Render {
+		md := markdown.NewWriter(os.Stdout, true)
+		responses, queryErr = q.query(ctx, params, opts.Tools, messages, md)
+		if err := md.Close(); err != nil && queryErr == nil {
+			queryErr = err
+		}
+	} else {
+		responses, queryErr = q.query(ctx, params, opts.Tools, messages, os.Stdout)
+	}
+	if queryErr != nil && !errors.Is(queryErr, context.Canceled) {
+		return queryErr
+	}
 
-	var errs []error
-	if err = q.sm.Store(sessionID, sess); err != nil {
+	// An answer cut short is kept if any of it arrived. Tool calls and their
+	// results that came before it are complete and always kept.
+	if last := len(responses) - 1; queryErr != nil && last >= 0 &&
+		responses[last].Role != message.RoleTool && len(responses[last].ToolCalls) == 0 {
+		if responses[last].Content == "" {
+			responses = responses[:last]
+		} else {
+			responses[last].Interrupted = true
+		}
+	}
+	for _, m := range responses {
+		sess.AddMessage(m)
+	}
+	var response message.Message
+	if len(responses) > 0 {
+		response = responses[len(responses)-1]
+		response.Usage = totalUsage(responses)
+	}
+
+	if queryErr == nil && waitTitle != nil {
+		sess.Title = waitTitle()
+	}
+
+	errs := []error{queryErr}
+	if queryErr == nil && opts.Apply {
+		patch, err := applyEdits(response.Content, files, opts.Confirm)
+		sess.Messages[len(sess.Messages)-1].Patch = patch
+		errs = append(errs, err)
+	}
+	if err := q.sm.Store(sessionID, *sess); err != nil {
 		errs = append(errs, fmt.Errorf("store session: %w", err))
 	}
 	historySize, _, err := q.conf.HistorySize()
@@ -117,39 +381,132 @@ func (q *Qory) runQueryInner(sessionID string, sess session.Session, inputs []st
 	} else if err = q.sm.Cleanup(historySize); err != nil {
 		errs = append(errs, fmt.Errorf("cleanup sessions: %w", err))
 	}
+
+	if opts.ShowUsage && queryErr == nil {
+		if err := q.reportUsage(response); err != nil {
+			errs = append(errs, fmt.Errorf("report usage: %w", err))
+		}
+	}
+
+	if queryErr == nil {
+		errs = append(errs, extractCode(response.Content, opts))
+	}
+
 	return errors.Join(errs...)
 }
 
+// query asks for the answer to messages, letting the model call tools if
+// any are enabled.
+func (q *Qory) query(ctx context.Context, params generation.Params, tools []tool.Tool, messages []message.Message, out io.Writer) ([]message.Message, error) {
+	if len(tools) == 0 {
+		response, err := q.client.Query(ctx, params, messages, out)
+		return []message.Message{response}, err
+	}
+	return q.client.QueryTools(ctx, params, tools, messages, out)
+}
+
+// totalUsage sums the token usage of responses, or returns nil if the
+// provider reported none.
+func totalUsage(responses []message.Message) *message.Usage {
+	var total *message.Usage
+	for _, m := range responses {
+		if m.Usage == nil {
+			continue
+		}
+		if total == nil {
+			total = &message.Usage{}
+		}
+		total.Add(*m.Usage)
+	}
+	return total
+}
+
+// reportUsage prints the token counts and estimated cost of m to stderr.
+func (q *Qory) reportUsage(m message.Message) error {
+	if m.Usage == nil {
+		fmt.Fprintln(os.Stderr, "Usage: not reported by provider")
+		return nil
+	}
+
+	prices, err := q.Prices()
+	if err != nil {
+		return err
+	}
+
+	line := fmt.Sprintf("Usage: %d prompt + %d completion tokens", m.Usage.PromptTokens, m.Usage.CompletionTokens)
+	if m.Usage.ReasoningTokens > 0 {
+		line += fmt.Sprintf(" (%d reasoning)", m.Usage.ReasoningTokens)
+	}
+	if cost, ok := prices.Cost(m.Model, *m.Usage); ok {
+		line += fmt.Sprintf(", est. $%.4f", cost)
+	} else {
+		line += fmt.Sprintf(", no price known for %q", m.Model)
+	}
+	fmt.Fprintln(os.Stderr, line)
+	return nil
+}
+
 // QueryNew starts a fresh session with a new UUID. History is never loaded.
-func (q *Qory) QueryNew(inputs []string) error {
+func (q *Qory) QueryNew(ctx context.Context, inputs []string, opts QueryOptions) error {
 	id := uuid.NewString()
 	session := session.NewSession()
-	return q.runQueryInner(id, session, inputs)
+	return q.runQueryInner(ctx, id, &session, inputs, opts)
 }
 
 // QuerySession loads the session with the given ID (creating it if absent) and
 // appends the new query to the existing conversation history.
-func (q *Qory) QuerySession(id string, inputs []string) error {
+func (q *Qory) QuerySession(ctx context.Context, id string, inputs []string, opts QueryOptions) error {
 	sess, err := q.sm.Load(id)
 	if err != nil {
 		return err
 	}
-	return q.runQueryInner(id, sess, inputs)
+	return q.runQueryInner(ctx, id, &sess, inputs, opts)
 }
 
 // QueryLast resolves the most recently modified session and continues it.
-func (q *Qory) QueryLast(inputs []string) error {
+func (q *Qory) QueryLast(ctx context.Context, inputs []string, opts QueryOptions) error {
 	id, err := q.sm.Last()
 	if err != nil {
 		return err
 	}
-	return q.QuerySession(id, inputs)
+	return q.QuerySession(ctx, id, inputs, opts)
+}
+
+// QueryFork branches the session id off after the given turn and continues
+// the new branch with inputs. The original session is left untouched.
+func (q *Qory) QueryFork(ctx context.Context, id string, turn int, inputs []string, opts QueryOptions) error {
+	sess, err := q.sm.Load(id)
+	if err != nil {
+		return err
+	}
+
+	fork, err := sess.Fork(id, turn)
+	if err != nil {
+		return err
+	}
+
+	forkID := uuid.NewString()
+	fmt.Fprintf(os.Stderr, "Forked session %s after turn %d into %s\n", id, turn, forkID)
+	return q.runQueryInner(ctx, forkID, &fork, inputs, opts)
+}
+
+// QueryForkLast is QueryFork on the most recently modified session.
+func (q *Qory) QueryForkLast(ctx context.Context, turn int, inputs []string, opts QueryOptions) error {
+	id, err := q.sm.Last()
+	if err != nil {
+		return err
+	}
+	return q.QueryFork(ctx, id, turn, inputs, opts)
 }
 
 // HistoryAll returns session previews. An optional limit caps the number
 // returned; omit or pass 0 to return all sessions.
-func (q *Qory) HistoryAll(limit int) ([]session.SessionPreview, error) {
-	return q.sm.Enum(limit)
+func (q *Qory) HistoryAll(limit ...int) ([]session.SessionPreview, error) {
+	n := 0
+	if len(limit) > 0 {
+		n = limit[0]
+	}
+	return q.sm.Enum(n)
 }
 
 // HistorySession returns the full session for the given session ID.
@@ -162,6 +519,92 @@ func (q *Qory) HistoryDelete(sessionID string) error {
 	return q.sm.Delete(sessionID)
 }
 
+// HistorySearch finds the stored sessions matching opts, best match first.
+func (q *Qory) HistorySearch(opts session.SearchOptions) ([]session.SearchResult, error) {
+	return q.sm.Search(opts)
+}
+
+// HistoryRename gives the session oldID the new ID newID.
+func (q *Qory) HistoryRename(oldID, newID string) error {
+	return q.sm.Rename(oldID, newID)
+}
+
+// HistoryPrune deletes every session last updated before cutoff and returns
+// the IDs of the deleted sessions.
+func (q *Qory) HistoryPrune(cutoff time.Time) ([]string, error) {
+	previews, err := q.sm.Enum(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, p := range previews {
+		if !p.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		if err := q.sm.Delete(p.Name); err != nil {
+			return deleted, fmt.Errorf("delete session %s: %w", p.Name, err)
+		}
+		deleted = append(deleted, p.Name)
+	}
+	return deleted, nil
+}
+
+// Prices returns the price table used for cost estimates: the built-in
+// defaults overridden by the user's configured table, if any.
+func (q *Qory) Prices() (usage.Prices, error) {
+	prices := usage.DefaultPrices()
+
+	raw, origin, err := q.conf.Prices()
+	if err != nil {
+		return nil, fmt.Errorf("get prices failed: %w", err)
+	}
+	if origin == config.OriginNotSet {
+		return prices, nil
+	}
+
+	overrides, err := usage.ParsePrices(raw)
+	if err != nil {
+		return nil, err
+	}
+	return prices.Merge(overrides), nil
+}
+
+// Usage aggregates the token usage recorded in all stored sessions,
+// considering only responses completed at or after since.
+func (q *Qory) Usage(by usage.GroupBy, since time.Time) ([]usage.Row, error) {
+	previews, err := q.sm.Enum(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []usage.Record
+	for _, p := range previews {
+		sess, err := q.sm.Load(p.Name)
+		if err != nil {
+			return nil, fmt.Errorf("load session %s: %w", p.Name, err)
+		}
+		for _, m := range sess.Messages {
+			if m.Role != message.RoleAssistant || m.Usage == nil || m.Time.Before(since) {
+				continue
+			}
+			records = append(records, usage.Record{
+				SessionID: p.Name,
+				Model:     m.Model,
+				Time:      m.Time,
+				Usage:     *m.Usage,
+			})
+		}
+	}
+
+	prices, err := q.Prices()
+	if err != nil {
+		return nil, err
+	}
+
+	return usage.Aggregate(records, by, prices), nil
+}
+
 // AvailableModels returns the list of models available from the client.
 func (q *Qory) AvailableModels() ([]string, error) {
 	return q.client.AvailableModels()
@@ -169,13 +612,13 @@ func (q *Qory) AvailableModels() ([]string, error) {
 
 // QueryDefault runs a query using the configured default mode (new or last).
 // If no mode is configured, it starts a new session.
-func (q *Qory) QueryDefault(inputs []string) error {
+func (q *Qory) QueryDefault(ctx context.Context, inputs []string, opts QueryOptions) error {
 	mode, _, err := q.conf.Mode()
 	if err != nil {
 		return fmt.Errorf("get mode failed: %w", err)
 	}
 	if mode == config.ModeLast {
-		return q.QueryLast(inputs)
+		return q.QueryLast(ctx, inputs, opts)
 	}
-	return q.QueryNew(inputs)
+	return q.QueryNew(ctx, inputs, opts)
 }
@@ -1,13 +1,20 @@
 package biz
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/generation"
 	"github.com/dtrugman/qory/lib/message"
 	"github.com/dtrugman/qory/lib/session"
+	"github.com/dtrugman/qory/lib/tool"
+	"github.com/dtrugman/qory/lib/usage"
+	"github.com/dtrugman/qory/lib/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -24,6 +31,41 @@ func (m *MockConfig) GetConfigSubdir(name string) (string, error) {
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockConfig) Profile() (string, config.Origin) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin)
+}
+
+func (m *MockConfig) UseProfile(name string) error {
+	return m.Called(name).Error(0)
+}
+
+func (m *MockConfig) Profiles() ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockConfig) AddProfile(name string) error {
+	return m.Called(name).Error(0)
+}
+
+func (m *MockConfig) RemoveProfile(name string) error {
+	return m.Called(name).Error(0)
+}
+
+func (m *MockConfig) DefaultProfile() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetDefaultProfile(name string) error {
+	return m.Called(name).Error(0)
+}
+
+func (m *MockConfig) UnsetDefaultProfile() error {
+	return m.Called().Error(0)
+}
+
 func (m *MockConfig) Editor() (string, config.Origin, error) {
 	args := m.Called()
 	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
@@ -50,6 +92,32 @@ func (m *MockConfig) UnsetHistorySize() error {
 	return m.Called().Error(0)
 }
 
+func (m *MockConfig) RetryAttempts() (int, config.Origin, error) {
+	args := m.Called()
+	return args.Int(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetRetryAttempts(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetRetryAttempts() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) RetryDelay() (time.Duration, config.Origin, error) {
+	args := m.Called()
+	return args.Get(0).(time.Duration), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetRetryDelay(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetRetryDelay() error {
+	return m.Called().Error(0)
+}
+
 func (m *MockConfig) Mode() (string, config.Origin, error) {
 	args := m.Called()
 	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
@@ -63,6 +131,19 @@ func (m *MockConfig) UnsetMode() error {
 	return m.Called().Error(0)
 }
 
+func (m *MockConfig) Provider() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetProvider(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetProvider() error {
+	return m.Called().Error(0)
+}
+
 func (m *MockConfig) APIKey() (string, config.Origin, error) {
 	args := m.Called()
 	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
@@ -102,6 +183,149 @@ func (m *MockConfig) UnsetModel() error {
 	return m.Called().Error(0)
 }
 
+func (m *MockConfig) TitleModel() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetTitleModel(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetTitleModel() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) Temperature() (float64, config.Origin, error) {
+	args := m.Called()
+	return args.Get(0).(float64), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetTemperature(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetTemperature() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) TopP() (float64, config.Origin, error) {
+	args := m.Called()
+	return args.Get(0).(float64), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetTopP(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetTopP() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) MaxTokens() (int64, config.Origin, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetMaxTokens(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetMaxTokens() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) Seed() (int64, config.Origin, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetSeed(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetSeed() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) ReasoningEffort() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetReasoningEffort(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetReasoningEffort() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) Prices() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetPrices(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetPrices() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) InputFormat() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetInputFormat(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetInputFormat() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) InputMode() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetInputMode(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetInputMode() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) ContextStrategy() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetContextStrategy(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetContextStrategy() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockConfig) ContextSizes() (string, config.Origin, error) {
+	args := m.Called()
+	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
+}
+
+func (m *MockConfig) SetContextSizes(value string) error {
+	return m.Called(value).Error(0)
+}
+
+func (m *MockConfig) UnsetContextSizes() error {
+	return m.Called().Error(0)
+}
+
 func (m *MockConfig) Prompt() (string, config.Origin, error) {
 	args := m.Called()
 	return args.String(0), args.Get(1).(config.Origin), args.Error(2)
@@ -115,6 +339,48 @@ func (m *MockConfig) UnsetPrompt() error {
 	return m.Called().Error(0)
 }
 
+// expectDefaultParams configures conf with the given model and no other
+// generation parameter defaults. No title model is configured either, so new
+// sessions are left untitled.
+func expectDefaultParams(conf *MockConfig, model string) {
+	expectParams(conf, generation.Params{Model: model}, "")
+}
+
+// expectParams configures conf with defaults as the configured generation
+// parameters, and titleModel as the title model unless it is empty.
+func expectParams(conf *MockConfig, defaults generation.Params, titleModel string) {
+	if titleModel == "" {
+		conf.On("TitleModel").Return("", config.OriginNotSet, nil).Maybe()
+	} else {
+		conf.On("TitleModel").Return(titleModel, config.OriginUser, nil)
+	}
+	conf.On("ContextStrategy").Return(config.DefaultContextStrategy, config.OriginDefault, nil).Maybe()
+	conf.On("InputFormat").Return(string(config.DefaultInputFormat), config.OriginDefault, nil).Maybe()
+	conf.On("InputMode").Return(string(config.DefaultInputMode), config.OriginDefault, nil).Maybe()
+	conf.On("ContextSizes").Return("", config.OriginNotSet, nil).Maybe()
+	conf.On("Model").Return(defaults.Model, config.OriginUser, nil)
+	expectParam(conf, "Temperature", defaults.Temperature)
+	expectParam(conf, "TopP", defaults.TopP)
+	expectParam(conf, "MaxTokens", defaults.MaxTokens)
+	expectParam(conf, "Seed", defaults.Seed)
+	if defaults.ReasoningEffort == "" {
+		conf.On("ReasoningEffort").Return("", config.OriginNotSet, nil)
+	} else {
+		conf.On("ReasoningEffort").Return(defaults.ReasoningEffort, config.OriginUser, nil)
+	}
+}
+
+// expectParam configures a single generation parameter default, which is
+// not set if value is nil.
+func expectParam[T any](conf *MockConfig, key string, value *T) {
+	if value == nil {
+		var zero T
+		conf.On(key).Return(zero, config.OriginNotSet, nil)
+		return
+	}
+	conf.On(key).Return(*value, config.OriginUser, nil)
+}
+
 // ---- mock client ----
 
 type MockClient struct {
@@ -126,9 +392,18 @@ func (m *MockClient) AvailableModels() ([]string, error) {
 	return args.Get(0).([]string), args.Error(1)
 }
 
-func (m *MockClient) Query(model string, msgs []message.Message) (string, error) {
-	args := m.Called(model, msgs)
-	return args.String(0), args.Error(1)
+func (m *MockClient) Query(_ context.Context, params generation.Params, msgs []message.Message, _ io.Writer) (message.Message, error) {
+	args := m.Called(params, msgs)
+	return args.Get(0).(message.Message), args.Error(1)
+}
+
+func (m *MockClient) QueryTools(_ context.Context, params generation.Params, tools []tool.Tool, msgs []message.Message, _ io.Writer) ([]message.Message, error) {
+	names := make([]string, 0, len(tools))
+	for _, t := range tools {
+		names = append(names, t.Name)
+	}
+	args := m.Called(params, names, msgs)
+	return args.Get(0).([]message.Message), args.Error(1)
 }
 
 // ---- mock session manager ----
@@ -162,6 +437,16 @@ func (m *MockSessionManager) Delete(id string) error {
 	return args.Error(0)
 }
 
+func (m *MockSessionManager) Rename(oldID, newID string) error {
+	args := m.Called(oldID, newID)
+	return args.Error(0)
+}
+
+func (m *MockSessionManager) Search(opts session.SearchOptions) ([]session.SearchResult, error) {
+	args := m.Called(opts)
+	return args.Get(0).([]session.SearchResult), args.Error(1)
+}
+
 func (m *MockSessionManager) Cleanup(limit int) error {
 	args := m.Called(limit)
 	return args.Error(0)
@@ -177,22 +462,164 @@ func Test_QueryNew_DoesNotLoadHistory(t *testing.T) {
 	client := &MockClient{}
 	sm := &MockSessionManager{}
 
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
+		message.NewUserMessage(userText),
+	}).Return(message.NewAssistantMessage(assistantText), nil)
+
+	expectedSession := session.NewSession()
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_SetsTitle(t *testing.T) {
+	userText := "hello"
+	assistantText := "response"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
+		message.NewUserMessage(userText),
+	}).Return(message.NewAssistantMessage(assistantText), nil)
+
+	expectedSession := session.NewSession()
+	expectedSession.Title = "Greetings"
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{Title: "Greetings"})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_GeneratesTitle(t *testing.T) {
+	userText := "how do I reverse a list in python"
+	assistantText := "Use reversed() or slicing."
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectParams(conf, generation.Params{Model: "gpt-4o"}, "gpt-4o-mini")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
+		message.NewUserMessage(userText),
+	}).Return(message.NewAssistantMessage(assistantText), nil)
+	client.On("Query", generation.Params{Model: "gpt-4o-mini"}, mock.Anything).
+		Return(message.NewAssistantMessage("\"Reversing Python lists.\"\n"), nil)
+
+	expectedSession := session.NewSession()
+	expectedSession.Title = "Reversing Python lists"
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_TitlesWhileAnswering(t *testing.T) {
+	userText := "hello"
+	assistantText := "response"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectParams(conf, generation.Params{Model: "gpt-4o"}, "gpt-4o-mini")
 	conf.On("Prompt").Return("", config.OriginNotSet, nil)
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	// The answer only completes once the title has been asked for.
+	titleAsked := make(chan struct{})
+	client.On("Query", generation.Params{Model: "gpt-4o-mini"}, mock.Anything).
+		Run(func(mock.Arguments) { close(titleAsked) }).
+		Return(message.NewAssistantMessage("Greetings"), nil)
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	}).Run(func(mock.Arguments) {
+		select {
+		case <-titleAsked:
+		case <-time.After(5 * time.Second):
+			t.Error("the title was not asked for while answering")
+		}
+	}).Return(message.NewAssistantMessage(assistantText), nil)
 
 	expectedSession := session.NewSession()
+	expectedSession.Title = "Greetings"
 	expectedSession.AddMessage(message.NewUserMessage(userText))
 	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
 	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryNew([]string{userText})
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_TitleFailureIsNotFatal(t *testing.T) {
+	userText := "hello"
+	assistantText := "response"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectParams(conf, generation.Params{Model: "gpt-4o"}, "gpt-4o-mini")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
+		message.NewUserMessage(userText),
+	}).Return(message.NewAssistantMessage(assistantText), nil)
+	client.On("Query", generation.Params{Model: "gpt-4o-mini"}, mock.Anything).
+		Return(message.Message{}, errors.New("model not found"))
+
+	expectedSession := session.NewSession()
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -209,16 +636,16 @@ func Test_QueryNew_UsesUniqueSessionIDs(t *testing.T) {
 	client := &MockClient{}
 	sm := &MockSessionManager{}
 
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
 	conf.On("Prompt").Return("", config.OriginNotSet, nil)
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewUserMessage(firstUserText),
-	}).Return(assistantText, nil).Once()
-	client.On("Query", "gpt-4o", []message.Message{
+	}).Return(message.NewAssistantMessage(assistantText), nil).Once()
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewUserMessage(secondUserText),
-	}).Return(assistantText, nil).Once()
+	}).Return(message.NewAssistantMessage(assistantText), nil).Once()
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	firstExpected := session.NewSession()
@@ -229,32 +656,142 @@ func Test_QueryNew_UsesUniqueSessionIDs(t *testing.T) {
 	secondExpected.AddMessage(message.NewUserMessage(secondUserText))
 	secondExpected.AddMessage(message.NewAssistantMessage(assistantText))
 
-	var storedIDs []string
-	captureID := func(args mock.Arguments) {
-		storedIDs = append(storedIDs, args.String(0))
-	}
+	var storedIDs []string
+	captureID := func(args mock.Arguments) {
+		storedIDs = append(storedIDs, args.String(0))
+	}
+
+	sm.On("Store", mock.AnythingOfType("string"), firstExpected).
+		Run(captureID).Return(nil).Once()
+	sm.On("Store", mock.AnythingOfType("string"), secondExpected).
+		Run(captureID).Return(nil).Once()
+
+	q := NewQory(conf, client, sm)
+	err1 := q.QueryNew(context.Background(), []string{firstUserText}, QueryOptions{})
+	require.NoError(t, err1)
+	err2 := q.QueryNew(context.Background(), []string{secondUserText}, QueryOptions{})
+	require.NoError(t, err2)
+
+	require.Len(t, storedIDs, 2)
+	assert.NotEqual(t, storedIDs[0], storedIDs[1])
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_AddsSystemPrompt(t *testing.T) {
+	systemText := "Be concise."
+	userText := "hello"
+	assistantText := "response"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return(systemText, config.OriginUser, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
+		message.NewSystemMessage(systemText),
+		message.NewUserMessage(userText),
+	}).Return(message.NewAssistantMessage(assistantText), nil)
+
+	expectedSession := session.NewSession()
+	expectedSession.AddMessage(message.NewSystemMessage(systemText))
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_ReturnsErrorOnQueryFailure(t *testing.T) {
+	queryErr := errors.New("rate limit exceeded")
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+
+	client.On("Query", generation.Params{Model: "gpt-4o"}, mock.Anything).Return(message.Message{}, queryErr)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{"hello"}, QueryOptions{})
+	require.ErrorIs(t, err, queryErr)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_StoresPartialResponseOnCancel(t *testing.T) {
+	userText := "hello"
+	partialText := "partial ans"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	client.On("Query", generation.Params{Model: "gpt-4o"}, mock.Anything).Return(message.NewAssistantMessage(partialText), context.Canceled)
+
+	expectedSession := session.NewSession()
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(message.NewInterruptedMessage(partialText))
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_StoresUserTurnWhenCancelledBeforeFirstToken(t *testing.T) {
+	userText := "hello"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 
-	sm.On("Store", mock.AnythingOfType("string"), firstExpected).
-		Run(captureID).Return(nil).Once()
-	sm.On("Store", mock.AnythingOfType("string"), secondExpected).
-		Run(captureID).Return(nil).Once()
+	client.On("Query", generation.Params{Model: "gpt-4o"}, mock.Anything).Return(message.Message{}, context.Canceled)
 
-	q := NewQory(conf, client, sm)
-	err1 := q.QueryNew([]string{firstUserText})
-	require.NoError(t, err1)
-	err2 := q.QueryNew([]string{secondUserText})
-	require.NoError(t, err2)
+	expectedSession := session.NewSession()
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
-	require.Len(t, storedIDs, 2)
-	assert.NotEqual(t, storedIDs[0], storedIDs[1])
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{})
+	require.ErrorIs(t, err, context.Canceled)
 
 	sm.AssertExpectations(t)
 	conf.AssertExpectations(t)
 	client.AssertExpectations(t)
 }
 
-func Test_QueryNew_AddsSystemPrompt(t *testing.T) {
-	systemText := "Be concise."
+func Test_QueryNew_ParamsOverrideDefaultsAndAreRecorded(t *testing.T) {
 	userText := "hello"
 	assistantText := "response"
 
@@ -262,24 +799,37 @@ func Test_QueryNew_AddsSystemPrompt(t *testing.T) {
 	client := &MockClient{}
 	sm := &MockSessionManager{}
 
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
-	conf.On("Prompt").Return(systemText, config.OriginUser, nil)
+	expectParams(conf, generation.Params{
+		Model:       "gpt-4o",
+		Temperature: util.Ptr(0.7),
+		MaxTokens:   util.Ptr(int64(256)),
+	}, "")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
-		message.NewSystemMessage(systemText),
-		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	override := generation.Params{
+		Model:       "gpt-4o-mini",
+		Temperature: util.Ptr(0.1),
+		Stop:        []string{"END"},
+	}
 
+	client.On("Query", generation.Params{
+		Model:       "gpt-4o-mini",
+		Temperature: util.Ptr(0.1),
+		MaxTokens:   util.Ptr(int64(256)),
+		Stop:        []string{"END"},
+	}, mock.Anything).Return(message.NewAssistantMessage(assistantText), nil)
+
+	// Only the explicitly chosen parameters are recorded, not the defaults.
 	expectedSession := session.NewSession()
-	expectedSession.AddMessage(message.NewSystemMessage(systemText))
+	expectedSession.Params = override
 	expectedSession.AddMessage(message.NewUserMessage(userText))
 	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
 	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryNew([]string{userText})
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{Params: override})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -287,21 +837,16 @@ func Test_QueryNew_AddsSystemPrompt(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
-func Test_QueryNew_ReturnsErrorOnQueryFailure(t *testing.T) {
-	queryErr := errors.New("rate limit exceeded")
-
+func Test_QueryNew_FailsWhenModelNotSet(t *testing.T) {
 	conf := &MockConfig{}
 	client := &MockClient{}
 	sm := &MockSessionManager{}
 
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
-	conf.On("Prompt").Return("", config.OriginNotSet, nil)
-
-	client.On("Query", "gpt-4o", mock.Anything).Return("", queryErr)
+	expectDefaultParams(conf, "")
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryNew([]string{"hello"})
-	require.ErrorIs(t, err, queryErr)
+	err := q.QueryNew(context.Background(), []string{"hello"}, QueryOptions{})
+	require.ErrorContains(t, err, "model is not set")
 
 	sm.AssertExpectations(t)
 	conf.AssertExpectations(t)
@@ -324,15 +869,15 @@ func Test_QuerySession_LoadsExistingHistory(t *testing.T) {
 	client := &MockClient{}
 	sm := &MockSessionManager{}
 
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 	sm.On("Load", "my-session").Return(existing, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewUserMessage(prevUserText),
 		message.NewAssistantMessage(prevAssistantText),
 		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	}).Return(message.NewAssistantMessage(assistantText), nil)
 
 	expectedSession := session.NewSession()
 	expectedSession.AddMessage(message.NewUserMessage(prevUserText))
@@ -343,7 +888,7 @@ func Test_QuerySession_LoadsExistingHistory(t *testing.T) {
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QuerySession("my-session", []string{userText})
+	err := q.QuerySession(context.Background(), "my-session", []string{userText}, QueryOptions{})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -359,7 +904,7 @@ func Test_QuerySession_FailsWhenNotFound(t *testing.T) {
 	sm.On("Load", "unknown-session").Return(session.Session{}, session.ErrNotFound)
 
 	q := NewQory(conf, client, sm)
-	err := q.QuerySession("unknown-session", []string{"hello"})
+	err := q.QuerySession(context.Background(), "unknown-session", []string{"hello"}, QueryOptions{})
 
 	require.ErrorIs(t, err, session.ErrNotFound)
 	sm.AssertExpectations(t)
@@ -383,16 +928,16 @@ func Test_QuerySession_SkipsSystemPrompt(t *testing.T) {
 	client := &MockClient{}
 	sm := &MockSessionManager{}
 
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 	sm.On("Load", "my-session").Return(existing, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewSystemMessage(systemText),
 		message.NewUserMessage(prevUserText),
 		message.NewAssistantMessage(prevAssistantText),
 		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	}).Return(message.NewAssistantMessage(assistantText), nil)
 
 	expectedSession := session.NewSession()
 	expectedSession.AddMessage(message.NewSystemMessage(systemText))
@@ -404,7 +949,7 @@ func Test_QuerySession_SkipsSystemPrompt(t *testing.T) {
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QuerySession("my-session", []string{userText})
+	err := q.QuerySession(context.Background(), "my-session", []string{userText}, QueryOptions{})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -428,16 +973,16 @@ func Test_QueryLast_ResolvesLastSessionID(t *testing.T) {
 	client := &MockClient{}
 	sm := &MockSessionManager{}
 
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 	sm.On("Last").Return("last-session", nil)
 	sm.On("Load", "last-session").Return(existing, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewUserMessage(prevUserText),
 		message.NewAssistantMessage(prevAssistantText),
 		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	}).Return(message.NewAssistantMessage(assistantText), nil)
 
 	expectedSession := session.NewSession()
 	expectedSession.AddMessage(message.NewUserMessage(prevUserText))
@@ -448,7 +993,7 @@ func Test_QueryLast_ResolvesLastSessionID(t *testing.T) {
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryLast([]string{userText})
+	err := q.QueryLast(context.Background(), []string{userText}, QueryOptions{})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -472,17 +1017,17 @@ func Test_QueryLast_SkipsSystemPrompt(t *testing.T) {
 	client := &MockClient{}
 	sm := &MockSessionManager{}
 
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 	sm.On("Last").Return("last-session", nil)
 	sm.On("Load", "last-session").Return(existing, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewSystemMessage(systemText),
 		message.NewUserMessage(prevUserText),
 		message.NewAssistantMessage(prevAssistantText),
 		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	}).Return(message.NewAssistantMessage(assistantText), nil)
 
 	expectedSession := session.NewSession()
 	expectedSession.AddMessage(message.NewSystemMessage(systemText))
@@ -494,7 +1039,7 @@ func Test_QueryLast_SkipsSystemPrompt(t *testing.T) {
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryLast([]string{userText})
+	err := q.QueryLast(context.Background(), []string{userText}, QueryOptions{})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -513,13 +1058,13 @@ func Test_QueryDefault_NoConfig(t *testing.T) {
 	sm := &MockSessionManager{}
 
 	conf.On("Mode").Return("", config.OriginNotSet, nil)
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
 	conf.On("Prompt").Return("", config.OriginNotSet, nil)
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	}).Return(message.NewAssistantMessage(assistantText), nil)
 
 	expectedSession := session.NewSession()
 	expectedSession.AddMessage(message.NewUserMessage(userText))
@@ -528,7 +1073,7 @@ func Test_QueryDefault_NoConfig(t *testing.T) {
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryDefault([]string{userText})
+	err := q.QueryDefault(context.Background(), []string{userText}, QueryOptions{})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -545,13 +1090,13 @@ func Test_QueryDefault_ModeNew(t *testing.T) {
 	sm := &MockSessionManager{}
 
 	conf.On("Mode").Return("new", config.OriginUser, nil)
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
 	conf.On("Prompt").Return("", config.OriginNotSet, nil)
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	}).Return(message.NewAssistantMessage(assistantText), nil)
 
 	expectedSession := session.NewSession()
 	expectedSession.AddMessage(message.NewUserMessage(userText))
@@ -560,7 +1105,7 @@ func Test_QueryDefault_ModeNew(t *testing.T) {
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryDefault([]string{userText})
+	err := q.QueryDefault(context.Background(), []string{userText}, QueryOptions{})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -583,16 +1128,16 @@ func Test_QueryDefault_ModeLast(t *testing.T) {
 	sm := &MockSessionManager{}
 
 	conf.On("Mode").Return("last", config.OriginUser, nil)
-	conf.On("Model").Return("gpt-4o", config.OriginUser, nil)
+	expectDefaultParams(conf, "gpt-4o")
 	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
 	sm.On("Last").Return("last-session", nil)
 	sm.On("Load", "last-session").Return(existing, nil)
 
-	client.On("Query", "gpt-4o", []message.Message{
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
 		message.NewUserMessage(prevUserText),
 		message.NewAssistantMessage(prevAssistantText),
 		message.NewUserMessage(userText),
-	}).Return(assistantText, nil)
+	}).Return(message.NewAssistantMessage(assistantText), nil)
 
 	expectedSession := session.NewSession()
 	expectedSession.AddMessage(message.NewUserMessage(prevUserText))
@@ -603,7 +1148,7 @@ func Test_QueryDefault_ModeLast(t *testing.T) {
 	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryDefault([]string{userText})
+	err := q.QueryDefault(context.Background(), []string{userText}, QueryOptions{})
 	require.NoError(t, err)
 
 	sm.AssertExpectations(t)
@@ -687,6 +1232,66 @@ func Test_History_DeleteReturnsError(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+func Test_History_RenameCallsRename(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Rename", "old-id", "new-id").Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.HistoryRename("old-id", "new-id")
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_History_PruneDeletesOnlyOlderSessions(t *testing.T) {
+	now := time.Now()
+	previews := []session.SessionPreview{
+		{Name: "fresh", UpdatedAt: now},
+		{Name: "stale", UpdatedAt: now.Add(-48 * time.Hour)},
+	}
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Enum", 0).Return(previews, nil)
+	sm.On("Delete", "stale").Return(nil)
+
+	q := NewQory(conf, client, sm)
+	deleted, err := q.HistoryPrune(now.Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stale"}, deleted)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_History_SearchCallsSearch(t *testing.T) {
+	opts := session.SearchOptions{Query: "nginx", Limit: 5}
+	expected := []session.SearchResult{{ID: "s1", Snippet: "nginx config"}}
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Search", opts).Return(expected, nil)
+
+	q := NewQory(conf, client, sm)
+	results, err := q.HistorySearch(opts)
+	require.NoError(t, err)
+	assert.Equal(t, expected, results)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
 func Test_History_SessionNotFoundReturnsError(t *testing.T) {
 	conf := &MockConfig{}
 	client := &MockClient{}
@@ -703,6 +1308,65 @@ func Test_History_SessionNotFoundReturnsError(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+// ---- QueryFork tests ----
+
+func Test_QueryFork_ContinuesBranchInNewSession(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	parent := session.NewSession()
+	parent.AddMessage(message.NewUserMessage("q1"))
+	parent.AddMessage(message.NewAssistantMessage("a1"))
+	parent.AddMessage(message.NewUserMessage("q2"))
+	parent.AddMessage(message.NewAssistantMessage("a2"))
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+	sm.On("Load", "parent").Return(parent, nil)
+
+	client.On("Query", generation.Params{Model: "gpt-4o"}, []message.Message{
+		message.NewUserMessage("q1"),
+		message.NewAssistantMessage("a1"),
+		message.NewUserMessage("other q2"),
+	}).Return(message.NewAssistantMessage("other a2"), nil)
+
+	expected := session.NewSession()
+	expected.ForkedFrom = &session.Lineage{Parent: "parent", Turn: 1}
+	expected.AddMessage(message.NewUserMessage("q1"))
+	expected.AddMessage(message.NewAssistantMessage("a1"))
+	expected.AddMessage(message.NewUserMessage("other q2"))
+	expected.AddMessage(message.NewAssistantMessage("other a2"))
+	sm.On("Store", mock.MatchedBy(func(id string) bool { return id != "parent" }), expected).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryFork(context.Background(), "parent", 1, []string{"other q2"}, QueryOptions{})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryFork_RejectsInvalidTurn(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	parent := session.NewSession()
+	parent.AddMessage(message.NewUserMessage("q1"))
+	sm.On("Load", "parent").Return(parent, nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryFork(context.Background(), "parent", 5, []string{"q"}, QueryOptions{})
+	require.Error(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
 // ---- QueryLast error tests ----
 
 func Test_QueryLast_FailsWhenLastErrors(t *testing.T) {
@@ -715,7 +1379,7 @@ func Test_QueryLast_FailsWhenLastErrors(t *testing.T) {
 	sm.On("Last").Return("", lastErr)
 
 	q := NewQory(conf, client, sm)
-	err := q.QueryLast([]string{"hello"})
+	err := q.QueryLast(context.Background(), []string{"hello"}, QueryOptions{})
 	require.ErrorIs(t, err, lastErr)
 
 	sm.AssertExpectations(t)
@@ -761,3 +1425,247 @@ func Test_AvailableModels_ReturnsErrorOnFailure(t *testing.T) {
 	conf.AssertExpectations(t)
 	client.AssertExpectations(t)
 }
+
+// ---- Usage tests ----
+
+func Test_Usage_AggregatesAssistantMessages(t *testing.T) {
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+
+	answer := func(model string, prompt, completion int64) message.Message {
+		m := message.NewAssistantMessage("answer")
+		m.Model = model
+		m.Time = day
+		m.Usage = &message.Usage{PromptTokens: prompt, CompletionTokens: completion}
+		return m
+	}
+
+	first := session.NewSession()
+	first.AddMessage(message.NewUserMessage("q1"))
+	first.AddMessage(answer("gpt-4o", 1_000_000, 0))
+	first.AddMessage(message.NewUserMessage("q2"))
+	first.AddMessage(message.NewAssistantMessage("no usage recorded"))
+
+	second := session.NewSession()
+	second.AddMessage(message.NewUserMessage("q3"))
+	second.AddMessage(answer("openai/gpt-4o", 0, 1_000_000))
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	conf.On("Prices").Return("", config.OriginNotSet, nil)
+	sm.On("Enum", 0).Return([]session.SessionPreview{{Name: "first"}, {Name: "second"}}, nil)
+	sm.On("Load", "first").Return(first, nil)
+	sm.On("Load", "second").Return(second, nil)
+
+	q := NewQory(conf, client, sm)
+	rows, err := q.Usage(usage.GroupByDay, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "2024-03-01", rows[0].Key)
+	assert.Equal(t, 2, rows[0].Requests)
+	assert.Equal(t, message.Usage{PromptTokens: 1_000_000, CompletionTokens: 1_000_000}, rows[0].Usage)
+	assert.InDelta(t, 12.5, rows[0].Cost, 1e-9)
+	assert.Zero(t, rows[0].Unpriced)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Usage_SkipsOlderResponses(t *testing.T) {
+	old := message.NewAssistantMessage("old")
+	old.Model = "gpt-4o"
+	old.Time = time.Now().Add(-48 * time.Hour)
+	old.Usage = &message.Usage{PromptTokens: 10, CompletionTokens: 10}
+
+	sess := session.NewSession()
+	sess.AddMessage(old)
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	conf.On("Prices").Return("", config.OriginNotSet, nil)
+	sm.On("Enum", 0).Return([]session.SessionPreview{{Name: "s"}}, nil)
+	sm.On("Load", "s").Return(sess, nil)
+
+	q := NewQory(conf, client, sm)
+	rows, err := q.Usage(usage.GroupByModel, time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_Prices_UserTableOverridesDefaults(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	conf.On("Prices").Return(`{"gpt-4o": {"input": 1, "output": 2}, "local": {"input": 0, "output": 0}}`, config.OriginUser, nil)
+
+	q := NewQory(conf, client, sm)
+	prices, err := q.Prices()
+	require.NoError(t, err)
+	assert.Equal(t, usage.Price{Input: 1, Output: 2}, prices["gpt-4o"])
+	assert.Contains(t, prices, "local")
+	assert.Contains(t, prices, "gpt-4o-mini")
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_FormatIsNotRecorded(t *testing.T) {
+	userText := "hello"
+	assistantText := "{}\n"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	format := &generation.Format{Schema: json.RawMessage(`{"type": "object"}`), Name: "reply"}
+	client.On("Query", generation.Params{Model: "gpt-4o", Format: format}, mock.Anything).
+		Return(message.NewAssistantMessage(assistantText), nil)
+
+	expectedSession := session.NewSession()
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QueryNew(context.Background(), []string{userText}, QueryOptions{Params: generation.Params{Format: format}})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_RecordsToolCalls(t *testing.T) {
+	userText := "what does main do?"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	call := message.NewAssistantMessage("")
+	call.ToolCalls = []message.ToolCall{{ID: "call_1", Name: "read_file", Arguments: `{"path":"main.go"}`}}
+	result := message.NewToolMessage("call_1", "package main\n")
+	answer := message.NewAssistantMessage("Nothing yet.\n")
+	client.On("QueryTools", generation.Params{Model: "gpt-4o"}, []string{"read_file", "grep"}, []message.Message{
+		message.NewUserMessage(userText),
+	}).Return([]message.Message{call, result, answer}, nil)
+
+	expectedSession := session.NewSession()
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(call)
+	expectedSession.AddMessage(result)
+	expectedSession.AddMessage(answer)
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	tools, err := tool.Builtins([]string{"read", "grep"}, tool.Options{})
+	require.NoError(t, err)
+
+	q := NewQory(conf, client, sm)
+	err = q.QueryNew(context.Background(), []string{userText}, QueryOptions{Tools: tools})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryNew_KeepsToolCallsWhenCancelled(t *testing.T) {
+	userText := "what does main do?"
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("Prompt").Return("", config.OriginNotSet, nil)
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	call := message.NewAssistantMessage("")
+	call.ToolCalls = []message.ToolCall{{ID: "call_1", Name: "read_file", Arguments: `{"path":"main.go"}`}}
+	result := message.NewToolMessage("call_1", "package main\n")
+	client.On("QueryTools", generation.Params{Model: "gpt-4o"}, []string{"read_file"}, mock.Anything).
+		Return([]message.Message{call, result, message.NewAssistantMessage("")}, context.Canceled)
+
+	expectedSession := session.NewSession()
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(call)
+	expectedSession.AddMessage(result)
+	sm.On("Store", mock.AnythingOfType("string"), expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	tools, err := tool.Builtins([]string{"read"}, tool.Options{})
+	require.NoError(t, err)
+
+	q := NewQory(conf, client, sm)
+	err = q.QueryNew(context.Background(), []string{userText}, QueryOptions{Tools: tools})
+	require.ErrorIs(t, err, context.Canceled)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QuerySession_ReusesRecordedParams(t *testing.T) {
+	userText := "follow up"
+	assistantText := "new response"
+
+	existing := session.NewSession()
+	existing.Params = generation.Params{Model: "o3-mini", ReasoningEffort: generation.ReasoningEffortHigh}
+	existing.AddMessage(message.NewUserMessage("previous question"))
+	existing.AddMessage(message.NewAssistantMessage("previous answer"))
+
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	sm.On("Load", "my-session").Return(existing, nil)
+	client.On("Query", generation.Params{
+		Model:           "o3-mini",
+		ReasoningEffort: generation.ReasoningEffortHigh,
+		Seed:            util.Ptr(int64(42)),
+	}, mock.Anything).Return(message.NewAssistantMessage(assistantText), nil)
+
+	expectedSession := session.NewSession()
+	expectedSession.Params = generation.Params{
+		Model:           "o3-mini",
+		ReasoningEffort: generation.ReasoningEffortHigh,
+		Seed:            util.Ptr(int64(42)),
+	}
+	expectedSession.Messages = append(expectedSession.Messages, existing.Messages...)
+	expectedSession.AddMessage(message.NewUserMessage(userText))
+	expectedSession.AddMessage(message.NewAssistantMessage(assistantText))
+	sm.On("Store", "my-session", expectedSession).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	err := q.QuerySession(context.Background(), "my-session", []string{userText},
+		QueryOptions{Params: generation.Params{Seed: util.Ptr(int64(42))}})
+	require.NoError(t, err)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
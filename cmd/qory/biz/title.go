@@ -0,0 +1,109 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+)
+
+const (
+	titlePrompt = "Write a short title (at most 6 words) for the conversation below. " +
+		"Reply with the title only, without quotes or trailing punctuation."
+
+	// titleExcerptChars bounds how much of each message is sent to the title
+	// model; the opening of a conversation is enough to name it.
+	titleExcerptChars = 2000
+
+	maxTitleChars = 80
+
+	// titleTimeout bounds the title call, so that a slow title model never
+	// holds up the answer for long.
+	titleTimeout = 10 * time.Second
+)
+
+// titleLater starts titling a new session from its opening messages, while
+// the question is being answered. wait returns the title once it is ready or
+// the call has timed out. stop gives up on the title if it isn't ready yet,
+// and must be called either way.
+func (q *Qory) titleLater(ctx context.Context, messages []message.Message) (wait func() string, stop context.CancelFunc) {
+	ctx, stop = context.WithTimeout(ctx, titleTimeout)
+	titles := make(chan string, 1)
+	go func() {
+		titles <- q.generateTitle(ctx, messages)
+	}()
+	return func() string { return <-titles }, stop
+}
+
+// generateTitle asks the configured title model for a short title describing
+// messages. Titling is best-effort: an empty string is returned when no title
+// model is configured or the call fails, and the failure is only reported as
+// a warning.
+func (q *Qory) generateTitle(ctx context.Context, messages []message.Message) string {
+	titleModel, origin, err := q.conf.TitleModel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: get title model: %v\n", err)
+		return ""
+	}
+	if origin == config.OriginNotSet || titleModel == "" {
+		return ""
+	}
+
+	var transcript strings.Builder
+	for _, m := range messages {
+		if m.Role == message.RoleSystem {
+			continue
+		}
+		content := m.Text()
+		if len(content) > titleExcerptChars {
+			content = content[:titleExcerptChars] + "..."
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", m.Role, strings.TrimSpace(content))
+	}
+
+	request := []message.Message{
+		message.NewSystemMessage(titlePrompt),
+		message.NewUserMessage(transcript.String()),
+	}
+	response, err := q.client.Query(ctx, generation.Params{Model: titleModel}, request, io.Discard)
+	if err != nil {
+		// Given up on along with the answer, which has nothing to title.
+		if !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "Warning: generate session title: %v\n", err)
+		}
+		return ""
+	}
+
+	return cleanTitle(response.Content)
+}
+
+// cleanTitle reduces a model reply to a single, reasonably short line.
+func cleanTitle(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.Trim(s, " \t\"'`*#.")
+	if r := []rune(s); len(r) > maxTitleChars {
+		s = strings.TrimSpace(string(r[:maxTitleChars])) + "..."
+	}
+	return s
+}
+
+// countRole returns how many of messages were authored by role.
+func countRole(messages []message.Message, role message.Role) int {
+	n := 0
+	for _, m := range messages {
+		if m.Role == role {
+			n++
+		}
+	}
+	return n
+}
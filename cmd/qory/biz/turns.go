@@ -0,0 +1,115 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+)
+
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// LastSession returns the ID of the most recently modified session.
+func (q *Qory) LastSession() (string, error) {
+	return q.sm.Last()
+}
+
+// QueryRetry discards the latest answer of the session id and asks the same
+// question again.
+func (q *Qory) QueryRetry(ctx context.Context, id string, opts QueryOptions) error {
+	sess, err := q.sm.Load(id)
+	if err != nil {
+		return err
+	}
+	return q.retryTurn(ctx, id, &sess, opts)
+}
+
+// HistoryUndo removes the latest question of the session id together with its
+// answer. A session left without questions is deleted.
+func (q *Qory) HistoryUndo(id string) error {
+	sess, err := q.sm.Load(id)
+	if err != nil {
+		return err
+	}
+	if err := undoTurn(&sess); err != nil {
+		return err
+	}
+	return q.persistEdit(id, sess)
+}
+
+// LastQuestion returns the latest question asked in the session id.
+func (q *Qory) LastQuestion(id string) (string, error) {
+	sess, err := q.sm.Load(id)
+	if err != nil {
+		return "", err
+	}
+	last := message.LastIndexOfRole(sess.Messages, message.RoleUser)
+	if last < 0 {
+		return "", errors.New("session has no questions")
+	}
+	return sess.Messages[last].Content, nil
+}
+
+// QueryEdit replaces the text of the latest question of the session id with
+// question, keeping its images and discarding its answer, and queries the
+// model again.
+func (q *Qory) QueryEdit(ctx context.Context, id string, question string, opts QueryOptions) error {
+	sess, err := q.sm.Load(id)
+	if err != nil {
+		return err
+	}
+	last := message.LastIndexOfRole(sess.Messages, message.RoleUser)
+	if last < 0 {
+		return errors.New("session has no questions")
+	}
+	edited := sess.Messages[last]
+	edited.Content = question
+	sess.Rewind(last)
+	sess.AddMessage(edited)
+	return q.retryTurn(ctx, id, &sess, opts)
+}
+
+// retryTurn drops whatever follows the latest question in sess and queries
+// the model for a new answer.
+func (q *Qory) retryTurn(ctx context.Context, id string, sess *session.Session, opts QueryOptions) error {
+	last := message.LastIndexOfRole(sess.Messages, message.RoleUser)
+	if last < 0 {
+		return errors.New("nothing to retry")
+	}
+	sess.Rewind(last + 1)
+
+	params, err := q.resolveParams(sess, opts)
+	if err != nil {
+		return err
+	}
+	return q.answer(ctx, id, sess, params, nil, opts)
+}
+
+// undoTurn removes the latest question in sess and everything after it.
+func undoTurn(sess *session.Session) error {
+	last := message.LastIndexOfRole(sess.Messages, message.RoleUser)
+	if last < 0 {
+		return ErrNothingToUndo
+	}
+	sess.Rewind(last)
+	return nil
+}
+
+// persistEdit writes out a session after an edit, removing it from disk when
+// the edit left no question behind: sessions without questions are never
+// stored.
+func (q *Qory) persistEdit(id string, sess session.Session) error {
+	if sess.Turns() > 0 {
+		if err := q.sm.Store(id, sess); err != nil {
+			return fmt.Errorf("store session: %w", err)
+		}
+		return nil
+	}
+
+	if err := q.sm.Delete(id); err != nil && !errors.Is(err, session.ErrNotFound) {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package biz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_QueryRetry_ReplacesLastAnswer(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	sess := makeChatSession()
+	sm.On("Load", "notes").Return(sess, nil)
+	client.On("Query", generation.Params{Model: "gpt-4o-mini"}, sess.Messages[:3]).
+		Return(message.NewAssistantMessage("better answer"), nil)
+
+	expected := makeChatSession()
+	expected.Params = generation.Params{Model: "gpt-4o-mini"}
+	expected.Messages[3] = message.NewAssistantMessage("better answer")
+	sm.On("Store", "notes", expected).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	opts := QueryOptions{Params: generation.Params{Model: "gpt-4o-mini"}}
+	require.NoError(t, q.QueryRetry(context.Background(), "notes", opts))
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryRetry_AfterInterruptedQuestion(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	sess := makeChatSession()
+	sess.Messages = sess.Messages[:3]
+	sm.On("Load", "notes").Return(sess, nil)
+	client.On("Query", generation.Params{Model: "gpt-4o"}, sess.Messages).
+		Return(message.NewAssistantMessage("answer two"), nil)
+	sm.On("Store", "notes", makeChatSession()).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	require.NoError(t, q.QueryRetry(context.Background(), "notes", QueryOptions{}))
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_HistoryUndo_RemovesLastExchange(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Load", "notes").Return(makeChatSession(), nil)
+	expected := makeChatSession()
+	expected.Messages = expected.Messages[:2]
+	sm.On("Store", "notes", expected).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	require.NoError(t, q.HistoryUndo("notes"))
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_HistoryUndo_EmptySession(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sess := session.NewSession()
+	sess.AddMessage(message.NewSystemMessage("be brief"))
+	sm.On("Load", "notes").Return(sess, nil)
+
+	q := NewQory(conf, client, sm)
+	assert.ErrorIs(t, q.HistoryUndo("notes"), ErrNothingToUndo)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_LastQuestion(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	sm.On("Load", "notes").Return(makeChatSession(), nil)
+
+	q := NewQory(conf, client, sm)
+	question, err := q.LastQuestion("notes")
+	require.NoError(t, err)
+	assert.Equal(t, "second", question)
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func Test_QueryEdit_ReplacesLastQuestion(t *testing.T) {
+	conf := &MockConfig{}
+	client := &MockClient{}
+	sm := &MockSessionManager{}
+
+	expectDefaultParams(conf, "gpt-4o")
+	conf.On("HistorySize").Return(config.DefaultHistorySize, config.OriginDefault, nil)
+
+	sm.On("Load", "notes").Return(makeChatSession(), nil)
+	asked := []message.Message{
+		message.NewUserMessage("first"),
+		message.NewAssistantMessage("answer one"),
+		message.NewUserMessage("second, rephrased"),
+	}
+	client.On("Query", generation.Params{Model: "gpt-4o"}, asked).
+		Return(message.NewAssistantMessage("new answer"), nil)
+
+	expected := session.NewSession()
+	expected.Messages = append(asked, message.NewAssistantMessage("new answer"))
+	sm.On("Store", "notes", expected).Return(nil)
+	sm.On("Cleanup", config.DefaultHistorySize).Return(nil)
+
+	q := NewQory(conf, client, sm)
+	require.NoError(t, q.QueryEdit(context.Background(), "notes", "second, rephrased", QueryOptions{}))
+
+	sm.AssertExpectations(t)
+	conf.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/dtrugman/qory/cmd/qory/biz"
+	"github.com/dtrugman/qory/lib/input"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/spf13/cobra"
+)
+
+const chatHelp = `Commands:
+  /model [name]     Show or switch the model for the following turns
+  /system [prompt]  Show or replace the system prompt (/system - removes it)
+  /save <name>      Store the session under a name (named sessions are never cleaned up)
+  /undo             Remove the last question and its answer
+  /retry            Ask the last question again
+  /file <path>      Attach a file to the next message
+  /help             Show this help
+  /exit             Leave the chat (or press Ctrl+D)
+
+Press Enter to send, Alt+Enter or Ctrl+J for a new line. Ctrl+C stops an answer.`
+
+var errChatExit = errors.New("exit chat")
+
+func newChatCmd(q *biz.Qory) *cobra.Command {
+	var sessionID string
+	var last bool
+	var opts biz.QueryOptions
+	var genFlags paramsFlags
+	var outFlags renderFlags
+	var toolFlags toolsFlags
+
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "Chat interactively",
+		Long: `Chat interactively, keeping a session open across turns.
+
+Every turn is saved to the session as soon as it's answered, just like a
+one-shot query. Type /help in the chat for the available commands.
+
+Examples:
+  qory chat
+  qory chat --last
+  qory chat --session nginx-notes --model gpt-4o
+  qory chat --tools read,list,grep`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{handlesInterrupt: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params, err := genFlags.params()
+			if err != nil {
+				return err
+			}
+			opts.Params = params
+			opts.Render = outFlags.enabled()
+			if opts.Tools, err = toolFlags.tools(); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+
+			var chat *biz.Chat
+			if last {
+				chat, err = q.OpenLastChat(opts)
+			} else {
+				chat, err = q.OpenChat(sessionID, opts)
+			}
+			if err != nil {
+				return err
+			}
+
+			return runChat(cmd.Context(), chat, newInputReader(userHistory(chat)))
+		},
+	}
+
+	cmd.Flags().StringVarP(&sessionID, "session", "s", "", "Session name to continue or start")
+	cmd.Flags().BoolVarP(&last, "last", "l", false, "Continue the last session")
+	genFlags.register(cmd)
+	outFlags.register(cmd)
+	toolFlags.register(cmd)
+	cmd.Flags().BoolVar(&opts.ShowUsage, "usage", false, "Print token usage and estimated cost after each answer")
+	cmd.Flags().StringVar(&opts.Title, "title", "", "Set a human-readable title for the session")
+	cmd.MarkFlagsMutuallyExclusive("last", "session")
+
+	return cmd
+}
+
+// runChat is the read-eval-print loop. Ctrl+C only stops the answer being
+// streamed; cancelling ctx, as SIGTERM does, ends the chat.
+func runChat(ctx context.Context, chat *biz.Chat, input inputReader) error {
+	model, err := chat.Model()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Chatting in session %s with %s. Type /help for commands.\n", chat.ID(), model)
+
+	var attachments []string
+	for ctx.Err() == nil {
+		text, err := input.ReadInput()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		input.AddHistory(text)
+
+		if strings.HasPrefix(text, "/") {
+			err := runChatCommand(ctx, chat, text, &attachments)
+			if errors.Is(err, errChatExit) {
+				return nil
+			}
+			reportChatError(err)
+			continue
+		}
+
+		inputs := append(attachments, text)
+		attachments = nil
+		reportChatError(runChatTurn(ctx, func(ctx context.Context) error {
+			return chat.Send(ctx, inputs)
+		}))
+	}
+
+	return ctx.Err()
+}
+
+// runChatTurn runs a query that Ctrl+C cancels without ending the chat.
+func runChatTurn(parent context.Context, turn func(ctx context.Context) error) error {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt)
+	defer stop()
+
+	err := turn(ctx)
+	fmt.Println()
+	return err
+}
+
+func reportChatError(err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(os.Stderr, "(interrupted)")
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+// parseChatCommand splits "/name args" into the command name and its
+// argument string.
+func parseChatCommand(text string) (string, string) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(text, "/"), " ")
+	return strings.ToLower(name), strings.TrimSpace(arg)
+}
+
+func runChatCommand(ctx context.Context, chat *biz.Chat, text string, attachments *[]string) error {
+	name, arg := parseChatCommand(text)
+	switch name {
+	case "exit", "quit":
+		return errChatExit
+	case "help":
+		fmt.Println(chatHelp)
+	case "model":
+		if arg != "" {
+			chat.SetModel(arg)
+		}
+		model, err := chat.Model()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Model: %s\n", model)
+	case "system":
+		switch arg {
+		case "":
+			msgs := chat.Session().Messages
+			if len(msgs) > 0 && msgs[0].Role == message.RoleSystem {
+				fmt.Println(msgs[0].Content)
+			} else {
+				fmt.Println("No system prompt.")
+			}
+		case "-":
+			return chat.SetSystemPrompt("")
+		default:
+			return chat.SetSystemPrompt(arg)
+		}
+	case "save":
+		if arg == "" {
+			return errors.New("usage: /save <name>")
+		}
+		if err := chat.Save(arg); err != nil {
+			return err
+		}
+		fmt.Printf("Session saved as %s\n", chat.ID())
+	case "undo":
+		if err := chat.Undo(); err != nil {
+			return err
+		}
+		fmt.Println("Removed the last exchange.")
+	case "retry":
+		return runChatTurn(ctx, chat.Retry)
+	case "file":
+		if arg == "" {
+			return errors.New("usage: /file <path>")
+		}
+		if _, err := os.Stat(arg); err != nil {
+			return err
+		}
+		*attachments = append(*attachments, input.RefTo(arg))
+		fmt.Printf("Attached %s to the next message.\n", arg)
+	default:
+		return fmt.Errorf("unknown command /%s, type /help for the list", name)
+	}
+	return nil
+}
+
+// userHistory seeds the input history with the questions already asked in
+// the session.
+func userHistory(chat *biz.Chat) []string {
+	var history []string
+	for _, m := range chat.Session().Messages {
+		if m.Role == message.RoleUser {
+			history = append(history, m.Content)
+		}
+	}
+	return history
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	inputPrompt             = "> "
+	inputContinuationPrompt = ". "
+)
+
+var (
+	inputPromptStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("86")).
+				Bold(true)
+
+	inputCursorStyle = lipgloss.NewStyle().Reverse(true)
+)
+
+// inputReader reads the user's turns in chat mode. ReadInput returns io.EOF
+// once the user is done.
+type inputReader interface {
+	ReadInput() (string, error)
+	AddHistory(entry string)
+}
+
+// newInputReader returns a line editor when stdin is a terminal, and a plain
+// line reader (one turn per line) when input is piped.
+func newInputReader(history []string) inputReader {
+	if stdinIsTerminal() {
+		return &terminalReader{history: history}
+	}
+	return &lineReader{scanner: bufio.NewScanner(os.Stdin)}
+}
+
+type terminalReader struct {
+	history []string
+}
+
+func (r *terminalReader) ReadInput() (string, error) {
+	p := tea.NewProgram(newInputModel(r.history))
+	final, err := p.Run()
+	if err != nil {
+		return "", err
+	}
+
+	m := final.(inputModel)
+	if m.eof {
+		return "", io.EOF
+	}
+	return string(m.buf), nil
+}
+
+func (r *terminalReader) AddHistory(entry string) {
+	if n := len(r.history); n > 0 && r.history[n-1] == entry {
+		return
+	}
+	r.history = append(r.history, entry)
+}
+
+type lineReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *lineReader) ReadInput() (string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *lineReader) AddHistory(string) {}
+
+// inputModel is a small multi-line line editor.
+//
+// Enter submits; Alt+Enter, Ctrl+J or a trailing backslash start a new line.
+// ↑/↓ move between lines and, on the first/last line, through the history.
+// Ctrl+C clears the input, or ends the chat when the input is already empty;
+// Ctrl+D on an empty input ends the chat too.
+type inputModel struct {
+	buf    []rune
+	cursor int
+
+	history []string
+	histIdx int    // len(history) while editing a new entry
+	draft   string // the new entry, kept while browsing the history
+
+	done bool
+	eof  bool
+}
+
+func newInputModel(history []string) inputModel {
+	return inputModel{history: history, histIdx: len(history)}
+}
+
+func (m inputModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m inputModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch key.Type {
+	case tea.KeyEnter:
+		if key.Alt {
+			m.insert("\n")
+		} else if m.cursor == len(m.buf) && m.cursor > 0 && m.buf[m.cursor-1] == '\\' {
+			m.buf[m.cursor-1] = '\n'
+		} else {
+			m.done = true
+			return m, tea.Quit
+		}
+	case tea.KeyCtrlJ:
+		m.insert("\n")
+	case tea.KeyCtrlC:
+		if len(m.buf) == 0 {
+			m.done, m.eof = true, true
+			return m, tea.Quit
+		}
+		m.buf, m.cursor = nil, 0
+	case tea.KeyCtrlD:
+		if len(m.buf) == 0 {
+			m.done, m.eof = true, true
+			return m, tea.Quit
+		}
+		m.deleteRange(m.cursor, min(m.cursor+1, len(m.buf)))
+	case tea.KeyRunes, tea.KeySpace:
+		m.insert(strings.ReplaceAll(string(key.Runes), "\r\n", "\n"))
+	case tea.KeyBackspace:
+		m.deleteRange(max(m.cursor-1, 0), m.cursor)
+	case tea.KeyDelete:
+		m.deleteRange(m.cursor, min(m.cursor+1, len(m.buf)))
+	case tea.KeyLeft, tea.KeyCtrlB:
+		m.cursor = max(m.cursor-1, 0)
+	case tea.KeyRight, tea.KeyCtrlF:
+		m.cursor = min(m.cursor+1, len(m.buf))
+	case tea.KeyHome, tea.KeyCtrlA:
+		m.cursor = m.lineStart(m.cursor)
+	case tea.KeyEnd, tea.KeyCtrlE:
+		m.cursor = m.lineEnd(m.cursor)
+	case tea.KeyCtrlU:
+		m.deleteRange(m.lineStart(m.cursor), m.cursor)
+	case tea.KeyCtrlK:
+		m.deleteRange(m.cursor, m.lineEnd(m.cursor))
+	case tea.KeyCtrlW:
+		m.deleteRange(m.wordStart(m.cursor), m.cursor)
+	case tea.KeyUp:
+		if start := m.lineStart(m.cursor); start > 0 {
+			m.cursor = m.moveToLine(m.lineStart(start-1), m.cursor-start)
+		} else {
+			m.browseHistory(-1)
+		}
+	case tea.KeyDown:
+		if end := m.lineEnd(m.cursor); end < len(m.buf) {
+			m.cursor = m.moveToLine(end+1, m.cursor-m.lineStart(m.cursor))
+		} else {
+			m.browseHistory(1)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *inputModel) insert(s string) {
+	runes := []rune(s)
+	buf := make([]rune, 0, len(m.buf)+len(runes))
+	buf = append(buf, m.buf[:m.cursor]...)
+	buf = append(buf, runes...)
+	buf = append(buf, m.buf[m.cursor:]...)
+	m.buf = buf
+	m.cursor += len(runes)
+}
+
+func (m *inputModel) deleteRange(from, to int) {
+	if from >= to {
+		return
+	}
+	m.buf = append(m.buf[:from:from], m.buf[to:]...)
+	m.cursor = from
+}
+
+func (m inputModel) lineStart(pos int) int {
+	for pos > 0 && m.buf[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+func (m inputModel) lineEnd(pos int) int {
+	for pos < len(m.buf) && m.buf[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+// moveToLine returns the position at column col of the line starting at
+// start, clamped to the line's length.
+func (m inputModel) moveToLine(start, col int) int {
+	return min(start+col, m.lineEnd(start))
+}
+
+func (m inputModel) wordStart(pos int) int {
+	for pos > 0 && m.buf[pos-1] == ' ' {
+		pos--
+	}
+	for pos > 0 && m.buf[pos-1] != ' ' && m.buf[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+func (m *inputModel) browseHistory(delta int) {
+	idx := m.histIdx + delta
+	if idx < 0 || idx > len(m.history) {
+		return
+	}
+	if m.histIdx == len(m.history) {
+		m.draft = string(m.buf)
+	}
+	m.histIdx = idx
+
+	if idx == len(m.history) {
+		m.buf = []rune(m.draft)
+	} else {
+		m.buf = []rune(m.history[idx])
+	}
+	m.cursor = len(m.buf)
+}
+
+func (m inputModel) View() string {
+	var sb strings.Builder
+	pos := 0
+	for i, line := range strings.Split(string(m.buf), "\n") {
+		prompt := inputPrompt
+		if i > 0 {
+			sb.WriteString("\n")
+			prompt = inputContinuationPrompt
+		}
+		sb.WriteString(inputPromptStyle.Render(prompt))
+
+		runes := []rune(line)
+		if !m.done && m.cursor >= pos && m.cursor <= pos+len(runes) {
+			col := m.cursor - pos
+			under := " "
+			rest := ""
+			if col < len(runes) {
+				under = string(runes[col])
+				rest = string(runes[col+1:])
+			}
+			sb.WriteString(string(runes[:col]))
+			sb.WriteString(inputCursorStyle.Render(under))
+			sb.WriteString(rest)
+		} else {
+			sb.WriteString(line)
+		}
+		pos += len(runes) + 1
+	}
+	if m.done {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
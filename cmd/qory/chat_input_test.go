@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func typeText(m inputModel, text string) inputModel {
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)})
+	return next.(inputModel)
+}
+
+func pressKey(m inputModel, key tea.KeyMsg) inputModel {
+	next, _ := m.Update(key)
+	return next.(inputModel)
+}
+
+func press(m inputModel, keyType tea.KeyType) inputModel {
+	return pressKey(m, tea.KeyMsg{Type: keyType})
+}
+
+func TestInputModel_EnterSubmits(t *testing.T) {
+	m := typeText(newInputModel(nil), "hello")
+	m = press(m, tea.KeyEnter)
+	assert.True(t, m.done)
+	assert.False(t, m.eof)
+	assert.Equal(t, "hello", string(m.buf))
+}
+
+func TestInputModel_NewLines(t *testing.T) {
+	m := typeText(newInputModel(nil), "a")
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyEnter, Alt: true})
+	m = typeText(m, "b")
+	m = press(m, tea.KeyCtrlJ)
+	m = typeText(m, "c\\")
+	m = press(m, tea.KeyEnter)
+	m = typeText(m, "d")
+	assert.False(t, m.done)
+	assert.Equal(t, "a\nb\nc\nd", string(m.buf))
+}
+
+func TestInputModel_Editing(t *testing.T) {
+	m := typeText(newInputModel(nil), "hello world")
+	m = press(m, tea.KeyCtrlW)
+	assert.Equal(t, "hello ", string(m.buf))
+
+	m = press(m, tea.KeyHome)
+	m = typeText(m, ">")
+	m = press(m, tea.KeyDelete)
+	assert.Equal(t, ">ello ", string(m.buf))
+
+	m = press(m, tea.KeyCtrlK)
+	m = press(m, tea.KeyBackspace)
+	assert.Equal(t, "", string(m.buf))
+}
+
+func TestInputModel_CtrlCClearsThenExits(t *testing.T) {
+	m := typeText(newInputModel(nil), "draft")
+	m = press(m, tea.KeyCtrlC)
+	assert.False(t, m.done)
+	assert.Empty(t, m.buf)
+
+	m = press(m, tea.KeyCtrlC)
+	assert.True(t, m.eof)
+}
+
+func TestInputModel_CtrlDExitsOnlyWhenEmpty(t *testing.T) {
+	m := typeText(newInputModel(nil), "ab")
+	m = press(m, tea.KeyLeft)
+	m = press(m, tea.KeyCtrlD)
+	assert.False(t, m.eof)
+	assert.Equal(t, "a", string(m.buf))
+
+	m = press(m, tea.KeyBackspace)
+	m = press(m, tea.KeyCtrlD)
+	assert.True(t, m.eof)
+}
+
+func TestInputModel_HistoryKeepsDraft(t *testing.T) {
+	m := typeText(newInputModel([]string{"first", "second"}), "draft")
+	m = press(m, tea.KeyUp)
+	assert.Equal(t, "second", string(m.buf))
+	m = press(m, tea.KeyUp)
+	assert.Equal(t, "first", string(m.buf))
+	m = press(m, tea.KeyUp)
+	assert.Equal(t, "first", string(m.buf))
+	m = press(m, tea.KeyDown)
+	m = press(m, tea.KeyDown)
+	assert.Equal(t, "draft", string(m.buf))
+}
+
+func TestInputModel_UpMovesBetweenLinesFirst(t *testing.T) {
+	m := typeText(newInputModel([]string{"old"}), "abc")
+	m = press(m, tea.KeyCtrlJ)
+	m = typeText(m, "d")
+	m = press(m, tea.KeyUp)
+	assert.Equal(t, "abc\nd", string(m.buf))
+	assert.Equal(t, 1, m.cursor)
+
+	m = press(m, tea.KeyUp)
+	assert.Equal(t, "old", string(m.buf))
+}
+
+func TestInputModel_ViewShowsContinuationPrompt(t *testing.T) {
+	m := typeText(newInputModel(nil), "a\nb")
+	view := m.View()
+	assert.Contains(t, view, inputPrompt)
+	assert.Contains(t, view, inputContinuationPrompt)
+}
+
+func TestParseChatCommand(t *testing.T) {
+	name, arg := parseChatCommand("/System  be terse ")
+	assert.Equal(t, "system", name)
+	assert.Equal(t, "be terse", arg)
+
+	name, arg = parseChatCommand("/undo")
+	assert.Equal(t, "undo", name)
+	assert.Equal(t, "", arg)
+}
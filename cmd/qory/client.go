@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/dtrugman/qory/cmd/qory/biz"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/model"
+	"github.com/dtrugman/qory/lib/tool"
+)
+
+// lazyClient defers building the model client until it is first used, so the
+// API key, base URL and retry settings are read from the profile selected on
+// the command line rather than the one active at startup.
+type lazyClient struct {
+	conf biz.Config
+
+	once   sync.Once
+	client *model.Client
+	err    error
+}
+
+func newLazyClient(conf biz.Config) *lazyClient {
+	return &lazyClient{conf: conf}
+}
+
+func (c *lazyClient) get() (*model.Client, error) {
+	c.once.Do(func() {
+		c.client, c.err = buildClient(c.conf)
+	})
+	return c.client, c.err
+}
+
+func (c *lazyClient) AvailableModels() ([]string, error) {
+	client, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	return client.AvailableModels()
+}
+
+func (c *lazyClient) Query(ctx context.Context, params generation.Params, messages []message.Message, out io.Writer) (message.Message, error) {
+	client, err := c.get()
+	if err != nil {
+		return message.Message{}, err
+	}
+	return client.Query(ctx, params, messages, out)
+}
+
+func (c *lazyClient) QueryTools(ctx context.Context, params generation.Params, tools []tool.Tool, messages []message.Message, out io.Writer) ([]message.Message, error) {
+	client, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	return client.QueryTools(ctx, params, tools, messages, out)
+}
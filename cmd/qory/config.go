@@ -5,25 +5,44 @@ import (
 
 	"github.com/dtrugman/qory/cmd/qory/biz"
 	"github.com/dtrugman/qory/lib/config"
+	"github.com/dtrugman/qory/lib/editor"
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/input"
 	"github.com/spf13/cobra"
 )
 
 func newConfigCmd(q *biz.Qory) *cobra.Command {
 	conf := q.GetConfig()
 
-	cmdAPIKey := newConfigKeyCmd("api-key",
+	cmdProvider := newConfigKeyCmd(conf, "provider",
+		fmt.Sprintf("API spoken to the model provider (default %q)", config.DefaultProvider),
+		`Selects the API qory speaks to the model provider:
+
+  openai     The OpenAI chat completions API, which most providers and local
+             servers offer as well (default)
+  anthropic  The Anthropic Messages API; the API key falls back to
+             $ANTHROPIC_API_KEY
+
+The base URL defaults to the provider's own API.`,
+		conf.Provider, conf.SetProvider, conf.UnsetProvider,
+		func() (string, error) {
+			return promptFromList([]string{config.ProviderOpenAI, config.ProviderAnthropic})
+		},
+	)
+
+	cmdAPIKey := newConfigKeyCmd(conf, "api-key",
 		"API key for the model provider", "",
 		conf.APIKey, conf.SetAPIKey, conf.UnsetAPIKey,
 		promptUserInput,
 	)
 
-	cmdBaseURL := newConfigKeyCmd("base-url",
+	cmdBaseURL := newConfigKeyCmd(conf, "base-url",
 		"Base URL for the model provider", "",
 		conf.BaseURL, conf.SetBaseURL, conf.UnsetBaseURL,
 		promptUserInput,
 	)
 
-	cmdModel := newConfigKeyCmd("model",
+	cmdModel := newConfigKeyCmd(conf, "model",
 		"Model to use for queries", "",
 		conf.Model, conf.SetModel, conf.UnsetModel,
 		func() (string, error) {
@@ -35,13 +54,28 @@ func newConfigCmd(q *biz.Qory) *cobra.Command {
 		},
 	)
 
-	cmdPrompt := newConfigKeyCmd("prompt",
+	cmdTitleModel := newConfigKeyCmd(conf, "title-model",
+		"Model used to title new sessions",
+		"Model used to generate a short title for a new session after its first exchange.\n"+
+			"Titles are not generated when unset; a small, cheap model is recommended.",
+		conf.TitleModel, conf.SetTitleModel, conf.UnsetTitleModel,
+		func() (string, error) {
+			models, err := q.AvailableModels()
+			if err != nil {
+				return "", err
+			}
+			return promptModel(models)
+		},
+	)
+
+	cmdPrompt := newConfigKeyCmd(conf, "prompt",
 		"Persistent system prompt prepended to every new session", "",
 		conf.Prompt, conf.SetPrompt, conf.UnsetPrompt,
 		promptUserInput,
 	)
 
 	cmdMode := newConfigKeyCmd(
+		conf,
 		"mode",
 		`Controls the default session behavior ("new" or "last")`,
 		`Controls the default session behavior when no session flag is provided:
@@ -56,7 +90,7 @@ Use --new or --last on individual queries to override the configured mode.`,
 		},
 	)
 
-	cmdEditor := newConfigKeyCmd("editor",
+	cmdEditor := newConfigKeyCmd(conf, "editor",
 		`Editor to open when no input is provided (default "vi")`,
 		`Controls which editor is opened when qory is run without any input arguments.
 
@@ -69,6 +103,109 @@ The editor is resolved in the following order:
 		promptUserInput,
 	)
 
+	cmdPrices := newConfigKeyCmd(conf, "prices",
+		"Per-model price table used for cost estimates",
+		`A JSON object mapping model names to their price in USD per million tokens.
+Entries override qory's built-in table, which only covers a few common models:
+
+  {"gpt-4o": {"input": 2.5, "output": 10}, "my-model": {"input": 0, "output": 0}}
+
+Model names are matched exactly first, then without their provider prefix
+(e.g. "openai/gpt-4o" matches "gpt-4o"). Running set without a value opens
+your editor.`,
+		conf.Prices, conf.SetPrices, conf.UnsetPrices,
+		func() (string, error) {
+			editorName, _, err := conf.Editor()
+			if err != nil {
+				return "", err
+			}
+			return editor.Edit(editorName)
+		},
+	)
+
+	cmdInputFormat := newConfigKeyCmd(
+		conf,
+		"input-format",
+		fmt.Sprintf(`How files and piped input are marked up in questions (default %q)`, config.DefaultInputFormat),
+		`Controls how the files and piped input of a question are presented to the model:
+
+  markdown  The path, then the content in a code block tagged with its language (default)
+  xml       The content in a <file path="..."> element (piped input in <stdin>)
+  plain     The raw content, as older qory versions sent it`,
+		conf.InputFormat, conf.SetInputFormat, conf.UnsetInputFormat,
+		func() (string, error) {
+			return promptFromList([]string{
+				string(input.FormatMarkdown),
+				string(input.FormatXML),
+				string(input.FormatPlain),
+			})
+		},
+	)
+
+	cmdInputMode := newConfigKeyCmd(
+		conf,
+		"input-mode",
+		fmt.Sprintf(`How inputs naming files are told apart from text (default %q)`, config.DefaultInputMode),
+		`Controls which inputs of a question are read as files:
+
+  guess     Inputs naming an existing file, directory or glob match are read (default)
+  explicit  Only @path references are read, everything else is text
+  strict    Like explicit, but a reference to a missing file is an error
+
+References work in every mode, also with a line range: @main.go:10-20, @main.go:10-.
+Write @@ for an input that starts with a literal @.`,
+		conf.InputMode, conf.SetInputMode, conf.UnsetInputMode,
+		func() (string, error) {
+			return promptFromList([]string{
+				string(input.ModeGuess),
+				string(input.ModeExplicit),
+				string(input.ModeStrict),
+			})
+		},
+	)
+
+	cmdContextStrategy := newConfigKeyCmd(
+		conf,
+		"context-strategy",
+		fmt.Sprintf(`How sessions outgrowing the model's context are compacted (default %q)`, config.DefaultContextStrategy),
+		`Controls what happens before a query whose session no longer fits the model's
+context window:
+
+  truncate   Leave out the oldest turns, keeping the system prompt (default)
+  summarize  Replace the oldest turns with a summary written by the model; the
+             summary is stored in the session and extended as it grows
+  off        Always send the whole session
+
+The full conversation is kept in the session either way, and a note is printed
+whenever history was compacted. Models missing from the context size table
+(see "qory config context-sizes") are never compacted.`,
+		conf.ContextStrategy, conf.SetContextStrategy, conf.UnsetContextStrategy,
+		func() (string, error) {
+			return promptFromList([]string{config.ContextTruncate, config.ContextSummarize, config.ContextOff})
+		},
+	)
+
+	cmdContextSizes := newConfigKeyCmd(conf, "context-sizes",
+		"Per-model context window sizes used to compact long sessions",
+		`A JSON object mapping model names to the size of their context window in
+tokens. Entries override qory's built-in table, which only covers a few common
+models:
+
+  {"gpt-4o": 128000, "llama3": 8192}
+
+Model names are matched exactly first, then without their provider prefix
+(e.g. "openai/gpt-4o" matches "gpt-4o"). Running set without a value opens
+your editor.`,
+		conf.ContextSizes, conf.SetContextSizes, conf.UnsetContextSizes,
+		func() (string, error) {
+			editorName, _, err := conf.Editor()
+			if err != nil {
+				return "", err
+			}
+			return editor.Edit(editorName)
+		},
+	)
+
 	getHistorySizeStr := func() (string, config.Origin, error) {
 		size, origin, err := conf.HistorySize()
 		if err != nil {
@@ -78,6 +215,7 @@ The editor is resolved in the following order:
 	}
 
 	cmdHistorySize := newConfigKeyCmd(
+		conf,
 		"history-size",
 		fmt.Sprintf("Number of unnamed sessions to keep (default %d)", config.DefaultHistorySize),
 		`Controls how many unnamed (auto-generated) sessions are retained on disk.
@@ -89,18 +227,116 @@ cleanup occurs — the excess sessions are removed the next time a new query is
 		promptUserInput,
 	)
 
+	getRetryAttemptsStr := func() (string, config.Origin, error) {
+		attempts, origin, err := conf.RetryAttempts()
+		if err != nil {
+			return "", origin, err
+		}
+		return fmt.Sprintf("%d", attempts), origin, nil
+	}
+
+	cmdRetryAttempts := newConfigKeyCmd(
+		conf,
+		"retry-attempts",
+		fmt.Sprintf("Maximum attempts for a query hitting transient provider errors (default %d)", config.DefaultRetryAttempts),
+		`Controls how many times a query is attempted when the provider fails with a
+transient error (rate limiting, 5xx responses, dropped connections).
+
+Retries only happen before the first token of the answer is streamed, and each
+retry is reported on stderr. Set to 1 to disable retries.`,
+		getRetryAttemptsStr, conf.SetRetryAttempts, conf.UnsetRetryAttempts,
+		promptUserInput,
+	)
+
+	getRetryDelayStr := func() (string, config.Origin, error) {
+		delay, origin, err := conf.RetryDelay()
+		if err != nil {
+			return "", origin, err
+		}
+		return delay.String(), origin, nil
+	}
+
+	cmdRetryDelay := newConfigKeyCmd(
+		conf,
+		"retry-delay",
+		fmt.Sprintf("Base delay between retries (default %s)", config.DefaultRetryDelay),
+		`Controls the base delay of the exponential backoff used between retries,
+e.g. "500ms" or "2s". The delay doubles on every retry and is randomized by up
+to half its value. A Retry-After header sent by the provider takes precedence.`,
+		getRetryDelayStr, conf.SetRetryDelay, conf.UnsetRetryDelay,
+		promptUserInput,
+	)
+
+	paramsLong := `Default applied to every query unless overridden by the matching root flag
+or recorded in the continued session. Unset to use the provider's default.`
+
+	cmdTemperature := newConfigKeyCmd(conf, "temperature",
+		"Default sampling temperature (0-2)", paramsLong,
+		formatGetter(conf.Temperature), conf.SetTemperature, conf.UnsetTemperature,
+		promptUserInput,
+	)
+
+	cmdTopP := newConfigKeyCmd(conf, "top-p",
+		"Default nucleus sampling probability mass (0-1)", paramsLong,
+		formatGetter(conf.TopP), conf.SetTopP, conf.UnsetTopP,
+		promptUserInput,
+	)
+
+	cmdMaxTokens := newConfigKeyCmd(conf, "max-tokens",
+		"Default maximum number of tokens to generate", paramsLong,
+		formatGetter(conf.MaxTokens), conf.SetMaxTokens, conf.UnsetMaxTokens,
+		promptUserInput,
+	)
+
+	cmdSeed := newConfigKeyCmd(conf, "seed",
+		"Default sampling seed", paramsLong,
+		formatGetter(conf.Seed), conf.SetSeed, conf.UnsetSeed,
+		promptUserInput,
+	)
+
+	cmdReasoningEffort := newConfigKeyCmd(conf, "reasoning-effort",
+		`Default reasoning effort for reasoning models ("low", "medium" or "high")`, paramsLong,
+		conf.ReasoningEffort, conf.SetReasoningEffort, conf.UnsetReasoningEffort,
+		func() (string, error) {
+			return promptFromList([]string{
+				generation.ReasoningEffortLow,
+				generation.ReasoningEffortMedium,
+				generation.ReasoningEffortHigh,
+			})
+		},
+	)
+
 	cmd := &cobra.Command{
 		Use:   "config",
 		Short: "Manage configuration",
+		Long: `Manage configuration.
+
+Every key is scoped to the active profile (see "qory config profile").
+Keys not set in a profile fall back to the default profile's value.`,
 	}
 	cmd.AddCommand(
+		newConfigProfileCmd(conf),
+		cmdProvider,
 		cmdAPIKey,
 		cmdBaseURL,
 		cmdPrompt,
 		cmdModel,
+		cmdTitleModel,
+		cmdTemperature,
+		cmdTopP,
+		cmdMaxTokens,
+		cmdSeed,
+		cmdReasoningEffort,
 		cmdMode,
 		cmdEditor,
 		cmdHistorySize,
+		cmdRetryAttempts,
+		cmdRetryDelay,
+		cmdPrices,
+		cmdInputFormat,
+		cmdInputMode,
+		cmdContextStrategy,
+		cmdContextSizes,
 	)
 
 	return cmd
@@ -108,6 +344,7 @@ cleanup occurs — the excess sessions are removed the next time a new query is
 
 // newConfigKeyCmd builds a subcommand for a single config key with get/set/unset children.
 func newConfigKeyCmd(
+	conf biz.Config,
 	use string,
 	short string,
 	long string,
@@ -131,7 +368,7 @@ func newConfigKeyCmd(
 				if origin == config.OriginNotSet {
 					fmt.Println(origin)
 				} else {
-					fmt.Printf("%s  [%s]\n", value, origin)
+					fmt.Printf("%s  [%s]\n", value, describeOrigin(conf, origin))
 				}
 
 				return nil
@@ -170,3 +407,29 @@ func newConfigKeyCmd(
 	)
 	return cmd
 }
+
+// formatGetter adapts a typed config getter to the string getter expected by
+// newConfigKeyCmd.
+func formatGetter[T any](getter func() (T, config.Origin, error)) func() (string, config.Origin, error) {
+	return func() (string, config.Origin, error) {
+		value, origin, err := getter()
+		if err != nil {
+			return "", origin, err
+		}
+		return fmt.Sprint(value), origin, nil
+	}
+}
+
+// describeOrigin explains where a value came from, naming the profile when
+// one other than the default is active.
+func describeOrigin(conf biz.Config, origin config.Origin) string {
+	profile, _ := conf.Profile()
+	switch {
+	case origin == config.OriginProfile:
+		return fmt.Sprintf("%s %s", origin, profile)
+	case origin == config.OriginUser && profile != config.ProfileDefault:
+		return fmt.Sprintf("%s in profile %s", origin, config.ProfileDefault)
+	default:
+		return origin.String()
+	}
+}
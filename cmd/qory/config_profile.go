@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dtrugman/qory/cmd/qory/biz"
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigProfileCmd(conf biz.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage named configuration profiles",
+		Long: `Profiles let you keep several provider setups side by side, e.g. an internal
+gateway, OpenAI and a local Ollama server, and switch between them per call.
+
+Every config key is scoped to the active profile. Keys not set in a profile fall
+back to the value stored in the "default" profile.
+
+The active profile is resolved in the following order:
+  1. The --profile flag
+  2. The $` + config.EnvProfile + ` environment variable
+  3. The profile chosen with "qory config profile use"
+  4. "default"
+
+Examples:
+  qory config profile add local
+  qory --profile local config base-url set http://localhost:11434/v1
+  qory --profile local config model set llama3
+  qory --profile local "hi"
+  ` + config.EnvProfile + `=local qory "hi"`,
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List profiles, marking the active one",
+			Args:  cobra.NoArgs,
+			RunE: func(_ *cobra.Command, _ []string) error {
+				names, err := conf.Profiles()
+				if err != nil {
+					return err
+				}
+				active, origin := conf.Profile()
+				for _, name := range names {
+					if name == active {
+						fmt.Printf("* %s  [%s]\n", name, origin)
+					} else {
+						fmt.Printf("  %s\n", name)
+					}
+				}
+				return nil
+			},
+		},
+
+		&cobra.Command{
+			Use:   "current",
+			Short: "Print the active profile and how it was selected",
+			Args:  cobra.NoArgs,
+			RunE: func(_ *cobra.Command, _ []string) error {
+				active, origin := conf.Profile()
+				fmt.Printf("%s  [%s]\n", active, origin)
+				return nil
+			},
+		},
+
+		&cobra.Command{
+			Use:   "add <name>",
+			Short: "Create a new, empty profile",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(_ *cobra.Command, args []string) error {
+				return conf.AddProfile(args[0])
+			},
+		},
+
+		&cobra.Command{
+			Use:   "rm <name>",
+			Short: "Delete a profile and all of its values",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(_ *cobra.Command, args []string) error {
+				return conf.RemoveProfile(args[0])
+			},
+		},
+
+		&cobra.Command{
+			Use:   "use <name>",
+			Short: "Make a profile the default for future invocations",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(_ *cobra.Command, args []string) error {
+				return conf.SetDefaultProfile(args[0])
+			},
+		},
+	)
+
+	return cmd
+}
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/dtrugman/qory/cmd/qory/biz"
 	"github.com/dtrugman/qory/lib/editor"
 	"github.com/spf13/cobra"
@@ -8,9 +13,12 @@ import (
 
 func newHistoryCmd(q *biz.Qory) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:          "history",
-		Short:        "Browse chat history",
-		Long:         `Browse chat history interactively. Navigate sessions with ↑/↓ and press enter to continue one in your editor.`,
+		Use:   "history",
+		Short: "Browse chat history",
+		Long: `Browse chat history interactively. Navigate sessions with ↑/↓ and press enter to continue one in your editor,
+or press f to branch it off at an earlier turn instead.
+
+Use the subcommands to inspect and manage sessions from scripts.`,
 		Args:         cobra.NoArgs,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -19,7 +27,7 @@ func newHistoryCmd(q *biz.Qory) *cobra.Command {
 				return err
 			}
 
-			if selected == "" {
+			if selected.ID == "" {
 				return nil
 			}
 
@@ -35,7 +43,146 @@ func newHistoryCmd(q *biz.Qory) *cobra.Command {
 				return nil
 			}
 
-			return q.QuerySession(selected, []string{content})
+			if selected.Fork {
+				return q.QueryFork(cmd.Context(), selected.ID, selected.Turn, []string{content}, biz.QueryOptions{})
+			}
+			return q.QuerySession(cmd.Context(), selected.ID, []string{content}, biz.QueryOptions{})
+		},
+	}
+
+	cmd.AddCommand(
+		newHistoryListCmd(q),
+		newHistorySearchCmd(q),
+		newHistoryShowCmd(q),
+		newHistoryRmCmd(q),
+		newHistoryRenameCmd(q),
+	)
+
+	return cmd
+}
+
+func newHistoryListCmd(q *biz.Qory) *cobra.Command {
+	var limit int
+	var asJSON bool
+	var tree bool
+
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List sessions, most recently updated first",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if limit < 0 {
+				return fmt.Errorf("invalid limit %d", limit)
+			}
+			previews, err := q.HistoryAll(limit)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return writePreviewsJSON(os.Stdout, previews)
+			}
+			if len(previews) == 0 {
+				fmt.Println("No sessions.")
+				return nil
+			}
+			if tree {
+				writePreviewsTree(os.Stdout, previews)
+				return nil
+			}
+			writePreviewsTable(os.Stdout, previews)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&limit, "limit", 0, "Maximum number of sessions to list (0 for all)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print sessions as JSON")
+	cmd.Flags().BoolVar(&tree, "tree", false, "Show forked sessions under the session they branched off")
+
+	return cmd
+}
+
+func newHistoryShowCmd(q *biz.Qory) *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print a session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := parseSessionFormat(format)
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+
+			sess, err := q.HistorySession(args[0])
+			if err != nil {
+				return err
+			}
+			return writeSession(os.Stdout, args[0], sess, f)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", string(formatText), "Output format: text, json or markdown")
+
+	return cmd
+}
+
+func newHistoryRmCmd(q *biz.Qory) *cobra.Command {
+	var olderThan string
+
+	cmd := &cobra.Command{
+		Use:   "rm <id>... | --older-than <age>",
+		Short: "Delete sessions",
+		Long: `Delete the given sessions, or every session not updated within the given age.
+
+Examples:
+  qory history rm 3f1c2a9e-0b7d-4d52-9f0e-6a1b2c3d4e5f
+  qory history rm --older-than 30d`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if (olderThan == "") == (len(args) == 0) {
+				return errors.New("specify either session IDs or --older-than")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if olderThan != "" {
+				age, err := parseAge(olderThan)
+				if err != nil {
+					return err
+				}
+				cmd.SilenceUsage = true
+
+				deleted, err := q.HistoryPrune(time.Now().Add(-age))
+				fmt.Printf("Deleted %d session(s)\n", len(deleted))
+				return err
+			}
+
+			cmd.SilenceUsage = true
+			var errs []error
+			for _, id := range args {
+				if err := q.HistoryDelete(id); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", id, err))
+				}
+			}
+			return errors.Join(errs...)
+		},
+	}
+
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "Delete sessions not updated within this age (e.g. 30d, 2w, 12h)")
+
+	return cmd
+}
+
+func newHistoryRenameCmd(q *biz.Qory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "rename <old> <new>",
+		Short:        "Change the ID of a session",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return q.HistoryRename(args[0], args[1])
 		},
 	}
 	return cmd
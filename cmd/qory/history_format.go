@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+)
+
+type sessionFormat string
+
+const (
+	formatText     sessionFormat = "text"
+	formatJSON     sessionFormat = "json"
+	formatMarkdown sessionFormat = "markdown"
+)
+
+func parseSessionFormat(value string) (sessionFormat, error) {
+	switch f := sessionFormat(value); f {
+	case formatText, formatJSON, formatMarkdown:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid format %q (valid: text, json, markdown)", value)
+	}
+}
+
+// previewJSON is the machine-readable form of a session preview.
+type previewJSON struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Snippet   string    `json:"snippet"`
+
+	ForkedFrom *session.Lineage `json:"forked_from,omitempty"`
+}
+
+func writePreviewsJSON(w io.Writer, previews []session.SessionPreview) error {
+	out := make([]previewJSON, 0, len(previews))
+	for _, p := range previews {
+		out = append(out, previewJSON{
+			ID:        p.Name,
+			Title:     p.Title,
+			Model:     p.Model,
+			CreatedAt: p.CreatedAt,
+			UpdatedAt: p.UpdatedAt,
+			Snippet:   p.Snippet,
+
+			ForkedFrom: p.ForkedFrom,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func writePreviewsTable(w io.Writer, previews []session.SessionPreview) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUPDATED\tMODEL\tTITLE")
+	for _, p := range previews {
+		writePreviewRow(tw, p.Name, p)
+	}
+	tw.Flush()
+}
+
+// writePreviewsTree is writePreviewsTable with forks listed under the session
+// they branched off. Forks whose parent is not listed are shown as roots.
+func writePreviewsTree(w io.Writer, previews []session.SessionPreview) {
+	listed := make(map[string]bool, len(previews))
+	for _, p := range previews {
+		listed[p.Name] = true
+	}
+
+	children := make(map[string][]session.SessionPreview)
+	var roots []session.SessionPreview
+	for _, p := range previews {
+		if p.ForkedFrom != nil && listed[p.ForkedFrom.Parent] {
+			children[p.ForkedFrom.Parent] = append(children[p.ForkedFrom.Parent], p)
+		} else {
+			roots = append(roots, p)
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUPDATED\tMODEL\tTITLE")
+
+	var walk func(p session.SessionPreview, branch, indent string)
+	walk = func(p session.SessionPreview, branch, indent string) {
+		label := branch + p.Name
+		if p.ForkedFrom != nil {
+			label += fmt.Sprintf(" (turn %d)", p.ForkedFrom.Turn)
+		}
+		writePreviewRow(tw, label, p)
+
+		kids := children[p.Name]
+		for i, child := range kids {
+			if i == len(kids)-1 {
+				walk(child, indent+"└─ ", indent+"   ")
+			} else {
+				walk(child, indent+"├─ ", indent+"│  ")
+			}
+		}
+	}
+	for _, root := range roots {
+		walk(root, "", "")
+	}
+	tw.Flush()
+}
+
+func writePreviewRow(w io.Writer, label string, p session.SessionPreview) {
+	title := p.Title
+	if title == "" {
+		title = strings.Join(strings.Fields(p.Snippet), " ")
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", label, p.UpdatedAt.Format(dateFormat), p.Model, title)
+}
+
+func writeSession(w io.Writer, id string, sess session.Session, format sessionFormat) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			ID string `json:"id"`
+			session.Session
+		}{id, sess})
+	case formatMarkdown:
+		writeSessionMarkdown(w, id, sess)
+	default:
+		writeSessionText(w, sess)
+	}
+	return nil
+}
+
+func writeSessionText(w io.Writer, sess session.Session) {
+	for i, m := range sess.Messages {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "--- %s ---\n", roleHeading(m, strings.ToUpper(string(m.Role))))
+		fmt.Fprintln(w, strings.TrimRight(m.Text(), "\n"))
+	}
+}
+
+func writeSessionMarkdown(w io.Writer, id string, sess session.Session) {
+	title := sess.Title
+	if title == "" {
+		title = id
+	}
+	fmt.Fprintf(w, "# %s\n", title)
+	for _, m := range sess.Messages {
+		role := string(m.Role)
+		role = strings.ToUpper(role[:1]) + role[1:]
+		fmt.Fprintf(w, "\n## %s\n\n", roleHeading(m, role))
+		fmt.Fprintln(w, strings.TrimRight(m.Text(), "\n"))
+	}
+}
+
+func roleHeading(m message.Message, role string) string {
+	if m.Interrupted {
+		role += " (interrupted)"
+	}
+	return role
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeFormatSession() session.Session {
+	sess := session.NewSession()
+	sess.Title = "Capitals"
+	sess.AddMessage(message.NewUserMessage("capital of France?"))
+	sess.AddMessage(message.NewAssistantMessage("Paris\n"))
+	return sess
+}
+
+func TestParseSessionFormat(t *testing.T) {
+	f, err := parseSessionFormat("markdown")
+	require.NoError(t, err)
+	assert.Equal(t, formatMarkdown, f)
+
+	_, err = parseSessionFormat("html")
+	assert.Error(t, err)
+}
+
+func TestWriteSession_Text(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeSession(&buf, "s1", makeFormatSession(), formatText))
+	assert.Equal(t, "--- USER ---\ncapital of France?\n\n--- ASSISTANT ---\nParis\n", buf.String())
+}
+
+func TestWriteSession_Markdown(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeSession(&buf, "s1", makeFormatSession(), formatMarkdown))
+	assert.Equal(t, "# Capitals\n\n## User\n\ncapital of France?\n\n## Assistant\n\nParis\n", buf.String())
+}
+
+func TestWriteSession_JSONIncludesID(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeSession(&buf, "s1", makeFormatSession(), formatJSON))
+
+	var decoded struct {
+		ID       string            `json:"id"`
+		Title    string            `json:"title"`
+		Messages []message.Message `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "s1", decoded.ID)
+	assert.Equal(t, "Capitals", decoded.Title)
+	assert.Len(t, decoded.Messages, 2)
+}
+
+func TestWritePreviewsTree_NestsForks(t *testing.T) {
+	var buf bytes.Buffer
+	writePreviewsTree(&buf, []session.SessionPreview{
+		{Name: "child", ForkedFrom: &session.Lineage{Parent: "root", Turn: 1}},
+		{Name: "orphan", ForkedFrom: &session.Lineage{Parent: "gone", Turn: 2}},
+		{Name: "root"},
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[1], "orphan (turn 2)"))
+	assert.True(t, strings.HasPrefix(lines[2], "root "))
+	assert.True(t, strings.HasPrefix(lines[3], "└─ child (turn 1)"))
+}
+
+func TestWritePreviewsTable_FallsBackToSnippet(t *testing.T) {
+	var buf bytes.Buffer
+	writePreviewsTable(&buf, []session.SessionPreview{
+		{Name: "s1", Snippet: "what is\nthe capital", Model: "gpt-4o"},
+	})
+	assert.Contains(t, buf.String(), "what is the capital")
+	assert.Contains(t, buf.String(), "gpt-4o")
+}
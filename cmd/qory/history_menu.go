@@ -11,7 +11,7 @@ import (
 )
 
 type historyProvider interface {
-	HistoryAll(limit int) ([]session.SessionPreview, error)
+	HistoryAll(limit ...int) ([]session.SessionPreview, error)
 	HistorySession(id string) (session.Session, error)
 	HistoryDelete(id string) error
 }
@@ -52,6 +52,7 @@ var (
 		message.RoleUser:      lipgloss.NewStyle().Foreground(lipgloss.Color("86")).Bold(true),
 		message.RoleAssistant: lipgloss.NewStyle().Foreground(lipgloss.Color("212")).Bold(true),
 		message.RoleSystem:    lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Bold(true),
+		message.RoleTool:      lipgloss.NewStyle().Foreground(lipgloss.Color("179")).Bold(true),
 	}
 )
 
@@ -61,14 +62,33 @@ type listState struct {
 	previewOffset int
 }
 
+// forkState tracks choosing the turn to branch the selected session off at.
+type forkState struct {
+	active bool
+	turn   int // number of turns to keep
+	turns  int // number of turns in the session
+}
+
+// historySelection is what the user picked in the history browser: a session
+// to continue, or to fork after the given turn.
+type historySelection struct {
+	ID   string
+	Fork bool
+	Turn int
+}
+
 type sessionModel struct {
 	provider historyProvider
 	previews []session.SessionPreview
 
 	selected  string
+	forkTurn  int
+	forked    bool
 	quitting  bool
 	statusMsg string
 
+	fork forkState
+
 	width  int
 	height int
 
@@ -96,6 +116,9 @@ func (m sessionModel) Init() tea.Cmd {
 func (m sessionModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.fork.active {
+			return m.updateFork(msg)
+		}
 		switch msg.String() {
 		case "ctrl+c", "q", "esc":
 			m.quitting = true
@@ -133,6 +156,18 @@ func (m sessionModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.list.previewOffset = 0
 				}
 			}
+		case "f":
+			if len(m.previews) > 0 {
+				sess, err := m.provider.HistorySession(m.previews[m.list.cursor].Name)
+				if err != nil {
+					m.statusMsg = fmt.Sprintf("Error: %v", err)
+				} else {
+					m.statusMsg = ""
+					turns := sess.Turns()
+					m.fork = forkState{active: true, turn: turns, turns: turns}
+					m.list.previewOffset = 0
+				}
+			}
 		case "enter":
 			if len(m.previews) > 0 {
 				m.selected = m.previews[m.list.cursor].Name
@@ -146,6 +181,37 @@ func (m sessionModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// updateFork handles keys while choosing the turn to fork at.
+func (m sessionModel) updateFork(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		m.quitting = true
+		return m, tea.Quit
+	case "esc":
+		m.fork = forkState{}
+	case "left", "h":
+		if m.fork.turn > 0 {
+			m.fork.turn--
+		}
+	case "right", "l":
+		if m.fork.turn < m.fork.turns {
+			m.fork.turn++
+		}
+	case "ctrl+j", "ctrl+down":
+		m.list.previewOffset++
+	case "ctrl+k", "ctrl+up":
+		if m.list.previewOffset > 0 {
+			m.list.previewOffset--
+		}
+	case "enter":
+		m.selected = m.previews[m.list.cursor].Name
+		m.forked = true
+		m.forkTurn = m.fork.turn
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
 func (m sessionModel) View() string {
 	if m.quitting {
 		return ""
@@ -161,13 +227,17 @@ func (m sessionModel) View() string {
 	items, cursorInView := m.visibleItems(navCount)
 	sb.WriteString(m.renderNavigator(items, cursorInView))
 
-	if m.list.showPreview {
+	if m.list.showPreview || m.fork.active {
 		previewHeight := max(1, m.height-navCount-viewOverheadLines)
 		sb.WriteString(m.renderSeparator())
 		sb.WriteString(m.renderPreview(previewHeight))
 	}
 
 	sb.WriteString(m.renderSeparator())
+	if m.fork.active {
+		sb.WriteString(helpStyle.Render(fmt.Sprintf("Fork after turn %d of %d", m.fork.turn, m.fork.turns)))
+		sb.WriteByte('\n')
+	}
 	if m.statusMsg != "" {
 		sb.WriteString(helpStyle.Render(m.statusMsg))
 		sb.WriteByte('\n')
@@ -219,7 +289,17 @@ func (m sessionModel) renderNavigator(items []session.SessionPreview, cursorInVi
 		// Absolute 1-based index of this item in the full preview list.
 		absNum := m.list.cursor - cursorInView + i + 1
 		num := fmt.Sprintf("%*d", numWidth, absNum)
-		line := fmt.Sprintf("%s. %s (%s)", num, p.Name, p.UpdatedAt.Format(dateFormat))
+		name := p.Name
+		if p.Title != "" {
+			name = p.Title
+		}
+		if p.ForkedFrom != nil {
+			name = "↳ " + name
+		}
+		line := fmt.Sprintf("%s. %s (%s)", num, name, p.UpdatedAt.Format(dateFormat))
+		if p.Model != "" {
+			line += " [" + p.Model + "]"
+		}
 		if i == cursorInView {
 			sb.WriteString(selectedStyle.Render("> " + line))
 		} else {
@@ -246,8 +326,11 @@ func (m sessionModel) buildPreviewLines(messages []message.Message) []string {
 			style = normalStyle
 		}
 		role := strings.ToUpper(string(msg.Role))
+		if msg.Interrupted {
+			role += " (interrupted)"
+		}
 		lines = append(lines, style.Render("--- "+role+" ---"))
-		for _, l := range strings.Split(wordWrap(msg.Content, m.width), "\n") {
+		for _, l := range strings.Split(wordWrap(msg.Text(), m.width), "\n") {
 			lines = append(lines, previewBodyStyle.Render(l))
 		}
 		lines = append(lines, "")
@@ -262,7 +345,15 @@ func (m sessionModel) renderPreview(maxLines int) string {
 		return fmt.Sprintf("Error loading session: %v\n", err)
 	}
 
-	all := m.buildPreviewLines(sess.Messages)
+	messages := sess.Messages
+	if m.fork.active {
+		// Only show what the fork will keep.
+		if fork, err := sess.Fork(id, m.fork.turn); err == nil {
+			messages = fork.Messages
+		}
+	}
+
+	all := m.buildPreviewLines(messages)
 	total := len(all)
 
 	// Clamp the offset so we never scroll past the last screenful.
@@ -289,10 +380,13 @@ func (m sessionModel) renderPreview(maxLines int) string {
 }
 
 func (m sessionModel) helpLine() string {
+	if m.fork.active {
+		return "←/h fewer turns  →/l more turns  ctrl+↑/↓ scroll preview  enter fork  esc cancel  q quit"
+	}
 	if m.list.showPreview {
-		return "↑/k up  ↓/j down  ctrl+↑/↓ scroll preview  p hide preview  d delete  enter select  q quit"
+		return "↑/k up  ↓/j down  ctrl+↑/↓ scroll preview  p hide preview  d delete  f fork  enter select  q quit"
 	}
-	return "↑/k up  ↓/j down  p show preview  d delete  enter select  q quit"
+	return "↑/k up  ↓/j down  p show preview  d delete  f fork  enter select  q quit"
 }
 
 // wordWrap inserts newlines so no line exceeds maxWidth runes.
@@ -317,21 +411,22 @@ func wordWrap(text string, maxWidth int) string {
 }
 
 // ShowHistoryMenu presents an interactive session browser.
-// Returns the selected session ID, or an empty string if the user quits without selecting.
-func ShowHistoryMenu(provider historyProvider) (string, error) {
+// Returns the selection, whose ID is empty if the user quits without selecting.
+func ShowHistoryMenu(provider historyProvider) (historySelection, error) {
 	m, err := newSessionModel(newCachingProvider(provider))
 	if err != nil {
-		return "", err
+		return historySelection{}, err
 	}
 	if len(m.previews) == 0 {
-		return "", nil
+		return historySelection{}, nil
 	}
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	final, err := p.Run()
 	if err != nil {
-		return "", err
+		return historySelection{}, err
 	}
 
-	return final.(sessionModel).selected, nil
+	fm := final.(sessionModel)
+	return historySelection{ID: fm.selected, Fork: fm.forked, Turn: fm.forkTurn}, nil
 }
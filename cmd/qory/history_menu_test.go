@@ -182,6 +182,65 @@ func TestUpdate_EnterOnEmptyDoesNothing(t *testing.T) {
 	p.AssertExpectations(t)
 }
 
+// ---- fork ----
+
+func makeTwoTurnSession() session.Session {
+	sess := session.NewSession()
+	sess.AddMessage(message.NewUserMessage("q1"))
+	sess.AddMessage(message.NewAssistantMessage("a1"))
+	sess.AddMessage(message.NewUserMessage("q2"))
+	sess.AddMessage(message.NewAssistantMessage("a2"))
+	return sess
+}
+
+func TestUpdate_ForkSelectsTurn(t *testing.T) {
+	p := newMockProvider(makePreviews("a"))
+	p.On("HistorySession", "a").Return(makeTwoTurnSession(), nil)
+	m := mustModel(t, p)
+
+	m = sendKey(m, "f")
+	require.True(t, m.fork.active)
+	assert.Equal(t, 2, m.fork.turn)
+
+	m = sendSpecialKey(m, tea.KeyLeft)
+	m = sendKey(m, "h")
+	m = sendKey(m, "h")
+	assert.Equal(t, 0, m.fork.turn)
+	m = sendKey(m, "l")
+
+	m = sendSpecialKey(m, tea.KeyEnter)
+	assert.Equal(t, "a", m.selected)
+	assert.True(t, m.forked)
+	assert.Equal(t, 1, m.forkTurn)
+	p.AssertExpectations(t)
+}
+
+func TestUpdate_ForkEscCancels(t *testing.T) {
+	p := newMockProvider(makePreviews("a"))
+	p.On("HistorySession", "a").Return(makeTwoTurnSession(), nil)
+	m := mustModel(t, p)
+
+	m = sendKey(m, "f")
+	m = sendSpecialKey(m, tea.KeyEsc)
+	assert.False(t, m.fork.active)
+	assert.False(t, m.quitting)
+	p.AssertExpectations(t)
+}
+
+func TestView_ForkPreviewShowsKeptTurnsOnly(t *testing.T) {
+	p := newMockProvider(makePreviews("a"))
+	p.On("HistorySession", "a").Return(makeTwoTurnSession(), nil)
+	m := mustModel(t, p)
+
+	m = sendKey(m, "f")
+	m = sendKey(m, "h")
+	view := m.View()
+	assert.Contains(t, view, "a1")
+	assert.NotContains(t, view, "a2")
+	assert.Contains(t, view, "Fork after turn 1 of 2")
+	p.AssertExpectations(t)
+}
+
 // ---- delete ----
 
 func TestUpdate_DeleteRemovesSessionFromList(t *testing.T) {
@@ -497,6 +556,21 @@ func TestBuildPreviewLines_RendersRoles(t *testing.T) {
 	p.AssertExpectations(t)
 }
 
+func TestBuildPreviewLines_MarksInterruptedMessages(t *testing.T) {
+	msgs := []message.Message{
+		message.NewUserMessage("hello"),
+		message.NewInterruptedMessage("wor"),
+	}
+	p := newMockProvider(makePreviews("s"))
+	m := mustModel(t, p)
+
+	lines := m.buildPreviewLines(msgs)
+	joined := strings.Join(lines, "\n")
+	assert.Contains(t, joined, "ASSISTANT (interrupted)")
+	assert.Contains(t, joined, "wor")
+	p.AssertExpectations(t)
+}
+
 func TestBuildPreviewLines_WrapsLongContent(t *testing.T) {
 	longMsg := strings.Repeat("x", 200)
 	msgs := []message.Message{message.NewUserMessage(longMsg)}
@@ -617,6 +691,19 @@ func TestView_SessionNameAppearsInNavigator(t *testing.T) {
 	p.AssertExpectations(t)
 }
 
+func TestView_TitleAndModelAppearInNavigator(t *testing.T) {
+	preview := makePreview("s")
+	preview.Title = "Capital cities"
+	preview.Model = "gpt-4o"
+	p := newMockProvider([]session.SessionPreview{preview})
+	p.On("HistorySession", "s").Return(session.Session{}, nil)
+	m := mustModel(t, p)
+	view := m.View()
+	assert.Contains(t, view, "Capital cities")
+	assert.Contains(t, view, "[gpt-4o]")
+	p.AssertExpectations(t)
+}
+
 func TestView_DateAppearsInNavigator(t *testing.T) {
 	p := newMockProvider(makePreviews("s"))
 	p.On("HistorySession", "s").Return(session.Session{}, nil)
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dtrugman/qory/cmd/qory/biz"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/session"
+	"github.com/spf13/cobra"
+)
+
+const defaultSearchLimit = 20
+
+var (
+	searchHeaderStyle = lipgloss.NewStyle().Bold(true)
+
+	searchMetaStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("241"))
+
+	searchHighlightStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("212")).
+				Bold(true)
+)
+
+func newHistorySearchCmd(q *biz.Qory) *cobra.Command {
+	var roles []string
+	var regex bool
+	var since, until string
+	var model string
+	var limit int
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search all stored sessions",
+		Long: `Search the messages of all stored sessions.
+
+By default the query is a list of words that must all appear in a session;
+matching ignores case and punctuation. With --regex it is a Go regular
+expression (prefix with (?i) to ignore case).
+
+Examples:
+  qory history search nginx config
+  qory history search --role user --since 30d "reverse proxy"
+  qory history search --regex 'proxy_(pass|set_header)' --model gpt-4o`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			now := time.Now()
+			opts := session.SearchOptions{
+				Query: strings.Join(args, " "),
+				Regex: regex,
+				Model: model,
+				Limit: limit,
+			}
+
+			for _, r := range roles {
+				role, err := parseSearchRole(r)
+				if err != nil {
+					return err
+				}
+				opts.Roles = append(opts.Roles, role)
+			}
+
+			var err error
+			if since != "" {
+				if opts.Since, err = parseTimeBound(since, now, false); err != nil {
+					return err
+				}
+			}
+			if until != "" {
+				if opts.Until, err = parseTimeBound(until, now, true); err != nil {
+					return err
+				}
+			}
+			if limit < 0 {
+				return fmt.Errorf("invalid limit %d", limit)
+			}
+			cmd.SilenceUsage = true
+
+			results, err := q.HistorySearch(opts)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return writeSearchJSON(os.Stdout, results)
+			}
+			if len(results) == 0 {
+				fmt.Println("No matching sessions.")
+				return nil
+			}
+			writeSearchResults(os.Stdout, results)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&roles, "role", nil, "Only match messages from these roles (user, assistant, system, tool)")
+	cmd.Flags().BoolVar(&regex, "regex", false, "Treat the query as a regular expression")
+	cmd.Flags().StringVar(&since, "since", "", "Only sessions updated since this date or age (e.g. 2024-05-01, 30d)")
+	cmd.Flags().StringVar(&until, "until", "", "Only sessions updated until this date or age (e.g. 2024-05-31, 7d)")
+	cmd.Flags().StringVar(&model, "model", "", "Only sessions that used a model whose name contains this")
+	cmd.Flags().IntVar(&limit, "limit", defaultSearchLimit, "Maximum number of results (0 for all)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print results as JSON")
+
+	return cmd
+}
+
+func parseSearchRole(value string) (message.Role, error) {
+	switch role := message.Role(strings.ToLower(value)); role {
+	case message.RoleUser, message.RoleAssistant, message.RoleSystem, message.RoleTool:
+		return role, nil
+	default:
+		return "", fmt.Errorf("invalid role %q (valid: user, assistant, system, tool)", value)
+	}
+}
+
+// searchResultJSON is the machine-readable form of a search result.
+type searchResultJSON struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Score     float64   `json:"score"`
+	Snippet   string    `json:"snippet"`
+	Matches   [][2]int  `json:"matches,omitempty"`
+}
+
+func writeSearchJSON(w io.Writer, results []session.SearchResult) error {
+	out := make([]searchResultJSON, 0, len(results))
+	for _, r := range results {
+		out = append(out, searchResultJSON{
+			ID:        r.ID,
+			Title:     r.Title,
+			Model:     r.Model,
+			UpdatedAt: r.UpdatedAt,
+			Score:     r.Score,
+			Snippet:   r.Snippet,
+			Matches:   r.Highlights,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func writeSearchResults(w io.Writer, results []session.SearchResult) {
+	for i, r := range results {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		header := r.ID
+		if r.Title != "" {
+			header += "  " + r.Title
+		}
+		meta := r.UpdatedAt.Format(dateFormat)
+		if r.Model != "" {
+			meta += ", " + r.Model
+		}
+		fmt.Fprintf(w, "%s  %s\n", searchHeaderStyle.Render(header), searchMetaStyle.Render("("+meta+")"))
+		fmt.Fprintf(w, "    %s\n", highlightSnippet(r.Snippet, r.Highlights))
+	}
+}
+
+// highlightSnippet styles the given byte ranges of snippet.
+func highlightSnippet(snippet string, ranges [][2]int) string {
+	var sb strings.Builder
+	last := 0
+	for _, r := range ranges {
+		if r[0] < last || r[1] > len(snippet) {
+			continue
+		}
+		sb.WriteString(snippet[last:r[0]])
+		sb.WriteString(searchHighlightStyle.Render(snippet[r[0]:r[1]]))
+		last = r[1]
+	}
+	sb.WriteString(snippet[last:])
+	return sb.String()
+}
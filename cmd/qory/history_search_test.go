@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHighlightSnippet_KeepsText(t *testing.T) {
+	got := highlightSnippet("configure nginx proxy", [][2]int{{10, 15}})
+	assert.Contains(t, got, "configure ")
+	assert.Contains(t, got, "nginx")
+	assert.Contains(t, got, " proxy")
+}
+
+func TestParseSearchRole(t *testing.T) {
+	role, err := parseSearchRole("Assistant")
+	require.NoError(t, err)
+	assert.Equal(t, message.RoleAssistant, role)
+
+	role, err = parseSearchRole("tool")
+	require.NoError(t, err)
+	assert.Equal(t, message.RoleTool, role)
+
+	_, err = parseSearchRole("bot")
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/jsonschema"
+	"github.com/spf13/cobra"
+)
+
+const maxSchemaName = 64
+
+// jsonFlags holds the flags asking for answers in JSON.
+type jsonFlags struct {
+	json   bool
+	schema string
+}
+
+func (f *jsonFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.json, "json", false, "Ask for an answer that is a JSON object, and print only the JSON")
+	cmd.Flags().StringVar(&f.schema, "schema", "", "Ask for an answer matching the JSON Schema in `file` (implies --json)")
+}
+
+// format returns the answer format the flags ask for, or nil without them.
+// The schema is checked up front, so a broken one fails before any query.
+func (f *jsonFlags) format() (*generation.Format, error) {
+	if f.schema == "" {
+		if f.json {
+			return &generation.Format{}, nil
+		}
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(f.schema)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := jsonschema.Compile(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.schema, err)
+	}
+	return &generation.Format{Schema: data, Name: schemaName(f.schema)}, nil
+}
+
+// schemaName derives the name of a schema from its file name, keeping only
+// the characters providers accept in schema names.
+func schemaName(path string) string {
+	base := filepath.Base(path)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, base)
+	if len(name) > maxSchemaName {
+		name = name[:maxSchemaName]
+	}
+	if strings.Trim(name, "_") == "" {
+		return "response"
+	}
+	return name
+}
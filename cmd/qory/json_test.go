@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaName(t *testing.T) {
+	assert.Equal(t, "invoice_schema", schemaName("schemas/invoice.schema.json"))
+	assert.Equal(t, "my_reply-v2", schemaName("my reply-v2.json"))
+	assert.Equal(t, "response", schemaName("ü.json"))
+	assert.Len(t, schemaName(strings.Repeat("a", 100)+".json"), maxSchemaName)
+}
+
+func TestJSONFlags_Format(t *testing.T) {
+	format, err := (&jsonFlags{}).format()
+	require.NoError(t, err)
+	assert.Nil(t, format)
+
+	format, err = (&jsonFlags{json: true}).format()
+	require.NoError(t, err)
+	assert.Empty(t, format.Schema)
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "city.json")
+	require.NoError(t, os.WriteFile(good, []byte(`{"type": "object"}`), 0o644))
+	format, err = (&jsonFlags{schema: good}).format()
+	require.NoError(t, err)
+	assert.Equal(t, "city", format.Name)
+	assert.JSONEq(t, `{"type": "object"}`, string(format.Schema))
+
+	bad := filepath.Join(dir, "bad.json")
+	require.NoError(t, os.WriteFile(bad, []byte(`[]`), 0o644))
+	_, err = (&jsonFlags{schema: bad}).format()
+	assert.EqualError(t, err, bad+": schema must be a JSON object")
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/dtrugman/qory/cmd/qory/biz"
 	"github.com/dtrugman/qory/lib/config"
@@ -11,7 +15,19 @@ import (
 	"github.com/dtrugman/qory/lib/session"
 )
 
+// exitInterrupted is the conventional exit status for a process stopped by SIGINT.
+const exitInterrupted = 130
+
+// handlesInterrupt annotates commands that handle Ctrl+C themselves, rather
+// than having it cancel their context.
+const handlesInterrupt = "handles-interrupt"
+
 func buildClient(conf biz.Config) (*model.Client, error) {
+	provider, _, err := conf.Provider()
+	if err != nil {
+		return nil, fmt.Errorf("get provider failed: %w", err)
+	}
+
 	apiKeyStr, _, err := conf.APIKey()
 	if err != nil {
 		return nil, fmt.Errorf("get API key failed: %w", err)
@@ -22,6 +38,14 @@ func buildClient(conf biz.Config) (*model.Client, error) {
 		return nil, fmt.Errorf("get base URL failed: %w", err)
 	}
 
+	retry := model.DefaultRetryPolicy()
+	if retry.MaxAttempts, _, err = conf.RetryAttempts(); err != nil {
+		return nil, fmt.Errorf("get retry attempts failed: %w", err)
+	}
+	if retry.BaseDelay, _, err = conf.RetryDelay(); err != nil {
+		return nil, fmt.Errorf("get retry delay failed: %w", err)
+	}
+
 	var apiKey *string
 	if apiKeyStr != "" {
 		apiKey = &apiKeyStr
@@ -32,8 +56,12 @@ func buildClient(conf biz.Config) (*model.Client, error) {
 		baseURL = &baseURLStr
 	}
 
-	client := model.NewClient(apiKey, baseURL)
-	return client, nil
+	switch provider {
+	case config.ProviderAnthropic:
+		return model.NewAnthropicClient(apiKey, baseURL, retry), nil
+	default:
+		return model.NewClient(apiKey, baseURL, retry), nil
+	}
 }
 
 func buildSessionManager(conf biz.Config) (*session.Manager, error) {
@@ -57,10 +85,7 @@ func buildQory() (*biz.Qory, error) {
 		return nil, fmt.Errorf("config: %w", err)
 	}
 
-	client, err := buildClient(conf)
-	if err != nil {
-		return nil, fmt.Errorf("client: %w", err)
-	}
+	client := newLazyClient(conf)
 
 	sm, err := buildSessionManager(conf)
 	if err != nil {
@@ -82,10 +107,25 @@ func main() {
 	root.AddCommand(
 		newVersionCmd(),
 		newHistoryCmd(q),
+		newChatCmd(q),
 		newConfigCmd(q),
+		newUsageCmd(q),
 	)
 
-	if err := root.Execute(); err != nil {
+	// Cancel in-flight queries on SIGINT/SIGTERM so partial answers are saved.
+	// Commands that handle Ctrl+C themselves are only cancelled by SIGTERM.
+	signals := []os.Signal{syscall.SIGTERM}
+	if cmd, _, err := root.Find(os.Args[1:]); err != nil || cmd.Annotations[handlesInterrupt] == "" {
+		signals = append(signals, os.Interrupt)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), signals...)
+	defer stop()
+
+	if err := root.ExecuteContext(ctx); err != nil {
+		stop()
+		if errors.Is(err, context.Canceled) {
+			os.Exit(exitInterrupted)
+		}
 		os.Exit(1)
 	}
 }
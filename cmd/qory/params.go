@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/util"
+	"github.com/spf13/cobra"
+)
+
+// paramsFlags holds the raw values of the per-query generation flags.
+type paramsFlags struct {
+	model           string
+	temperature     string
+	topP            string
+	maxTokens       string
+	stop            []string
+	seed            string
+	reasoningEffort string
+}
+
+func (f *paramsFlags) register(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVarP(&f.model, "model", "m", "", "Model to use, overriding the session and configured model")
+	flags.StringVar(&f.temperature, "temperature", "", "Sampling `temperature` between 0 and 2")
+	flags.StringVar(&f.topP, "top-p", "", "Nucleus sampling probability `mass` between 0 and 1")
+	flags.StringVar(&f.maxTokens, "max-tokens", "", "Maximum `number` of tokens to generate")
+	flags.StringArrayVar(&f.stop, "stop", nil, "Stop `sequence` (repeatable)")
+	flags.StringVar(&f.seed, "seed", "", "Sampling `seed` for best-effort deterministic output")
+	flags.StringVar(&f.reasoningEffort, "reasoning-effort", "", "Reasoning `effort` for reasoning models (low, medium, high)")
+}
+
+// params validates the flags that were given and converts them to generation
+// parameters. Flags that were not given are left unset.
+func (f *paramsFlags) params() (generation.Params, error) {
+	params := generation.Params{
+		Model: f.model,
+		Stop:  f.stop,
+	}
+
+	if f.temperature != "" {
+		t, err := generation.ParseTemperature(f.temperature)
+		if err != nil {
+			return params, err
+		}
+		params.Temperature = util.Ptr(t)
+	}
+
+	if f.topP != "" {
+		p, err := generation.ParseTopP(f.topP)
+		if err != nil {
+			return params, err
+		}
+		params.TopP = util.Ptr(p)
+	}
+
+	if f.maxTokens != "" {
+		n, err := generation.ParseMaxTokens(f.maxTokens)
+		if err != nil {
+			return params, err
+		}
+		params.MaxTokens = util.Ptr(n)
+	}
+
+	if f.seed != "" {
+		n, err := generation.ParseSeed(f.seed)
+		if err != nil {
+			return params, err
+		}
+		params.Seed = util.Ptr(n)
+	}
+
+	if f.reasoningEffort != "" {
+		effort, err := generation.ParseReasoningEffort(f.reasoningEffort)
+		if err != nil {
+			return params, err
+		}
+		params.ReasoningEffort = effort
+	}
+
+	return params, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+// renderFlags holds the flags choosing between rendered and raw answers.
+type renderFlags struct {
+	raw    bool
+	render bool
+}
+
+func (f *renderFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.raw, "raw", false, "Print answers as raw markdown, even to a terminal")
+	cmd.Flags().BoolVar(&f.render, "render", false, "Render the markdown of answers, even when stdout is not a terminal")
+	cmd.MarkFlagsMutuallyExclusive("raw", "render")
+}
+
+// enabled reports whether answers are rendered: when printing to a terminal,
+// unless --raw is given, or whenever --render is.
+func (f *renderFlags) enabled() bool {
+	if f.raw || f.render {
+		return f.render
+	}
+	return stdoutIsTerminal()
+}
+
+// stdoutIsTerminal reports whether stdout is attached to a terminal rather
+// than redirected to a file or a pipe. Other character devices, such as
+// /dev/null, are not terminals.
+func stdoutIsTerminal() bool {
+	fd := os.Stdout.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
 	"github.com/dtrugman/qory/cmd/qory/biz"
+	"github.com/dtrugman/qory/lib/config"
 	"github.com/dtrugman/qory/lib/editor"
+	"github.com/dtrugman/qory/lib/input"
 	"github.com/spf13/cobra"
 )
 
@@ -10,6 +17,16 @@ func newRootCmd(q *biz.Qory) *cobra.Command {
 	var sessionID string
 	var last bool
 	var new_ bool
+	var forkAt int
+	var retry, undo, edit bool
+	var opts biz.QueryOptions
+	var files []string
+	var code int
+	var profile string
+	var genFlags paramsFlags
+	var outFlags renderFlags
+	var formatFlags jsonFlags
+	var toolFlags toolsFlags
 
 	cmd := &cobra.Command{
 		Use:   "qory <input...>",
@@ -21,12 +38,110 @@ Examples:
   qory # Will open an editor for the query
   qory "Please create a basic OpenAPI yaml template"
   qory "Please add a health check to my OpenAPI spec" openapi.yaml
+  kubectl logs my-pod | qory "Why is this crashing?"
+  git diff | qory "Review this change against" - "and the style guide" STYLE.md
+  qory "Why does this panic?" @main.go:40-60
+  qory --text "Is" README.md "a good name for the docs?"
+  qory --code "Write a Python script that renames photos by date" > rename.py
+  qory --write-blocks src/ "Split this into a package and its tests" main.go
+  qory --apply main.py "Add a /ping endpoint"
+  qory --schema invoice.schema.json "Extract the invoice details" invoice.pdf
+  qory --tools read,grep "Where is the retry policy configured?"
   qory --last "So how would you suggest to fix that?"
   qory --session 3f2e1d0c-... "Please also add query parameters"
-  qory --new "Start fresh regardless of configured mode"`,
+  qory --new "Start fresh regardless of configured mode"
+  qory --session 3f2e1d0c-... --fork-at 2 "Let's try another approach instead"
+  qory --last --retry --model gpt-4o # Ask the last question again
+  qory --last --undo # Forget the last question and its answer
+  qory --last --edit # Rewrite the last question in your editor and ask again
+  qory --profile local "Answer using the local profile"
+  qory --model gpt-4o-mini --temperature 0.2 "Name three colors"`,
 		Args: cobra.ArbitraryArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if profile == "" {
+				return nil
+			}
+			return q.GetConfig().UseProfile(profile)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 0 {
+			params, err := genFlags.params()
+			if err != nil {
+				return err
+			}
+			opts.Params = params
+			opts.Render = outFlags.enabled()
+
+			if opts.Params.Format, err = formatFlags.format(); err != nil {
+				return err
+			}
+			if opts.Params.Format != nil {
+				opts.Render = false
+			}
+			if opts.Tools, err = toolFlags.tools(); err != nil {
+				return err
+			}
+
+			if cmd.Flags().Changed("code") {
+				if code < 0 {
+					return fmt.Errorf("--code takes the position of a block, counting from 1")
+				}
+				opts.PrintCode = true
+				opts.Blocks.Index = code
+			}
+			if opts.Blocks.Lang != "" && opts.WriteBlocks == "" {
+				opts.PrintCode = true
+			}
+			if opts.Overwrite && opts.WriteBlocks == "" {
+				return fmt.Errorf("--overwrite requires --write-blocks")
+			}
+			if opts.Apply || opts.WriteBlocks != "" {
+				opts.Confirm = confirmOnTerminal
+			}
+
+			forking := cmd.Flags().Changed("fork-at")
+			if forking && sessionID == "" && !last {
+				return fmt.Errorf("--fork-at requires --session or --last")
+			}
+
+			rewinding := retry || undo || edit
+			if rewinding && sessionID == "" && !last {
+				return fmt.Errorf("--retry, --undo and --edit require --session or --last")
+			}
+			if rewinding && len(args) > 0 {
+				return fmt.Errorf("--retry, --undo and --edit take no input")
+			}
+
+			// Flags parsed fine; runtime errors (including Ctrl-C) shouldn't dump usage.
+			cmd.SilenceUsage = true
+
+			if rewinding {
+				return runRewind(cmd, q, sessionID, retry, undo, opts)
+			}
+
+			for _, f := range files {
+				if _, err := os.Stat(f); err != nil && !input.IsGlob(f) {
+					return err
+				}
+				args = append(args, input.RefTo(f))
+			}
+
+			piped := stdinIsPiped()
+			if !piped && slices.Contains(args, biz.StdinArg) {
+				return fmt.Errorf(`"%s" stands for piped input, but nothing is piped in`, biz.StdinArg)
+			}
+			if piped {
+				if opts.Stdin, err = readStdin(os.Stdin); err != nil {
+					return err
+				}
+				if len(args) == 0 && strings.TrimSpace(opts.Stdin) == "" {
+					return fmt.Errorf("no input: stdin was empty")
+				}
+			}
+
+			if len(args) == 0 && !piped {
+				if !stdinIsTerminal() {
+					return fmt.Errorf("no input")
+				}
 				editorName, _, err := q.GetConfig().Editor()
 				if err != nil {
 					return err
@@ -40,25 +155,102 @@ Examples:
 				}
 				args = []string{content}
 			}
+			if forking && last {
+				return q.QueryForkLast(cmd.Context(), forkAt, args, opts)
+			}
+			if forking {
+				return q.QueryFork(cmd.Context(), sessionID, forkAt, args, opts)
+			}
 			if new_ {
-				return q.QueryNew(args)
+				return q.QueryNew(cmd.Context(), args, opts)
 			}
 			if last {
-				return q.QueryLast(args)
+				return q.QueryLast(cmd.Context(), args, opts)
 			}
 			if sessionID != "" {
-				return q.QuerySession(sessionID, args)
+				return q.QuerySession(cmd.Context(), sessionID, args, opts)
 			}
-			return q.QueryDefault(args)
+			return q.QueryDefault(cmd.Context(), args, opts)
 		},
 	}
 
 	cmd.Flags().StringVarP(&sessionID, "session", "s", "", "Session name to continue")
 	cmd.Flags().BoolVarP(&last, "last", "l", false, "Continue the last session")
 	cmd.Flags().BoolVarP(&new_, "new", "n", false, "Start a new session")
+	cmd.Flags().IntVar(&forkAt, "fork-at", 0, "Branch the session off into a new one after this many turns (0 keeps only the system prompt)")
+	cmd.Flags().BoolVar(&retry, "retry", false, "Discard the last answer of the session and ask again")
+	cmd.Flags().BoolVar(&undo, "undo", false, "Remove the last question of the session and its answer")
+	cmd.Flags().BoolVar(&edit, "edit", false, "Edit the last question of the session in your editor and ask again")
+	genFlags.register(cmd)
+	outFlags.register(cmd)
+	formatFlags.register(cmd)
+	toolFlags.register(cmd)
+	cmd.Flags().StringArrayVarP(&files, "file", "f", nil, "Include this file, directory or glob (repeatable)")
+	cmd.Flags().BoolVar(&opts.ExplicitInputs, "text", false, "Treat inputs as text unless they are @path references")
+	cmd.Flags().BoolVar(&opts.HTMLText, "html-text", false, "Send the text of HTML inputs rather than their markup")
+	cmd.Flags().IntVar(&code, "code", 0, "Print only the code blocks of the answer, or only the `n`th one with --code=n")
+	cmd.Flags().Lookup("code").NoOptDefVal = "0"
+	cmd.Flags().StringVar(&opts.Blocks.Lang, "lang", "", "Only pick code blocks in this `language` (implies --code without --write-blocks)")
+	cmd.Flags().StringVar(&opts.WriteBlocks, "write-blocks", "", "Write the code blocks of the answer to files in `dir`, named after the paths their fences give")
+	cmd.Flags().BoolVar(&opts.Overwrite, "overwrite", false, "Let --write-blocks replace existing files without asking")
+	cmd.Flags().BoolVar(&opts.Apply, "apply", false, "Ask for edits to the input files, then review and apply them one file at a time")
+	cmd.Flags().BoolVar(&opts.ShowUsage, "usage", false, "Print token usage and estimated cost to stderr")
+	cmd.Flags().StringVar(&opts.Title, "title", "", "Set a human-readable title for the session")
+	cmd.PersistentFlags().StringVar(&profile, "profile", "",
+		"Configuration profile to use (overrides $"+config.EnvProfile+")")
 	cmd.MarkFlagsMutuallyExclusive("new", "last")
 	cmd.MarkFlagsMutuallyExclusive("new", "session")
 	cmd.MarkFlagsMutuallyExclusive("last", "session")
+	cmd.MarkFlagsMutuallyExclusive("retry", "undo", "edit", "fork-at", "new")
+	// Edits are confined to the input files of the question, which are only
+	// known when it is asked.
+	for _, other := range []string{"code", "lang", "undo", "retry", "edit"} {
+		cmd.MarkFlagsMutuallyExclusive("apply", other)
+	}
+	for _, other := range []string{"apply", "code", "lang", "write-blocks", "render", "undo", "tools"} {
+		cmd.MarkFlagsMutuallyExclusive("json", other)
+		cmd.MarkFlagsMutuallyExclusive("schema", other)
+	}
 
 	return cmd
 }
+
+// runRewind handles --retry, --undo and --edit, which all rework the latest
+// turn of an existing session instead of adding a new one.
+func runRewind(cmd *cobra.Command, q *biz.Qory, sessionID string, retry, undo bool, opts biz.QueryOptions) error {
+	id := sessionID
+	if id == "" {
+		var err error
+		if id, err = q.LastSession(); err != nil {
+			return err
+		}
+	}
+
+	if retry {
+		return q.QueryRetry(cmd.Context(), id, opts)
+	}
+	if undo {
+		if err := q.HistoryUndo(id); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Removed the last exchange of session %s\n", id)
+		return nil
+	}
+
+	question, err := q.LastQuestion(id)
+	if err != nil {
+		return err
+	}
+	editorName, _, err := q.GetConfig().Editor()
+	if err != nil {
+		return err
+	}
+	content, err := editor.EditText(editorName, question)
+	if err != nil {
+		return err
+	}
+	if content == "" {
+		return nil
+	}
+	return q.QueryEdit(cmd.Context(), id, content, opts)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/mattn/go-isatty"
+)
+
+// maxStdinBytes caps how much piped input is read into a question.
+const maxStdinBytes = 1 << 20
+
+// stdinIsTerminal reports whether stdin is attached to an interactive
+// terminal. Other character devices, such as /dev/null, are not terminals.
+func stdinIsTerminal() bool {
+	fd := os.Stdin.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// stdinIsPiped reports whether stdin is a pipe or a redirected file. Other
+// kinds of stdin, such as a socket inherited from a parent process, may never
+// reach EOF and are not read.
+func stdinIsPiped() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	mode := stat.Mode()
+	return mode&os.ModeNamedPipe != 0 || mode.IsRegular()
+}
+
+// readStdin reads piped input, refusing input larger than maxStdinBytes or
+// that is not text.
+func readStdin(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxStdinBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("read stdin: %w", err)
+	}
+	if len(data) > maxStdinBytes {
+		return "", fmt.Errorf("piped input exceeds the %d KiB limit", maxStdinBytes>>10)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("piped input is not text")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStdin(t *testing.T) {
+	got, err := readStdin(strings.NewReader("panic: oops\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "panic: oops\n", got)
+}
+
+func TestReadStdin_RejectsOversized(t *testing.T) {
+	_, err := readStdin(strings.NewReader(strings.Repeat("a", maxStdinBytes+1)))
+	assert.ErrorContains(t, err, "limit")
+
+	_, err = readStdin(strings.NewReader(strings.Repeat("a", maxStdinBytes)))
+	assert.NoError(t, err)
+}
+
+func TestReadStdin_RejectsBinary(t *testing.T) {
+	_, err := readStdin(strings.NewReader("\xff\xfe\x00"))
+	assert.Error(t, err)
+}
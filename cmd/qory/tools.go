@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/dtrugman/qory/lib/tool"
+	"github.com/spf13/cobra"
+)
+
+// toolsFlags holds the flag enabling built-in tools.
+type toolsFlags struct {
+	names []string
+}
+
+func (f *toolsFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&f.names, "tools", nil,
+		"Let the model call these built-in `tools` ("+strings.Join(tool.Names(), ", ")+"); shell commands are confirmed one by one")
+}
+
+// tools returns the tools the flag enables, if any.
+func (f *toolsFlags) tools() ([]tool.Tool, error) {
+	if len(f.names) == 0 {
+		return nil, nil
+	}
+	return tool.Builtins(f.names, tool.Options{Confirm: confirmOnTerminal})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dtrugman/qory/cmd/qory/biz"
+	"github.com/dtrugman/qory/lib/usage"
+	"github.com/spf13/cobra"
+)
+
+func newUsageCmd(q *biz.Qory) *cobra.Command {
+	var by string
+	var since string
+
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Report token usage and estimated cost",
+		Long: `Aggregate the token usage recorded in stored sessions by day, model or session.
+
+Costs are estimates based on qory's built-in price table, overridden by
+"qory config prices". Only sessions still on disk are counted, so usage of
+sessions removed by history-size cleanup is not included.
+
+Examples:
+  qory usage
+  qory usage --by model --since 30d
+  qory usage --by session --since 1w`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			groupBy, err := usage.ParseGroupBy(by)
+			if err != nil {
+				return err
+			}
+
+			var from time.Time
+			if since != "" {
+				age, err := parseAge(since)
+				if err != nil {
+					return err
+				}
+				from = time.Now().Add(-age)
+			}
+
+			rows, err := q.Usage(groupBy, from)
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				fmt.Println("No usage recorded.")
+				return nil
+			}
+
+			printUsageRows(string(groupBy), rows)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&by, "by", string(usage.GroupByDay), "Group by day, model or session")
+	cmd.Flags().StringVar(&since, "since", "", "Only include usage newer than this age (e.g. 30d, 2w, 12h)")
+
+	return cmd
+}
+
+func printUsageRows(keyTitle string, rows []usage.Row) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tREQUESTS\tPROMPT\tCOMPLETION\tREASONING\tEST. COST\t\n", strings.ToUpper(keyTitle))
+
+	unpriced := false
+	writeRow := func(row usage.Row) {
+		cost := fmt.Sprintf("$%.4f", row.Cost)
+		if row.Unpriced > 0 {
+			cost += "*"
+			unpriced = true
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t\n",
+			row.Key, row.Requests,
+			row.Usage.PromptTokens, row.Usage.CompletionTokens, row.Usage.ReasoningTokens,
+			cost)
+	}
+
+	for _, row := range rows {
+		writeRow(row)
+	}
+	if len(rows) > 1 {
+		writeRow(usage.Total(rows))
+	}
+	w.Flush()
+
+	if unpriced {
+		fmt.Println("\n* includes requests to models without a known price (see \"qory config prices\")")
+	}
+}
@@ -5,18 +5,38 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/input"
+	"github.com/dtrugman/qory/lib/usage"
+	"github.com/dtrugman/qory/lib/window"
 )
 
 const (
-	DefaultHistorySize = 50
-	DefaultEditor      = "vi"
+	DefaultHistorySize   = 50
+	DefaultEditor        = "vi"
+	DefaultRetryAttempts = 3
+	DefaultRetryDelay    = time.Second
+
+	DefaultProvider        = ProviderOpenAI
+	DefaultContextStrategy = ContextTruncate
+	DefaultInputFormat     = input.FormatMarkdown
+	DefaultInputMode       = input.ModeGuess
 )
 
 // Config is the application configuration layer. It wraps FileStorage and
 // provides typed accessors with defaults, env-var resolution, and validation.
 // All getters return an Origin indicating where the value came from.
+//
+// Values are scoped by profile: keys set in the active profile override the
+// ones stored in the default profile (the top-level config directory).
 type Config struct {
 	storage *FileStorage
+
+	profile       *FileStorage // nil when the default profile is active
+	profileName   string
+	profileOrigin Origin
 }
 
 func NewConfig(userDir string) (*Config, error) {
@@ -24,7 +44,15 @@ func NewConfig(userDir string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Config{storage: storage}, nil
+	c := &Config{
+		storage:       storage,
+		profileName:   ProfileDefault,
+		profileOrigin: OriginDefault,
+	}
+	if err := c.resolveProfile(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 func (c *Config) GetConfigSubdir(name string) (string, error) {
@@ -43,28 +71,28 @@ func (c *Config) Editor() (string, Origin, error) {
 	if ed := os.Getenv("EDITOR"); ed != "" {
 		return ed, OriginEnv, nil
 	}
-	v, err := c.storage.Get(Editor)
+	v, origin, err := c.get(Editor)
 	if err != nil {
 		return "", OriginNotSet, err
 	}
 	if v != nil && *v != "" {
-		return *v, OriginUser, nil
+		return *v, origin, nil
 	}
 	return DefaultEditor, OriginDefault, nil
 }
 
 func (c *Config) SetEditor(value string) error {
-	return c.storage.Set(Editor, value)
+	return c.store().Set(Editor, value)
 }
 
 func (c *Config) UnsetEditor() error {
-	return c.storage.Unset(Editor)
+	return c.store().Unset(Editor)
 }
 
 // HistorySize returns the number of unnamed sessions to retain.
 // Falls back to DefaultHistorySize when not configured.
 func (c *Config) HistorySize() (int, Origin, error) {
-	v, err := c.storage.Get(HistorySize)
+	v, origin, err := c.get(HistorySize)
 	if err != nil {
 		return 0, OriginNotSet, err
 	}
@@ -73,9 +101,9 @@ func (c *Config) HistorySize() (int, Origin, error) {
 	}
 	size, err := strconv.Atoi(*v)
 	if err != nil {
-		return 0, OriginUser, fmt.Errorf("invalid history size %q: %w", *v, err)
+		return 0, origin, fmt.Errorf("invalid history size %q: %w", *v, err)
 	}
-	return size, OriginUser, nil
+	return size, origin, nil
 }
 
 func (c *Config) SetHistorySize(value string) error {
@@ -83,11 +111,69 @@ func (c *Config) SetHistorySize(value string) error {
 	if err != nil || size <= 0 {
 		return fmt.Errorf("invalid history size %q: must be a positive integer", value)
 	}
-	return c.storage.Set(HistorySize, value)
+	return c.store().Set(HistorySize, value)
 }
 
 func (c *Config) UnsetHistorySize() error {
-	return c.storage.Unset(HistorySize)
+	return c.store().Unset(HistorySize)
+}
+
+// RetryAttempts returns the maximum number of attempts made for a query that
+// fails with a transient provider error. Falls back to DefaultRetryAttempts.
+func (c *Config) RetryAttempts() (int, Origin, error) {
+	v, origin, err := c.get(RetryAttempts)
+	if err != nil {
+		return 0, OriginNotSet, err
+	}
+	if v == nil {
+		return DefaultRetryAttempts, OriginDefault, nil
+	}
+	attempts, err := strconv.Atoi(*v)
+	if err != nil {
+		return 0, origin, fmt.Errorf("invalid retry attempts %q: %w", *v, err)
+	}
+	return attempts, origin, nil
+}
+
+func (c *Config) SetRetryAttempts(value string) error {
+	attempts, err := strconv.Atoi(value)
+	if err != nil || attempts <= 0 {
+		return fmt.Errorf("invalid retry attempts %q: must be a positive integer", value)
+	}
+	return c.store().Set(RetryAttempts, value)
+}
+
+func (c *Config) UnsetRetryAttempts() error {
+	return c.store().Unset(RetryAttempts)
+}
+
+// RetryDelay returns the base delay of the exponential retry backoff.
+// Falls back to DefaultRetryDelay.
+func (c *Config) RetryDelay() (time.Duration, Origin, error) {
+	v, origin, err := c.get(RetryDelay)
+	if err != nil {
+		return 0, OriginNotSet, err
+	}
+	if v == nil {
+		return DefaultRetryDelay, OriginDefault, nil
+	}
+	delay, err := time.ParseDuration(*v)
+	if err != nil {
+		return 0, origin, fmt.Errorf("invalid retry delay %q: %w", *v, err)
+	}
+	return delay, origin, nil
+}
+
+func (c *Config) SetRetryDelay(value string) error {
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay <= 0 {
+		return fmt.Errorf("invalid retry delay %q: must be a positive duration (e.g. 500ms, 2s)", value)
+	}
+	return c.store().Set(RetryDelay, value)
+}
+
+func (c *Config) UnsetRetryDelay() error {
+	return c.store().Unset(RetryDelay)
 }
 
 func (c *Config) Mode() (string, Origin, error) {
@@ -101,11 +187,38 @@ func (c *Config) SetMode(value string) error {
 	default:
 		return fmt.Errorf("invalid mode %q", value)
 	}
-	return c.storage.Set(Mode, value)
+	return c.store().Set(Mode, value)
 }
 
 func (c *Config) UnsetMode() error {
-	return c.storage.Unset(Mode)
+	return c.store().Unset(Mode)
+}
+
+// Provider returns the API spoken to the model provider. Falls back to
+// DefaultProvider.
+func (c *Config) Provider() (string, Origin, error) {
+	v, origin, err := c.getNoDefault(Provider)
+	if err != nil {
+		return "", OriginNotSet, err
+	}
+	if origin == OriginNotSet {
+		return DefaultProvider, OriginDefault, nil
+	}
+	return v, origin, nil
+}
+
+func (c *Config) SetProvider(value string) error {
+	switch value {
+	case ProviderOpenAI, ProviderAnthropic:
+		// valid
+	default:
+		return fmt.Errorf("invalid provider %q", value)
+	}
+	return c.store().Set(Provider, value)
+}
+
+func (c *Config) UnsetProvider() error {
+	return c.store().Unset(Provider)
 }
 
 func (c *Config) APIKey() (string, Origin, error) {
@@ -113,11 +226,11 @@ func (c *Config) APIKey() (string, Origin, error) {
 }
 
 func (c *Config) SetAPIKey(value string) error {
-	return c.storage.Set(APIKey, value)
+	return c.store().Set(APIKey, value)
 }
 
 func (c *Config) UnsetAPIKey() error {
-	return c.storage.Unset(APIKey)
+	return c.store().Unset(APIKey)
 }
 
 func (c *Config) BaseURL() (string, Origin, error) {
@@ -128,11 +241,11 @@ func (c *Config) SetBaseURL(value string) error {
 	if !strings.HasSuffix(value, "/") {
 		value = value + "/"
 	}
-	return c.storage.Set(BaseURL, value)
+	return c.store().Set(BaseURL, value)
 }
 
 func (c *Config) UnsetBaseURL() error {
-	return c.storage.Unset(BaseURL)
+	return c.store().Unset(BaseURL)
 }
 
 func (c *Config) Model() (string, Origin, error) {
@@ -140,11 +253,25 @@ func (c *Config) Model() (string, Origin, error) {
 }
 
 func (c *Config) SetModel(value string) error {
-	return c.storage.Set(Model, value)
+	return c.store().Set(Model, value)
 }
 
 func (c *Config) UnsetModel() error {
-	return c.storage.Unset(Model)
+	return c.store().Unset(Model)
+}
+
+// TitleModel is the model used to generate session titles. Titles are not
+// generated when it is not set.
+func (c *Config) TitleModel() (string, Origin, error) {
+	return c.getNoDefault(TitleModel)
+}
+
+func (c *Config) SetTitleModel(value string) error {
+	return c.store().Set(TitleModel, value)
+}
+
+func (c *Config) UnsetTitleModel() error {
+	return c.store().Unset(TitleModel)
 }
 
 func (c *Config) Prompt() (string, Origin, error) {
@@ -152,22 +279,238 @@ func (c *Config) Prompt() (string, Origin, error) {
 }
 
 func (c *Config) SetPrompt(value string) error {
-	return c.storage.Set(Prompt, value)
+	return c.store().Set(Prompt, value)
 }
 
 func (c *Config) UnsetPrompt() error {
-	return c.storage.Unset(Prompt)
+	return c.store().Unset(Prompt)
+}
+
+// Temperature returns the default sampling temperature.
+// Returns OriginNotSet when the provider's default should be used.
+func (c *Config) Temperature() (float64, Origin, error) {
+	return getParsed(c, Temperature, generation.ParseTemperature)
+}
+
+func (c *Config) SetTemperature(value string) error {
+	return setParsed(c, Temperature, value, generation.ParseTemperature)
+}
+
+func (c *Config) UnsetTemperature() error {
+	return c.store().Unset(Temperature)
+}
+
+// TopP returns the default nucleus sampling probability mass.
+func (c *Config) TopP() (float64, Origin, error) {
+	return getParsed(c, TopP, generation.ParseTopP)
+}
+
+func (c *Config) SetTopP(value string) error {
+	return setParsed(c, TopP, value, generation.ParseTopP)
+}
+
+func (c *Config) UnsetTopP() error {
+	return c.store().Unset(TopP)
+}
+
+// MaxTokens returns the default cap on generated tokens.
+func (c *Config) MaxTokens() (int64, Origin, error) {
+	return getParsed(c, MaxTokens, generation.ParseMaxTokens)
+}
+
+func (c *Config) SetMaxTokens(value string) error {
+	return setParsed(c, MaxTokens, value, generation.ParseMaxTokens)
+}
+
+func (c *Config) UnsetMaxTokens() error {
+	return c.store().Unset(MaxTokens)
+}
+
+// Seed returns the default sampling seed.
+func (c *Config) Seed() (int64, Origin, error) {
+	return getParsed(c, Seed, generation.ParseSeed)
+}
+
+func (c *Config) SetSeed(value string) error {
+	return setParsed(c, Seed, value, generation.ParseSeed)
+}
+
+func (c *Config) UnsetSeed() error {
+	return c.store().Unset(Seed)
+}
+
+// ReasoningEffort returns the default reasoning effort for reasoning models.
+func (c *Config) ReasoningEffort() (string, Origin, error) {
+	return getParsed(c, ReasoningEffort, generation.ParseReasoningEffort)
+}
+
+func (c *Config) SetReasoningEffort(value string) error {
+	return setParsed(c, ReasoningEffort, value, generation.ParseReasoningEffort)
+}
+
+func (c *Config) UnsetReasoningEffort() error {
+	return c.store().Unset(ReasoningEffort)
+}
+
+// Prices returns the user's per-model price table as raw JSON. Entries
+// override the built-in table used for cost estimates.
+func (c *Config) Prices() (string, Origin, error) {
+	return c.getNoDefault(Prices)
+}
+
+func (c *Config) SetPrices(value string) error {
+	return setParsed(c, Prices, value, usage.ParsePrices)
+}
+
+func (c *Config) UnsetPrices() error {
+	return c.store().Unset(Prices)
+}
+
+// InputFormat returns how files and piped input are marked up in questions.
+// Falls back to DefaultInputFormat.
+func (c *Config) InputFormat() (string, Origin, error) {
+	format, origin, err := getParsed(c, InputFormat, input.ParseFormat)
+	if err != nil {
+		return "", origin, err
+	}
+	if origin == OriginNotSet {
+		return string(DefaultInputFormat), OriginDefault, nil
+	}
+	return string(format), origin, nil
+}
+
+func (c *Config) SetInputFormat(value string) error {
+	return setParsed(c, InputFormat, value, input.ParseFormat)
+}
+
+func (c *Config) UnsetInputFormat() error {
+	return c.store().Unset(InputFormat)
+}
+
+// InputMode returns how plain arguments are told apart from file paths.
+// Falls back to DefaultInputMode.
+func (c *Config) InputMode() (string, Origin, error) {
+	mode, origin, err := getParsed(c, InputMode, input.ParseMode)
+	if err != nil {
+		return "", origin, err
+	}
+	if origin == OriginNotSet {
+		return string(DefaultInputMode), OriginDefault, nil
+	}
+	return string(mode), origin, nil
+}
+
+func (c *Config) SetInputMode(value string) error {
+	return setParsed(c, InputMode, value, input.ParseMode)
+}
+
+func (c *Config) UnsetInputMode() error {
+	return c.store().Unset(InputMode)
+}
+
+// ContextStrategy returns how sessions that outgrow the model's context window
+// are compacted. Falls back to DefaultContextStrategy.
+func (c *Config) ContextStrategy() (string, Origin, error) {
+	v, origin, err := c.getNoDefault(ContextStrategy)
+	if err != nil {
+		return "", OriginNotSet, err
+	}
+	if origin == OriginNotSet {
+		return DefaultContextStrategy, OriginDefault, nil
+	}
+	return v, origin, nil
+}
+
+func (c *Config) SetContextStrategy(value string) error {
+	switch value {
+	case ContextTruncate, ContextSummarize, ContextOff:
+		// valid
+	default:
+		return fmt.Errorf("invalid context strategy %q", value)
+	}
+	return c.store().Set(ContextStrategy, value)
+}
+
+func (c *Config) UnsetContextStrategy() error {
+	return c.store().Unset(ContextStrategy)
+}
+
+// ContextSizes returns the user's per-model context size table as raw JSON.
+// Entries override the built-in table.
+func (c *Config) ContextSizes() (string, Origin, error) {
+	return c.getNoDefault(ContextSizes)
+}
+
+func (c *Config) SetContextSizes(value string) error {
+	return setParsed(c, ContextSizes, value, window.ParseSizes)
+}
+
+func (c *Config) UnsetContextSizes() error {
+	return c.store().Unset(ContextSizes)
+}
+
+// get reads key from the active profile, falling back to the default profile.
+// Returns (nil, OriginNotSet, nil) when the key has not been set in either.
+func (c *Config) get(key string) (*string, Origin, error) {
+	if c.profile != nil {
+		v, err := c.profile.Get(key)
+		if err != nil {
+			return nil, OriginNotSet, err
+		}
+		if v != nil {
+			return v, OriginProfile, nil
+		}
+	}
+	v, err := c.storage.Get(key)
+	if err != nil {
+		return nil, OriginNotSet, err
+	}
+	if v == nil {
+		return nil, OriginNotSet, nil
+	}
+	return v, OriginUser, nil
+}
+
+// store returns the storage that setters write to: the active profile.
+func (c *Config) store() *FileStorage {
+	if c.profile != nil {
+		return c.profile
+	}
+	return c.storage
+}
+
+// getParsed reads key and converts it with parse.
+// Returns the zero value and OriginNotSet when the key has not been set.
+func getParsed[T any](c *Config, key string, parse func(string) (T, error)) (T, Origin, error) {
+	var zero T
+	v, origin, err := c.get(key)
+	if err != nil || v == nil {
+		return zero, origin, err
+	}
+	parsed, err := parse(*v)
+	if err != nil {
+		return zero, origin, err
+	}
+	return parsed, origin, nil
+}
+
+// setParsed validates value with parse before storing it.
+func setParsed[T any](c *Config, key string, value string, parse func(string) (T, error)) error {
+	if _, err := parse(value); err != nil {
+		return err
+	}
+	return c.store().Set(key, value)
 }
 
 // getNoDefault reads a value from storage.
 // Returns ("", OriginNotSet, nil) when the key has not been set.
 func (c *Config) getNoDefault(key string) (string, Origin, error) {
-	v, err := c.storage.Get(key)
+	v, origin, err := c.get(key)
 	if err != nil {
 		return "", OriginNotSet, err
 	}
 	if v == nil {
 		return "", OriginNotSet, nil
 	}
-	return *v, OriginUser, nil
+	return *v, origin, nil
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -207,6 +208,51 @@ func TestConfig_SetHistorySize_RejectsNonInteger(t *testing.T) {
 	assert.Error(t, c.SetHistorySize("abc"))
 }
 
+func TestConfig_RetryAttempts_Default(t *testing.T) {
+	c := newTestConfig(t)
+	attempts, origin, err := c.RetryAttempts()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRetryAttempts, attempts)
+	assert.Equal(t, OriginDefault, origin)
+}
+
+func TestConfig_RetryAttempts_StoredValue(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetRetryAttempts("5"))
+	attempts, origin, err := c.RetryAttempts()
+	require.NoError(t, err)
+	assert.Equal(t, 5, attempts)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestConfig_SetRetryAttempts_RejectsZero(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetRetryAttempts("0"))
+}
+
+func TestConfig_RetryDelay_Default(t *testing.T) {
+	c := newTestConfig(t)
+	delay, origin, err := c.RetryDelay()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRetryDelay, delay)
+	assert.Equal(t, OriginDefault, origin)
+}
+
+func TestConfig_RetryDelay_StoredValue(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetRetryDelay("250ms"))
+	delay, origin, err := c.RetryDelay()
+	require.NoError(t, err)
+	assert.Equal(t, 250*time.Millisecond, delay)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestConfig_SetRetryDelay_RejectsInvalid(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetRetryDelay("soon"))
+	assert.Error(t, c.SetRetryDelay("-1s"))
+}
+
 func TestConfig_SetMode_AcceptsValid(t *testing.T) {
 	for _, v := range []string{ModeNew, ModeLast} {
 		t.Run(v, func(t *testing.T) {
@@ -265,3 +311,152 @@ func TestConfig_APIKey_Set(t *testing.T) {
 	assert.Equal(t, "sk-test", val)
 	assert.Equal(t, OriginUser, origin)
 }
+
+func TestConfig_SetPrices_RejectsInvalidJSON(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetPrices("gpt-4o: 2.5"))
+}
+
+func TestConfig_SetPrices_RejectsInvalidTables(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetPrices("5"))
+	assert.Error(t, c.SetPrices(`["gpt-4o"]`))
+	assert.Error(t, c.SetPrices(`{"gpt-4o": 2.5}`))
+	assert.Error(t, c.SetPrices(`{"gpt-4o": {"input": -1, "output": 10}}`))
+
+	_, origin, err := c.Prices()
+	require.NoError(t, err)
+	assert.Equal(t, OriginNotSet, origin)
+}
+
+func TestConfig_Prices_Set(t *testing.T) {
+	c := newTestConfig(t)
+	table := `{"gpt-4o": {"input": 2.5, "output": 10}}`
+	require.NoError(t, c.SetPrices(table))
+	val, origin, err := c.Prices()
+	require.NoError(t, err)
+	assert.Equal(t, table, val)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestConfig_InputFormat_Default(t *testing.T) {
+	c := newTestConfig(t)
+	format, origin, err := c.InputFormat()
+	require.NoError(t, err)
+	assert.Equal(t, "markdown", format)
+	assert.Equal(t, OriginDefault, origin)
+}
+
+func TestConfig_InputFormat_StoredValue(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetInputFormat("xml"))
+	format, origin, err := c.InputFormat()
+	require.NoError(t, err)
+	assert.Equal(t, "xml", format)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestConfig_SetInputFormat_RejectsInvalid(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetInputFormat("yaml"))
+}
+
+func TestConfig_InputMode_Default(t *testing.T) {
+	c := newTestConfig(t)
+	mode, origin, err := c.InputMode()
+	require.NoError(t, err)
+	assert.Equal(t, "guess", mode)
+	assert.Equal(t, OriginDefault, origin)
+}
+
+func TestConfig_SetInputMode_RejectsInvalid(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetInputMode("lenient"))
+}
+
+func TestConfig_Provider_Default(t *testing.T) {
+	c := newTestConfig(t)
+	provider, origin, err := c.Provider()
+	require.NoError(t, err)
+	assert.Equal(t, ProviderOpenAI, provider)
+	assert.Equal(t, OriginDefault, origin)
+}
+
+func TestConfig_Provider_StoredValue(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetProvider(ProviderAnthropic))
+	provider, origin, err := c.Provider()
+	require.NoError(t, err)
+	assert.Equal(t, ProviderAnthropic, provider)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestConfig_SetProvider_RejectsInvalid(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetProvider("acme"))
+}
+
+func TestConfig_ContextStrategy_Default(t *testing.T) {
+	c := newTestConfig(t)
+	strategy, origin, err := c.ContextStrategy()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultContextStrategy, strategy)
+	assert.Equal(t, OriginDefault, origin)
+}
+
+func TestConfig_ContextStrategy_StoredValue(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetContextStrategy(ContextSummarize))
+	strategy, origin, err := c.ContextStrategy()
+	require.NoError(t, err)
+	assert.Equal(t, ContextSummarize, strategy)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestConfig_SetContextStrategy_RejectsInvalid(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetContextStrategy("forget"))
+}
+
+func TestConfig_SetContextSizes_RejectsInvalidJSON(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetContextSizes("{"))
+}
+
+func TestConfig_SetContextSizes_RejectsInvalidTables(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetContextSizes("8192"))
+	assert.Error(t, c.SetContextSizes(`{"llama3": 0}`))
+	assert.Error(t, c.SetContextSizes(`{"llama3": "8k"}`))
+
+	_, origin, err := c.ContextSizes()
+	require.NoError(t, err)
+	assert.Equal(t, OriginNotSet, origin)
+}
+
+func TestConfig_Temperature_NotSet(t *testing.T) {
+	c := newTestConfig(t)
+	_, origin, err := c.Temperature()
+	require.NoError(t, err)
+	assert.Equal(t, OriginNotSet, origin)
+}
+
+func TestConfig_Temperature_Set(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetTemperature("0.2"))
+	val, origin, err := c.Temperature()
+	require.NoError(t, err)
+	assert.Equal(t, 0.2, val)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestConfig_SetTemperature_RejectsOutOfRange(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetTemperature("3"))
+}
+
+func TestConfig_SetReasoningEffort_RejectsInvalid(t *testing.T) {
+	c := newTestConfig(t)
+	assert.Error(t, c.SetReasoningEffort("max"))
+	require.NoError(t, c.SetReasoningEffort("low"))
+}
@@ -9,13 +9,36 @@ const (
 )
 
 const ( // Public configuration keys
+	Provider    = "provider"
 	APIKey      = "api_key"
 	BaseURL     = "base_url"
 	Model       = "model"
+	TitleModel  = "title_model"
 	Prompt      = "prompt"
 	Mode        = "mode"
 	Editor      = "editor"
 	HistorySize = "history_size"
+
+	Prices = "prices"
+
+	InputFormat = "input_format"
+	InputMode   = "input_mode"
+
+	ContextStrategy = "context_strategy"
+	ContextSizes    = "context_sizes"
+
+	Temperature     = "temperature"
+	TopP            = "top_p"
+	MaxTokens       = "max_tokens"
+	Seed            = "seed"
+	ReasoningEffort = "reasoning_effort"
+
+	// Profile holds the default profile name. It is only ever read from and
+	// written to the top-level config directory, never from a profile.
+	Profile = "profile"
+
+	RetryAttempts = "retry_attempts"
+	RetryDelay    = "retry_delay"
 )
 
 const ( // Valid values for Mode
@@ -23,6 +46,17 @@ const ( // Valid values for Mode
 	ModeLast = "last"
 )
 
+const ( // Valid values for Provider
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+)
+
+const ( // Valid values for ContextStrategy
+	ContextTruncate  = "truncate"
+	ContextSummarize = "summarize"
+	ContextOff       = "off"
+)
+
 // FileStorage persists each configuration value as a separate file under the
 // application config directory.
 type FileStorage struct {
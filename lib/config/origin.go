@@ -8,6 +8,8 @@ const (
 	OriginDefault               // built-in default is being used
 	OriginUser                  // explicitly set in the config file
 	OriginEnv                   // sourced from an environment variable
+	OriginProfile               // explicitly set in the active, non-default profile
+	OriginFlag                  // given on the command line
 )
 
 func (o Origin) String() string {
@@ -20,6 +22,10 @@ func (o Origin) String() string {
 		return "Set by user"
 	case OriginEnv:
 		return "From env"
+	case OriginProfile:
+		return "Set in profile"
+	case OriginFlag:
+		return "From flag"
 	default:
 		return "Unknown"
 	}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+const (
+	// ProfileDefault names the implicit profile backed by the top-level config
+	// directory. It always exists and cannot be removed.
+	ProfileDefault = "default"
+
+	// EnvProfile selects the active profile, overriding the stored default.
+	EnvProfile = "QORY_PROFILE"
+
+	profilesDirName = "profiles"
+)
+
+var (
+	ErrInvalidProfile  = errors.New("invalid profile name")
+	ErrProfileNotFound = errors.New("unknown profile")
+	ErrProfileExists   = errors.New("profile already exists")
+)
+
+var (
+	validProfileRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+func (c *Config) profilesDir() (string, error) {
+	return c.storage.GetConfigSubdir(profilesDirName)
+}
+
+func (c *Config) profileDir(name string) (string, error) {
+	if !validProfileRegexp.MatchString(name) {
+		return "", ErrInvalidProfile
+	}
+	dir, err := c.profilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func (c *Config) profileExists(name string) (bool, error) {
+	if name == ProfileDefault {
+		return true, nil
+	}
+	dir, err := c.profileDir(name)
+	if err != nil {
+		return false, err
+	}
+	stat, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return stat.IsDir(), nil
+}
+
+// resolveProfile activates the profile selected by $QORY_PROFILE or, failing
+// that, the stored default profile. A selected profile that doesn't exist,
+// e.g. because it was removed by hand, leaves the default profile active
+// with a warning, so that "qory config profile" can still set things right.
+func (c *Config) resolveProfile() error {
+	name, origin := os.Getenv(EnvProfile), OriginEnv
+	if name == "" {
+		v, err := c.storage.Get(Profile)
+		if err != nil {
+			return err
+		}
+		if v == nil || *v == "" {
+			return nil
+		}
+		name, origin = *v, OriginUser
+	}
+
+	err := c.activateProfile(name, origin)
+	if errors.Is(err, ErrProfileNotFound) || errors.Is(err, ErrInvalidProfile) {
+		fmt.Fprintf(os.Stderr, "Warning: %v; using the %s profile\n", err, ProfileDefault)
+		return nil
+	}
+	return err
+}
+
+func (c *Config) activateProfile(name string, origin Origin) error {
+	exists, err := c.profileExists(name)
+	if err != nil {
+		return fmt.Errorf("profile %q: %w", name, err)
+	}
+	if !exists {
+		return fmt.Errorf("profile %q: %w", name, ErrProfileNotFound)
+	}
+
+	if name == ProfileDefault {
+		c.profile = nil
+	} else {
+		dir, err := c.profileDir(name)
+		if err != nil {
+			return err
+		}
+		c.profile = &FileStorage{dir: dir}
+	}
+	c.profileName = name
+	c.profileOrigin = origin
+	return nil
+}
+
+// UseProfile activates the named profile for the lifetime of this Config,
+// taking precedence over $QORY_PROFILE and the stored default.
+func (c *Config) UseProfile(name string) error {
+	return c.activateProfile(name, OriginFlag)
+}
+
+// Profile returns the name of the active profile and how it was selected.
+func (c *Config) Profile() (string, Origin) {
+	return c.profileName, c.profileOrigin
+}
+
+// Profiles returns the names of all profiles, including the default one.
+func (c *Config) Profiles() ([]string, error) {
+	dir, err := c.profilesDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{ProfileDefault}
+	for _, entry := range entries {
+		if entry.IsDir() && validProfileRegexp.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names[1:])
+	return names, nil
+}
+
+// AddProfile creates a new, empty profile. Keys not set in a profile fall
+// back to the default profile's values.
+func (c *Config) AddProfile(name string) error {
+	if name == ProfileDefault {
+		return ErrProfileExists
+	}
+	exists, err := c.profileExists(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrProfileExists
+	}
+	dir, err := c.profileDir(name)
+	if err != nil {
+		return err
+	}
+	_, err = getOrCreateDir(dir)
+	return err
+}
+
+// RemoveProfile deletes a profile and all of its stored values. If it was
+// the stored default, the default profile becomes the default again.
+func (c *Config) RemoveProfile(name string) error {
+	if name == ProfileDefault {
+		return fmt.Errorf("the %s profile cannot be removed", ProfileDefault)
+	}
+	exists, err := c.profileExists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrProfileNotFound
+	}
+	dir, err := c.profileDir(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	stored, _, err := c.DefaultProfile()
+	if err != nil {
+		return err
+	}
+	if stored == name {
+		return c.storage.Unset(Profile)
+	}
+	return nil
+}
+
+// DefaultProfile returns the profile used when neither --profile nor
+// $QORY_PROFILE is given.
+func (c *Config) DefaultProfile() (string, Origin, error) {
+	v, err := c.storage.Get(Profile)
+	if err != nil {
+		return "", OriginNotSet, err
+	}
+	if v == nil || *v == "" {
+		return ProfileDefault, OriginDefault, nil
+	}
+	return *v, OriginUser, nil
+}
+
+func (c *Config) SetDefaultProfile(name string) error {
+	exists, err := c.profileExists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrProfileNotFound
+	}
+	if name == ProfileDefault {
+		return c.UnsetDefaultProfile()
+	}
+	return c.storage.Set(Profile, name)
+}
+
+func (c *Config) UnsetDefaultProfile() error {
+	err := c.storage.Unset(Profile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfigAt(t *testing.T, dir string) *Config {
+	t.Helper()
+	c, err := NewConfig(dir)
+	require.NoError(t, err)
+	return c
+}
+
+func TestProfile_DefaultWhenNothingSelected(t *testing.T) {
+	t.Setenv(EnvProfile, "")
+	c := newTestConfig(t)
+
+	name, origin := c.Profile()
+	assert.Equal(t, ProfileDefault, name)
+	assert.Equal(t, OriginDefault, origin)
+}
+
+func TestProfile_AddAndList(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.AddProfile("work"))
+	require.NoError(t, c.AddProfile("local"))
+
+	names, err := c.Profiles()
+	require.NoError(t, err)
+	assert.Equal(t, []string{ProfileDefault, "local", "work"}, names)
+}
+
+func TestProfile_AddRejectsDuplicatesAndInvalidNames(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.AddProfile("work"))
+	assert.ErrorIs(t, c.AddProfile("work"), ErrProfileExists)
+	assert.ErrorIs(t, c.AddProfile(ProfileDefault), ErrProfileExists)
+	assert.ErrorIs(t, c.AddProfile("../etc"), ErrInvalidProfile)
+}
+
+func TestProfile_UseUnknownFails(t *testing.T) {
+	c := newTestConfig(t)
+	assert.ErrorIs(t, c.UseProfile("missing"), ErrProfileNotFound)
+}
+
+func TestProfile_ValuesAreScoped(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetModel("gpt-4o"))
+	require.NoError(t, c.AddProfile("local"))
+
+	require.NoError(t, c.UseProfile("local"))
+	require.NoError(t, c.SetModel("llama3"))
+
+	val, origin, err := c.Model()
+	require.NoError(t, err)
+	assert.Equal(t, "llama3", val)
+	assert.Equal(t, OriginProfile, origin)
+
+	require.NoError(t, c.UseProfile(ProfileDefault))
+	val, origin, err = c.Model()
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", val)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestProfile_FallsBackToDefaultProfile(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetAPIKey("sk-default"))
+	require.NoError(t, c.AddProfile("work"))
+	require.NoError(t, c.UseProfile("work"))
+
+	val, origin, err := c.APIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "sk-default", val)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestProfile_UnsetOnlyAffectsActiveProfile(t *testing.T) {
+	c := newTestConfig(t)
+	require.NoError(t, c.SetHistorySize("10"))
+	require.NoError(t, c.AddProfile("work"))
+	require.NoError(t, c.UseProfile("work"))
+	require.NoError(t, c.SetHistorySize("20"))
+	require.NoError(t, c.UnsetHistorySize())
+
+	size, origin, err := c.HistorySize()
+	require.NoError(t, err)
+	assert.Equal(t, 10, size)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestProfile_EnvVarSelectsProfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvProfile, "")
+	require.NoError(t, newTestConfigAt(t, dir).AddProfile("work"))
+
+	t.Setenv(EnvProfile, "work")
+	c := newTestConfigAt(t, dir)
+
+	name, origin := c.Profile()
+	assert.Equal(t, "work", name)
+	assert.Equal(t, OriginEnv, origin)
+}
+
+func TestProfile_EnvVarUnknownProfileFallsBackToDefault(t *testing.T) {
+	t.Setenv(EnvProfile, "missing")
+	c, err := NewConfig(t.TempDir())
+	require.NoError(t, err)
+
+	name, origin := c.Profile()
+	assert.Equal(t, ProfileDefault, name)
+	assert.Equal(t, OriginDefault, origin)
+}
+
+func TestProfile_DeletedStoredProfileFallsBackToDefault(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvProfile, "")
+	c := newTestConfigAt(t, dir)
+	require.NoError(t, c.AddProfile("work"))
+	require.NoError(t, c.SetDefaultProfile("work"))
+	profiles, err := c.profilesDir()
+	require.NoError(t, err)
+	require.NoError(t, os.RemoveAll(filepath.Join(profiles, "work")))
+
+	c = newTestConfigAt(t, dir)
+	name, origin := c.Profile()
+	assert.Equal(t, ProfileDefault, name)
+	assert.Equal(t, OriginDefault, origin)
+
+	// The profile commands needed to recover still work.
+	require.NoError(t, c.SetDefaultProfile(ProfileDefault))
+	require.NoError(t, c.AddProfile("work"))
+}
+
+func TestProfile_StoredDefaultSelectsProfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvProfile, "")
+	c := newTestConfigAt(t, dir)
+	require.NoError(t, c.AddProfile("work"))
+	require.NoError(t, c.SetDefaultProfile("work"))
+
+	c = newTestConfigAt(t, dir)
+	name, origin := c.Profile()
+	assert.Equal(t, "work", name)
+	assert.Equal(t, OriginUser, origin)
+}
+
+func TestProfile_FlagOverridesEnvVar(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvProfile, "")
+	c := newTestConfigAt(t, dir)
+	require.NoError(t, c.AddProfile("work"))
+	require.NoError(t, c.AddProfile("local"))
+
+	t.Setenv(EnvProfile, "work")
+	c = newTestConfigAt(t, dir)
+	require.NoError(t, c.UseProfile("local"))
+
+	name, origin := c.Profile()
+	assert.Equal(t, "local", name)
+	assert.Equal(t, OriginFlag, origin)
+}
+
+func TestProfile_RemoveClearsStoredDefault(t *testing.T) {
+	t.Setenv(EnvProfile, "")
+	c := newTestConfig(t)
+	require.NoError(t, c.AddProfile("work"))
+	require.NoError(t, c.SetDefaultProfile("work"))
+	require.NoError(t, c.RemoveProfile("work"))
+
+	name, origin, err := c.DefaultProfile()
+	require.NoError(t, err)
+	assert.Equal(t, ProfileDefault, name)
+	assert.Equal(t, OriginDefault, origin)
+
+	assert.ErrorIs(t, c.RemoveProfile("work"), ErrProfileNotFound)
+	assert.Error(t, c.RemoveProfile(ProfileDefault))
+}
@@ -21,9 +21,26 @@ func Edit(editorBin string) (string, error) {
 	return string(bytes), nil
 }
 
+// EditText is like Edit, but the editor starts out with initial as the file
+// content.
+func EditText(editorBin, initial string) (string, error) {
+	bytes, err := open(editorBin, []byte(initial))
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(bytes)) == "" {
+		return "", nil
+	}
+	return string(bytes), nil
+}
+
 // Open opens the given editor binary for editing and returns the result.
 func Open(editorBin string) ([]byte, error) {
-	path, cleanup, err := createEditFile()
+	return open(editorBin, nil)
+}
+
+func open(editorBin string, initial []byte) ([]byte, error) {
+	path, cleanup, err := createEditFile(initial)
 	if err != nil {
 		return nil, fmt.Errorf("create edit file: %w", err)
 	}
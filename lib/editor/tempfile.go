@@ -6,10 +6,10 @@ import (
 	"path/filepath"
 )
 
-// createEditFile returns the path the editor should open and a cleanup
-// function. The caller must invoke cleanup after reading back the edited
+// createEditFile returns the path the editor should open, holding initial,
+// and a cleanup function. The caller must invoke cleanup after reading back the edited
 // content.
-func createEditFile() (string, func(), error) {
+func createEditFile(initial []byte) (string, func(), error) {
 	dir, err := os.MkdirTemp("", "editor-scratch-*")
 	if err != nil {
 		return "", nil, fmt.Errorf("mkdirtemp: %w", err)
@@ -22,12 +22,17 @@ func createEditFile() (string, func(), error) {
 	}
 
 	path := filepath.Join(dir, "edit")
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL, 0600)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
 	if err != nil {
 		os.RemoveAll(dir)
 		return "", nil, fmt.Errorf("create tmpfile: %w", err)
 	}
+	_, err = f.Write(initial)
 	f.Close()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("write tmpfile: %w", err)
+	}
 
 	cleanup := func() { os.RemoveAll(dir) }
 	return path, cleanup, nil
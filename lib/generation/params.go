@@ -0,0 +1,118 @@
+package generation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Valid values for Params.ReasoningEffort
+const (
+	ReasoningEffortLow    = "low"
+	ReasoningEffortMedium = "medium"
+	ReasoningEffortHigh   = "high"
+)
+
+// Params are the generation settings sent with a query. Unset (nil or empty)
+// fields are omitted from the request, leaving the provider's defaults.
+type Params struct {
+	Model           string   `json:"model,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"top_p,omitempty"`
+	MaxTokens       *int64   `json:"max_tokens,omitempty"`
+	Stop            []string `json:"stop,omitempty"`
+	Seed            *int64   `json:"seed,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"`
+
+	// Format asks for answers in JSON. It applies to a single query and is
+	// not recorded in sessions.
+	Format *Format `json:"-"`
+}
+
+// Format constrains answers to JSON.
+type Format struct {
+	// Schema is the JSON Schema answers must match. Without one, answers
+	// only need to be a JSON object.
+	Schema json.RawMessage
+
+	// Name identifies the schema to the provider.
+	Name string
+}
+
+// Merge returns a copy of p where every field set in override replaces the
+// corresponding field of p.
+func (p Params) Merge(override Params) Params {
+	if override.Model != "" {
+		p.Model = override.Model
+	}
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		p.MaxTokens = override.MaxTokens
+	}
+	if len(override.Stop) > 0 {
+		p.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		p.Seed = override.Seed
+	}
+	if override.ReasoningEffort != "" {
+		p.ReasoningEffort = override.ReasoningEffort
+	}
+	if override.Format != nil {
+		p.Format = override.Format
+	}
+	return p
+}
+
+// IsZero reports whether no parameter is set.
+func (p Params) IsZero() bool {
+	return p.Model == "" && p.Temperature == nil && p.TopP == nil &&
+		p.MaxTokens == nil && len(p.Stop) == 0 && p.Seed == nil &&
+		p.ReasoningEffort == "" && p.Format == nil
+}
+
+func ParseTemperature(value string) (float64, error) {
+	t, err := strconv.ParseFloat(value, 64)
+	if err != nil || t < 0 || t > 2 {
+		return 0, fmt.Errorf("invalid temperature %q: must be a number between 0 and 2", value)
+	}
+	return t, nil
+}
+
+func ParseTopP(value string) (float64, error) {
+	p, err := strconv.ParseFloat(value, 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0, fmt.Errorf("invalid top_p %q: must be a number between 0 and 1", value)
+	}
+	return p, nil
+}
+
+func ParseMaxTokens(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid max tokens %q: must be a positive integer", value)
+	}
+	return n, nil
+}
+
+func ParseSeed(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seed %q: must be an integer", value)
+	}
+	return n, nil
+}
+
+func ParseReasoningEffort(value string) (string, error) {
+	switch value {
+	case ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh:
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid reasoning effort %q (expected low, medium or high)", value)
+	}
+}
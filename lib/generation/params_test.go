@@ -0,0 +1,46 @@
+package generation
+
+import (
+	"testing"
+
+	"github.com/dtrugman/qory/lib/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParams_MergeOverridesOnlySetFields(t *testing.T) {
+	base := Params{Model: "a", Temperature: util.Ptr(0.5), Seed: util.Ptr(int64(1))}
+	override := Params{Model: "b", MaxTokens: util.Ptr(int64(10))}
+
+	merged := base.Merge(override)
+	assert.Equal(t, Params{
+		Model:       "b",
+		Temperature: util.Ptr(0.5),
+		MaxTokens:   util.Ptr(int64(10)),
+		Seed:        util.Ptr(int64(1)),
+	}, merged)
+}
+
+func TestParams_IsZero(t *testing.T) {
+	assert.True(t, Params{}.IsZero())
+	assert.False(t, Params{Stop: []string{"x"}}.IsZero())
+}
+
+func TestParseTemperature_Range(t *testing.T) {
+	_, err := ParseTemperature("2.1")
+	assert.Error(t, err)
+	_, err = ParseTemperature("-0.1")
+	assert.Error(t, err)
+	v, err := ParseTemperature("0.3")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.3, v)
+}
+
+func TestParseMaxTokens_RejectsNonPositive(t *testing.T) {
+	_, err := ParseMaxTokens("0")
+	assert.Error(t, err)
+}
+
+func TestParseReasoningEffort_RejectsUnknown(t *testing.T) {
+	_, err := ParseReasoningEffort("extreme")
+	assert.Error(t, err)
+}
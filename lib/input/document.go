@@ -0,0 +1,86 @@
+package input
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrBinary  = errors.New("binary files are not supported (only text, PDF and DOCX files are)")
+	ErrExtract = errors.New("extract text")
+)
+
+// extractors convert documents to plain text, by file extension.
+var extractors = map[string]func([]byte) (string, error){
+	".pdf":  extractPDF,
+	".docx": extractDOCX,
+}
+
+// htmlExtensions name the HTML files, whose text is only extracted when
+// asked for.
+var htmlExtensions = []string{".html", ".htm", ".xhtml"}
+
+// Extraction says which documents have their text extracted. PDF and DOCX
+// files always do; HTML files are read as markup, like other source files,
+// unless HTML is set.
+type Extraction struct {
+	HTML bool
+}
+
+// IsDocument reports whether the file at path is a document whose text is
+// extracted rather than included as is, with the default Extraction.
+func IsDocument(path string) bool {
+	return Extraction{}.IsDocument(path)
+}
+
+// IsDocument reports whether the file at path is a document whose text is
+// extracted rather than included as is.
+func (e Extraction) IsDocument(path string) bool {
+	return e.extractor(path) != nil
+}
+
+func (e Extraction) extractor(path string) func([]byte) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if e.HTML && slices.Contains(htmlExtensions, ext) {
+		return extractHTML
+	}
+	return extractors[ext]
+}
+
+// toText returns the text of the file at path with the given content:
+// documents are converted, other binary files are rejected with ErrBinary.
+func (e Extraction) toText(path string, content []byte) ([]byte, error) {
+	extract := e.extractor(path)
+	if extract == nil {
+		if isBinary(content) {
+			return nil, ErrBinary
+		}
+		return content, nil
+	}
+
+	text, err := extract(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExtract, err)
+	}
+	return []byte(text), nil
+}
+
+var (
+	spaceRun     = regexp.MustCompile(`[ \t\f\v\r]+`)
+	blankLineRun = regexp.MustCompile(`\n{3,}`)
+)
+
+// tidyText collapses the whitespace left behind by extraction: runs of
+// spaces, trailing spaces and runs of blank lines.
+func tidyText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(spaceRun.ReplaceAllString(l, " "))
+	}
+	text = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLineRun.ReplaceAllString(text, "\n\n"))
+}
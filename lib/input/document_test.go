@@ -0,0 +1,285 @@
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildPDF assembles a PDF from the given objects, numbered from 1. Object 1
+// must be the catalog. The cross-reference table is left out: extraction
+// doesn't rely on it.
+func buildPDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func pdfStreamObj(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(t *testing.T, data string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func TestExtractPDF_Pages(t *testing.T) {
+	page1 := "BT /F1 12 Tf 72 720 Td (Hello, ) Tj [(wor) -20 (ld)] TJ 0 -14 Td (second \\(line\\)) Tj ET"
+	page2 := "BT /F1 12 Tf 72 720 Td [(spaced) -500 (out)] TJ T* (caf\\351) Tj ET"
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 7 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		pdfStreamObj("", []byte(page1)),
+		pdfStreamObj("/Filter /FlateDecode", deflate(t, page2)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+
+	text, err := extractPDF(pdf)
+	require.NoError(t, err)
+	assert.Equal(t, "--- Page 1 ---\nHello, world\nsecond (line)\n\n--- Page 2 ---\nspaced out\ncafé", text)
+}
+
+func TestExtractPDF_ToUnicode(t *testing.T) {
+	cmap := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+1 beginbfchar <0001> <0048> endbfchar
+1 beginbfrange <0002> <0003> <0069> endbfrange
+endcmap`
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		pdfStreamObj("", []byte("BT /F1 12 Tf <000100020003> Tj ET")),
+		"<< /Type /Font /Subtype /Type0 /ToUnicode 6 0 R >>",
+		pdfStreamObj("", []byte(cmap)),
+	)
+
+	text, err := extractPDF(pdf)
+	require.NoError(t, err)
+	assert.Equal(t, "--- Page 1 ---\nHij", text)
+}
+
+func TestExtractPDF_ObjectStream(t *testing.T) {
+	pages := "<< /Type /Pages /Kids [4 0 R] /Count 1 >>"
+	page := "<< /Type /Page /Parent 3 0 R /Contents 5 0 R >>"
+	header := fmt.Sprintf("3 0 4 %d ", len(pages)+1)
+	packed := header + pages + " " + page
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 3 0 R >>",
+		pdfStreamObj(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)), deflate(t, packed)),
+		"null",
+		"null",
+		pdfStreamObj("", []byte("BT (packed) Tj ET")),
+	)
+	// Objects 3 and 4 are only defined in the object stream.
+	pdf = bytes.Replace(pdf, []byte("3 0 obj\nnull\nendobj\n4 0 obj\nnull\nendobj\n"), nil, 1)
+
+	text, err := extractPDF(pdf)
+	require.NoError(t, err)
+	assert.Equal(t, "--- Page 1 ---\npacked", text)
+}
+
+func TestExtractPDF_SelfReferencingForm(t *testing.T) {
+	form := "BT (looped) Tj ET" + strings.Repeat(" /X Do", 20)
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /XObject << /X 5 0 R >> >> >>",
+		pdfStreamObj("", []byte("/X Do /X Do")),
+		pdfStreamObj("/Type /XObject /Subtype /Form /Resources << /XObject << /X 5 0 R >> >>", []byte(form)),
+	)
+
+	done := make(chan struct{})
+	var text string
+	var err error
+	go func() {
+		defer close(done)
+		text, err = extractPDF(pdf)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("extraction did not finish")
+	}
+	require.NoError(t, err)
+	assert.Equal(t, "--- Page 1 ---\nlooped", text)
+}
+
+func TestExtractPDF_OutOfRangeOffsets(t *testing.T) {
+	for name, tc := range map[string]struct {
+		object string
+		err    string
+	}{
+		"negative length": {"<< /Length -57 >>\nstream\nBT (x) Tj ET\nendstream", "/Length -57 is out of range"},
+		"length past end": {"<< /Length 99999 >>\nstream\nBT (x) Tj ET\nendstream", "/Length 99999 is out of range"},
+		"negative first":  {pdfStreamObj("/Type /ObjStm /N 1 /First -1", []byte("3 0 null")), "/First -1 is out of range"},
+		"negative offset": {pdfStreamObj("/Type /ObjStm /N 1 /First 5", []byte("3 -5 null")), "offset -5 of object 3 is out of range"},
+		"offset past end": {pdfStreamObj("/Type /ObjStm /N 1 /First 6", []byte("3 500 null")), "offset 500 of object 3 is out of range"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pdf := buildPDF("<< /Type /Catalog /Pages 3 0 R >>", tc.object)
+			_, err := extractPDF(pdf)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestExtractPDF_Errors(t *testing.T) {
+	_, err := extractPDF([]byte("just text"))
+	assert.ErrorContains(t, err, "not a PDF")
+
+	scanned := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		pdfStreamObj("", []byte("q 100 0 0 100 0 0 cm /Im1 Do Q")),
+	)
+	_, err = extractPDF(scanned)
+	assert.ErrorContains(t, err, "no text found")
+
+	encrypted := bytes.Replace(scanned, []byte("<< /Root 1 0 R >>"), []byte("<< /Root 1 0 R /Encrypt 9 0 R >>"), 1)
+	_, err = extractPDF(encrypted)
+	assert.ErrorContains(t, err, "encrypted")
+}
+
+func buildDOCX(t *testing.T, body string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.Create("word/document.xml")
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>%s</w:body></w:document>`, body)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return b.Bytes()
+}
+
+func TestExtractDOCX(t *testing.T) {
+	docx := buildDOCX(t, `
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Overview</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Split </w:t></w:r><w:r><w:t>runs</w:t><w:tab/><w:t>&amp; tabs</w:t></w:r></w:p>
+<w:tbl>
+  <w:tr><w:tc><w:p><w:r><w:t>a</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>b</w:t></w:r></w:p></w:tc></w:tr>
+</w:tbl>
+<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Details</w:t></w:r></w:p>
+<w:p><w:r><w:t>Last</w:t><w:br/><w:t>line</w:t></w:r></w:p>`)
+
+	text, err := extractDOCX(docx)
+	require.NoError(t, err)
+	assert.Equal(t, "# Overview\n\nSplit runs & tabs\n| a | b |\n\n## Details\n\nLast\nline", text)
+}
+
+func TestExtractDOCX_NotADocument(t *testing.T) {
+	_, err := extractDOCX([]byte("PK but not really"))
+	assert.Error(t, err)
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	require.NoError(t, zw.Close())
+	_, err = extractDOCX(b.Bytes())
+	assert.ErrorContains(t, err, "word/document.xml")
+}
+
+func TestExtractHTML(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html><head><title>Guide</title><style>p { color: red; }</style>
+<script>if (a < b) { document.write("<p>no</p>") }</script></head>
+<body>
+<!-- a comment -->
+<h1>Install</h1>
+<p>Run   the <b>installer</b>,
+then <a href="/x?a=1&amp;b=2">reboot</a> &mdash; done.</p>
+<ul><li>one</li><li>two</li></ul>
+<table><tr><th>key</th><td>value</td></tr></table>
+<pre>
+  indented
+    code
+</pre>
+<SCRIPT>ignored()</SCRIPT>
+</body></html>`
+
+	text, err := extractHTML([]byte(page))
+	require.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"Guide",
+		"",
+		"# Install",
+		"",
+		"Run the installer, then reboot — done.",
+		"",
+		"- one",
+		"- two",
+		"key | value",
+		"  indented",
+		"    code",
+	}, "\n"), text)
+}
+
+func TestReadFile_Documents(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.html")
+	require.NoError(t, os.WriteFile(page, []byte("<p>Hello &amp; welcome</p>"), 0o600))
+	blob := filepath.Join(dir, "blob.bin")
+	require.NoError(t, os.WriteFile(blob, []byte{0x7f, 'E', 'L', 'F', 0, 0}, 0o600))
+	broken := filepath.Join(dir, "broken.pdf")
+	require.NoError(t, os.WriteFile(broken, []byte("%PDF-1.4\ngarbage"), 0o600))
+
+	content, err := ReadFile(page, &Budget{Remaining: 1 << 20})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>Hello &amp; welcome</p>", string(content), "HTML is sent as markup by default")
+
+	content, err = Extraction{HTML: true}.ReadFile(page, &Budget{Remaining: 1 << 20})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello & welcome", string(content))
+
+	_, err = ReadFile(blob, &Budget{Remaining: 1 << 20})
+	assert.ErrorIs(t, err, ErrBinary)
+	assert.ErrorContains(t, err, blob)
+
+	_, err = ReadFile(broken, &Budget{Remaining: 1 << 20})
+	assert.ErrorIs(t, err, ErrExtract)
+}
+
+func TestReadFile_TooLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "huge.pdf")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(maxFileBytes+1))
+	require.NoError(t, f.Close())
+
+	_, err = ReadFile(path, &Budget{Remaining: 1 << 20})
+	assert.ErrorIs(t, err, ErrTooLarge)
+	assert.ErrorContains(t, err, path)
+}
+
+func TestIsDocument(t *testing.T) {
+	assert.True(t, IsDocument("report.PDF"))
+	assert.True(t, IsDocument("notes.docx"))
+	assert.False(t, IsDocument("index.htm"))
+	assert.True(t, Extraction{HTML: true}.IsDocument("index.htm"))
+	assert.False(t, IsDocument("main.go"))
+	assert.False(t, IsDocument("old.doc"))
+}
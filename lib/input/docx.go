@@ -0,0 +1,139 @@
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxDOCXXMLBytes caps how much of the document body is decompressed.
+const maxDOCXXMLBytes = 64 << 20
+
+// extractDOCX returns the text of a Word document, one paragraph per line.
+// Headings become markdown headings, marking the sections of the document,
+// and table rows are written as rows of cells separated by "|".
+func extractDOCX(content []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", errors.New("not a DOCX file")
+	}
+	var body *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			body = f
+			break
+		}
+	}
+	if body == nil {
+		return "", errors.New("not a DOCX file: no word/document.xml")
+	}
+
+	rc, err := body.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	text, err := docxText(io.LimitReader(rc, maxDOCXXMLBytes))
+	if err != nil {
+		return "", fmt.Errorf("word/document.xml: %v", err)
+	}
+	return tidyText(text), nil
+}
+
+// docxText walks the WordprocessingML of a document body.
+func docxText(r io.Reader) (string, error) {
+	var out, para strings.Builder
+	var heading int
+	var cells []string
+	tableDepth := 0
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				heading = 0
+			case "pStyle":
+				heading = headingLevel(attr(t, "val"))
+			case "tab":
+				para.WriteByte('\t')
+			case "br", "cr":
+				para.WriteByte('\n')
+			case "tbl":
+				tableDepth++
+			case "tr":
+				cells = nil
+			case "tc":
+				cells = append(cells, "")
+			case "t":
+				var s string
+				if err := dec.DecodeElement(&s, &t); err != nil {
+					return "", err
+				}
+				para.WriteString(s)
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				line := strings.TrimSpace(para.String())
+				switch {
+				case tableDepth > 0 && len(cells) > 0:
+					cells[len(cells)-1] = strings.TrimSpace(cells[len(cells)-1] + " " + line)
+				case line == "":
+					out.WriteString("\n")
+				case heading > 0:
+					fmt.Fprintf(&out, "\n%s %s\n\n", strings.Repeat("#", heading), line)
+				default:
+					out.WriteString(line + "\n")
+				}
+			case "tr":
+				out.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+				cells = nil
+			case "tbl":
+				tableDepth--
+				out.WriteString("\n")
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+// headingLevel returns the level of a paragraph style, 0 for styles other
+// than headings.
+func headingLevel(style string) int {
+	if style == "Title" {
+		return 1
+	}
+	if level, ok := strings.CutPrefix(style, "Heading"); ok {
+		if n, err := strconv.Atoi(level); err == nil && n >= 1 && n <= 6 {
+			return n
+		}
+	}
+	return 0
+}
+
+func attr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,267 @@
+package input
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// sniffLen is how much of a file is inspected to tell binary from text, as
+// git does.
+const sniffLen = 8000
+
+// maxFileBytes caps the size of a file read as input, before any text is
+// extracted from it.
+const maxFileBytes = 64 << 20
+
+var ErrTooLarge = errors.New("inputs are too large")
+
+// File is a text file included in a question.
+type File struct {
+	// Path is the path of the file as derived from the argument that
+	// included it.
+	Path    string
+	Content []byte
+}
+
+// Budget bounds the total size of the files included in a single question.
+type Budget struct {
+	Remaining int64
+}
+
+// take reserves n bytes for a file of the argument arg.
+func (b *Budget) take(arg string, n int64) error {
+	if n > b.Remaining {
+		return fmt.Errorf("%w: %s exceeds the remaining %d KiB; narrow it down or exclude files with .qoryignore",
+			ErrTooLarge, arg, b.Remaining>>10)
+	}
+	b.Remaining -= n
+	return nil
+}
+
+// ReadFile reads the text of a single file named explicitly, charging it to
+// budget. The text of documents is extracted (see IsDocument); other binary
+// files fail with ErrBinary.
+func ReadFile(name string, budget *Budget) ([]byte, error) {
+	return Extraction{}.ReadFile(name, budget)
+}
+
+// ReadFile is the package's ReadFile, extracting the text of the documents e
+// names.
+func (e Extraction) ReadFile(name string, budget *Budget) ([]byte, error) {
+	content, err := readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if content, err = e.toText(name, content); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := budget.take(name, int64(len(content))); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// IsGlob reports whether arg contains glob metacharacters.
+func IsGlob(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+// Expand resolves a directory or glob argument into the text files it
+// covers, in lexical order, extracting the text of documents. Files ignored
+// by .gitignore or .qoryignore, hidden files and directories, binary files
+// and files that don't fit in budget are skipped. A glob may use "**" to
+// match any number of directories.
+//
+// ok is false when arg is neither a directory nor a glob matching any file.
+func Expand(arg string, budget *Budget) (files []File, ok bool, err error) {
+	return Extraction{}.Expand(arg, budget)
+}
+
+// Expand is the package's Expand, extracting the text of the documents e
+// names.
+func (e Extraction) Expand(arg string, budget *Budget) (files []File, ok bool, err error) {
+	if info, err := os.Stat(arg); err == nil && info.IsDir() {
+		files, err := e.walk(arg, nil, budget)
+		return files, true, err
+	}
+	if !IsGlob(arg) {
+		return nil, false, nil
+	}
+
+	root, pattern := splitGlob(arg)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, false, nil
+	}
+	files, err = e.walk(root, pattern, budget)
+	if err != nil {
+		return nil, true, err
+	}
+	return files, len(files) > 0, nil
+}
+
+// splitGlob splits a glob into the directory it is rooted at, which holds no
+// metacharacters, and the pattern segments relative to it.
+func splitGlob(glob string) (string, []string) {
+	segments := strings.Split(filepath.ToSlash(glob), "/")
+	i := 0
+	for i < len(segments)-1 && !IsGlob(segments[i]) {
+		i++
+	}
+
+	root := strings.Join(segments[:i], "/")
+	switch {
+	case root == "" && i > 0:
+		root = "/"
+	case root == "":
+		root = "."
+	}
+	return filepath.FromSlash(root), segments[i:]
+}
+
+// walk collects the text files under root whose path relative to root
+// matches pattern, or all of them when pattern is nil.
+func (e Extraction) walk(root string, pattern []string, budget *Budget) ([]File, error) {
+	ig, err := newIgnorer(root)
+	if err != nil {
+		return nil, err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		abs := filepath.Join(absRoot, rel)
+
+		if strings.HasPrefix(d.Name(), ".") || ig.ignored(abs, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if pattern != nil && !slices.Contains(pattern, "**") && strings.Count(rel, string(filepath.Separator))+1 >= len(pattern) {
+				return filepath.SkipDir
+			}
+			return ig.load(abs)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if pattern != nil && !matchSegments(pattern, strings.Split(filepath.ToSlash(rel), "/")) {
+			return nil
+		}
+
+		content, ok, err := e.readWalked(p, budget)
+		if ok {
+			files = append(files, File{Path: p, Content: content})
+		}
+		return err
+	})
+	return files, err
+}
+
+// readWalked reads a file found by walk, charging it to budget. Binaries,
+// unreadable documents and files that don't fit in the remaining budget are
+// left out, like ignored files, which ok reports. Files are sized up and
+// sniffed before they are read in full.
+func (e Extraction) readWalked(p string, budget *Budget) (content []byte, ok bool, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The text of a document is charged once it is extracted.
+	document := e.IsDocument(p)
+	limit := budget.Remaining
+	if document {
+		limit = maxFileBytes
+	}
+	if info.Size() > limit {
+		leaveOut(p, budget)
+		return nil, false, nil
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, false, err
+	}
+	content = head[:n]
+	if !document && isBinary(content) {
+		return nil, false, nil
+	}
+	rest, err := io.ReadAll(io.LimitReader(f, limit+1-int64(n)))
+	if err != nil {
+		return nil, false, err
+	}
+	content = append(content, rest...)
+
+	if content, err = e.toText(p, content); err != nil {
+		return nil, false, nil
+	}
+	if int64(len(content)) > budget.Remaining {
+		leaveOut(p, budget)
+		return nil, false, nil
+	}
+	budget.Remaining -= int64(len(content))
+	return content, true, nil
+}
+
+// leaveOut warns that the file at p is left out for lack of budget.
+func leaveOut(p string, budget *Budget) {
+	fmt.Fprintf(os.Stderr, "Warning: leaving out %s, which is larger than the %d KiB left for inputs\n", p, budget.Remaining>>10)
+}
+
+// readFile reads a file, refusing files larger than maxFileBytes.
+func readFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tooLarge := fmt.Errorf("%w: %s is larger than %d MiB", ErrTooLarge, name, maxFileBytes>>20)
+	if info, err := f.Stat(); err == nil && info.Size() > maxFileBytes {
+		return nil, tooLarge
+	}
+	// The size of special files such as pipes is unknown up front.
+	content, err := io.ReadAll(io.LimitReader(f, maxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxFileBytes {
+		return nil, tooLarge
+	}
+	return content, nil
+}
+
+// isBinary reports whether content looks like a binary file: one with a NUL
+// byte near its start.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), sniffLen)], 0) >= 0
+}
@@ -0,0 +1,146 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree creates the given files (path → content) under a new directory,
+// which is returned.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	return root
+}
+
+func paths(root string, files []File) []string {
+	var out []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f.Path)
+		out = append(out, filepath.ToSlash(rel))
+	}
+	return out
+}
+
+func bigBudget() *Budget {
+	return &Budget{Remaining: 1 << 20}
+}
+
+func TestExpand_DirectoryHonorsIgnoreFiles(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":       "*.log\nbuild/\n",
+		"main.go":          "package main",
+		"app.log":          "log",
+		"build/out.txt":    "built",
+		"pkg/.qoryignore":  "secret.txt\n",
+		"pkg/secret.txt":   "secret",
+		"pkg/lib.go":       "package pkg",
+		"pkg/keep.log":     "kept",
+		"pkg/.gitignore":   "!keep.log\n",
+		".hidden/file.txt": "hidden",
+		"image.bin":        "\x00\x01\x02",
+	})
+
+	files, ok, err := Expand(root, bigBudget())
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"main.go", "pkg/keep.log", "pkg/lib.go"}, paths(root, files))
+	assert.Equal(t, "package main", string(files[0].Content))
+}
+
+func TestExpand_ParentIgnoreFilesApplyWithinRepo(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".git/HEAD":  "ref",
+		".gitignore": "*.tmp\n",
+		"src/a.go":   "a",
+		"src/b.tmp":  "b",
+	})
+
+	files, _, err := Expand(filepath.Join(root, "src"), bigBudget())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src/a.go"}, paths(root, files))
+}
+
+func TestExpand_Glob(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a.go":           "a",
+		"b.txt":          "b",
+		"pkg/c.go":       "c",
+		"pkg/deep/d.go":  "d",
+		"vendor/e.go":    "e",
+		".gitignore":     "vendor/\n",
+		"pkg/deep/e.txt": "e",
+	})
+
+	files, ok, err := Expand(filepath.Join(root, "*.go"), bigBudget())
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a.go"}, paths(root, files))
+
+	files, _, err = Expand(filepath.Join(root, "**/*.go"), bigBudget())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.go", "pkg/c.go", "pkg/deep/d.go"}, paths(root, files))
+
+	files, _, err = Expand(filepath.Join(root, "pkg/*/*.txt"), bigBudget())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pkg/deep/e.txt"}, paths(root, files))
+}
+
+func TestExpand_NotAPathOrGlob(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.go": "a"})
+
+	for _, arg := range []string{"hello", filepath.Join(root, "a.go"), filepath.Join(root, "*.rs"), "why?"} {
+		_, ok, err := Expand(arg, bigBudget())
+		require.NoError(t, err)
+		assert.False(t, ok, arg)
+	}
+}
+
+func TestExpand_LeavesOutFilesOverBudget(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a.txt": "0123456789",
+		"b.txt": "0123456789",
+		"c.txt": "01234",
+	})
+
+	budget := &Budget{Remaining: 15}
+	files, _, err := Expand(root, budget)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "c.txt"}, paths(root, files))
+	assert.Equal(t, int64(0), budget.Remaining)
+}
+
+func TestExpand_LeavesOutLargeFilesUnread(t *testing.T) {
+	root := writeTree(t, map[string]string{"small.txt": "hello"})
+	big, err := os.Create(filepath.Join(root, "big.txt"))
+	require.NoError(t, err)
+	require.NoError(t, big.Truncate(maxFileBytes+1))
+	require.NoError(t, big.Close())
+
+	files, _, err := Expand(root, &Budget{Remaining: 1 << 20})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"small.txt"}, paths(root, files))
+}
+
+func TestReadFile_ChargesBudget(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.txt": "0123456789"})
+
+	budget := &Budget{Remaining: 15}
+	content, err := ReadFile(filepath.Join(root, "a.txt"), budget)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(content))
+	assert.Equal(t, int64(5), budget.Remaining)
+
+	_, err = ReadFile(filepath.Join(root, "a.txt"), budget)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
@@ -0,0 +1,108 @@
+package input
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is how files and piped input are marked up in a question, so that
+// the model can tell them apart and refer to them by name.
+type Format string
+
+const (
+	// FormatMarkdown precedes each file with its path and wraps it in a
+	// fenced code block tagged with its language.
+	FormatMarkdown Format = "markdown"
+
+	// FormatXML wraps each file in a <file path="..."> element.
+	FormatXML Format = "xml"
+
+	// FormatPlain includes file contents as they are.
+	FormatPlain Format = "plain"
+)
+
+const stdinLabel = "Input from stdin:"
+
+func ParseFormat(value string) (Format, error) {
+	switch f := Format(value); f {
+	case FormatMarkdown, FormatXML, FormatPlain:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid input format %q (valid: markdown, xml, plain)", value)
+	}
+}
+
+// File renders the content of the file at path.
+func (f Format) File(path string, content string) string {
+	return f.Excerpt(path, nil, content)
+}
+
+// Excerpt renders the content of the given lines of the file at path, or of
+// the whole file when lines is nil.
+func (f Format) Excerpt(path string, lines *Lines, content string) string {
+	path = DisplayPath(path)
+	switch f {
+	case FormatMarkdown:
+		label := path
+		if lines != nil {
+			label = fmt.Sprintf("%s (lines %s)", path, lines)
+		}
+		return fmt.Sprintf("%s\n%s", label, fence(content, Language(path)))
+	case FormatXML:
+		attrs := fmt.Sprintf("path=\"%s\"", html.EscapeString(path))
+		if lines != nil {
+			attrs += fmt.Sprintf(" lines=\"%s\"", lines)
+		}
+		return fmt.Sprintf("<file %s>\n%s\n</file>", attrs, strings.TrimSuffix(content, "\n"))
+	default:
+		return content
+	}
+}
+
+// Stdin renders input piped into qory.
+func (f Format) Stdin(content string) string {
+	switch f {
+	case FormatMarkdown:
+		return fmt.Sprintf("%s\n%s", stdinLabel, fence(content, ""))
+	case FormatXML:
+		return fmt.Sprintf("<stdin>\n%s\n</stdin>", strings.TrimSuffix(content, "\n"))
+	default:
+		return stdinLabel + "\n" + content
+	}
+}
+
+// fence wraps content in a fenced code block, using a fence longer than any
+// run of backticks in content.
+func fence(content, lang string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	marker := strings.Repeat("`", max(3, longest+1))
+	return fmt.Sprintf("%s%s\n%s\n%s", marker, lang, strings.TrimSuffix(content, "\n"), marker)
+}
+
+// DisplayPath returns path relative to the working directory when it lies
+// within it, and unchanged otherwise.
+func DisplayPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.ToSlash(filepath.Clean(path))
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,60 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat_File(t *testing.T) {
+	assert.Equal(t, "src/main.go\n```go\npackage main\n```", FormatMarkdown.File("src/main.go", "package main\n"))
+	assert.Equal(t, "<file path=\"a&amp;b.txt\">\nhi\n</file>", FormatXML.File("a&b.txt", "hi\n"))
+	assert.Equal(t, "package main\n", FormatPlain.File("src/main.go", "package main\n"))
+}
+
+func TestFormat_Excerpt(t *testing.T) {
+	lines := &Lines{From: 2, To: 3}
+	assert.Equal(t, "main.go (lines 2-3)\n```go\nb\nc\n```", FormatMarkdown.Excerpt("main.go", lines, "b\nc\n"))
+	assert.Equal(t, "<file path=\"main.go\" lines=\"2-3\">\nb\nc\n</file>", FormatXML.Excerpt("main.go", lines, "b\nc\n"))
+	assert.Equal(t, "b\nc\n", FormatPlain.Excerpt("main.go", lines, "b\nc\n"))
+}
+
+func TestFormat_MarkdownFenceOutgrowsContent(t *testing.T) {
+	got := FormatMarkdown.File("README.md", "```bash\nls\n```")
+	assert.Equal(t, "README.md\n````markdown\n```bash\nls\n```\n````", got)
+}
+
+func TestFormat_Stdin(t *testing.T) {
+	assert.Equal(t, "Input from stdin:\n```\nlog\n```", FormatMarkdown.Stdin("log\n"))
+	assert.Equal(t, "<stdin>\nlog\n</stdin>", FormatXML.Stdin("log\n"))
+	assert.Equal(t, "Input from stdin:\nlog\n", FormatPlain.Stdin("log\n"))
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("xml")
+	require.NoError(t, err)
+	assert.Equal(t, FormatXML, f)
+
+	_, err = ParseFormat("html")
+	assert.Error(t, err)
+}
+
+func TestDisplayPath(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	assert.Equal(t, "a/b.go", DisplayPath(filepath.Join(wd, "a", "b.go")))
+	assert.Equal(t, "a/b.go", DisplayPath("./a//b.go"))
+	outside := filepath.Join(filepath.Dir(wd), "other.go")
+	assert.Equal(t, outside, DisplayPath(outside))
+}
+
+func TestLanguage(t *testing.T) {
+	assert.Equal(t, "python", Language("x/main.py"))
+	assert.Equal(t, "yaml", Language("openapi.YML"))
+	assert.Equal(t, "dockerfile", Language("build/Dockerfile"))
+	assert.Equal(t, "", Language("notes"))
+}
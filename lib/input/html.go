@@ -0,0 +1,194 @@
+package input
+
+import (
+	"html"
+	"strings"
+)
+
+// htmlBlocks are the elements that start on a line of their own.
+var htmlBlocks = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"body": true, "br": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"title": true, "tr": true, "ul": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// htmlSkipped are the elements whose content is not text.
+var htmlSkipped = map[string]bool{
+	"script": true, "style": true, "template": true, "svg": true, "noscript": true,
+}
+
+// extractHTML returns the text of an HTML page. Headings become markdown
+// headings, marking the sections of the page, and list items are bulleted.
+// Scripts and styles are dropped; preformatted text keeps its layout.
+func extractHTML(content []byte) (string, error) {
+	src := string(content)
+	h := htmlText{}
+
+	for i := 0; i < len(src); {
+		if src[i] != '<' {
+			end := strings.IndexByte(src[i:], '<')
+			if end < 0 {
+				end = len(src) - i
+			}
+			h.text(html.UnescapeString(src[i : i+end]))
+			i += end
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(src[i:], "<!--"):
+			i = skipPast(src, i, "-->")
+			continue
+		case strings.HasPrefix(src[i:], "<!"), strings.HasPrefix(src[i:], "<?"):
+			i = skipPast(src, i, ">")
+			continue
+		}
+
+		name, closing, end := parseTag(src, i)
+		if name == "" {
+			h.text("<")
+			i++
+			continue
+		}
+		i = end
+
+		if htmlSkipped[name] && !closing {
+			i = skipPast(src, i, "</"+name)
+			i = skipPast(src, i, ">")
+			continue
+		}
+		h.tag(name, closing)
+	}
+
+	return blankLineRun.ReplaceAllString(strings.TrimSpace(h.out.String()), "\n\n"), nil
+}
+
+// htmlText accumulates the text of an HTML page.
+type htmlText struct {
+	out strings.Builder
+
+	// line is the current line; outside of <pre> its whitespace is collapsed
+	// when it ends.
+	line strings.Builder
+	pre  int
+}
+
+func (h *htmlText) text(s string) {
+	h.line.WriteString(s)
+}
+
+func (h *htmlText) tag(name string, closing bool) {
+	switch {
+	case name == "pre" && !closing:
+		h.flush()
+		h.pre++
+		return
+	case name == "pre" && closing:
+		h.flushPre()
+		h.pre = max(h.pre-1, 0)
+		return
+	case name == "td" || name == "th":
+		if !closing && strings.TrimSpace(h.line.String()) != "" {
+			h.line.WriteString(" | ")
+		}
+		return
+	case !htmlBlocks[name]:
+		return
+	}
+
+	h.flush()
+	if closing {
+		if name == "p" || len(name) == 2 && name[0] == 'h' {
+			h.out.WriteString("\n")
+		}
+		return
+	}
+	switch {
+	case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+		h.out.WriteString("\n")
+		h.line.WriteString(strings.Repeat("#", int(name[1]-'0')) + " ")
+	case name == "li":
+		h.line.WriteString("- ")
+	}
+}
+
+// flush ends the current line.
+func (h *htmlText) flush() {
+	if h.pre > 0 {
+		h.flushPre()
+		return
+	}
+	line := strings.Join(strings.Fields(h.line.String()), " ")
+	h.line.Reset()
+	if line == "" || line == "-" || strings.Trim(line, "#") == "" {
+		return
+	}
+	h.out.WriteString(line + "\n")
+}
+
+func (h *htmlText) flushPre() {
+	text := strings.Trim(h.line.String(), "\n")
+	h.line.Reset()
+	if text != "" {
+		h.out.WriteString(text + "\n")
+	}
+}
+
+// parseTag parses the tag starting at src[i], returning its lower-cased name,
+// whether it is a closing tag and where it ends. name is empty when src[i]
+// doesn't start a tag.
+func parseTag(src string, i int) (name string, closing bool, end int) {
+	j := i + 1
+	if j < len(src) && src[j] == '/' {
+		closing = true
+		j++
+	}
+	start := j
+	for j < len(src) && (isASCIILetter(src[j]) || start < j && src[j] >= '0' && src[j] <= '9') {
+		j++
+	}
+	if j == start {
+		return "", false, i
+	}
+	name = strings.ToLower(src[start:j])
+
+	// Skip the attributes, minding quoted values that may hold '>'.
+	var quote byte
+	for ; j < len(src); j++ {
+		switch c := src[j]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return name, closing, j + 1
+		}
+	}
+	return name, closing, len(src)
+}
+
+// skipPast returns the index just past the first occurrence of marker in src
+// from i on, or len(src) if there is none. Letters match case-insensitively.
+func skipPast(src string, i int, marker string) int {
+	for j := i; j < len(src); j++ {
+		k := strings.IndexByte(src[j:], marker[0])
+		if k < 0 {
+			break
+		}
+		j += k
+		if len(src)-j >= len(marker) && strings.EqualFold(src[j:j+len(marker)], marker) {
+			return j + len(marker)
+		}
+	}
+	return len(src)
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,211 @@
+package input
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileNames are read in every directory walked; .qoryignore uses the
+// .gitignore syntax and is applied after it, so it can also re-include files.
+var ignoreFileNames = []string{".gitignore", ".qoryignore"}
+
+// ignoreRule is a single pattern line of an ignore file.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// parseIgnoreRule parses a line in .gitignore syntax. ok is false for blank
+// lines and comments.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A pattern without a slash matches at any depth; one with a slash is
+	// relative to the directory holding the ignore file.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	rule.segments = strings.Split(line, "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	return rule, true
+}
+
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// ignorer applies the ignore files found in a directory tree. Rules of a
+// deeper directory take precedence over those of its parents, and later rules
+// over earlier ones, as in git.
+type ignorer struct {
+	rules map[string][]ignoreRule // by directory
+	top   string                  // outermost directory whose rules apply
+}
+
+// newIgnorer returns an ignorer for walking root. The ignore files of the
+// directories above root apply too, up to the root of its git repository.
+func newIgnorer(root string) (*ignorer, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ig := &ignorer{rules: map[string][]ignoreRule{}, top: abs}
+	for dir := abs; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			ig.top = dir
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if err := ig.load(dir); err != nil {
+			return nil, err
+		}
+		if dir == ig.top {
+			break
+		}
+	}
+	return ig, nil
+}
+
+// load reads the ignore files of dir, given as an absolute path.
+func (ig *ignorer) load(dir string) error {
+	var rules []ignoreRule
+	for _, name := range ignoreFileNames {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	if len(rules) > 0 {
+		ig.rules[dir] = rules
+	}
+	return nil
+}
+
+// ignored reports whether the file or directory at the absolute path p is
+// ignored.
+func (ig *ignorer) ignored(p string, isDir bool) bool {
+	var dirs []string
+	for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == ig.top || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(dirs[i], p)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range ig.rules[dirs[i]] {
+			if rule.match(rel, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// Skipped reports whether walking the directory root would leave out the
+// file at rel, a path relative to root: one of its elements is hidden, or
+// the ignore files exclude it or one of its directories.
+func Skipped(root, rel string) (bool, error) {
+	ig, err := newIgnorer(root)
+	if err != nil {
+		return false, err
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return false, err
+	}
+
+	elems := strings.Split(filepath.Clean(rel), string(filepath.Separator))
+	for i, elem := range elems {
+		if elem == "." {
+			continue
+		}
+		abs = filepath.Join(abs, elem)
+		isDir := i < len(elems)-1
+		if strings.HasPrefix(elem, ".") || ig.ignored(abs, isDir) {
+			return true, nil
+		}
+		if isDir {
+			if err := ig.load(abs); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// matchSegments matches a slash-separated path against pattern segments,
+// where "**" stands for any number of path segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,84 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIgnoreRule_SkipsBlankAndComments(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/"} {
+		_, ok := parseIgnoreRule(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestIgnoreRule_Match(t *testing.T) {
+	cases := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "app.log", false, true},
+		{"*.log", "logs/app.log", false, true},
+		{"*.log", "app.log.txt", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "src/build", true, false},
+		{"docs/*.md", "docs/a.md", false, true},
+		{"docs/*.md", "src/docs/a.md", false, false},
+		{"**/testdata", "a/b/testdata", true, true},
+		{"a/**/z", "a/z", false, true},
+		{"a/**/z", "a/b/c/z", false, true},
+		{`\#notes`, "#notes", false, true},
+	}
+	for _, c := range cases {
+		rule, ok := parseIgnoreRule(c.pattern)
+		assert.True(t, ok, c.pattern)
+		assert.Equal(t, c.want, rule.match(c.rel, c.isDir), "%s vs %s", c.pattern, c.rel)
+	}
+}
+
+func TestParseIgnoreRule_Negation(t *testing.T) {
+	rule, ok := parseIgnoreRule("!keep.log")
+	assert.True(t, ok)
+	assert.True(t, rule.negate)
+	assert.True(t, rule.match("keep.log", false))
+}
+
+func TestSkipped(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":      "build/\n*.log\n",
+		"src/.qoryignore": "secret.go\n",
+		"src/main.go":     "package main",
+		"src/secret.go":   "package main",
+		"build/out.go":    "package out",
+		"app.log":         "noise",
+		".env":            "TOKEN=x",
+		".github/ci.yml":  "on: push",
+	} {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	for rel, want := range map[string]bool{
+		"src/main.go":    false,
+		"./src/main.go":  false,
+		"src/secret.go":  true,
+		"build/out.go":   true,
+		"app.log":        true,
+		".env":           true,
+		".github/ci.yml": true,
+	} {
+		skipped, err := Skipped(root, rel)
+		require.NoError(t, err)
+		assert.Equal(t, want, skipped, rel)
+	}
+}
@@ -0,0 +1,72 @@
+package input
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languages maps file extensions to the language tag of a fenced code block.
+var languages = map[string]string{
+	".c":       "c",
+	".h":       "c",
+	".cc":      "cpp",
+	".cpp":     "cpp",
+	".hpp":     "cpp",
+	".cs":      "csharp",
+	".css":     "css",
+	".csv":     "csv",
+	".dart":    "dart",
+	".ex":      "elixir",
+	".exs":     "elixir",
+	".go":      "go",
+	".graphql": "graphql",
+	".hs":      "haskell",
+	".html":    "html",
+	".java":    "java",
+	".js":      "javascript",
+	".mjs":     "javascript",
+	".cjs":     "javascript",
+	".json":    "json",
+	".jsx":     "jsx",
+	".kt":      "kotlin",
+	".lua":     "lua",
+	".md":      "markdown",
+	".php":     "php",
+	".pl":      "perl",
+	".proto":   "protobuf",
+	".py":      "python",
+	".rb":      "ruby",
+	".rs":      "rust",
+	".scala":   "scala",
+	".scss":    "scss",
+	".sh":      "bash",
+	".bash":    "bash",
+	".zsh":     "zsh",
+	".sql":     "sql",
+	".swift":   "swift",
+	".tf":      "hcl",
+	".toml":    "toml",
+	".ts":      "typescript",
+	".tsx":     "tsx",
+	".vue":     "vue",
+	".xml":     "xml",
+	".yaml":    "yaml",
+	".yml":     "yaml",
+	".zig":     "zig",
+}
+
+// names maps well-known extensionless file names to their language tag.
+var names = map[string]string{
+	"Dockerfile":     "dockerfile",
+	"Makefile":       "makefile",
+	"CMakeLists.txt": "cmake",
+}
+
+// Language returns the language tag for the file at path, or "" if unknown.
+func Language(path string) string {
+	base := filepath.Base(path)
+	if lang, ok := names[base]; ok {
+		return lang
+	}
+	return languages[strings.ToLower(filepath.Ext(base))]
+}
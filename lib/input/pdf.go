@@ -0,0 +1,924 @@
+package input
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxPDFStreamBytes caps how much a single PDF stream is decompressed to.
+const maxPDFStreamBytes = 64 << 20
+
+// extractPDF returns the text of a PDF, each page preceded by a
+// "--- Page N ---" marker. Only text drawn by the content streams is found:
+// scanned pages, which are images, come out empty.
+func extractPDF(content []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(content, " \t\r\n"), []byte("%PDF-")) {
+		return "", errors.New("not a PDF file")
+	}
+
+	doc, err := parsePDF(content)
+	if err != nil {
+		return "", err
+	}
+	if doc.encrypted {
+		return "", errors.New("encrypted PDFs are not supported")
+	}
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return "", errors.New("no pages found")
+	}
+
+	var out strings.Builder
+	found := false
+	for i, page := range pages {
+		text := tidyText(doc.pageText(page))
+		found = found || text != ""
+		fmt.Fprintf(&out, "--- Page %d ---\n", i+1)
+		if text != "" {
+			out.WriteString(text + "\n")
+		}
+		out.WriteString("\n")
+	}
+	if !found {
+		return "", errors.New("no text found; the PDF may hold scanned images only")
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// PDF objects, as parsed by pdfParser.
+type (
+	pdfName   string
+	pdfString []byte
+	pdfArray  []any
+	pdfDict   map[pdfName]any
+	pdfRef    struct{ num, gen int }
+	pdfOp     string
+
+	pdfStream struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+// pdfDoc is a PDF whose objects were located by scanning the file for their
+// headers rather than by following the cross-reference table, which is often
+// damaged, and which later revisions of an object override.
+type pdfDoc struct {
+	objects   map[int]any
+	trailers  []pdfDict
+	encrypted bool
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func parsePDF(data []byte) (*pdfDoc, error) {
+	doc := &pdfDoc{objects: map[int]any{}}
+
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		if m[0] > 0 && !isPDFSpace(data[m[0]-1]) && !isPDFDelim(data[m[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		p := &pdfParser{data: data, pos: m[1]}
+		obj, err := p.object()
+		if err != nil {
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			stream, ok, err := p.stream(dict)
+			if err != nil {
+				return nil, fmt.Errorf("object %d: %w", num, err)
+			}
+			if ok {
+				obj = stream
+			}
+		}
+		doc.objects[num] = obj
+	}
+
+	for i := bytes.Index(data, []byte("trailer")); i >= 0; {
+		p := &pdfParser{data: data, pos: i + len("trailer")}
+		if obj, err := p.object(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				doc.trailers = append(doc.trailers, dict)
+			}
+		}
+		next := bytes.Index(data[i+1:], []byte("trailer"))
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+
+	// Objects packed into object streams, and the trailers of
+	// cross-reference streams.
+	for num, obj := range doc.objects {
+		stream, ok := obj.(pdfStream)
+		if !ok {
+			continue
+		}
+		switch stream.dict["Type"] {
+		case pdfName("ObjStm"):
+			if err := doc.unpackObjects(num, stream); err != nil {
+				return nil, fmt.Errorf("object stream %d: %w", num, err)
+			}
+		case pdfName("XRef"):
+			doc.trailers = append(doc.trailers, stream.dict)
+		}
+	}
+
+	for _, t := range doc.trailers {
+		if _, ok := t["Encrypt"]; ok {
+			doc.encrypted = true
+		}
+	}
+	return doc, nil
+}
+
+// unpackObjects adds the objects of an object stream that aren't defined
+// elsewhere. Streams that can't be decoded are skipped, but offsets pointing
+// outside of the stream are an error.
+func (d *pdfDoc) unpackObjects(num int, stream pdfStream) error {
+	data, err := d.decode(stream)
+	if err != nil {
+		return nil
+	}
+	n, _ := d.resolve(stream.dict["N"]).(float64)
+	first, _ := d.resolve(stream.dict["First"]).(float64)
+	if !inRange(first, len(data)) {
+		return fmt.Errorf("/First %v is out of range", first)
+	}
+
+	header := &pdfParser{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		objNum, err1 := header.object()
+		offset, err2 := header.object()
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		on, _ := objNum.(float64)
+		off, _ := offset.(float64)
+		if !inRange(off, len(data)-int(first)) {
+			return fmt.Errorf("offset %v of object %v is out of range", off, on)
+		}
+		if _, defined := d.objects[int(on)]; defined || int(on) == num {
+			continue
+		}
+		p := &pdfParser{data: data, pos: int(first) + int(off)}
+		if obj, err := p.object(); err == nil {
+			d.objects[int(on)] = obj
+		}
+	}
+	return nil
+}
+
+// inRange reports whether v, read from the file, is a valid offset or length
+// within n bytes.
+func inRange(v float64, n int) bool {
+	return v >= 0 && v <= float64(n)
+}
+
+// resolve follows obj if it is a reference.
+func (d *pdfDoc) resolve(obj any) any {
+	for range 32 {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = d.objects[ref.num]
+	}
+	return nil
+}
+
+func (d *pdfDoc) dict(obj any) pdfDict {
+	switch v := d.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// pages returns the page dictionaries in order, with inherited resources
+// filled in.
+func (d *pdfDoc) pages() []pdfDict {
+	var root pdfDict
+	for _, t := range d.trailers {
+		if root = d.dict(t["Root"]); root != nil {
+			break
+		}
+	}
+	if root == nil {
+		for _, obj := range d.objects {
+			if dict, ok := obj.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				root = dict
+				break
+			}
+		}
+	}
+	if root == nil {
+		return nil
+	}
+
+	var pages []pdfDict
+	visited := map[int]bool{}
+	var walk func(node any, resources any, depth int)
+	walk = func(node any, resources any, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		dict := d.dict(node)
+		if dict == nil || depth > 64 {
+			return
+		}
+		if r, ok := dict["Resources"]; ok {
+			resources = r
+		}
+		kids, isTree := d.resolve(dict["Kids"]).(pdfArray)
+		if !isTree {
+			page := pdfDict{"Contents": dict["Contents"], "Resources": resources}
+			pages = append(pages, page)
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+	walk(root["Pages"], nil, 0)
+	return pages
+}
+
+// decode returns the decoded content of a stream.
+func (d *pdfDoc) decode(s pdfStream) ([]byte, error) {
+	var filters []any
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+
+	data := s.raw
+	for _, f := range filters {
+		var err error
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = inflate(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = decodeASCIIHex(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, maxPDFStreamBytes))
+	// Truncated streams are common; keep what could be inflated.
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	if i := bytes.IndexByte(data, '>'); i >= 0 {
+		data = data[:i]
+	}
+	return hexDigits(data)
+}
+
+// hexDigits decodes hex digits, ignoring whitespace; a missing last digit
+// is taken as 0.
+func hexDigits(data []byte) ([]byte, error) {
+	digits := make([]byte, 0, len(data)+1)
+	for _, c := range data {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+// pageText returns the text drawn on a page.
+func (d *pdfDoc) pageText(page pdfDict) string {
+	var content []byte
+	contents := d.resolve(page["Contents"])
+	if arr, ok := contents.(pdfArray); ok {
+		for _, c := range arr {
+			if s, ok := d.resolve(c).(pdfStream); ok {
+				if data, err := d.decode(s); err == nil {
+					content = append(content, data...)
+					content = append(content, '\n')
+				}
+			}
+		}
+	} else if s, ok := contents.(pdfStream); ok {
+		content, _ = d.decode(s)
+	}
+
+	var out strings.Builder
+	d.showText(&out, content, d.dict(page["Resources"]), map[pdfRef]bool{})
+	return out.String()
+}
+
+// showText runs a content stream, writing the text it draws to out. Line
+// breaks are inferred from text positioning. Each form XObject is drawn at
+// most once per page, as recorded in drawn, so forms that draw themselves or
+// each other many times cannot blow up.
+func (d *pdfDoc) showText(out *strings.Builder, content []byte, resources pdfDict, drawn map[pdfRef]bool) {
+	fonts := d.dict(resources["Font"])
+	xobjects := d.dict(resources["XObject"])
+
+	var font *pdfFont
+	fontCache := map[pdfName]*pdfFont{}
+	var operands []any
+	lastY, haveY := 0.0, false
+
+	newline := func() {
+		if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+			out.WriteByte('\n')
+		}
+	}
+	space := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			out.WriteByte(' ')
+		}
+	}
+	show := func(obj any) {
+		if s, ok := obj.(pdfString); ok {
+			out.WriteString(font.decode(s))
+		}
+	}
+	number := func(i int) float64 {
+		if i < 0 || i >= len(operands) {
+			return 0
+		}
+		f, _ := operands[i].(float64)
+		return f
+	}
+
+	p := &pdfParser{data: content}
+	for {
+		obj, err := p.object()
+		if err != nil {
+			break
+		}
+		op, isOp := obj.(pdfOp)
+		if !isOp {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "BT":
+			haveY = false
+		case "ET":
+			space()
+		case "Tf":
+			if len(operands) > 0 {
+				name, _ := operands[0].(pdfName)
+				if _, ok := fontCache[name]; !ok {
+					fontCache[name] = d.font(fonts[name])
+				}
+				font = fontCache[name]
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			newline()
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				arr, _ := operands[len(operands)-1].(pdfArray)
+				for _, item := range arr {
+					if kern, ok := item.(float64); ok && kern < -200 {
+						space()
+					}
+					show(item)
+				}
+			}
+		case "Td", "TD":
+			if number(1) != 0 {
+				newline()
+			} else {
+				space()
+			}
+		case "T*":
+			newline()
+		case "Tm":
+			y := number(5)
+			if haveY && y != lastY {
+				newline()
+			} else {
+				space()
+			}
+			lastY, haveY = y, true
+		case "Do":
+			if len(operands) > 0 {
+				name, _ := operands[0].(pdfName)
+				// Streams are always indirect objects, so a form is known by
+				// its reference.
+				ref, isRef := xobjects[name].(pdfRef)
+				if !isRef || drawn[ref] {
+					break
+				}
+				drawn[ref] = true
+				if form, ok := d.resolve(ref).(pdfStream); ok && form.dict["Subtype"] == pdfName("Form") {
+					if data, err := d.decode(form); err == nil {
+						formResources := d.dict(form.dict["Resources"])
+						if formResources == nil {
+							formResources = resources
+						}
+						newline()
+						d.showText(out, data, formResources, drawn)
+						newline()
+					}
+				}
+			}
+		case "BI":
+			p.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// pdfFont maps the character codes of a font to text.
+type pdfFont struct {
+	// codeLen is the number of bytes per character code.
+	codeLen int
+	cmap    map[uint32]string
+}
+
+func (d *pdfDoc) font(obj any) *pdfFont {
+	dict := d.dict(obj)
+	f := &pdfFont{codeLen: 1}
+	if dict == nil {
+		return f
+	}
+	if dict["Subtype"] == pdfName("Type0") {
+		f.codeLen = 2
+	}
+	if s, ok := d.resolve(dict["ToUnicode"]).(pdfStream); ok {
+		if data, err := d.decode(s); err == nil {
+			f.cmap, f.codeLen = parseToUnicode(data, f.codeLen)
+		}
+	}
+	return f
+}
+
+// decode converts a string drawn with the font to text. Without a ToUnicode
+// map, single byte codes are read as WinAnsi, which is right for most simple
+// fonts, and composite fonts can't be read at all.
+func (f *pdfFont) decode(s pdfString) string {
+	if f == nil {
+		f = &pdfFont{codeLen: 1}
+	}
+	var b strings.Builder
+	for i := 0; i+f.codeLen <= len(s); i += f.codeLen {
+		var code uint32
+		for _, c := range s[i : i+f.codeLen] {
+			code = code<<8 | uint32(c)
+		}
+		if text, ok := f.cmap[code]; ok {
+			b.WriteString(text)
+		} else if f.codeLen == 1 {
+			b.WriteRune(winAnsi(byte(code)))
+		}
+	}
+	return b.String()
+}
+
+// winAnsiHigh holds the WinAnsiEncoding characters that differ from Latin-1.
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+func winAnsi(c byte) rune {
+	if r, ok := winAnsiHigh[c]; ok {
+		return r
+	}
+	if c < 0x20 && c != '\t' && c != '\n' {
+		return ' '
+	}
+	return rune(c)
+}
+
+// parseToUnicode reads the bfchar and bfrange mappings of a ToUnicode CMap,
+// and the code length its codespace range declares.
+func parseToUnicode(data []byte, codeLen int) (map[uint32]string, int) {
+	cmap := map[uint32]string{}
+	p := &pdfParser{data: data}
+	var operands []any
+	for {
+		obj, err := p.object()
+		if err != nil {
+			break
+		}
+		op, isOp := obj.(pdfOp)
+		if !isOp {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].(pdfString); ok && len(lo) > 0 {
+					codeLen = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					cmap[codeOf(src)] = utf16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || codeOf(hi) < codeOf(lo) || codeOf(hi)-codeOf(lo) > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := utf16.Decode(utf16Units(dst))
+					for code := codeOf(lo); code <= codeOf(hi) && len(base) > 0; code++ {
+						text := append([]rune{}, base...)
+						text[len(text)-1] += rune(code - codeOf(lo))
+						cmap[code] = string(text)
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok {
+							cmap[codeOf(lo)+uint32(j)] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return cmap, codeLen
+}
+
+func codeOf(s pdfString) uint32 {
+	var code uint32
+	for _, c := range s {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func utf16Units(s pdfString) []uint16 {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return units
+}
+
+func utf16BE(s pdfString) string {
+	return string(utf16.Decode(utf16Units(s)))
+}
+
+// pdfParser reads PDF objects, and the operators of content streams.
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+var errPDFEnd = errors.New("unexpected end of PDF data")
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case isPDFSpace(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// object reads the next object. Within content streams, operators are
+// returned as pdfOp.
+func (p *pdfParser) object() (any, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, errPDFEnd
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '/':
+		p.pos++
+		return pdfName(p.word()), nil
+	case c == '(':
+		return p.literalString(), nil
+	case c == '<' && p.peek(1) == '<':
+		return p.dictionary()
+	case c == '<':
+		return p.hexString()
+	case c == '[':
+		p.pos++
+		var arr pdfArray
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return nil, errPDFEnd
+			}
+			if p.data[p.pos] == ']' {
+				p.pos++
+				return arr, nil
+			}
+			obj, err := p.object()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, obj)
+		}
+	case c == ')' || c == '>' || c == ']' || c == '{' || c == '}':
+		p.pos++
+		return pdfOp(c), nil
+	case c == '+' || c == '-' || c == '.' || c >= '0' && c <= '9':
+		return p.number(), nil
+	default:
+		word := p.word()
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return pdfOp(word), nil
+	}
+}
+
+func (p *pdfParser) peek(offset int) byte {
+	if p.pos+offset < len(p.data) {
+		return p.data[p.pos+offset]
+	}
+	return 0
+}
+
+func (p *pdfParser) word() string {
+	start := p.pos
+	for p.pos < len(p.data) && !isPDFSpace(p.data[p.pos]) && !isPDFDelim(p.data[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		// A stray delimiter; consume it so parsing moves on.
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// number reads a number, or a reference when it is followed by a generation
+// number and "R".
+func (p *pdfParser) number() any {
+	word := p.word()
+	n, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		return pdfOp(word)
+	}
+
+	save := p.pos
+	if num, err := strconv.Atoi(word); err == nil {
+		p.skipSpace()
+		gen := p.word()
+		p.skipSpace()
+		if _, err := strconv.Atoi(gen); err == nil && p.peek(0) == 'R' &&
+			(p.pos+1 == len(p.data) || isPDFSpace(p.peek(1)) || isPDFDelim(p.peek(1))) {
+			p.pos++
+			g, _ := strconv.Atoi(gen)
+			return pdfRef{num: num, gen: g}
+		}
+	}
+	p.pos = save
+	return n
+}
+
+func (p *pdfParser) literalString() pdfString {
+	p.pos++ // (
+	var s []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				return s
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.peek(0) == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.peek(0) >= '0' && p.peek(0) <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+func (p *pdfParser) hexString() (pdfString, error) {
+	p.pos++ // <
+	end := bytes.IndexByte(p.data[p.pos:], '>')
+	if end < 0 {
+		return nil, errPDFEnd
+	}
+	s, err := hexDigits(p.data[p.pos : p.pos+end])
+	p.pos += end + 1
+	return s, err
+}
+
+func (p *pdfParser) dictionary() (pdfDict, error) {
+	p.pos += 2 // <<
+	dict := pdfDict{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, errPDFEnd
+		}
+		if p.data[p.pos] == '>' && p.peek(1) == '>' {
+			p.pos += 2
+			return dict, nil
+		}
+		key, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			return nil, fmt.Errorf("dictionary key %v is not a name", key)
+		}
+		value, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		dict[name] = value
+	}
+}
+
+// stream reads the data of the stream dict describes, if one follows. A
+// /Length reaching outside of the data is an error.
+func (p *pdfParser) stream(dict pdfDict) (pdfStream, bool, error) {
+	p.skipSpace()
+	if !bytes.HasPrefix(p.data[p.pos:], []byte("stream")) {
+		return pdfStream{}, false, nil
+	}
+	start := p.pos + len("stream")
+	if p.peekAt(start) == '\r' {
+		start++
+	}
+	if p.peekAt(start) == '\n' {
+		start++
+	}
+
+	if length, ok := dict["Length"].(float64); ok {
+		if !inRange(length, len(p.data)-start) {
+			return pdfStream{}, false, fmt.Errorf("stream /Length %v is out of range", length)
+		}
+		end := start + int(length)
+		if bytes.HasPrefix(bytes.TrimLeft(p.data[end:], "\r\n "), []byte("endstream")) {
+			p.pos = end
+			return pdfStream{dict: dict, raw: p.data[start:end]}, true, nil
+		}
+	}
+
+	// The length is indirect or wrong: look for the end marker instead.
+	end := bytes.Index(p.data[start:], []byte("endstream"))
+	if end < 0 {
+		return pdfStream{}, false, nil
+	}
+	raw := bytes.TrimSuffix(p.data[start:start+end], []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	p.pos = start + end
+	return pdfStream{dict: dict, raw: raw}, true, nil
+}
+
+func (p *pdfParser) peekAt(i int) byte {
+	if i < len(p.data) {
+		return p.data[i]
+	}
+	return 0
+}
+
+// skipInlineImage moves past the data of an inline image, which follows the
+// ID operator and ends with EI.
+func (p *pdfParser) skipInlineImage() {
+	id := bytes.Index(p.data[p.pos:], []byte("ID"))
+	if id < 0 {
+		p.pos = len(p.data)
+		return
+	}
+	for i := p.pos + id + 3; i+2 <= len(p.data); i++ {
+		if p.data[i] == 'E' && p.peekAt(i+1) == 'I' && isPDFSpace(p.data[i-1]) &&
+			(i+2 == len(p.data) || isPDFSpace(p.data[i+2])) {
+			p.pos = i + 2
+			return
+		}
+	}
+	p.pos = len(p.data)
+}
@@ -0,0 +1,125 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Mode is how plain arguments are told apart from file paths.
+type Mode string
+
+const (
+	// ModeGuess treats an argument naming a readable file, a directory or a
+	// matching glob as a file input, and anything else as text.
+	ModeGuess Mode = "guess"
+
+	// ModeExplicit treats only references (@path) as file inputs.
+	ModeExplicit Mode = "explicit"
+
+	// ModeStrict is ModeExplicit, but a reference to a missing file is an
+	// error instead of being sent as text.
+	ModeStrict Mode = "strict"
+)
+
+func ParseMode(value string) (Mode, error) {
+	switch m := Mode(value); m {
+	case ModeGuess, ModeExplicit, ModeStrict:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid input mode %q (valid: guess, explicit, strict)", value)
+	}
+}
+
+// RefPrefix marks an argument as a file reference. A doubled prefix escapes
+// it, so "@@name" is the text "@name".
+const RefPrefix = "@"
+
+var linesPattern = regexp.MustCompile(`^([1-9][0-9]*)(-([1-9][0-9]*)?)?$`)
+
+// Ref is an explicit reference to a file, directory or glob, written @path,
+// optionally restricted to a range of lines with @path:from-to.
+type Ref struct {
+	Path  string
+	Lines *Lines
+}
+
+// ParseRef parses a reference. ok is false when arg is not one.
+func ParseRef(arg string) (ref Ref, ok bool, err error) {
+	if !strings.HasPrefix(arg, RefPrefix) || strings.HasPrefix(arg, RefPrefix+RefPrefix) || arg == RefPrefix {
+		return Ref{}, false, nil
+	}
+	ref.Path = arg[len(RefPrefix):]
+
+	// A path that happens to end in ":<number>" is taken as is if it exists.
+	i := strings.LastIndex(ref.Path, ":")
+	if i <= 0 {
+		return ref, true, nil
+	}
+	m := linesPattern.FindStringSubmatch(ref.Path[i+1:])
+	if m == nil {
+		return ref, true, nil
+	}
+	if _, err := os.Stat(ref.Path); err == nil {
+		return ref, true, nil
+	}
+
+	from, _ := strconv.Atoi(m[1])
+	to := from
+	if m[2] != "" {
+		to = 0
+		if m[3] != "" {
+			to, _ = strconv.Atoi(m[3])
+		}
+	}
+	if to != 0 && to < from {
+		return Ref{}, true, fmt.Errorf("invalid line range in %s: %d comes after %d", arg, from, to)
+	}
+	ref.Path = ref.Path[:i]
+	ref.Lines = &Lines{From: from, To: to}
+	return ref, true, nil
+}
+
+// Lines is a range of lines, numbered from 1. To is 0 for the end of file.
+type Lines struct {
+	From int
+	To   int
+}
+
+func (l Lines) String() string {
+	switch {
+	case l.To == l.From:
+		return strconv.Itoa(l.From)
+	case l.To == 0:
+		return fmt.Sprintf("%d-", l.From)
+	default:
+		return fmt.Sprintf("%d-%d", l.From, l.To)
+	}
+}
+
+// Slice returns the lines of content within l. A range running past the end
+// of content is cut short.
+func (l Lines) Slice(content string) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if l.From > len(lines) {
+		return "", fmt.Errorf("line %d is past the end (%d lines)", l.From, len(lines))
+	}
+	to := len(lines)
+	if l.To != 0 {
+		to = min(l.To, len(lines))
+	}
+	return strings.Join(lines[l.From-1:to], ""), nil
+}
+
+// RefTo returns the reference to path, for inputs that are known to be files.
+func RefTo(path string) string {
+	if strings.HasPrefix(path, RefPrefix) {
+		path = "." + string(os.PathSeparator) + path
+	}
+	return RefPrefix + path
+}
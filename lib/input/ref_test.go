@@ -0,0 +1,100 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRef_NotARef(t *testing.T) {
+	for _, arg := range []string{"main.go", "@", "@@john", ""} {
+		_, ok, err := ParseRef(arg)
+		require.NoError(t, err, arg)
+		assert.False(t, ok, arg)
+	}
+}
+
+func TestParseRef_Lines(t *testing.T) {
+	tests := []struct {
+		arg   string
+		path  string
+		lines *Lines
+	}{
+		{"@main.go", "main.go", nil},
+		{"@main.go:12", "main.go", &Lines{From: 12, To: 12}},
+		{"@main.go:10-20", "main.go", &Lines{From: 10, To: 20}},
+		{"@main.go:10-", "main.go", &Lines{From: 10}},
+		{"@main.go:x", "main.go:x", nil},
+		{"@main.go:0", "main.go:0", nil},
+	}
+	for _, tt := range tests {
+		ref, ok, err := ParseRef(tt.arg)
+		require.NoError(t, err, tt.arg)
+		assert.True(t, ok, tt.arg)
+		assert.Equal(t, Ref{Path: tt.path, Lines: tt.lines}, ref, tt.arg)
+	}
+}
+
+func TestParseRef_InvertedRange(t *testing.T) {
+	_, ok, err := ParseRef("@main.go:20-10")
+	assert.True(t, ok)
+	assert.Error(t, err)
+}
+
+func TestParseRef_ExistingPathWithColon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes:3")
+	require.NoError(t, os.WriteFile(path, []byte("x"), 0o600))
+
+	ref, ok, err := ParseRef("@" + path)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Path: path}, ref)
+}
+
+func TestLines_Slice(t *testing.T) {
+	content := "a\nb\nc\n"
+
+	got, err := Lines{From: 2, To: 2}.Slice(content)
+	require.NoError(t, err)
+	assert.Equal(t, "b\n", got)
+
+	got, err = Lines{From: 2}.Slice(content)
+	require.NoError(t, err)
+	assert.Equal(t, "b\nc\n", got)
+
+	got, err = Lines{From: 1, To: 10}.Slice("a\nb")
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb", got)
+
+	_, err = Lines{From: 4}.Slice(content)
+	assert.Error(t, err)
+}
+
+func TestLines_String(t *testing.T) {
+	assert.Equal(t, "3", Lines{From: 3, To: 3}.String())
+	assert.Equal(t, "3-", Lines{From: 3}.String())
+	assert.Equal(t, "3-7", Lines{From: 3, To: 7}.String())
+}
+
+func TestRefTo(t *testing.T) {
+	assert.Equal(t, "@main.go", RefTo("main.go"))
+	assert.Equal(t, "@."+string(filepath.Separator)+"@types", RefTo("@types"))
+
+	ref, ok, err := ParseRef(RefTo("@types"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "@types", filepath.Clean(ref.Path))
+}
+
+func TestParseMode(t *testing.T) {
+	for _, m := range []Mode{ModeGuess, ModeExplicit, ModeStrict} {
+		got, err := ParseMode(string(m))
+		require.NoError(t, err)
+		assert.Equal(t, m, got)
+	}
+	_, err := ParseMode("sometimes")
+	assert.Error(t, err)
+}
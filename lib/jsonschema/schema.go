@@ -0,0 +1,497 @@
+// Package jsonschema validates JSON documents against JSON Schemas. It covers
+// the keywords that schemas for structured model output use: types, enums,
+// object properties, arrays, string and number bounds, the combinators and
+// local $refs. Unknown keywords, such as format, are ignored.
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+}
+
+// ValidationError describes where a document breaks its schema.
+type ValidationError struct {
+	// Path is the JSON pointer of the offending value, "" for the document.
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("at %s: %s", e.Path, e.Message)
+}
+
+// Compile parses a JSON Schema.
+func Compile(data []byte) (*Schema, error) {
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	switch root.(type) {
+	case map[string]any, bool:
+	default:
+		return nil, errors.New("schema must be a JSON object")
+	}
+
+	s := &Schema{root: root, patterns: map[string]*regexp.Regexp{}}
+	if err := s.compilePatterns(root); err != nil {
+		return nil, err
+	}
+	if err := s.checkRefLoops(root, map[uintptr]bool{}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// checkRefLoops rejects $refs that lead back to a schema without descending
+// into the document, such as {"$defs": {"a": {"$ref": "#/$defs/b"}, "b":
+// {"$ref": "#/$defs/a"}}}, which validation would follow forever. done holds
+// the schemas already known to be free of loops.
+func (s *Schema) checkRefLoops(node any, done map[uintptr]bool) error {
+	switch n := node.(type) {
+	case map[string]any:
+		if err := s.followRefs(n, "", map[uintptr]bool{}, done); err != nil {
+			return err
+		}
+		for _, v := range n {
+			if err := s.checkRefLoops(v, done); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, v := range n {
+			if err := s.checkRefLoops(v, done); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// followRefs walks the subschemas that apply to the same value as sch: its
+// $ref, the combinators and not. ref is the last $ref taken on the way, and
+// visiting holds the schemas on the way.
+func (s *Schema) followRefs(sch map[string]any, ref string, visiting, done map[uintptr]bool) error {
+	id := reflect.ValueOf(sch).Pointer()
+	if visiting[id] {
+		return fmt.Errorf("schema $ref %q loops back without matching any value", ref)
+	}
+	if done[id] {
+		return nil
+	}
+	visiting[id] = true
+
+	var next []any
+	if r, ok := sch["$ref"].(string); ok {
+		// References that point nowhere are reported by Validate.
+		if target, err := s.resolve(r); err == nil {
+			if target, ok := target.(map[string]any); ok {
+				if err := s.followRefs(target, r, visiting, done); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, _ := sch[keyword].([]any)
+		next = append(next, subs...)
+	}
+	if not, ok := sch["not"]; ok {
+		next = append(next, not)
+	}
+	for _, sub := range next {
+		if sub, ok := sub.(map[string]any); ok {
+			if err := s.followRefs(sub, ref, visiting, done); err != nil {
+				return err
+			}
+		}
+	}
+
+	delete(visiting, id)
+	done[id] = true
+	return nil
+}
+
+// compilePatterns compiles the regular expressions of pattern and
+// patternProperties up front, so that bad ones are reported by Compile.
+func (s *Schema) compilePatterns(node any) error {
+	switch n := node.(type) {
+	case map[string]any:
+		var patterns []string
+		if p, ok := n["pattern"].(string); ok {
+			patterns = append(patterns, p)
+		}
+		if props, ok := n["patternProperties"].(map[string]any); ok {
+			for p := range props {
+				patterns = append(patterns, p)
+			}
+		}
+		for _, p := range patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("schema pattern %q: %w", p, err)
+			}
+			s.patterns[p] = re
+		}
+		for _, v := range n {
+			if err := s.compilePatterns(v); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, v := range n {
+			if err := s.compilePatterns(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks that data is a JSON document the schema accepts.
+func (s *Schema) Validate(data []byte) error {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return &ValidationError{Message: fmt.Sprintf("not valid JSON: %v", err)}
+	}
+	return s.validate(s.root, doc, "")
+}
+
+func (s *Schema) validate(schema any, v any, path string) error {
+	switch sch := schema.(type) {
+	case bool:
+		if !sch {
+			return &ValidationError{Path: path, Message: "no value is allowed here"}
+		}
+		return nil
+	case map[string]any:
+		if ref, ok := sch["$ref"].(string); ok {
+			target, err := s.resolve(ref)
+			if err != nil {
+				return err
+			}
+			if err := s.validate(target, v, path); err != nil {
+				return err
+			}
+		}
+		for _, check := range []func(map[string]any, any, string) error{
+			s.checkType, s.checkEnum, s.checkObject, s.checkArray, s.checkString, checkNumber, s.checkCombinators,
+		} {
+			if err := check(sch, v, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid schema at %s", pathOrRoot(path))
+}
+
+// resolve returns the subschema a local reference such as #/$defs/item
+// points to.
+func (s *Schema) resolve(ref string) (any, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("schema $ref %q: only references within the schema are supported", ref)
+	}
+	node := s.root
+	if pointer == "" {
+		return node, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch n := node.(type) {
+		case map[string]any:
+			node, ok = n[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			ok = err == nil && i >= 0 && i < len(n)
+			if ok {
+				node = n[i]
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			return nil, fmt.Errorf("schema $ref %q points nowhere", ref)
+		}
+	}
+	return node, nil
+}
+
+func (s *Schema) checkType(sch map[string]any, v any, path string) error {
+	var types []string
+	switch t := sch["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, e := range t {
+			if name, ok := e.(string); ok {
+				types = append(types, name)
+			}
+		}
+	default:
+		return nil
+	}
+
+	actual := typeOf(v)
+	for _, t := range types {
+		if t == actual || t == "number" && actual == "integer" {
+			return nil
+		}
+	}
+	return &ValidationError{Path: path, Message: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), actual)}
+}
+
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func (s *Schema) checkEnum(sch map[string]any, v any, path string) error {
+	if c, ok := sch["const"]; ok && !reflect.DeepEqual(c, v) {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must be %s", compact(c))}
+	}
+	if enum, ok := sch["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be one of %s", compact(enum))}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) checkObject(sch map[string]any, v any, path string) error {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	if required, ok := sch["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := obj[name]; !present {
+					return &ValidationError{Path: path, Message: fmt.Sprintf("missing required property %q", name)}
+				}
+			}
+		}
+	}
+	if err := checkCount(sch, "minProperties", "maxProperties", len(obj), "properties", path); err != nil {
+		return err
+	}
+
+	props, _ := sch["properties"].(map[string]any)
+	patternProps, _ := sch["patternProperties"].(map[string]any)
+	additional, hasAdditional := sch["additionalProperties"]
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		child := path + "/" + escapeToken(k)
+		matched := false
+		if p, ok := props[k]; ok {
+			matched = true
+			if err := s.validate(p, obj[k], child); err != nil {
+				return err
+			}
+		}
+		for pattern, p := range patternProps {
+			if s.patterns[pattern].MatchString(k) {
+				matched = true
+				if err := s.validate(p, obj[k], child); err != nil {
+					return err
+				}
+			}
+		}
+		if matched || !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("property %q is not allowed", k)}
+		}
+		if err := s.validate(additional, obj[k], child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) checkArray(sch map[string]any, v any, path string) error {
+	arr, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+
+	if err := checkCount(sch, "minItems", "maxItems", len(arr), "items", path); err != nil {
+		return err
+	}
+	if unique, _ := sch["uniqueItems"].(bool); unique {
+		for i := range arr {
+			for j := range i {
+				if reflect.DeepEqual(arr[i], arr[j]) {
+					return &ValidationError{Path: path, Message: fmt.Sprintf("items %d and %d are equal", j, i)}
+				}
+			}
+		}
+	}
+
+	// prefixItems (or, before draft 2020-12, an array of items) constrains
+	// the leading items one by one; items then applies to the rest.
+	prefix, _ := sch["prefixItems"].([]any)
+	rest, hasRest := sch["items"]
+	if tuple, ok := rest.([]any); ok {
+		prefix, rest, hasRest = tuple, sch["additionalItems"], sch["additionalItems"] != nil
+	}
+	for i, item := range arr {
+		child := path + "/" + strconv.Itoa(i)
+		var err error
+		switch {
+		case i < len(prefix):
+			err = s.validate(prefix[i], item, child)
+		case hasRest:
+			err = s.validate(rest, item, child)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) checkString(sch map[string]any, v any, path string) error {
+	str, ok := v.(string)
+	if !ok {
+		return nil
+	}
+	if err := checkCount(sch, "minLength", "maxLength", utf8.RuneCountInString(str), "characters", path); err != nil {
+		return err
+	}
+	if p, ok := sch["pattern"].(string); ok && !s.patterns[p].MatchString(str) {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must match %q", p)}
+	}
+	return nil
+}
+
+func checkNumber(sch map[string]any, v any, path string) error {
+	n, ok := v.(float64)
+	if !ok {
+		return nil
+	}
+	bounds := []struct {
+		keyword string
+		fails   func(n, bound float64) bool
+		message string
+	}{
+		{"minimum", func(n, b float64) bool { return n < b }, "at least"},
+		{"maximum", func(n, b float64) bool { return n > b }, "at most"},
+		{"exclusiveMinimum", func(n, b float64) bool { return n <= b }, "greater than"},
+		{"exclusiveMaximum", func(n, b float64) bool { return n >= b }, "less than"},
+	}
+	for _, b := range bounds {
+		if bound, ok := sch[b.keyword].(float64); ok && b.fails(n, bound) {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be %s %v", b.message, bound)}
+		}
+	}
+	if m, ok := sch["multipleOf"].(float64); ok && m > 0 {
+		if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be a multiple of %v", m)}
+		}
+	}
+	return nil
+}
+
+// checkCount checks the size of a value against a pair of min and max
+// keywords.
+func checkCount(sch map[string]any, minKeyword, maxKeyword string, n int, unit string, path string) error {
+	if min, ok := sch[minKeyword].(float64); ok && float64(n) < min {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must have at least %v %s", min, unit)}
+	}
+	if max, ok := sch[maxKeyword].(float64); ok && float64(n) > max {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must have at most %v %s", max, unit)}
+	}
+	return nil
+}
+
+func (s *Schema) checkCombinators(sch map[string]any, v any, path string) error {
+	if allOf, ok := sch["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			if err := s.validate(sub, v, path); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := sch["anyOf"].([]any); ok {
+		if s.matches(anyOf, v, path) == 0 {
+			return &ValidationError{Path: path, Message: "doesn't match any of the allowed schemas (anyOf)"}
+		}
+	}
+	if oneOf, ok := sch["oneOf"].([]any); ok {
+		if n := s.matches(oneOf, v, path); n != 1 {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must match exactly one schema of oneOf, matches %d", n)}
+		}
+	}
+	if not, ok := sch["not"]; ok && s.validate(not, v, path) == nil {
+		return &ValidationError{Path: path, Message: "matches a schema it must not (not)"}
+	}
+	return nil
+}
+
+// matches returns how many of schemas accept v.
+func (s *Schema) matches(schemas []any, v any, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		if s.validate(sub, v, path) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func escapeToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func compact(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
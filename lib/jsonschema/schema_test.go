@@ -0,0 +1,100 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"email": {"type": ["string", "null"], "pattern": "^[^@]+@[^@]+$"},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "maxItems": 2, "uniqueItems": true}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"$defs": {"tag": {"type": "string", "maxLength": 5}}
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(personSchema))
+	require.NoError(t, err)
+
+	for doc, want := range map[string]string{
+		`{"name": "Ada", "age": 36, "email": "ada@example.com", "role": "admin", "tags": ["math"]}`: "",
+		`{"name": "Ada", "age": 36, "email": null}`:                                                 "",
+		`{"name": "Ada"}`:                                    `missing required property "age"`,
+		`{"name": "Ada", "age": 36.5}`:                       "at /age: expected integer, got number",
+		`{"name": "Ada", "age": -1}`:                         "at /age: must be at least 0",
+		`{"name": "", "age": 1}`:                             "at /name: must have at least 1 characters",
+		`{"name": "Ada", "age": 1, "email": "nope"}`:         `at /email: must match "^[^@]+@[^@]+$"`,
+		`{"name": "Ada", "age": 1, "role": "root"}`:          `at /role: must be one of ["admin","user"]`,
+		`{"name": "Ada", "age": 1, "tags": ["toolong"]}`:     "at /tags/0: must have at most 5 characters",
+		`{"name": "Ada", "age": 1, "tags": ["a", "a"]}`:      "at /tags: items 0 and 1 are equal",
+		`{"name": "Ada", "age": 1, "tags": ["a", "b", "c"]}`: "at /tags: must have at most 2 items",
+		`{"name": "Ada", "age": 1, "extra": true}`:           `property "extra" is not allowed`,
+		`["Ada"]`:                            "expected object, got array",
+		`{"name": "Ada", "age": 1} trailing`: "not valid JSON: invalid character 't' after top-level value",
+	} {
+		err := s.Validate([]byte(doc))
+		if want == "" {
+			assert.NoError(t, err, doc)
+		} else {
+			assert.EqualError(t, err, want, doc)
+		}
+	}
+}
+
+func TestValidate_Combinators(t *testing.T) {
+	s, err := Compile([]byte(`{
+		"oneOf": [{"type": "integer"}, {"type": "number", "multipleOf": 0.5}],
+		"not": {"const": 0}
+	}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Validate([]byte(`1.5`)))
+	assert.EqualError(t, s.Validate([]byte(`2`)), "must match exactly one schema of oneOf, matches 2")
+	assert.EqualError(t, s.Validate([]byte(`1.25`)), "must match exactly one schema of oneOf, matches 0")
+
+	s, err = Compile([]byte(`{"anyOf": [{"type": "string"}, {"type": "null"}]}`))
+	require.NoError(t, err)
+	assert.NoError(t, s.Validate([]byte(`null`)))
+	assert.EqualError(t, s.Validate([]byte(`true`)), "doesn't match any of the allowed schemas (anyOf)")
+}
+
+func TestValidate_Tuples(t *testing.T) {
+	s, err := Compile([]byte(`{"prefixItems": [{"type": "string"}, {"type": "integer"}], "items": false}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Validate([]byte(`["a", 1]`)))
+	assert.EqualError(t, s.Validate([]byte(`["a", "b"]`)), "at /1: expected integer, got string")
+	assert.EqualError(t, s.Validate([]byte(`["a", 1, 2]`)), "at /2: no value is allowed here")
+}
+
+func TestCompile_Errors(t *testing.T) {
+	_, err := Compile([]byte(`{"type": `))
+	assert.ErrorContains(t, err, "schema is not valid JSON")
+
+	_, err = Compile([]byte(`[]`))
+	assert.EqualError(t, err, "schema must be a JSON object")
+
+	_, err = Compile([]byte(`{"pattern": "(?<=a)b"}`))
+	assert.ErrorContains(t, err, `schema pattern "(?<=a)b"`)
+
+	_, err = Compile([]byte(`{"$ref": "#/$defs/a", "$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}}`))
+	assert.ErrorContains(t, err, `schema $ref "#/$defs/a" loops back`)
+
+	_, err = Compile([]byte(`{"properties": {"self": {"$ref": "#"}}}`))
+	assert.NoError(t, err, "a reference inside a property matches a smaller value each time")
+}
+
+func TestValidate_BadReference(t *testing.T) {
+	s, err := Compile([]byte(`{"$ref": "#/$defs/missing"}`))
+	require.NoError(t, err)
+	assert.EqualError(t, s.Validate([]byte(`1`)), `schema $ref "#/$defs/missing" points nowhere`)
+}
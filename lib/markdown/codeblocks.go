@@ -0,0 +1,121 @@
+package markdown
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CodeBlock is a fenced code block.
+type CodeBlock struct {
+	// Lang is the language the fence names, if any.
+	Lang string
+
+	// Path is the file the fence says the code belongs in, if any, as in
+	// ```go main.go, ```go:main.go or ```go title="main.go".
+	Path string
+
+	Code string
+}
+
+var pathAttrPattern = regexp.MustCompile(`^(?:title|file|filename|path)=["']?([^"']+)["']?$`)
+
+// CodeBlocks returns the fenced code blocks of markdown text, in order. A
+// block left open at the end of text runs to its end.
+func CodeBlocks(text string) []CodeBlock {
+	var blocks []CodeBlock
+	var current *CodeBlock
+	var fence, indent string
+	var code []string
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if current == nil {
+			if m := fencePattern.FindStringSubmatch(line); m != nil {
+				indent, fence = m[1], m[2]
+				current = parseInfo(strings.TrimSpace(line[len(m[1])+len(m[2]):]))
+				code = nil
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			current.Code = strings.Join(code, "\n") + "\n"
+			blocks = append(blocks, *current)
+			current = nil
+			continue
+		}
+		code = append(code, strings.TrimPrefix(line, indent))
+	}
+
+	if current != nil && len(code) > 0 {
+		current.Code = strings.Join(code, "\n") + "\n"
+		blocks = append(blocks, *current)
+	}
+	return blocks
+}
+
+// parseInfo reads the language and path hint of a fence's info string.
+func parseInfo(info string) *CodeBlock {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return &CodeBlock{}
+	}
+
+	b := &CodeBlock{Lang: fields[0]}
+	if lang, path, ok := strings.Cut(fields[0], ":"); ok {
+		b.Lang, b.Path = lang, path
+	}
+	for _, f := range fields[1:] {
+		if m := pathAttrPattern.FindStringSubmatch(f); m != nil {
+			b.Path = m[1]
+		} else if b.Path == "" && !strings.Contains(f, "=") && strings.ContainsAny(f, "./") {
+			b.Path = f
+		}
+	}
+	return b
+}
+
+// extensions maps languages to the extension of their source files.
+var extensions = map[string]string{
+	"go": ".go", "python": ".py", "javascript": ".js", "rust": ".rs", "c": ".c", "java": ".java",
+	"shell": ".sh", "sql": ".sql", "yaml": ".yaml", "json": ".json",
+	"typescript": ".ts", "ts": ".ts", "tsx": ".tsx", "jsx": ".jsx", "cpp": ".cpp", "c++": ".cpp",
+	"cs": ".cs", "csharp": ".cs", "kotlin": ".kt", "swift": ".swift", "ruby": ".rb", "rb": ".rb",
+	"php": ".php", "html": ".html", "css": ".css", "markdown": ".md", "md": ".md", "toml": ".toml",
+	"xml": ".xml", "dockerfile": ".dockerfile", "makefile": ".mk", "lua": ".lua", "scala": ".scala",
+}
+
+// FileName returns where the block belongs: its path hint, or a name made
+// up from its position n (from 1) among the blocks of the answer and its
+// language. ok is false when there is no usable path hint.
+func (b CodeBlock) FileName(n int) (name string, ok bool) {
+	if b.Path != "" && filepath.IsLocal(filepath.FromSlash(b.Path)) {
+		return filepath.FromSlash(b.Path), true
+	}
+
+	ext, known := extensions[strings.ToLower(b.Lang)]
+	if !known {
+		ext, known = extensions[canonicalLang(b.Lang)]
+	}
+	if !known {
+		ext = ".txt"
+	}
+	return fmt.Sprintf("block-%d%s", n, ext), false
+}
+
+// IsLang reports whether the block is in lang, counting aliases such as
+// "py" for "python".
+func (b CodeBlock) IsLang(lang string) bool {
+	return canonicalLang(b.Lang) == canonicalLang(lang)
+}
+
+func canonicalLang(lang string) string {
+	lang = strings.ToLower(lang)
+	if alias, ok := syntaxAliases[lang]; ok {
+		return alias
+	}
+	return lang
+}
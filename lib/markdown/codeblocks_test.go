@@ -0,0 +1,49 @@
+package markdown
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeBlocks(t *testing.T) {
+	answer := "Here you go:\n\n```go main.go\npackage main\n```\n\nThen:\n\n" +
+		"~~~python title=\"tools/run.py\"\nprint('```')\n~~~\n\n" +
+		"  ```\n  indented\n  ```\n" +
+		"```js:web/app.js\nlet unterminated"
+
+	assert.Equal(t, []CodeBlock{
+		{Lang: "go", Path: "main.go", Code: "package main\n"},
+		{Lang: "python", Path: "tools/run.py", Code: "print('```')\n"},
+		{Code: "indented\n"},
+		{Lang: "js", Path: "web/app.js", Code: "let unterminated\n"},
+	}, CodeBlocks(answer))
+}
+
+func TestCodeBlocks_None(t *testing.T) {
+	assert.Empty(t, CodeBlocks("just `inline` code"))
+}
+
+func TestCodeBlock_FileName(t *testing.T) {
+	name, ok := CodeBlock{Lang: "go", Path: "cmd/main.go"}.FileName(1)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join("cmd", "main.go"), name)
+
+	name, ok = CodeBlock{Lang: "py"}.FileName(2)
+	assert.False(t, ok)
+	assert.Equal(t, "block-2.py", name)
+
+	name, ok = CodeBlock{Lang: "go", Path: "../escape.go"}.FileName(3)
+	assert.False(t, ok)
+	assert.Equal(t, "block-3.go", name)
+
+	name, _ = CodeBlock{Path: "/etc/passwd"}.FileName(4)
+	assert.Equal(t, "block-4.txt", name)
+}
+
+func TestCodeBlock_IsLang(t *testing.T) {
+	assert.True(t, CodeBlock{Lang: "py"}.IsLang("python"))
+	assert.True(t, CodeBlock{Lang: "Go"}.IsLang("golang"))
+	assert.False(t, CodeBlock{Lang: "go"}.IsLang("rust"))
+}
@@ -0,0 +1,237 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// syntax describes the lexical features of a language that highlighting
+// picks out.
+type syntax struct {
+	keywords     []string
+	lineComments []string
+	blockComment [2]string
+
+	// quotes open strings that end on the same line; longQuotes open strings
+	// that may span lines.
+	quotes     string
+	longQuotes []string
+
+	// foldCase makes keywords match regardless of case.
+	foldCase bool
+}
+
+var (
+	cLike = syntax{
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+	}
+	hashComments = syntax{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	}
+)
+
+func with(base syntax, keywords string, longQuotes ...string) syntax {
+	base.keywords = strings.Fields(keywords)
+	base.longQuotes = longQuotes
+	return base
+}
+
+func withQuotes(base syntax, quotes string) syntax {
+	base.quotes = quotes
+	return base
+}
+
+var syntaxes = map[string]syntax{
+	"go": with(cLike, "break case chan const continue default defer else fallthrough for func go goto if "+
+		"import interface map package range return select struct switch type var nil true false iota", "`"),
+	"python": with(hashComments, "and as assert async await break class continue def del elif else except "+
+		"finally for from global if import in is lambda nonlocal not or pass raise return try while with "+
+		`yield None True False self`, `"""`, `'''`),
+	"javascript": with(cLike, "async await break case catch class const continue default delete do else "+
+		"export extends finally for from function if import in instanceof let new of return static super "+
+		"switch this throw try typeof var void while yield null undefined true false interface type enum "+
+		"implements private public protected readonly", "`"),
+	"rust": withQuotes(with(cLike, "as async await break const continue crate dyn else enum extern false fn "+
+		"for if impl in let loop match mod move mut pub ref return self Self static struct super trait true "+
+		"type unsafe use where while Some None Ok Err"), `"`), // ' also starts lifetimes
+	"c": with(cLike, "auto break case char const continue default do double else enum extern float for goto "+
+		"if inline int long register return short signed sizeof static struct switch typedef union unsigned "+
+		"void volatile while bool true false NULL nullptr class namespace new delete public private "+
+		"protected template typename using virtual override this throw try catch"),
+	"java": with(cLike, "abstract boolean break byte case catch char class const continue default do double "+
+		"else enum extends final finally float for if implements import instanceof int interface long new "+
+		"package private protected public return short static super switch this throw throws try var void "+
+		"while true false null string bool namespace using readonly async await"),
+	"shell": with(hashComments, "if then else elif fi for while until do done case esac in function return "+
+		"local export exit echo cd set unset source"),
+	"sql": {
+		keywords: strings.Fields("select from where and or not insert into values update set delete create " +
+			"table index view drop alter add join left right inner outer on group by order having limit " +
+			"offset as distinct union all null is in like between case when then else end primary key " +
+			"foreign references default returning with"),
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		foldCase:     true,
+	},
+	"yaml": with(hashComments, "true false null yes no"),
+	"json": {keywords: []string{"true", "false", "null"}, quotes: `"`},
+}
+
+// syntaxAliases maps the info strings of code blocks to syntaxes.
+var syntaxAliases = map[string]string{
+	"golang": "go", "py": "python", "python3": "python",
+	"js": "javascript", "jsx": "javascript", "ts": "javascript", "tsx": "javascript",
+	"typescript": "javascript", "rs": "rust", "cpp": "c", "c++": "c", "h": "c", "hpp": "c",
+	"cs": "java", "csharp": "java", "kotlin": "java", "kt": "java", "swift": "java", "scala": "java",
+	"sh": "shell", "bash": "shell", "zsh": "shell", "console": "shell",
+	"yml": "yaml", "toml": "yaml", "dockerfile": "shell", "make": "shell", "makefile": "shell",
+	"postgresql": "sql", "mysql": "sql", "sqlite": "sql",
+}
+
+// highlighter colors the lines of a code block. It carries block comments
+// and long strings over from one line to the next.
+type highlighter struct {
+	st       styles
+	syn      *syntax
+	keywords map[string]bool
+
+	// open is the delimiter that ends the comment or string the previous
+	// line left open.
+	open      string
+	openStyle lipgloss.Style
+}
+
+func newHighlighter(lang string, st styles) *highlighter {
+	h := &highlighter{st: st}
+	lang = strings.ToLower(lang)
+	if alias, ok := syntaxAliases[lang]; ok {
+		lang = alias
+	}
+	if syn, ok := syntaxes[lang]; ok {
+		h.syn = &syn
+		h.keywords = map[string]bool{}
+		for _, k := range syn.keywords {
+			h.keywords[k] = true
+		}
+	}
+	return h
+}
+
+func (h *highlighter) line(line string) string {
+	if h.syn == nil {
+		return line
+	}
+
+	var b strings.Builder
+	i := 0
+	if h.open != "" {
+		end := strings.Index(line, h.open)
+		if end < 0 {
+			return h.openStyle.Render(line)
+		}
+		end += len(h.open)
+		b.WriteString(h.openStyle.Render(line[:end]))
+		h.open = ""
+		i = end
+	}
+
+	for i < len(line) {
+		rest := line[i:]
+
+		if hasAnyPrefix(rest, h.syn.lineComments) != "" {
+			b.WriteString(h.st.comment.Render(rest))
+			break
+		}
+		if start := h.syn.blockComment[0]; start != "" && strings.HasPrefix(rest, start) {
+			n := h.span(rest, len(start), h.syn.blockComment[1], h.st.comment)
+			b.WriteString(h.st.comment.Render(rest[:n]))
+			i += n
+			continue
+		}
+		if q := hasAnyPrefix(rest, h.syn.longQuotes); q != "" {
+			n := h.span(rest, len(q), q, h.st.str)
+			b.WriteString(h.st.str.Render(rest[:n]))
+			i += n
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case strings.ContainsRune(h.syn.quotes, r):
+			n := quotedLen(rest)
+			b.WriteString(h.st.str.Render(rest[:n]))
+			i += n
+		case unicode.IsDigit(r):
+			n := wordLen(rest)
+			b.WriteString(h.st.number.Render(rest[:n]))
+			i += n
+		case r == '_' || unicode.IsLetter(r):
+			n := wordLen(rest)
+			word := rest[:n]
+			if h.keywords[word] || h.syn.foldCase && h.keywords[strings.ToLower(word)] {
+				word = h.st.keyword.Render(word)
+			}
+			b.WriteString(word)
+			i += n
+		default:
+			b.WriteString(rest[:size])
+			i += size
+		}
+	}
+	return b.String()
+}
+
+// span returns the length of the comment or string at the start of s, whose
+// opening delimiter is skip bytes long and which ends with end. When it
+// doesn't end on this line, it is recorded as open.
+func (h *highlighter) span(s string, skip int, end string, style lipgloss.Style) int {
+	if j := strings.Index(s[skip:], end); j >= 0 {
+		return skip + j + len(end)
+	}
+	h.open, h.openStyle = end, style
+	return len(s)
+}
+
+// quotedLen returns the length of the string at the start of s, which ends
+// with the quote it starts with, minding escapes, or at the end of s.
+func quotedLen(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// wordLen returns the length of the identifier or number at the start of s.
+func wordLen(s string) int {
+	for i, r := range s {
+		if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return max(i, 1)
+		}
+		if r == '.' && (i == 0 || !unicode.IsDigit(rune(s[0]))) {
+			return max(i, 1)
+		}
+	}
+	return len(s)
+}
+
+func hasAnyPrefix(s string, prefixes []string) string {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return p
+		}
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// styles holds the lipgloss styles of a Writer, bound to its renderer. The
+// colors match those of the rest of qory.
+type styles struct {
+	heading   []lipgloss.Style
+	rule      lipgloss.Style
+	quote     lipgloss.Style
+	quoteBar  lipgloss.Style
+	marker    lipgloss.Style
+	bold      lipgloss.Style
+	italic    lipgloss.Style
+	strike    lipgloss.Style
+	codeSpan  lipgloss.Style
+	link      lipgloss.Style
+	url       lipgloss.Style
+	codeFrame lipgloss.Style
+	border    lipgloss.Style
+	header    lipgloss.Style
+
+	keyword lipgloss.Style
+	str     lipgloss.Style
+	comment lipgloss.Style
+	number  lipgloss.Style
+}
+
+func newStyles(r *lipgloss.Renderer) styles {
+	pink, cyan, grey := lipgloss.Color("212"), lipgloss.Color("86"), lipgloss.Color("241")
+	return styles{
+		heading: []lipgloss.Style{
+			r.NewStyle().Foreground(pink).Bold(true).Underline(true),
+			r.NewStyle().Foreground(pink).Bold(true),
+			r.NewStyle().Foreground(cyan).Bold(true),
+		},
+		rule:      r.NewStyle().Foreground(grey),
+		quote:     r.NewStyle().Italic(true),
+		quoteBar:  r.NewStyle().Foreground(grey),
+		marker:    r.NewStyle().Foreground(cyan),
+		bold:      r.NewStyle().Bold(true),
+		italic:    r.NewStyle().Italic(true),
+		strike:    r.NewStyle().Strikethrough(true),
+		codeSpan:  r.NewStyle().Foreground(lipgloss.Color("203")),
+		link:      r.NewStyle().Foreground(cyan).Underline(true),
+		url:       r.NewStyle().Foreground(grey),
+		codeFrame: r.NewStyle().Foreground(grey),
+		border:    r.NewStyle().Foreground(grey),
+		header:    r.NewStyle().Bold(true),
+
+		keyword: r.NewStyle().Foreground(pink),
+		str:     r.NewStyle().Foreground(lipgloss.Color("114")),
+		comment: r.NewStyle().Foreground(grey).Italic(true),
+		number:  r.NewStyle().Foreground(lipgloss.Color("180")),
+	}
+}
+
+var (
+	codeSpanPattern = regexp.MustCompile("(`+)(.+?)(`+)")
+	linkPattern     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldPattern     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	strikePattern   = regexp.MustCompile(`~~([^~]+)~~`)
+	italicPattern   = regexp.MustCompile(`(^|[^\w*])\*([^*\s][^*]*)\*|(^|[^\w])_([^_\s][^_]*)_(\W|$)`)
+)
+
+// inline renders the inline markup of text: code spans, links, bold,
+// italic and strikethrough.
+func (st styles) inline(text string) string {
+	var b strings.Builder
+	for {
+		loc := codeSpanPattern.FindStringSubmatchIndex(text)
+		// A code span needs a closing run of backticks as long as the opening one.
+		if loc == nil || loc[3]-loc[2] != loc[7]-loc[6] {
+			b.WriteString(st.emphasis(text))
+			return b.String()
+		}
+		b.WriteString(st.emphasis(text[:loc[0]]))
+		b.WriteString(st.codeSpan.Render(strings.TrimSpace(text[loc[4]:loc[5]])))
+		text = text[loc[1]:]
+	}
+}
+
+// plainInline renders the inline markup of text in a block that has a style
+// of its own, in which styled spans would reset the block's style.
+func (st styles) plainInline(text string) string {
+	text = codeSpanPattern.ReplaceAllString(text, "$2")
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = boldPattern.ReplaceAllString(text, "$1$2")
+	text = strikePattern.ReplaceAllString(text, "$1")
+	return italicPattern.ReplaceAllString(text, "$1$2$3$4$5")
+}
+
+func (st styles) emphasis(text string) string {
+	text = linkPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := linkPattern.FindStringSubmatch(s)
+		if m[1] == m[2] {
+			return st.link.Render(m[1])
+		}
+		return st.link.Render(m[1]) + st.url.Render(" ("+m[2]+")")
+	})
+	text = boldPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := boldPattern.FindStringSubmatch(s)
+		return st.bold.Render(m[1] + m[2])
+	})
+	text = strikePattern.ReplaceAllStringFunc(text, func(s string) string {
+		return st.strike.Render(strikePattern.FindStringSubmatch(s)[1])
+	})
+	return italicPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := italicPattern.FindStringSubmatch(s)
+		if m[2] != "" {
+			return m[1] + st.italic.Render(m[2])
+		}
+		return m[3] + st.italic.Render(m[4]) + m[5]
+	})
+}
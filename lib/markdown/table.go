@@ -0,0 +1,133 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var delimiterCellPattern = regexp.MustCompile(`^\s*(:?)-+(:?)\s*$`)
+
+func isTableRow(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "|") && len(trimmed) > 1
+}
+
+// splitRow returns the cells of a table row.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// flushTable renders the table rows collected so far. Rows without the
+// delimiter row that makes them a table are rendered as plain lines.
+func (w *Writer) flushTable() error {
+	rows := w.table
+	w.table = nil
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var aligns []lipgloss.Position
+	if len(rows) >= 2 {
+		for _, cell := range splitRow(rows[1]) {
+			m := delimiterCellPattern.FindStringSubmatch(cell)
+			if m == nil {
+				aligns = nil
+				break
+			}
+			switch {
+			case m[1] != "" && m[2] != "":
+				aligns = append(aligns, lipgloss.Center)
+			case m[2] != "":
+				aligns = append(aligns, lipgloss.Right)
+			default:
+				aligns = append(aligns, lipgloss.Left)
+			}
+		}
+	}
+	if aligns == nil {
+		for _, row := range rows {
+			if err := w.print(w.st.inline(row)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cells := [][]string{w.renderCells(rows[0], len(aligns), w.st.header)}
+	for _, row := range rows[2:] {
+		cells = append(cells, w.renderCells(row, len(aligns), lipgloss.Style{}))
+	}
+	widths := make([]int, len(aligns))
+	for _, row := range cells {
+		for i, cell := range row {
+			widths[i] = max(widths[i], lipgloss.Width(cell))
+		}
+	}
+
+	bar := w.st.border.Render(" │ ")
+	for r, row := range cells {
+		padded := make([]string, len(row))
+		for i, cell := range row {
+			padded[i] = pad(cell, widths[i], aligns[i])
+		}
+		if err := w.print(strings.TrimRight(" "+strings.Join(padded, bar), " ")); err != nil {
+			return err
+		}
+		if r == 0 {
+			rules := make([]string, len(widths))
+			for i, width := range widths {
+				rules[i] = strings.Repeat("─", width)
+			}
+			if err := w.print(w.st.border.Render("─" + strings.Join(rules, "─┼─") + "─")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderCells renders the cells of a row, padded or cut to n cells.
+func (w *Writer) renderCells(row string, n int, style lipgloss.Style) []string {
+	cells := splitRow(row)
+	rendered := make([]string, n)
+	for i := range rendered {
+		if i < len(cells) {
+			rendered[i] = style.Render(w.st.inline(cells[i]))
+		}
+	}
+	return rendered
+}
+
+func pad(cell string, width int, align lipgloss.Position) string {
+	gap := width - lipgloss.Width(cell)
+	switch align {
+	case lipgloss.Right:
+		return strings.Repeat(" ", gap) + cell
+	case lipgloss.Center:
+		return strings.Repeat(" ", gap/2) + cell + strings.Repeat(" ", gap-gap/2)
+	default:
+		return cell + strings.Repeat(" ", gap)
+	}
+}
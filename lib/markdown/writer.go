@@ -0,0 +1,150 @@
+// Package markdown renders the markdown a model streams for display in a
+// terminal.
+package markdown
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+var (
+	fencePattern   = regexp.MustCompile("^(\\s*)(`{3,}|~{3,})\\s*([^`\\s]*)")
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rulePattern    = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	quotePattern   = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	bulletPattern  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	taskPattern    = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	orderedPattern = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+)
+
+// Writer renders markdown written to it. Output is produced a line at a
+// time, as soon as each line is complete; tables are held back until their
+// last row so that their columns can be aligned. Close must be called to
+// render whatever is still pending.
+type Writer struct {
+	out io.Writer
+	st  styles
+
+	// partial holds the start of a line whose end hasn't been written yet.
+	partial []byte
+
+	// fence is the marker that closes the code block being rendered, empty
+	// outside of code blocks.
+	fence  string
+	indent string
+	code   *highlighter
+
+	table []string
+}
+
+// NewWriter returns a Writer rendering to out, in the colors the terminal
+// behind out supports. With forceColors, colors are used even when out is not
+// a terminal, unless NO_COLOR says otherwise.
+func NewWriter(out io.Writer, forceColors bool) *Writer {
+	r := lipgloss.NewRenderer(out)
+	if forceColors && !r.Output().EnvNoColor() {
+		r.SetColorProfile(termenv.ANSI256)
+	}
+	return &Writer{out: out, st: newStyles(r)}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimSuffix(string(w.partial[:i]), "\r")
+		w.partial = w.partial[i+1:]
+		if err := w.line(line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Close renders the pending partial line and table.
+func (w *Writer) Close() error {
+	if len(w.partial) > 0 {
+		line := string(w.partial)
+		w.partial = nil
+		if err := w.line(line); err != nil {
+			return err
+		}
+	}
+	return w.flushTable()
+}
+
+func (w *Writer) line(line string) error {
+	if w.fence != "" {
+		return w.codeLine(line)
+	}
+
+	if isTableRow(line) {
+		w.table = append(w.table, line)
+		return nil
+	}
+	if err := w.flushTable(); err != nil {
+		return err
+	}
+
+	if m := fencePattern.FindStringSubmatch(line); m != nil {
+		w.indent, w.fence = m[1], m[2]
+		w.code = newHighlighter(m[3], w.st)
+		label := "╭─"
+		if m[3] != "" {
+			label += " " + m[3]
+		}
+		return w.print(m[1] + w.st.codeFrame.Render(label))
+	}
+	return w.print(w.block(line))
+}
+
+// codeLine renders a line of a code block, or its closing fence.
+func (w *Writer) codeLine(line string) error {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, w.fence) && strings.Trim(trimmed, w.fence[:1]) == "" {
+		w.fence = ""
+		return w.print(w.indent + w.st.codeFrame.Render("╰─"))
+	}
+	line = strings.TrimPrefix(line, w.indent)
+	return w.print(w.indent + w.st.codeFrame.Render("│ ") + w.code.line(line))
+}
+
+// block renders a line outside of code blocks and tables.
+func (w *Writer) block(line string) string {
+	if m := headingPattern.FindStringSubmatch(line); m != nil {
+		style := w.st.heading[min(len(m[1]), len(w.st.heading))-1]
+		return style.Render(w.st.plainInline(m[2]))
+	}
+	if rulePattern.MatchString(line) {
+		return w.st.rule.Render(strings.Repeat("─", 40))
+	}
+	if m := quotePattern.FindStringSubmatch(line); m != nil {
+		return w.st.quoteBar.Render("│ ") + w.st.quote.Render(w.st.plainInline(m[1]))
+	}
+	if m := bulletPattern.FindStringSubmatch(line); m != nil {
+		marker, text := "•", m[2]
+		if t := taskPattern.FindStringSubmatch(text); t != nil {
+			marker, text = "☐", t[2]
+			if t[1] != " " {
+				marker = "☑"
+			}
+		}
+		return m[1] + w.st.marker.Render(marker) + " " + w.st.inline(text)
+	}
+	if m := orderedPattern.FindStringSubmatch(line); m != nil {
+		return m[1] + w.st.marker.Render(m[2]) + " " + w.st.inline(m[3])
+	}
+	return w.st.inline(line)
+}
+
+func (w *Writer) print(s string) error {
+	_, err := io.WriteString(w.out, s+"\n")
+	return err
+}
@@ -0,0 +1,124 @@
+package markdown
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// render writes markdown to a Writer in pieces of the given size, as a
+// stream would, and returns the output. The output is not a terminal, so it
+// has no colors.
+func render(t *testing.T, markdown string, chunk int) string {
+	t.Helper()
+	var out bytes.Buffer
+	w := NewWriter(&out, false)
+	for len(markdown) > 0 {
+		n := min(chunk, len(markdown))
+		_, err := w.Write([]byte(markdown[:n]))
+		require.NoError(t, err)
+		markdown = markdown[n:]
+	}
+	require.NoError(t, w.Close())
+	return out.String()
+}
+
+func TestWriter_Blocks(t *testing.T) {
+	in := strings.Join([]string{
+		"# Title",
+		"Some **bold**, *italic* and `code` with a [link](https://example.com).",
+		"- one",
+		"  * nested",
+		"- [x] done",
+		"1. first",
+		"> quoted",
+		"---",
+		"snake_case_name stays",
+	}, "\n")
+	want := strings.Join([]string{
+		"Title",
+		"Some bold, italic and code with a link (https://example.com).",
+		"• one",
+		"  • nested",
+		"☑ done",
+		"1. first",
+		"│ quoted",
+		strings.Repeat("─", 40),
+		"snake_case_name stays",
+		"",
+	}, "\n")
+
+	assert.Equal(t, want, render(t, in, 1000))
+	assert.Equal(t, want, render(t, in, 3))
+}
+
+func TestWriter_CodeBlock(t *testing.T) {
+	in := "Before\n```go\n# not a heading\n- not a list\n```\nAfter\n"
+	want := "Before\n╭─ go\n│ # not a heading\n│ - not a list\n╰─\nAfter\n"
+	assert.Equal(t, want, render(t, in, 2))
+}
+
+func TestWriter_Table(t *testing.T) {
+	in := "| Name | Size |\n|:-----|-----:|\n| a | 1 |\n| long name | 100 |\nafter"
+	want := strings.Join([]string{
+		" Name      │ Size",
+		"───────────┼──────",
+		" a         │    1",
+		" long name │  100",
+		"after",
+		"",
+	}, "\n")
+	assert.Equal(t, want, render(t, in, 5))
+}
+
+func TestWriter_PipesWithoutDelimiterRowAreText(t *testing.T) {
+	assert.Equal(t, "| not | a table\n", render(t, "| not | a table", 100))
+}
+
+func TestWriter_PartialLineIsRenderedOnClose(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, false)
+	_, err := w.Write([]byte("## Hea"))
+	require.NoError(t, err)
+	assert.Empty(t, out.String())
+
+	_, err = w.Write([]byte("ding"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "Heading\n", out.String())
+}
+
+func TestWriter_ForcedColors(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	out := render(t, "**bold**\n", 100)
+	assert.Equal(t, "bold\n", out)
+
+	var colored bytes.Buffer
+	w := NewWriter(&colored, true)
+	_, err := w.Write([]byte("```go\nfunc main() {}\n```\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Contains(t, colored.String(), "\x1b[")
+	assert.Contains(t, colored.String(), "main() {}")
+}
+
+func TestHighlighter_CarriesBlockCommentsOver(t *testing.T) {
+	var out bytes.Buffer
+	h := newHighlighter("js", NewWriter(&out, true).st)
+
+	first := h.line("let x = 1; /* starts")
+	assert.Contains(t, first, "\x1b[")
+	assert.Equal(t, "*/", h.open)
+
+	h.line("still a comment */ let y")
+	assert.Empty(t, h.open)
+}
+
+func TestHighlighter_UnknownLanguageIsPlain(t *testing.T) {
+	var out bytes.Buffer
+	h := newHighlighter("brainfuck", NewWriter(&out, true).st)
+	assert.Equal(t, "+[->+<]", h.line("+[->+<]"))
+}
@@ -0,0 +1,93 @@
+package message
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxImageBytes caps the size of a single attached image.
+const MaxImageBytes = 20 << 20
+
+var (
+	ErrImageTooLarge = fmt.Errorf("image is larger than %d MiB", MaxImageBytes>>20)
+	ErrImageChanged  = errors.New("image changed since it was attached")
+)
+
+var imageMediaTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// Image is a picture attached to a user message. Sessions only record where
+// it lives and its digest; the content is read again whenever it is sent.
+type Image struct {
+	Path      string `json:"path"`
+	MediaType string `json:"media_type"`
+	SHA256    string `json:"sha256"`
+}
+
+// ImageMediaType returns the media type of an image file, judging by its
+// extension. ok is false for files that aren't supported images.
+func ImageMediaType(path string) (mediaType string, ok bool) {
+	mediaType, ok = imageMediaTypes[strings.ToLower(filepath.Ext(path))]
+	return mediaType, ok
+}
+
+// AttachImage reads the image at path and returns a reference to it.
+func AttachImage(path string) (Image, error) {
+	mediaType, ok := ImageMediaType(path)
+	if !ok {
+		return Image{}, fmt.Errorf("%s: not a supported image (png, jpg, gif, webp)", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Image{}, err
+	}
+	data, err := readImage(abs)
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{Path: abs, MediaType: mediaType, SHA256: digest(data)}, nil
+}
+
+// Read returns the content of the image, failing with ErrImageChanged when
+// the file no longer matches the digest recorded when it was attached.
+func (i Image) Read() ([]byte, error) {
+	data, err := readImage(i.Path)
+	if err != nil {
+		return nil, err
+	}
+	if digest(data) != i.SHA256 {
+		return nil, ErrImageChanged
+	}
+	return data, nil
+}
+
+// Placeholder stands in for the image wherever messages are shown as text.
+func (i Image) Placeholder() string {
+	return fmt.Sprintf("[image: %s]", i.Path)
+}
+
+func readImage(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > MaxImageBytes {
+		return nil, ErrImageTooLarge
+	}
+	return os.ReadFile(path)
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
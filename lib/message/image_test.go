@@ -0,0 +1,61 @@
+package message
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeImage(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestAttachImage_RecordsPathAndDigest(t *testing.T) {
+	path := writeImage(t, "shot.PNG", "pixels")
+
+	img, err := AttachImage(path)
+	require.NoError(t, err)
+	assert.Equal(t, path, img.Path)
+	assert.Equal(t, "image/png", img.MediaType)
+	assert.Len(t, img.SHA256, 64)
+
+	data, err := img.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "pixels", string(data))
+}
+
+func TestAttachImage_RejectsOtherFiles(t *testing.T) {
+	_, err := AttachImage(writeImage(t, "notes.txt", "text"))
+	assert.Error(t, err)
+}
+
+func TestImage_ReadDetectsChanges(t *testing.T) {
+	path := writeImage(t, "diagram.webp", "v1")
+	img, err := AttachImage(path)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("v2"), 0o600))
+	_, err = img.Read()
+	assert.ErrorIs(t, err, ErrImageChanged)
+
+	require.NoError(t, os.Remove(path))
+	_, err = img.Read()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMessage_TextShowsImagePlaceholders(t *testing.T) {
+	m := NewUserMessage("what is this?\n")
+	assert.Equal(t, "what is this?\n", m.Text())
+
+	m.Images = []Image{{Path: "/tmp/a.png"}, {Path: "/tmp/b.jpg"}}
+	assert.Equal(t, "what is this?\n[image: /tmp/a.png]\n[image: /tmp/b.jpg]", m.Text())
+
+	m.Content = ""
+	assert.Equal(t, "[image: /tmp/a.png]\n[image: /tmp/b.jpg]", m.Text())
+}
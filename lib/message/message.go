@@ -1,16 +1,110 @@
 package message
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 type Role string
 
 const (
 	RoleSystem    Role = "system"
 	RoleUser      Role = "user"
 	RoleAssistant Role = "assistant"
+
+	// RoleTool authors the result of a tool call; see ToolCallID.
+	RoleTool Role = "tool"
 )
 
+// Usage holds the token counts reported by the provider for a single response.
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	ReasoningTokens  int64 `json:"reasoning_tokens,omitempty"`
+}
+
+// Add accumulates other into u.
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.ReasoningTokens += other.ReasoningTokens
+}
+
+// ToolCall is a request by the model to run a tool.
+type ToolCall struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments is the JSON object of arguments the model passed.
+	Arguments string `json:"arguments"`
+}
+
+// Thinking is a block of a model's extended thinking, kept as the provider
+// returned it: providers verify the blocks sent back to them.
+type Thinking struct {
+	Text      string `json:"text,omitempty"`
+	Signature string `json:"signature,omitempty"`
+
+	// Redacted is the encrypted content of a block the provider withheld.
+	Redacted string `json:"redacted,omitempty"`
+}
+
 type Message struct {
 	Role    Role   `json:"role"`
 	Content string `json:"content"`
+
+	// Images are attached to user messages, after Content.
+	Images []Image `json:"images,omitempty"`
+
+	// Interrupted marks an assistant message whose stream was cancelled
+	// before the model finished; Content holds whatever was received.
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	// The following are recorded on assistant messages only.
+	Model   string    `json:"model,omitempty"`
+	BaseURL string    `json:"base_url,omitempty"`
+	Time    time.Time `json:"time,omitzero"`
+	Usage   *Usage    `json:"usage,omitempty"`
+
+	// ToolCalls are the tools an assistant message asks to run. Their
+	// results follow as tool messages.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	// Thinking is the extended thinking that led to an assistant message.
+	// It isn't shown, but is sent back along with the results of the tools
+	// the message calls.
+	Thinking []Thinking `json:"thinking,omitempty"`
+
+	// ToolCallID is the ID of the call a tool message holds the result of.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+
+	// Patch is the unified diff of the edits proposed in the answer that
+	// were applied to local files.
+	Patch string `json:"patch,omitempty"`
+}
+
+// Text returns the content of m for display, with images replaced by
+// placeholders and tool calls spelled out.
+func (m Message) Text() string {
+	if len(m.Images) == 0 && len(m.ToolCalls) == 0 {
+		return m.Content
+	}
+	parts := make([]string, 0, len(m.Images)+len(m.ToolCalls)+1)
+	if m.Content != "" {
+		parts = append(parts, strings.TrimRight(m.Content, "\n"))
+	}
+	for _, img := range m.Images {
+		parts = append(parts, img.Placeholder())
+	}
+	for _, call := range m.ToolCalls {
+		parts = append(parts, call.String())
+	}
+	return strings.Join(parts, "\n")
+}
+
+// String describes the call for display.
+func (c ToolCall) String() string {
+	return fmt.Sprintf("[tool call: %s %s]", c.Name, c.Arguments)
 }
 
 func NewRoleMessage(role Role, content string) Message {
@@ -31,3 +125,29 @@ func NewSystemMessage(content string) Message {
 func NewAssistantMessage(content string) Message {
 	return NewRoleMessage(RoleAssistant, content)
 }
+
+// NewToolMessage returns the result of the tool call with the given ID.
+func NewToolMessage(callID string, content string) Message {
+	m := NewRoleMessage(RoleTool, content)
+	m.ToolCallID = callID
+	return m
+}
+
+// NewInterruptedMessage returns a partial assistant message for a response
+// that was cut short by cancellation.
+func NewInterruptedMessage(content string) Message {
+	m := NewAssistantMessage(content)
+	m.Interrupted = true
+	return m
+}
+
+// LastIndexOfRole returns the index of the latest message authored by role,
+// or -1 if there is none.
+func LastIndexOfRole(messages []Message, role Role) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == role {
+			return i
+		}
+	}
+	return -1
+}
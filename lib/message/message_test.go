@@ -0,0 +1,33 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_TextShowsToolCalls(t *testing.T) {
+	m := NewAssistantMessage("Let me look.")
+	m.ToolCalls = []ToolCall{
+		{ID: "1", Name: "read_file", Arguments: `{"path":"go.mod"}`},
+		{ID: "2", Name: "grep", Arguments: `{"pattern":"TODO"}`},
+	}
+	assert.Equal(t, "Let me look.\n[tool call: read_file {\"path\":\"go.mod\"}]\n[tool call: grep {\"pattern\":\"TODO\"}]", m.Text())
+
+	result := NewToolMessage("1", "module example\n")
+	assert.Equal(t, "module example\n", result.Text())
+	assert.Equal(t, "1", result.ToolCallID)
+}
+
+func TestLastIndexOfRole(t *testing.T) {
+	messages := []Message{
+		NewSystemMessage("be brief"),
+		NewUserMessage("hi"),
+		NewAssistantMessage("hello"),
+		NewUserMessage("bye"),
+	}
+	assert.Equal(t, 3, LastIndexOfRole(messages, RoleUser))
+	assert.Equal(t, 2, LastIndexOfRole(messages, RoleAssistant))
+	assert.Equal(t, -1, LastIndexOfRole(messages, RoleTool))
+	assert.Equal(t, -1, LastIndexOfRole(nil, RoleUser))
+}
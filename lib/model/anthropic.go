@@ -0,0 +1,547 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+)
+
+const (
+	defaultAnthropicBaseURL = "https://api.anthropic.com/v1/"
+	anthropicVersion        = "2023-06-01"
+
+	// defaultAnthropicMaxTokens is the answer length asked for when none is
+	// set, as the API requires one. Extended thinking comes on top.
+	defaultAnthropicMaxTokens = 8192
+
+	// maxEventSize bounds a single line of the event stream.
+	maxEventSize = 4 << 20
+)
+
+// thinkingBudgets maps reasoning efforts to extended thinking budgets, in
+// tokens.
+var thinkingBudgets = map[string]int64{
+	generation.ReasoningEffortLow:    1024,
+	generation.ReasoningEffortMedium: 4096,
+	generation.ReasoningEffortHigh:   16384,
+}
+
+// anthropicProvider speaks the Anthropic Messages API.
+type anthropicProvider struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewAnthropicClient returns a client for the Anthropic Messages API. Without
+// an API key, $ANTHROPIC_API_KEY is used.
+func NewAnthropicClient(apiKey *string, baseURL *string, retry RetryPolicy) *Client {
+	p := &anthropicProvider{
+		apiKey:  os.Getenv("ANTHROPIC_API_KEY"),
+		baseURL: defaultAnthropicBaseURL,
+		client:  http.DefaultClient,
+	}
+	if apiKey != nil {
+		p.apiKey = *apiKey
+	}
+	if baseURL != nil {
+		p.baseURL = *baseURL
+	}
+	if !strings.HasSuffix(p.baseURL, "/") {
+		p.baseURL += "/"
+	}
+	return newClient(p, p.baseURL, retry)
+}
+
+// anthropicError is an error reported by the API, either as the response to a
+// request or as an event in the middle of its stream.
+type anthropicError struct {
+	StatusCode int
+	Header     http.Header
+	Type       string
+	Message    string
+}
+
+func (e *anthropicError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// errorStatuses maps the types of errors reported mid-stream to the status
+// they come with otherwise, so they are retried alike.
+var errorStatuses = map[string]int{
+	"rate_limit_error": http.StatusTooManyRequests,
+	"api_error":        http.StatusInternalServerError,
+	"overloaded_error": 529,
+}
+
+func (p *anthropicProvider) describe(err error) error {
+	if apiErr, ok := err.(*anthropicError); ok {
+		return fmt.Errorf("%s", apiErr.Message)
+	}
+	return err
+}
+
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	MaxTokens     int64                `json:"max_tokens"`
+	System        []anthropicBlock     `json:"system,omitempty"`
+	Messages      []anthropicMessage   `json:"messages"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Thinking      *anthropicThinking   `json:"thinking,omitempty"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Stream        bool                 `json:"stream"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block of any type; only the fields of its type
+// are set.
+type anthropicBlock struct {
+	Type string `json:"type"`
+
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+
+	// thinking and redacted_thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int64  `json:"budget_tokens"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+}
+
+// translateRequest builds the body of a request. The system prompt and the
+// conversation so far are marked for prompt caching, so that follow-up
+// requests only pay full price for what is new.
+func (p *anthropicProvider) translateRequest(req request) anthropicRequest {
+	gen := req.gen
+	body := anthropicRequest{
+		Model:         gen.Model,
+		MaxTokens:     defaultAnthropicMaxTokens,
+		Temperature:   gen.Temperature,
+		TopP:          gen.TopP,
+		StopSequences: gen.Stop,
+		Stream:        true,
+	}
+	if gen.MaxTokens != nil {
+		body.MaxTokens = *gen.MaxTokens
+	}
+	// The budget counts towards max_tokens, so it comes on top of the answer
+	// length asked for. Thinking doesn't go with sampling parameters.
+	if budget, ok := thinkingBudgets[gen.ReasoningEffort]; ok {
+		body.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		body.MaxTokens += budget
+		body.Temperature = nil
+		body.TopP = nil
+	}
+
+	var system []string
+	for _, m := range req.messages {
+		if m.Role == message.RoleSystem && m.Content != "" {
+			system = append(system, m.Content)
+		}
+	}
+	// The API has no option for JSON answers; they are only asked for.
+	if gen.Format != nil {
+		system = append(system, formatInstructions(*gen.Format))
+	}
+	if len(system) > 0 {
+		body.System = []anthropicBlock{{Type: "text", Text: strings.Join(system, "\n\n")}}
+		cache(body.System)
+	}
+
+	body.Messages = p.translateMessages(req.messages, len(req.tools) > 0)
+	if n := len(body.Messages); n > 0 {
+		cache(body.Messages[n-1].Content)
+	}
+
+	for _, t := range req.tools {
+		body.Tools = append(body.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+	}
+	if req.noToolCalls {
+		body.ToolChoice = &anthropicToolChoice{Type: "none"}
+	}
+	return body
+}
+
+// cache marks the end of blocks as a prompt caching breakpoint.
+func cache(blocks []anthropicBlock) {
+	if len(blocks) > 0 {
+		blocks[len(blocks)-1].CacheControl = &anthropicCacheControl{Type: "ephemeral"}
+	}
+}
+
+// translateMessages maps the conversation onto user and assistant messages;
+// system messages go into the system prompt instead. Tool results are sent
+// by the user, and consecutive messages of the same role are joined.
+// Without withTools, tool calls and results are spelled out as text: the API
+// rejects tool blocks in requests that don't define the tools.
+func (p *anthropicProvider) translateMessages(messages []message.Message, withTools bool) []anthropicMessage {
+	// Thinking is only sent back within the current turn, where the API
+	// needs it to continue after tool calls.
+	turn := message.LastIndexOfRole(messages, message.RoleUser)
+
+	var translated []anthropicMessage
+	for i, m := range messages {
+		var role string
+		var blocks []anthropicBlock
+		switch m.Role {
+		case message.RoleSystem:
+			continue
+		case message.RoleUser:
+			role, blocks = "user", p.userBlocks(m)
+		case message.RoleTool:
+			role = "user"
+			if withTools {
+				blocks = []anthropicBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}}
+			} else {
+				blocks = []anthropicBlock{{Type: "text", Text: fmt.Sprintf("[tool result: %s]", m.Content)}}
+			}
+		case message.RoleAssistant:
+			role, blocks = "assistant", assistantBlocks(m, i > turn, withTools)
+		default:
+			panic("unknown role")
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(translated); n > 0 && translated[n-1].Role == role {
+			translated[n-1].Content = append(translated[n-1].Content, blocks...)
+			continue
+		}
+		translated = append(translated, anthropicMessage{Role: role, Content: blocks})
+	}
+	return translated
+}
+
+// userBlocks builds the content of a user message. An image that can no
+// longer be read is replaced by a note saying so.
+func (p *anthropicProvider) userBlocks(m message.Message) []anthropicBlock {
+	var blocks []anthropicBlock
+	if m.Content != "" {
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+	}
+	for _, img := range m.Images {
+		data, err := img.Read()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: leaving out %s: %v\n", img.Path, err)
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: fmt.Sprintf("[image %s is no longer available]", img.Path)})
+			continue
+		}
+		blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicImageSource{
+			Type:      "base64",
+			MediaType: img.MediaType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		}})
+	}
+	return blocks
+}
+
+// assistantBlocks builds the content of an assistant message, with its
+// thinking if withThinking is set. Tool calls are spelled out as text unless
+// withTools is set.
+func assistantBlocks(m message.Message, withThinking, withTools bool) []anthropicBlock {
+	var blocks []anthropicBlock
+	if withThinking {
+		for _, t := range m.Thinking {
+			if t.Redacted != "" {
+				blocks = append(blocks, anthropicBlock{Type: "redacted_thinking", Data: t.Redacted})
+			} else {
+				blocks = append(blocks, anthropicBlock{Type: "thinking", Thinking: t.Text, Signature: t.Signature})
+			}
+		}
+	}
+	if text := strings.TrimRight(m.Content, " \t\n"); text != "" {
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+	}
+	for _, call := range m.ToolCalls {
+		if !withTools {
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: call.String()})
+			continue
+		}
+		input := json.RawMessage(call.Arguments)
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+		blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+	}
+	return blocks
+}
+
+// do sends a request to the API and returns the response if it succeeded.
+func (p *anthropicProvider) do(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	if body != nil {
+		httpReq.Header.Set("content-type", "application/json")
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &anthropicError{StatusCode: resp.StatusCode, Header: resp.Header, Message: resp.Status}
+	var errBody struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if data, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(data, &errBody) == nil && errBody.Error.Message != "" {
+		apiErr.Type = errBody.Error.Type
+		apiErr.Message = errBody.Error.Message
+	}
+	return nil, apiErr
+}
+
+func (p *anthropicProvider) models(ctx context.Context) ([]string, error) {
+	var names []string
+	query := url.Values{"limit": {"1000"}}
+	for {
+		resp, err := p.do(ctx, http.MethodGet, "models?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+			HasMore bool   `json:"has_more"`
+			LastID  string `json:"last_id"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range page.Data {
+			names = append(names, m.ID)
+		}
+		if !page.HasMore || page.LastID == "" {
+			return names, nil
+		}
+		query.Set("after_id", page.LastID)
+	}
+}
+
+// anthropicEvent is an event of a streamed answer; only the fields of its
+// type are set.
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Index        int            `json:"index"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+}
+
+func (p *anthropicProvider) stream(ctx context.Context, req request, out io.Writer) (response message.Message, streamed bool, err error) {
+	resp, err := p.do(ctx, http.MethodPost, "messages", p.translateRequest(req))
+	if err != nil {
+		return message.NewAssistantMessage(""), false, err
+	}
+	defer resp.Body.Close()
+
+	var blocks []anthropicBlock
+	var usage *message.Usage
+	done := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxEventSize)
+	for !done && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var event anthropicEvent
+		if err = json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			break
+		}
+
+		switch event.Type {
+		case "message_start":
+			u := event.Message.Usage
+			usage = &message.Usage{
+				PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+				CompletionTokens: u.OutputTokens,
+			}
+		case "content_block_start":
+			for len(blocks) <= event.Index {
+				blocks = append(blocks, anthropicBlock{})
+			}
+			blocks[event.Index] = event.ContentBlock
+			blocks[event.Index].Input = nil
+			if event.ContentBlock.Type == "tool_use" {
+				streamed = true
+			}
+		case "content_block_delta":
+			if event.Index >= len(blocks) {
+				continue
+			}
+			block := &blocks[event.Index]
+			switch event.Delta.Type {
+			case "text_delta":
+				block.Text += event.Delta.Text
+				fmt.Fprint(out, event.Delta.Text)
+				streamed = true
+			case "thinking_delta":
+				block.Thinking += event.Delta.Thinking
+			case "signature_delta":
+				block.Signature += event.Delta.Signature
+			case "input_json_delta":
+				block.Input = append(block.Input, event.Delta.PartialJSON...)
+			}
+		case "message_delta":
+			if usage != nil {
+				usage.CompletionTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			done = true
+		case "error":
+			err = &anthropicError{
+				StatusCode: errorStatuses[event.Error.Type],
+				Type:       event.Error.Type,
+				Message:    event.Error.Message,
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	if err == nil && !done {
+		err = io.ErrUnexpectedEOF
+	}
+
+	response = answerOf(blocks)
+	response.Usage = usage
+	if err != nil {
+		response.ToolCalls = nil
+		return response, streamed, err
+	}
+
+	// An answer that only calls tools has no text to end.
+	if response.Content != "" || len(response.ToolCalls) == 0 {
+		response.Content += "\n"
+		fmt.Fprintln(out, "")
+	}
+	return response, streamed, nil
+}
+
+// answerOf assembles an assistant message from the content blocks of an
+// answer.
+func answerOf(blocks []anthropicBlock) message.Message {
+	var text strings.Builder
+	var response message.Message
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			text.WriteString(b.Text)
+		case "thinking":
+			response.Thinking = append(response.Thinking, message.Thinking{Text: b.Thinking, Signature: b.Signature})
+		case "redacted_thinking":
+			response.Thinking = append(response.Thinking, message.Thinking{Redacted: b.Data})
+		case "tool_use":
+			args := string(b.Input)
+			if args == "" {
+				args = "{}"
+			}
+			response.ToolCalls = append(response.ToolCalls, message.ToolCall{ID: b.ID, Name: b.Name, Arguments: args})
+		}
+	}
+	response.Role = message.RoleAssistant
+	response.Content = text.String()
+	return response
+}
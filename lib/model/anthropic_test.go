@@ -0,0 +1,303 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/tool"
+	"github.com/dtrugman/qory/lib/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// anthropicServer answers successive requests to the Messages API with the
+// given handlers, and records the requests.
+func anthropicServer(t *testing.T, handlers ...http.HandlerFunc) (*Client, *[]map[string]any) {
+	t.Helper()
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+
+		req := map[string]any{"path": r.URL.Path}
+		if r.Method == http.MethodPost {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		} else {
+			req["after_id"] = r.URL.Query().Get("after_id")
+		}
+		requests = append(requests, req)
+		require.LessOrEqual(t, len(requests), len(handlers), "unexpected request")
+		handlers[len(requests)-1](w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	retry := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	return NewAnthropicClient(util.Ptr("key"), util.Ptr(server.URL), retry), &requests
+}
+
+// events streams the given events, ending the message.
+func events(events ...map[string]any) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events = append([]map[string]any{{
+			"type":    "message_start",
+			"message": map[string]any{"usage": map[string]any{"input_tokens": 10, "cache_read_input_tokens": 5, "output_tokens": 1}},
+		}}, events...)
+		events = append(events,
+			map[string]any{"type": "message_delta", "usage": map[string]any{"output_tokens": 7}},
+			map[string]any{"type": "message_stop"},
+		)
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event["type"], data)
+		}
+	}
+}
+
+func blockStart(index int, block map[string]any) map[string]any {
+	return map[string]any{"type": "content_block_start", "index": index, "content_block": block}
+}
+
+func blockDelta(index int, delta map[string]any) map[string]any {
+	return map[string]any{"type": "content_block_delta", "index": index, "delta": delta}
+}
+
+func textBlock(index int, text string) []map[string]any {
+	return []map[string]any{
+		blockStart(index, map[string]any{"type": "text", "text": ""}),
+		blockDelta(index, map[string]any{"type": "text_delta", "text": text}),
+	}
+}
+
+func TestAnthropicQuery_StreamsText(t *testing.T) {
+	client, requests := anthropicServer(t, events(
+		blockStart(0, map[string]any{"type": "text", "text": ""}),
+		blockDelta(0, map[string]any{"type": "text_delta", "text": "Hello, "}),
+		blockDelta(0, map[string]any{"type": "text_delta", "text": "world."}),
+	))
+
+	var out bytes.Buffer
+	answer, err := client.Query(context.Background(), generation.Params{Model: "claude", Temperature: util.Ptr(0.5)},
+		[]message.Message{message.NewSystemMessage("Be brief."), message.NewUserMessage("hi")}, &out)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello, world.\n", out.String())
+	assert.Equal(t, "Hello, world.\n", answer.Content)
+	assert.Equal(t, message.RoleAssistant, answer.Role)
+	assert.Equal(t, "claude", answer.Model)
+	assert.Equal(t, &message.Usage{PromptTokens: 15, CompletionTokens: 7}, answer.Usage)
+
+	require.Len(t, *requests, 1)
+	req := (*requests)[0]
+	assert.Equal(t, "/messages", req["path"])
+	assert.Equal(t, "claude", req["model"])
+	assert.Equal(t, 0.5, req["temperature"])
+	assert.EqualValues(t, defaultAnthropicMaxTokens, req["max_tokens"])
+	assert.Equal(t, true, req["stream"])
+	assert.Nil(t, req["thinking"])
+	assert.Equal(t, []any{map[string]any{
+		"type": "text", "text": "Be brief.", "cache_control": map[string]any{"type": "ephemeral"},
+	}}, req["system"])
+	assert.Equal(t, []any{map[string]any{"role": "user", "content": []any{map[string]any{
+		"type": "text", "text": "hi", "cache_control": map[string]any{"type": "ephemeral"},
+	}}}}, req["messages"])
+}
+
+func TestAnthropicQuery_ReasoningEffortEnablesThinking(t *testing.T) {
+	client, requests := anthropicServer(t, events(append([]map[string]any{
+		blockStart(0, map[string]any{"type": "thinking", "thinking": ""}),
+		blockDelta(0, map[string]any{"type": "thinking_delta", "thinking": "Let me see."}),
+		blockDelta(0, map[string]any{"type": "signature_delta", "signature": "sig"}),
+	}, textBlock(1, "Yes.")...)...))
+
+	var out bytes.Buffer
+	answer, err := client.Query(context.Background(),
+		generation.Params{Model: "claude", ReasoningEffort: generation.ReasoningEffortLow},
+		[]message.Message{message.NewUserMessage("sure?")}, &out)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Yes.\n", out.String(), "thinking is not printed")
+	assert.Equal(t, []message.Thinking{{Text: "Let me see.", Signature: "sig"}}, answer.Thinking)
+
+	req := (*requests)[0]
+	assert.Equal(t, map[string]any{"type": "enabled", "budget_tokens": 1024.0}, req["thinking"])
+	assert.EqualValues(t, defaultAnthropicMaxTokens+1024, req["max_tokens"])
+}
+
+func TestAnthropicQuery_ThinkingWithGenerationParams(t *testing.T) {
+	client, requests := anthropicServer(t, events(textBlock(0, "Yes.")...))
+
+	gen := generation.Params{
+		Model:           "claude",
+		ReasoningEffort: generation.ReasoningEffortMedium,
+		MaxTokens:       util.Ptr(int64(1000)),
+		Temperature:     util.Ptr(0.2),
+		TopP:            util.Ptr(0.9),
+	}
+	_, err := client.Query(context.Background(), gen, []message.Message{message.NewUserMessage("sure?")}, &bytes.Buffer{})
+	require.NoError(t, err)
+
+	req := (*requests)[0]
+	assert.Equal(t, map[string]any{"type": "enabled", "budget_tokens": 4096.0}, req["thinking"])
+	assert.EqualValues(t, 1000+4096, req["max_tokens"], "the budget comes on top of the answer")
+	assert.NotContains(t, req, "temperature")
+	assert.NotContains(t, req, "top_p")
+}
+
+func TestAnthropicQueryTools_ReplaysCallsAndThinking(t *testing.T) {
+	client, requests := anthropicServer(t,
+		events(
+			blockStart(0, map[string]any{"type": "thinking", "thinking": ""}),
+			blockDelta(0, map[string]any{"type": "thinking_delta", "thinking": "Echo it."}),
+			blockDelta(0, map[string]any{"type": "signature_delta", "signature": "sig"}),
+			blockStart(1, map[string]any{"type": "tool_use", "id": "toolu_1", "name": "echo", "input": map[string]any{}}),
+			blockDelta(1, map[string]any{"type": "input_json_delta", "partial_json": `{"text":`}),
+			blockDelta(1, map[string]any{"type": "input_json_delta", "partial_json": `"hi"}`}),
+		),
+		events(textBlock(0, "It said hi.")...),
+	)
+
+	var calls []string
+	var out bytes.Buffer
+	added, err := client.QueryTools(context.Background(), generation.Params{Model: "claude"}, []tool.Tool{echoTool(&calls)},
+		[]message.Message{message.NewUserMessage("say hi")}, &out)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`{"text":"hi"}`}, calls)
+	assert.Equal(t, "It said hi.\n", out.String())
+	require.Len(t, added, 3)
+	assert.Equal(t, []message.ToolCall{{ID: "toolu_1", Name: "echo", Arguments: `{"text":"hi"}`}}, added[0].ToolCalls)
+	assert.Equal(t, message.NewToolMessage("toolu_1", "hi"), added[1])
+
+	require.Len(t, *requests, 2)
+	assert.Equal(t, []any{map[string]any{
+		"name": "echo", "input_schema": map[string]any{"type": "object"},
+	}}, (*requests)[0]["tools"])
+
+	replay := (*requests)[1]["messages"].([]any)
+	require.Len(t, replay, 3)
+	assert.Equal(t, map[string]any{"role": "assistant", "content": []any{
+		map[string]any{"type": "thinking", "thinking": "Echo it.", "signature": "sig"},
+		map[string]any{"type": "tool_use", "id": "toolu_1", "name": "echo", "input": map[string]any{"text": "hi"}},
+	}}, replay[1])
+	assert.Equal(t, map[string]any{"role": "user", "content": []any{map[string]any{
+		"type": "tool_result", "tool_use_id": "toolu_1", "content": "hi", "cache_control": map[string]any{"type": "ephemeral"},
+	}}}, replay[2])
+}
+
+func TestAnthropicTranslateMessages_DropsThinkingOfPastTurns(t *testing.T) {
+	answer := message.NewAssistantMessage("Four.\n")
+	answer.Thinking = []message.Thinking{{Text: "2+2", Signature: "sig"}, {Redacted: "xyz"}}
+
+	translated := (&anthropicProvider{}).translateMessages([]message.Message{
+		message.NewUserMessage("2+2?"),
+		answer,
+		message.NewUserMessage("and"),
+		message.NewUserMessage("3+3?"),
+	}, false)
+
+	require.Len(t, translated, 3)
+	assert.Equal(t, []anthropicBlock{{Type: "text", Text: "Four."}}, translated[1].Content)
+	assert.Equal(t, []anthropicBlock{{Type: "text", Text: "and"}, {Type: "text", Text: "3+3?"}}, translated[2].Content)
+
+	// Within the current turn, thinking is sent back.
+	translated = (&anthropicProvider{}).translateMessages([]message.Message{message.NewUserMessage("2+2?"), answer}, false)
+	assert.Equal(t, []anthropicBlock{
+		{Type: "thinking", Thinking: "2+2", Signature: "sig"},
+		{Type: "redacted_thinking", Data: "xyz"},
+		{Type: "text", Text: "Four."},
+	}, translated[1].Content)
+}
+
+func TestAnthropicTranslateMessages_SpellsOutToolsWithoutDefinitions(t *testing.T) {
+	call := message.NewAssistantMessage("")
+	call.ToolCalls = []message.ToolCall{{ID: "toolu_1", Name: "echo", Arguments: `{"text":"hi"}`}}
+	conversation := []message.Message{
+		message.NewUserMessage("say hi"),
+		call,
+		message.NewToolMessage("toolu_1", "hi"),
+		message.NewAssistantMessage("It said hi."),
+		message.NewUserMessage("thanks"),
+	}
+
+	translated := (&anthropicProvider{}).translateMessages(conversation, false)
+	require.Len(t, translated, 5)
+	assert.Equal(t, []anthropicBlock{{Type: "text", Text: `[tool call: echo {"text":"hi"}]`}}, translated[1].Content)
+	assert.Equal(t, []anthropicBlock{{Type: "text", Text: "[tool result: hi]"}}, translated[2].Content)
+
+	translated = (&anthropicProvider{}).translateMessages(conversation, true)
+	assert.Equal(t, "tool_use", translated[1].Content[0].Type)
+	assert.Equal(t, "tool_result", translated[2].Content[0].Type)
+}
+
+func TestAnthropicQuery_RetriesOverloaded(t *testing.T) {
+	client, requests := anthropicServer(t,
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(529)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+		},
+		events(textBlock(0, "Finally.")...),
+	)
+
+	answer, err := client.Query(context.Background(), generation.Params{Model: "claude"},
+		[]message.Message{message.NewUserMessage("hi")}, &bytes.Buffer{})
+	require.NoError(t, err)
+	assert.Equal(t, "Finally.\n", answer.Content)
+	assert.Len(t, *requests, 2)
+}
+
+func TestAnthropicQuery_ReportsErrors(t *testing.T) {
+	client, _ := anthropicServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: too large"}}`)
+	})
+
+	var out bytes.Buffer
+	_, err := client.Query(context.Background(), generation.Params{Model: "claude"},
+		[]message.Message{message.NewUserMessage("hi")}, &out)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(*anthropicError).StatusCode)
+	assert.Equal(t, "Provider error: max_tokens: too large\n", out.String())
+}
+
+func TestAnthropicQuery_ErrorEventAfterText(t *testing.T) {
+	client, requests := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		events(append(textBlock(0, "Half"),
+			map[string]any{"type": "error", "error": map[string]any{"type": "overloaded_error", "message": "Overloaded"}})...)(w, r)
+	})
+
+	var out bytes.Buffer
+	_, err := client.Query(context.Background(), generation.Params{Model: "claude"},
+		[]message.Message{message.NewUserMessage("hi")}, &out)
+	require.Error(t, err)
+	assert.Len(t, *requests, 1, "nothing is retried once streamed")
+	assert.Equal(t, "Half\nProvider error: Overloaded\n", out.String())
+}
+
+func TestAnthropicAvailableModels_Paginates(t *testing.T) {
+	page := func(ids []string, more bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			var data []map[string]any
+			for _, id := range ids {
+				data = append(data, map[string]any{"id": id, "type": "model"})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": data, "has_more": more, "last_id": ids[len(ids)-1]})
+		}
+	}
+	client, requests := anthropicServer(t, page([]string{"a", "b"}, true), page([]string{"c"}, false))
+
+	models, err := client.AvailableModels()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, models)
+	require.Len(t, *requests, 2)
+	assert.Equal(t, "/models", (*requests)[0]["path"])
+	assert.Equal(t, "b", (*requests)[1]["after_id"])
+}
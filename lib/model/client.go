@@ -2,124 +2,125 @@ package model
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"os"
+	"time"
 
+	"github.com/dtrugman/qory/lib/generation"
 	"github.com/dtrugman/qory/lib/message"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
+	"github.com/dtrugman/qory/lib/tool"
 )
 
 var (
 	errorEmptyResponse = errors.New("empty response")
 )
 
+// Client queries the models of a provider. The provider's API is spoken by a
+// provider implementation; retries, tool calls and answer formats are handled
+// here, the same way for every provider.
 type Client struct {
-	openaiClient *openai.Client
+	provider provider
+	baseURL  string
+	retry    RetryPolicy
 }
 
-func NewClient(apiKey *string, baseURL *string) *Client {
-	var options []option.RequestOption
+// provider is the API of a model provider.
+type provider interface {
+	// models lists the IDs of the available models.
+	models(ctx context.Context) ([]string, error)
 
-	if apiKey != nil {
-		options = append(options, option.WithAPIKey(*apiKey))
-	}
+	// stream sends a single request and streams the text of the answer to
+	// out. streamed reports whether any of the answer arrived, after which
+	// the request can no longer be retried.
+	stream(ctx context.Context, req request, out io.Writer) (response message.Message, streamed bool, err error)
 
-	if baseURL != nil {
-		options = append(options, option.WithBaseURL(*baseURL))
-	}
+	// describe reduces an error of the provider's API to the message it
+	// carries, for the user.
+	describe(err error) error
+}
 
-	openaiClient := openai.NewClient(options...)
+// request is a single request to a provider.
+type request struct {
+	gen      generation.Params
+	messages []message.Message
 
-	return &Client{
-		openaiClient: openaiClient,
-	}
+	// tools are the tools the model may call; see QueryTools.
+	tools []tool.Tool
+	// noToolCalls keeps the model from calling tools, while still telling
+	// it about them, as the conversation holds calls already.
+	noToolCalls bool
 }
 
-func (c *Client) parseError(raw error) error {
-	var apierr *openai.Error
-	if !errors.As(raw, &apierr) {
-		return raw
-	}
-
-	var errobj struct {
-		Error openai.ErrorObject `json:"error"`
-	}
-	if err := json.Unmarshal([]byte(apierr.JSON.RawJSON()), &errobj); err != nil {
-		return raw
+func newClient(p provider, baseURL string, retry RetryPolicy) *Client {
+	return &Client{
+		provider: p,
+		baseURL:  baseURL,
+		retry:    retry,
 	}
-
-	return fmt.Errorf("%s", errobj.Error.Message)
 }
 
 func (c *Client) AvailableModels() ([]string, error) {
-	ctx := context.Background()
-
-	modelNames := make([]string, 0)
-
-	pager := c.openaiClient.Models.ListAutoPaging(ctx)
-	if pager.Err() != nil {
-		return nil, c.parseError(pager.Err())
+	models, err := c.provider.models(context.Background())
+	if err != nil {
+		return nil, c.provider.describe(err)
 	}
+	return models, nil
+}
 
-	for pager.Next() {
-		modelNames = append(modelNames, pager.Current().ID)
+// Query streams the model's answer to out and returns it as an assistant
+// message, annotated with the model name, base URL, completion time and token
+// usage.
+// Transient failures are retried according to the client's RetryPolicy, as
+// long as nothing has been streamed yet. If ctx is cancelled mid-stream, the
+// partial answer received so far is returned together with the context error.
+// With gen.Format, the answer is only written to out once it has been checked
+// (see queryJSON).
+func (c *Client) Query(ctx context.Context, gen generation.Params, messages []message.Message, out io.Writer) (message.Message, error) {
+	if gen.Format != nil {
+		return c.queryJSON(ctx, gen, messages, out)
 	}
-
-	return modelNames, nil
+	return c.query(ctx, gen, messages, out)
 }
 
-func (c *Client) translateMessage(m message.Message) openai.ChatCompletionMessageParamUnion {
-	switch m.Role {
-	case message.RoleUser:
-		return openai.UserMessage(m.Content)
-	case message.RoleSystem:
-		return openai.SystemMessage(m.Content)
-	case message.RoleAssistant:
-		return openai.AssistantMessage(m.Content)
-	default:
-		panic("unknown role")
-	}
+func (c *Client) query(ctx context.Context, gen generation.Params, messages []message.Message, out io.Writer) (message.Message, error) {
+	return c.send(ctx, request{gen: gen, messages: messages}, out)
 }
 
-func (c *Client) Query(model string, messages []message.Message) (string, error) {
-	ctx := context.Background()
+// send sends a request, retrying it as Query describes.
+func (c *Client) send(ctx context.Context, req request, out io.Writer) (message.Message, error) {
+	for attempt := 1; ; attempt++ {
+		response, streamed, err := c.provider.stream(ctx, req, out)
+		response.Model = req.gen.Model
+		response.BaseURL = c.baseURL
+		response.Time = time.Now()
+		if err == nil {
+			return response, nil
+		}
 
-	openAIMessages := make([]openai.ChatCompletionMessageParamUnion, 0)
-	for _, message := range messages {
-		openAIMessage := c.translateMessage(message)
-		openAIMessages = append(openAIMessages, openAIMessage)
-	}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			fmt.Fprintln(out, "")
+			return response, ctxErr
+		}
 
-	stream := c.openaiClient.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F(openAIMessages),
-		Model:    openai.F(model),
-	})
-
-	var aggregator strings.Builder
-
-	for stream.Next() {
-		event := stream.Current()
-		if len(event.Choices) > 0 {
-			choice := event.Choices[0]
-			if choice.Delta.Content != "" {
-				content := choice.Delta.Content
-				aggregator.WriteString(content)
-				fmt.Print(content)
+		described := c.provider.describe(err)
+
+		if !streamed && attempt < c.retry.MaxAttempts {
+			if delay, ok := c.retry.retryDelay(err, attempt); ok {
+				fmt.Fprintf(os.Stderr, "Provider error: %v (retrying in %s, attempt %d/%d)\n",
+					described, delay.Round(time.Millisecond), attempt+1, c.retry.MaxAttempts)
+				if err := sleepContext(ctx, delay); err != nil {
+					return message.Message{}, err
+				}
+				continue
 			}
 		}
-	}
 
-	if err := stream.Err(); err != nil {
-		parsed := c.parseError(err)
-		fmt.Printf("Provider error: %v\n", parsed)
-		return "", err
+		if streamed {
+			fmt.Fprintln(out, "")
+		}
+		fmt.Fprintf(out, "Provider error: %v\n", described)
+		return message.Message{}, err
 	}
-
-	aggregator.WriteString("\n")
-	fmt.Println("")
-
-	return aggregator.String(), nil
 }
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateParts_EncodesImages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dot.gif")
+	require.NoError(t, os.WriteFile(path, []byte("GIF89a"), 0o600))
+	img, err := message.AttachImage(path)
+	require.NoError(t, err)
+
+	m := message.NewUserMessage("what is this?")
+	m.Images = []message.Image{img}
+
+	parts := (&openaiProvider{}).translateParts(m)
+	require.Len(t, parts, 2)
+	assert.Equal(t, "what is this?", parts[0].(openai.ChatCompletionContentPartTextParam).Text.Value)
+	url := parts[1].(openai.ChatCompletionContentPartImageParam).ImageURL.Value.URL.Value
+	assert.Equal(t, "data:image/gif;base64,R0lGODlh", url)
+}
+
+func TestTranslateParts_MissingImageBecomesNote(t *testing.T) {
+	m := message.NewUserMessage("")
+	m.Images = []message.Image{{Path: "/nonexistent/shot.png", MediaType: "image/png"}}
+
+	parts := (&openaiProvider{}).translateParts(m)
+	require.Len(t, parts, 1)
+	assert.Contains(t, parts[0].(openai.ChatCompletionContentPartTextParam).Text.Value, "no longer available")
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/jsonschema"
+	"github.com/dtrugman/qory/lib/message"
+)
+
+// queryJSON queries for an answer in the format gen.Format asks for. The
+// complete answer is checked against the format; if it doesn't conform, the
+// model is told what is wrong and asked once more. Only the JSON of a valid
+// answer is written to out, and kept as the content of the answer.
+func (c *Client) queryJSON(ctx context.Context, gen generation.Params, messages []message.Message, out io.Writer) (message.Message, error) {
+	check, err := formatChecker(*gen.Format)
+	if err != nil {
+		return message.Message{}, err
+	}
+
+	response, err := c.query(ctx, gen, messages, io.Discard)
+	if err != nil {
+		return response, err
+	}
+
+	doc, invalid := check(response.Content)
+	if invalid != nil {
+		fmt.Fprintf(os.Stderr, "Invalid answer: %v (asking again)\n", invalid)
+		retry := append(slices.Clone(messages), response, message.NewUserMessage(
+			fmt.Sprintf("Your answer is invalid: %v. Reply again with only the corrected JSON.", invalid)))
+
+		first := response.Usage
+		if response, err = c.query(ctx, gen, retry, io.Discard); err != nil {
+			return response, err
+		}
+		response.Usage = addUsage(first, response.Usage)
+
+		if doc, invalid = check(response.Content); invalid != nil {
+			return message.Message{}, fmt.Errorf("invalid answer: %w", invalid)
+		}
+	}
+
+	response.Content = doc + "\n"
+	fmt.Fprint(out, response.Content)
+	return response, nil
+}
+
+// formatInstructions asks for an answer in format. Providers are told about
+// it in the conversation as well as through their options, if any: OpenAI
+// refuses JSON answers unless asked for JSON in so many words, and not every
+// compatible API enforces a schema.
+func formatInstructions(format generation.Format) string {
+	text := "Answer with only a JSON object, without any text or code fence around it."
+	if len(format.Schema) > 0 {
+		text += " The object must match this JSON Schema:\n" + string(format.Schema)
+	}
+	return text
+}
+
+// formatChecker returns a function that extracts the JSON document of an
+// answer and checks it against format.
+func formatChecker(format generation.Format) (func(answer string) (string, error), error) {
+	var schema *jsonschema.Schema
+	if len(format.Schema) > 0 {
+		var err error
+		if schema, err = jsonschema.Compile(format.Schema); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(answer string) (string, error) {
+		doc := unfence(answer)
+		if schema != nil {
+			return doc, schema.Validate([]byte(doc))
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(doc), &obj); err != nil {
+			return doc, errors.New("not a JSON object")
+		}
+		return doc, nil
+	}, nil
+}
+
+// unfence returns answer without the surrounding whitespace and the code
+// fence that providers without structured output tend to put around JSON.
+func unfence(answer string) string {
+	doc := strings.TrimSpace(answer)
+	if !strings.HasPrefix(doc, "```") || !strings.HasSuffix(doc, "```") {
+		return doc
+	}
+	_, body, found := strings.Cut(doc, "\n")
+	if !found {
+		return doc
+	}
+	return strings.TrimSpace(strings.TrimSuffix(body, "```"))
+}
+
+func addUsage(a, b *message.Usage) *message.Usage {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	sum := *a
+	sum.Add(*b)
+	return &sum
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// answerServer streams the given answers to successive chat completion
+// requests, and records the requests.
+func answerServer(t *testing.T, answers ...string) (*Client, *[]map[string]any) {
+	t.Helper()
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+		require.LessOrEqual(t, len(requests), len(answers), "unexpected request")
+
+		chunk, _ := json.Marshal(map[string]any{
+			"id": "1", "object": "chat.completion.chunk", "model": "m",
+			"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"content": answers[len(requests)-1]}}},
+			"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+		})
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", chunk)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(util.Ptr("key"), util.Ptr(server.URL), RetryPolicy{MaxAttempts: 1}), &requests
+}
+
+const citySchema = `{"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"], "additionalProperties": false}`
+
+func TestQuery_SchemaFormat(t *testing.T) {
+	client, requests := answerServer(t, "```json\n{\"city\": \"Paris\"}\n```")
+
+	var out bytes.Buffer
+	gen := generation.Params{Model: "m", Format: &generation.Format{Schema: json.RawMessage(citySchema), Name: "city"}}
+	response, err := client.Query(context.Background(), gen, []message.Message{message.NewUserMessage("capital of France?")}, &out)
+	require.NoError(t, err)
+
+	assert.Equal(t, "{\"city\": \"Paris\"}\n", out.String())
+	assert.Equal(t, "{\"city\": \"Paris\"}\n", response.Content)
+
+	require.Len(t, *requests, 1)
+	format := (*requests)[0]["response_format"].(map[string]any)
+	assert.Equal(t, "json_schema", format["type"])
+	schema := format["json_schema"].(map[string]any)
+	assert.Equal(t, "city", schema["name"])
+	assert.Equal(t, true, schema["strict"])
+	assert.Equal(t, []any{"city"}, schema["schema"].(map[string]any)["required"])
+}
+
+func TestQuery_SchemaFormatNotStrict(t *testing.T) {
+	client, requests := answerServer(t, `{"city": "Paris"}`)
+
+	// OpenAI's strict mode refuses optional properties.
+	optional := `{"type": "object", "properties": {"city": {"type": "string"}, "country": {"type": "string"}}, "required": ["city"]}`
+	gen := generation.Params{Model: "m", Format: &generation.Format{Schema: json.RawMessage(optional), Name: "city"}}
+	_, err := client.Query(context.Background(), gen, []message.Message{message.NewUserMessage("capital of France?")}, io.Discard)
+	require.NoError(t, err)
+
+	require.Len(t, *requests, 1)
+	schema := (*requests)[0]["response_format"].(map[string]any)["json_schema"].(map[string]any)
+	assert.NotContains(t, schema, "strict")
+}
+
+func TestStrictSchema(t *testing.T) {
+	assert.True(t, strictSchema(json.RawMessage(citySchema)))
+	assert.False(t, strictSchema(json.RawMessage(`{"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}`)))
+	assert.False(t, strictSchema(json.RawMessage(`{"type": "array", "items": {"type": "string"}}`)))
+	assert.False(t, strictSchema(json.RawMessage(`{"type": "object", "properties": {"at": {"type": "object", "properties": {"x": {"type": "number"}}, "additionalProperties": false}}, "required": ["at"], "additionalProperties": false}`)))
+}
+
+func TestQuery_SchemaFormatAsksAgainOnce(t *testing.T) {
+	client, requests := answerServer(t, `{"town": "Paris"}`, `{"city": "Paris"}`)
+
+	var out bytes.Buffer
+	gen := generation.Params{Model: "m", Format: &generation.Format{Schema: json.RawMessage(citySchema), Name: "city"}}
+	response, err := client.Query(context.Background(), gen, []message.Message{message.NewUserMessage("capital of France?")}, &out)
+	require.NoError(t, err)
+
+	assert.Equal(t, "{\"city\": \"Paris\"}\n", out.String())
+	assert.Equal(t, &message.Usage{PromptTokens: 20, CompletionTokens: 10}, response.Usage)
+
+	require.Len(t, *requests, 2)
+	retry := (*requests)[1]["messages"].([]any)
+	require.Len(t, retry, 4, "the question, answer and correction, then the format instructions")
+	assert.Equal(t, "{\"town\": \"Paris\"}\n", requestText(retry[1]))
+	assert.Equal(t, `Your answer is invalid: missing required property "city". Reply again with only the corrected JSON.`,
+		requestText(retry[2]))
+}
+
+// requestText returns the text of a message of a request, which the SDK
+// sends as a list of parts.
+func requestText(m any) string {
+	parts := m.(map[string]any)["content"].([]any)
+	return parts[0].(map[string]any)["text"].(string)
+}
+
+func TestQuery_SchemaFormatFailsAfterRetry(t *testing.T) {
+	client, _ := answerServer(t, `{"town": "Paris"}`, `Paris`)
+
+	var out bytes.Buffer
+	gen := generation.Params{Model: "m", Format: &generation.Format{Schema: json.RawMessage(citySchema), Name: "city"}}
+	_, err := client.Query(context.Background(), gen, []message.Message{message.NewUserMessage("capital of France?")}, &out)
+	assert.ErrorContains(t, err, "invalid answer: not valid JSON")
+	assert.Empty(t, out.String())
+}
+
+func TestQuery_JSONObjectFormat(t *testing.T) {
+	client, requests := answerServer(t, `["not", "an", "object"]`, `{"ok": true}`)
+
+	var out bytes.Buffer
+	gen := generation.Params{Model: "m", Format: &generation.Format{}}
+	_, err := client.Query(context.Background(), gen, []message.Message{message.NewUserMessage("status?")}, &out)
+	require.NoError(t, err)
+
+	assert.Equal(t, "{\"ok\": true}\n", out.String())
+	require.Len(t, *requests, 2)
+	assert.Equal(t, map[string]any{"type": "json_object"}, (*requests)[0]["response_format"])
+
+	// OpenAI refuses json_object unless the messages mention JSON.
+	messages := (*requests)[0]["messages"].([]any)
+	require.Len(t, messages, 2)
+	instructions := messages[1].(map[string]any)
+	assert.Equal(t, "system", instructions["role"])
+	assert.Contains(t, requestText(instructions), "JSON object")
+}
@@ -0,0 +1,359 @@
+package model
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/tool"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
+)
+
+const (
+	defaultBaseURL = "https://api.openai.com/v1/"
+)
+
+// openaiProvider speaks the OpenAI chat completions API, which most other
+// providers offer as well.
+type openaiProvider struct {
+	client *openai.Client
+}
+
+// NewClient returns a client for the OpenAI API, or any API compatible with
+// it at baseURL.
+func NewClient(apiKey *string, baseURL *string, retry RetryPolicy) *Client {
+	var options []option.RequestOption
+
+	if apiKey != nil {
+		options = append(options, option.WithAPIKey(*apiKey))
+	}
+
+	resolvedBaseURL := defaultBaseURL
+	if baseURL != nil {
+		options = append(options, option.WithBaseURL(*baseURL))
+		resolvedBaseURL = *baseURL
+	}
+
+	// Retries are handled by Client.send, which knows whether anything was streamed yet.
+	options = append(options, option.WithMaxRetries(0))
+
+	return newClient(&openaiProvider{client: openai.NewClient(options...)}, resolvedBaseURL, retry)
+}
+
+func (p *openaiProvider) describe(raw error) error {
+	var apierr *openai.Error
+	if !errors.As(raw, &apierr) {
+		return raw
+	}
+
+	var errobj struct {
+		Error openai.ErrorObject `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(apierr.JSON.RawJSON()), &errobj); err != nil {
+		return raw
+	}
+
+	return fmt.Errorf("%s", errobj.Error.Message)
+}
+
+func (p *openaiProvider) models(ctx context.Context) ([]string, error) {
+	modelNames := make([]string, 0)
+
+	pager := p.client.Models.ListAutoPaging(ctx)
+	if pager.Err() != nil {
+		return nil, pager.Err()
+	}
+
+	for pager.Next() {
+		modelNames = append(modelNames, pager.Current().ID)
+	}
+
+	return modelNames, nil
+}
+
+func (p *openaiProvider) translateMessage(m message.Message) openai.ChatCompletionMessageParamUnion {
+	switch m.Role {
+	case message.RoleUser:
+		if len(m.Images) > 0 {
+			return openai.UserMessageParts(p.translateParts(m)...)
+		}
+		return openai.UserMessage(m.Content)
+	case message.RoleSystem:
+		return openai.SystemMessage(m.Content)
+	case message.RoleAssistant:
+		if len(m.ToolCalls) > 0 {
+			return translateToolCalls(m)
+		}
+		return openai.AssistantMessage(m.Content)
+	case message.RoleTool:
+		return openai.ToolMessage(m.ToolCallID, m.Content)
+	default:
+		panic("unknown role")
+	}
+}
+
+// translateParts builds the content parts of a user message with images. An
+// image that can no longer be read is replaced by a note saying so.
+func (p *openaiProvider) translateParts(m message.Message) []openai.ChatCompletionContentPartUnionParam {
+	var parts []openai.ChatCompletionContentPartUnionParam
+	if m.Content != "" {
+		parts = append(parts, openai.TextPart(m.Content))
+	}
+	for _, img := range m.Images {
+		data, err := img.Read()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: leaving out %s: %v\n", img.Path, err)
+			parts = append(parts, openai.TextPart(fmt.Sprintf("[image %s is no longer available]", img.Path)))
+			continue
+		}
+		url := fmt.Sprintf("data:%s;base64,%s", img.MediaType, base64.StdEncoding.EncodeToString(data))
+		parts = append(parts, openai.ImagePart(url))
+	}
+	return parts
+}
+
+// translateRequest builds the parameters of a request, leaving unset
+// generation parameters out so the provider's defaults apply.
+func (p *openaiProvider) translateRequest(req request) openai.ChatCompletionNewParams {
+	gen := req.gen
+	params := openai.ChatCompletionNewParams{
+		Model: openai.F(gen.Model),
+		StreamOptions: openai.F(openai.ChatCompletionStreamOptionsParam{
+			IncludeUsage: openai.F(true),
+		}),
+	}
+	if gen.Temperature != nil {
+		params.Temperature = openai.F(*gen.Temperature)
+	}
+	if gen.TopP != nil {
+		params.TopP = openai.F(*gen.TopP)
+	}
+	if gen.MaxTokens != nil {
+		params.MaxCompletionTokens = openai.F(*gen.MaxTokens)
+	}
+	if len(gen.Stop) > 0 {
+		params.Stop = openai.F[openai.ChatCompletionNewParamsStopUnion](
+			openai.ChatCompletionNewParamsStopArray(gen.Stop))
+	}
+	if gen.Seed != nil {
+		params.Seed = openai.F(*gen.Seed)
+	}
+	if gen.ReasoningEffort != "" {
+		params.ReasoningEffort = openai.F(openai.ChatCompletionReasoningEffort(gen.ReasoningEffort))
+	}
+	if gen.Format != nil {
+		params.ResponseFormat = openai.F(translateFormat(*gen.Format))
+	}
+
+	if len(req.tools) > 0 {
+		params.Tools = openai.F(translateTools(req.tools))
+	}
+	if req.noToolCalls {
+		params.ToolChoice = openai.F[openai.ChatCompletionToolChoiceOptionUnionParam](openai.ChatCompletionToolChoiceOptionAutoNone)
+	}
+
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(req.messages)+1)
+	for _, m := range req.messages {
+		messages = append(messages, p.translateMessage(m))
+	}
+	if gen.Format != nil {
+		messages = append(messages, openai.SystemMessage(formatInstructions(*gen.Format)))
+	}
+	params.Messages = openai.F(messages)
+	return params
+}
+
+// translateFormat asks for a JSON object, or for structured output matching
+// the format's schema. Strict mode is only asked for when the schema follows
+// its rules; otherwise the answer is left to local validation.
+func translateFormat(format generation.Format) openai.ChatCompletionNewParamsResponseFormatUnion {
+	if len(format.Schema) == 0 {
+		return openai.ResponseFormatJSONObjectParam{
+			Type: openai.F(openai.ResponseFormatJSONObjectTypeJSONObject),
+		}
+	}
+	schema := openai.ResponseFormatJSONSchemaJSONSchemaParam{
+		Name:   openai.F(format.Name),
+		Schema: openai.F[interface{}](format.Schema),
+	}
+	if strictSchema(format.Schema) {
+		schema.Strict = openai.F(true)
+	}
+	return openai.ResponseFormatJSONSchemaParam{
+		Type:       openai.F(openai.ResponseFormatJSONSchemaTypeJSONSchema),
+		JSONSchema: openai.F(schema),
+	}
+}
+
+// strictSchema reports whether OpenAI accepts schema in strict mode: the
+// root is an object, and every object lists all of its properties as
+// required and allows no others.
+func strictSchema(schema json.RawMessage) bool {
+	var root map[string]any
+	if err := json.Unmarshal(schema, &root); err != nil || root["type"] != "object" {
+		return false
+	}
+	return strictNode(root)
+}
+
+func strictNode(node any) bool {
+	switch n := node.(type) {
+	case map[string]any:
+		props, hasProps := n["properties"].(map[string]any)
+		if hasProps || n["type"] == "object" {
+			if n["additionalProperties"] != false {
+				return false
+			}
+			required, _ := n["required"].([]any)
+			for name := range props {
+				if !slices.Contains(required, any(name)) {
+					return false
+				}
+			}
+		}
+		for _, v := range n {
+			if !strictNode(v) {
+				return false
+			}
+		}
+	case []any:
+		for _, v := range n {
+			if !strictNode(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func translateTools(tools []tool.Tool) []openai.ChatCompletionToolParam {
+	params := make([]openai.ChatCompletionToolParam, 0, len(tools))
+	for _, t := range tools {
+		params = append(params, openai.ChatCompletionToolParam{
+			Type: openai.F(openai.ChatCompletionToolTypeFunction),
+			Function: openai.F(shared.FunctionDefinitionParam{
+				Name:        openai.F(t.Name),
+				Description: openai.F(t.Description),
+				Parameters:  openai.F(shared.FunctionParameters(t.Parameters)),
+			}),
+		})
+	}
+	return params
+}
+
+// translateToolCalls builds an assistant message calling tools.
+func translateToolCalls(m message.Message) openai.ChatCompletionAssistantMessageParam {
+	calls := make([]openai.ChatCompletionMessageToolCallParam, 0, len(m.ToolCalls))
+	for _, call := range m.ToolCalls {
+		calls = append(calls, openai.ChatCompletionMessageToolCallParam{
+			ID:   openai.F(call.ID),
+			Type: openai.F(openai.ChatCompletionMessageToolCallTypeFunction),
+			Function: openai.F(openai.ChatCompletionMessageToolCallFunctionParam{
+				Name:      openai.F(call.Name),
+				Arguments: openai.F(call.Arguments),
+			}),
+		})
+	}
+
+	param := openai.ChatCompletionAssistantMessageParam{
+		Role:      openai.F(openai.ChatCompletionAssistantMessageParamRoleAssistant),
+		ToolCalls: openai.F(calls),
+	}
+	if m.Content != "" {
+		param.Content = openai.F([]openai.ChatCompletionAssistantMessageParamContentUnion{
+			openai.TextPart(m.Content),
+		})
+	}
+	return param
+}
+
+func (p *openaiProvider) stream(ctx context.Context, req request, out io.Writer) (response message.Message, streamed bool, err error) {
+	stream := p.client.Chat.Completions.NewStreaming(ctx, p.translateRequest(req))
+	defer stream.Close()
+
+	var aggregator strings.Builder
+	var usage *message.Usage
+	var calls toolCalls
+
+	for stream.Next() {
+		event := stream.Current()
+		if len(event.Choices) > 0 {
+			choice := event.Choices[0]
+			if choice.Delta.Content != "" {
+				content := choice.Delta.Content
+				aggregator.WriteString(content)
+				fmt.Fprint(out, content)
+				streamed = true
+			}
+			for _, delta := range choice.Delta.ToolCalls {
+				calls.add(delta)
+				streamed = true
+			}
+		}
+		// With include_usage, the final chunk carries the totals for the request.
+		if event.Usage.TotalTokens > 0 {
+			usage = translateUsage(event.Usage)
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		response = message.NewAssistantMessage(aggregator.String())
+		response.Usage = usage
+		return response, streamed, err
+	}
+
+	// An answer that only calls tools has no text to end.
+	if aggregator.Len() > 0 || len(calls) == 0 {
+		aggregator.WriteString("\n")
+		fmt.Fprintln(out, "")
+	}
+
+	response = message.NewAssistantMessage(aggregator.String())
+	response.ToolCalls = calls.messages()
+	response.Usage = usage
+	return response, streamed, nil
+}
+
+func translateUsage(u openai.CompletionUsage) *message.Usage {
+	return &message.Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		ReasoningTokens:  u.CompletionTokensDetails.ReasoningTokens,
+	}
+}
+
+// toolCalls assembles the tool calls of a streamed answer, which arrive in
+// fragments keyed by the index of the call.
+type toolCalls []message.ToolCall
+
+func (c *toolCalls) add(delta openai.ChatCompletionChunkChoicesDeltaToolCall) {
+	for int64(len(*c)) <= delta.Index {
+		*c = append(*c, message.ToolCall{})
+	}
+	call := &(*c)[delta.Index]
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	if delta.Function.Name != "" {
+		call.Name = delta.Function.Name
+	}
+	call.Arguments += delta.Function.Arguments
+}
+
+// messages returns the calls, or nil if there are none.
+func (c toolCalls) messages() []message.ToolCall {
+	if len(c) == 0 {
+		return nil
+	}
+	return c
+}
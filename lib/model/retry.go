@@ -0,0 +1,157 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/dtrugman/qory/lib/config"
+	"github.com/openai/openai-go"
+)
+
+const defaultRetryMaxDelay = 30 * time.Second
+
+// RetryPolicy controls how transient provider failures are retried.
+// Only failures that happen before the first token is streamed are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts, including the first one
+	BaseDelay   time.Duration // delay before the first retry, doubled on each retry
+	MaxDelay    time.Duration // upper bound for a single delay, even one the server asks for
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: config.DefaultRetryAttempts,
+		BaseDelay:   config.DefaultRetryDelay,
+		MaxDelay:    defaultRetryMaxDelay,
+	}
+}
+
+// backoff returns the delay before the given retry (1-based), using
+// exponential growth with "equal jitter": half fixed, half random.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// retryDelay decides whether err is transient and, if so, how long to wait
+// before the given retry. A server-provided Retry-After takes precedence over
+// the computed backoff, but is still capped at MaxDelay.
+func (p RetryPolicy) retryDelay(err error, retry int) (time.Duration, bool) {
+	if !isTransient(err) {
+		return 0, false
+	}
+
+	if _, header, ok := httpStatus(err); ok && header != nil {
+		if d, ok := parseRetryAfter(header); ok {
+			if p.MaxDelay > 0 && d > p.MaxDelay {
+				d = p.MaxDelay
+			}
+			return d, true
+		}
+	}
+
+	return p.backoff(retry), true
+}
+
+// isTransient reports whether err is worth retrying: rate limits, server-side
+// failures, timeouts and dropped connections.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if code, _, ok := httpStatus(err); ok {
+		switch {
+		case code == http.StatusRequestTimeout,
+			code == http.StatusConflict,
+			code == http.StatusTooManyRequests:
+			return true
+		case code >= http.StatusInternalServerError:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// httpStatus returns the status code and headers of the response an API
+// error stems from.
+func httpStatus(err error) (int, http.Header, bool) {
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		var header http.Header
+		if openaiErr.Response != nil {
+			header = openaiErr.Response.Header
+		}
+		return openaiErr.StatusCode, header, true
+	}
+
+	var anthropicErr *anthropicError
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode, anthropicErr.Header, true
+	}
+
+	return 0, nil, false
+}
+
+// parseRetryAfter reads the delay requested by the server, supporting the
+// non-standard "retry-after-ms" header as well as both forms of Retry-After
+// (delta-seconds and HTTP-date).
+func parseRetryAfter(h http.Header) (time.Duration, bool) {
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, time.Until(t)), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
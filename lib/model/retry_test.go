@@ -0,0 +1,104 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_BackoffGrowsWithinJitterBounds(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for retry, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		5: time.Second, // capped
+	} {
+		d := p.backoff(retry)
+		assert.GreaterOrEqual(t, d, want/2, "retry %d", retry)
+		assert.LessOrEqual(t, d, want, "retry %d", retry)
+	}
+}
+
+func TestIsTransient_StatusCodes(t *testing.T) {
+	for code, want := range map[int]bool{
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusRequestTimeout:      true,
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusNotFound:            false,
+	} {
+		err := &openai.Error{StatusCode: code}
+		assert.Equal(t, want, isTransient(err), "status %d", code)
+	}
+}
+
+func TestIsTransient_AnthropicErrors(t *testing.T) {
+	assert.True(t, isTransient(&anthropicError{StatusCode: 529, Type: "overloaded_error"}))
+	assert.False(t, isTransient(&anthropicError{StatusCode: http.StatusBadRequest, Type: "invalid_request_error"}))
+}
+
+func TestRetryDelay_AnthropicRetryAfter(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "2")
+	d, ok := RetryPolicy{MaxAttempts: 2}.retryDelay(&anthropicError{StatusCode: http.StatusTooManyRequests, Header: h}, 1)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, d)
+}
+
+func TestRetryDelay_RetryAfterCappedAtMaxDelay(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "3600")
+	p := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	d, ok := p.retryDelay(&anthropicError{StatusCode: http.StatusTooManyRequests, Header: h}, 1)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, d)
+}
+
+func TestIsTransient_ConnectionReset(t *testing.T) {
+	assert.True(t, isTransient(syscall.ECONNRESET))
+}
+
+func TestIsTransient_CancelledIsNotRetried(t *testing.T) {
+	assert.False(t, isTransient(context.Canceled))
+	assert.False(t, isTransient(errors.New("some other failure")))
+}
+
+func TestParseRetryAfter_Seconds(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "3")
+	d, ok := parseRetryAfter(h)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+}
+
+func TestParseRetryAfter_MillisecondsTakesPrecedence(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "3")
+	h.Set("Retry-After-Ms", "250")
+	d, ok := parseRetryAfter(h)
+	assert.True(t, ok)
+	assert.Equal(t, 250*time.Millisecond, d)
+}
+
+func TestParseRetryAfter_HTTPDate(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	d, ok := parseRetryAfter(h)
+	assert.True(t, ok)
+	assert.Greater(t, d, 50*time.Second)
+}
+
+func TestParseRetryAfter_Missing(t *testing.T) {
+	_, ok := parseRetryAfter(http.Header{})
+	assert.False(t, ok)
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/tool"
+)
+
+// maxToolRounds bounds how many times in a row the model may call tools
+// before it is made to answer with what it has.
+const maxToolRounds = 10
+
+// QueryTools is Query with tools the model may call. Whenever the model calls
+// tools, they are run and their results sent back, until it answers. It
+// returns the messages added to the conversation: the model's tool calls and
+// their results, followed by the answer. On cancellation, the answer is
+// whatever was received of it.
+func (c *Client) QueryTools(ctx context.Context, gen generation.Params, tools []tool.Tool, messages []message.Message, out io.Writer) ([]message.Message, error) {
+	var added []message.Message
+	for round := 0; ; round++ {
+		req := request{gen: gen, tools: tools, messages: slices.Concat(messages, added)}
+		if round == maxToolRounds {
+			fmt.Fprintf(os.Stderr, "Note: the model called tools %d times in a row, asking it to answer\n", maxToolRounds)
+			req.noToolCalls = true
+		}
+
+		response, err := c.send(ctx, req, out)
+		if err != nil {
+			if ctx.Err() != nil {
+				added = append(added, response)
+			}
+			return added, err
+		}
+		added = append(added, response)
+		if len(response.ToolCalls) == 0 {
+			return added, nil
+		}
+
+		for _, call := range response.ToolCalls {
+			added = append(added, message.NewToolMessage(call.ID, runTool(ctx, tools, call)))
+		}
+		if err := ctx.Err(); err != nil {
+			return added, err
+		}
+	}
+}
+
+// runTool performs a call and returns its result for the model, which is told
+// about failures so it can adjust.
+func runTool(ctx context.Context, tools []tool.Tool, call message.ToolCall) string {
+	if ctx.Err() != nil {
+		return "The call was cancelled."
+	}
+	t, ok := tool.Find(tools, call.Name)
+	if !ok {
+		return fmt.Sprintf("Error: there is no tool called %q.", call.Name)
+	}
+
+	fmt.Fprintf(os.Stderr, "Tool: %s %s\n", call.Name, call.Arguments)
+	result, err := t.Run(ctx, json.RawMessage(call.Arguments))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Tool error: %v\n", err)
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,156 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/generation"
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/tool"
+	"github.com/dtrugman/qory/lib/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deltaServer streams the deltas of each reply to successive chat completion
+// requests, one chunk per delta, and records the requests.
+func deltaServer(t *testing.T, replies ...[]map[string]any) (*Client, *[]map[string]any) {
+	t.Helper()
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+		require.LessOrEqual(t, len(requests), len(replies), "unexpected request")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range replies[len(requests)-1] {
+			chunk, _ := json.Marshal(map[string]any{
+				"id": "1", "object": "chat.completion.chunk", "model": "m",
+				"choices": []any{map[string]any{"index": 0, "delta": delta}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(util.Ptr("key"), util.Ptr(server.URL), RetryPolicy{MaxAttempts: 1}), &requests
+}
+
+func callDelta(index int, id, name, args string) map[string]any {
+	return map[string]any{"tool_calls": []any{map[string]any{
+		"index": index, "id": id, "type": "function",
+		"function": map[string]any{"name": name, "arguments": args},
+	}}}
+}
+
+func textDelta(text string) map[string]any {
+	return map[string]any{"content": text}
+}
+
+func echoTool(calls *[]string) tool.Tool {
+	return tool.Tool{
+		Name:       "echo",
+		Parameters: map[string]any{"type": "object"},
+		Run: func(_ context.Context, args json.RawMessage) (string, error) {
+			*calls = append(*calls, string(args))
+			var a struct{ Text string }
+			if err := json.Unmarshal(args, &a); err != nil {
+				return "", err
+			}
+			if a.Text == "" {
+				return "", errors.New("nothing to echo")
+			}
+			return a.Text, nil
+		},
+	}
+}
+
+func TestQueryTools_RunsCallsUntilAnswered(t *testing.T) {
+	client, requests := deltaServer(t,
+		[]map[string]any{
+			callDelta(0, "call_1", "echo", `{"text":`),
+			callDelta(0, "", "", `"hi"}`),
+			callDelta(1, "call_2", "echo", `{}`),
+		},
+		[]map[string]any{textDelta("It said "), textDelta("hi.")},
+	)
+
+	var calls []string
+	var out bytes.Buffer
+	added, err := client.QueryTools(context.Background(), generation.Params{Model: "m"}, []tool.Tool{echoTool(&calls)},
+		[]message.Message{message.NewUserMessage("say hi")}, &out)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`{"text":"hi"}`, `{}`}, calls)
+	assert.Equal(t, "It said hi.\n", out.String())
+
+	require.Len(t, added, 4)
+	assert.Equal(t, []message.ToolCall{
+		{ID: "call_1", Name: "echo", Arguments: `{"text":"hi"}`},
+		{ID: "call_2", Name: "echo", Arguments: `{}`},
+	}, added[0].ToolCalls)
+	assert.Empty(t, added[0].Content)
+	assert.Equal(t, message.NewToolMessage("call_1", "hi"), added[1])
+	assert.Equal(t, message.NewToolMessage("call_2", "Error: nothing to echo"), added[2])
+	assert.Equal(t, "It said hi.\n", added[3].Content)
+	assert.Equal(t, "m", added[3].Model)
+
+	require.Len(t, *requests, 2)
+	tools := (*requests)[0]["tools"].([]any)
+	require.Len(t, tools, 1)
+	assert.Equal(t, "echo", tools[0].(map[string]any)["function"].(map[string]any)["name"])
+
+	replay := (*requests)[1]["messages"].([]any)
+	require.Len(t, replay, 4)
+	assistant := replay[1].(map[string]any)
+	assert.Equal(t, "assistant", assistant["role"])
+	assert.Equal(t, []any{
+		map[string]any{"id": "call_1", "type": "function", "function": map[string]any{"name": "echo", "arguments": `{"text":"hi"}`}},
+		map[string]any{"id": "call_2", "type": "function", "function": map[string]any{"name": "echo", "arguments": `{}`}},
+	}, assistant["tool_calls"])
+	result := replay[2].(map[string]any)
+	assert.Equal(t, "tool", result["role"])
+	assert.Equal(t, "call_1", result["tool_call_id"])
+	assert.Equal(t, "hi", requestText(result))
+}
+
+func TestQueryTools_UnknownTool(t *testing.T) {
+	client, _ := deltaServer(t,
+		[]map[string]any{callDelta(0, "call_1", "rm", `{}`)},
+		[]map[string]any{textDelta("Sorry.")},
+	)
+
+	added, err := client.QueryTools(context.Background(), generation.Params{Model: "m"}, nil,
+		[]message.Message{message.NewUserMessage("clean up")}, &bytes.Buffer{})
+	require.NoError(t, err)
+
+	require.Len(t, added, 3)
+	assert.Equal(t, `Error: there is no tool called "rm".`, added[1].Content)
+}
+
+func TestQueryTools_StopsCallingAfterMaxRounds(t *testing.T) {
+	replies := make([][]map[string]any, 0, maxToolRounds+1)
+	for i := range maxToolRounds {
+		replies = append(replies, []map[string]any{callDelta(0, fmt.Sprintf("call_%d", i), "echo", `{"text":"again"}`)})
+	}
+	replies = append(replies, []map[string]any{textDelta("Done.")})
+	client, requests := deltaServer(t, replies...)
+
+	var calls []string
+	added, err := client.QueryTools(context.Background(), generation.Params{Model: "m"}, []tool.Tool{echoTool(&calls)},
+		[]message.Message{message.NewUserMessage("loop")}, &bytes.Buffer{})
+	require.NoError(t, err)
+
+	assert.Len(t, calls, maxToolRounds)
+	assert.Len(t, added, 2*maxToolRounds+1)
+	assert.Nil(t, (*requests)[maxToolRounds-1]["tool_choice"])
+	assert.Equal(t, "none", (*requests)[maxToolRounds]["tool_choice"])
+}
@@ -0,0 +1,157 @@
+package patch
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// contextLines is how many unchanged lines surround the changes of a hunk.
+const contextLines = 3
+
+// op is a line of an edit script: kept (' '), removed ('-') or added ('+').
+type op struct {
+	kind byte
+	line string
+}
+
+// Diff returns the unified diff that turns old into new, labelled from and to
+// (such as a/main.go and b/main.go, or DevNull). It is empty when there is no
+// difference between the lines of old and new.
+func Diff(from, to, old, new string) string {
+	ops := diffLines(splitLines(old), splitLines(new))
+
+	var b strings.Builder
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// A hunk runs until the changes are more than twice the context apart.
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*contextLines {
+				break
+			}
+		}
+		start, stop := max(i-contextLines, 0), min(end+contextLines, len(ops))
+
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+		}
+		oldStart, newStart := count(ops[:start])
+		oldLen, newLen := count(ops[start:stop])
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLen), hunkRange(newStart, newLen))
+		for _, o := range ops[start:stop] {
+			b.WriteByte(o.kind)
+			b.WriteString(o.line)
+			b.WriteByte('\n')
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+// count returns how many lines of the old and of the new text ops cover.
+func count(ops []op) (old, new int) {
+	for _, o := range ops {
+		if o.kind != '+' {
+			old++
+		}
+		if o.kind != '-' {
+			new++
+		}
+	}
+	return old, new
+}
+
+// hunkRange renders the range of a hunk header: the first line, counting
+// from 1, and the number of lines, which is left out when it is 1. An empty
+// range starts at the line before it.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// diffLines returns the shortest edit script that turns a into b, using
+// Myers' algorithm.
+func diffLines(a, b []string) []op {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return nil
+	}
+
+	// v[off+k] is the furthest x reached on diagonal k = x-y. trace keeps the
+	// diagonals -d..d of v as they were before each round d, for backtracking.
+	off := n + m
+	v := make([]int, 2*off+2)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v[off-d:off+d+1]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the rounds of diffLines back from the end of a and b to
+// their start, collecting the edit script.
+func backtrack(a, b []string, trace [][]int) []op {
+	var ops []op
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		prevX, prevY := 0, 0
+		if d > 0 {
+			at := func(k int) int { return trace[d][k+d] }
+			k := x - y
+			prevK := k - 1
+			if k == -d || k != d && at(k-1) < at(k+1) {
+				prevK = k + 1
+			}
+			prevX = at(prevK)
+			prevY = prevX - prevK
+		}
+
+		for x > prevX && y > prevY {
+			ops = append(ops, op{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, op{'+', b[y-1]})
+				y--
+			} else {
+				ops = append(ops, op{'-', a[x-1]})
+				x--
+			}
+		}
+	}
+	slices.Reverse(ops)
+	return ops
+}
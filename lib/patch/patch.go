@@ -0,0 +1,322 @@
+// Package patch reads the file edits a model proposes, either as unified
+// diffs or as search/replace blocks, and applies them.
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DevNull is the name diffs give to the missing side of a created or deleted
+// file.
+const DevNull = "/dev/null"
+
+// Edit is the change proposed to a single file.
+type Edit struct {
+	Path string
+
+	// Delete marks an edit that removes the file.
+	Delete bool
+
+	changes []change
+}
+
+// change replaces the lines old with the lines new. hint is the index of the
+// line old is expected at, or -1 when unknown; an empty old is inserted at
+// hint, or appended when hint is unknown.
+type change struct {
+	old, new []string
+	hint     int
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+const (
+	searchMarker  = "<<<<<<< SEARCH"
+	dividerMarker = "======="
+	replaceMarker = ">>>>>>> REPLACE"
+)
+
+// Parse returns the edits proposed in answer, one per file, in the order the
+// files are first mentioned. It understands unified diffs:
+//
+//	--- a/main.go
+//	+++ b/main.go
+//	@@ -10,3 +10,4 @@
+//	...
+//
+// and search/replace blocks, preceded by the path of their file:
+//
+//	main.go
+//	<<<<<<< SEARCH
+//	...
+//	=======
+//	...
+//	>>>>>>> REPLACE
+//
+// Either may sit inside code fences. Hunks are matched by their content, so
+// wrong line numbers in hunk headers are tolerated.
+func Parse(answer string) []Edit {
+	p := parser{lines: strings.Split(strings.ReplaceAll(answer, "\r\n", "\n"), "\n")}
+	for i := 0; i < len(p.lines); {
+		line := p.lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(p.lines) && strings.HasPrefix(p.lines[i+1], "+++ "):
+			i = p.unified(i)
+		case strings.TrimSpace(line) == searchMarker:
+			i = p.searchReplace(i)
+		default:
+			i++
+		}
+	}
+	return p.edits
+}
+
+type parser struct {
+	lines []string
+	edits []Edit
+
+	// lastPath is the file of the latest search/replace block, which the
+	// blocks right after it share.
+	lastPath string
+}
+
+// edit returns the edit to path, adding it if there is none yet.
+func (p *parser) edit(path string) *Edit {
+	for i := range p.edits {
+		if p.edits[i].Path == path {
+			return &p.edits[i]
+		}
+	}
+	p.edits = append(p.edits, Edit{Path: path})
+	return &p.edits[len(p.edits)-1]
+}
+
+// unified parses the diff of a file whose ---/+++ header starts at line i,
+// and returns the index of the line that follows it.
+func (p *parser) unified(i int) int {
+	from, to := diffPath(p.lines[i]), diffPath(p.lines[i+1])
+	var e *Edit
+	if to == DevNull {
+		e = p.edit(from)
+		e.Delete = true
+	} else {
+		e = p.edit(to)
+	}
+
+	i += 2
+	for i < len(p.lines) && strings.HasPrefix(p.lines[i], "@@") {
+		c := change{hint: -1}
+		if m := hunkHeaderPattern.FindStringSubmatch(p.lines[i]); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			c.hint = max(start-1, 0)
+		}
+
+		// Models tend to strip the space off blank context lines. Such lines
+		// count as context, unless they are the ones that end the hunk.
+		blanks := 0
+	hunk:
+		for i++; i < len(p.lines); i++ {
+			line := p.lines[i]
+			switch {
+			case strings.HasPrefix(line, "@@"), isFileHeader(p.lines, i):
+				break hunk
+			case line == "":
+				c.old, c.new = append(c.old, ""), append(c.new, "")
+				blanks++
+				continue
+			case line[0] == ' ':
+				c.old, c.new = append(c.old, line[1:]), append(c.new, line[1:])
+			case line[0] == '-':
+				c.old = append(c.old, line[1:])
+			case line[0] == '+':
+				c.new = append(c.new, line[1:])
+			case line[0] == '\\':
+				// \ No newline at end of file
+			default:
+				break hunk
+			}
+			blanks = 0
+		}
+		c.old, c.new = c.old[:len(c.old)-blanks], c.new[:len(c.new)-blanks]
+		e.changes = append(e.changes, c)
+	}
+	return i
+}
+
+func isFileHeader(lines []string, i int) bool {
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// diffPath returns the path a ---/+++ line of a diff names, without the a/
+// and b/ prefixes git adds or the timestamps diff adds.
+func diffPath(line string) string {
+	path := line[4:]
+	if tab := strings.IndexByte(path, '\t'); tab >= 0 {
+		path = path[:tab]
+	}
+	path = strings.TrimSpace(path)
+	if path == DevNull {
+		return path
+	}
+	for _, prefix := range []string{"a/", "b/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			return rest
+		}
+	}
+	return path
+}
+
+// searchReplace parses the search/replace block that starts at line i, and
+// returns the index of the line that follows it. Blocks without a path or an
+// end are dropped.
+func (p *parser) searchReplace(i int) int {
+	path := p.pathBefore(i)
+
+	var search, replace []string
+	target := &search
+	for i++; i < len(p.lines); i++ {
+		line := strings.TrimRight(p.lines[i], " \t")
+		switch {
+		case line == dividerMarker && target == &search:
+			target = &replace
+		case strings.HasPrefix(line, replaceMarker[:7]) && target == &replace:
+			if path != "" {
+				p.lastPath = path
+				e := p.edit(path)
+				e.changes = append(e.changes, change{old: search, new: replace, hint: -1})
+			}
+			return i + 1
+		default:
+			*target = append(*target, p.lines[i])
+		}
+	}
+	return i
+}
+
+// pathBefore returns the path of the file the search/replace block at line i
+// edits: the line above it, or the path in the info string of the fence
+// around it, as in ```go main.go.
+func (p *parser) pathBefore(i int) string {
+	for j := i - 1; j >= 0; j-- {
+		line := strings.TrimSpace(p.lines[j])
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, replaceMarker[:7]):
+			return p.lastPath
+		case strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~"):
+			if path := fencePath(line); path != "" {
+				return path
+			}
+			continue
+		}
+		path := strings.Trim(line, "`*#: ")
+		if path == "" || strings.ContainsAny(path, " \t") {
+			return ""
+		}
+		return path
+	}
+	return ""
+}
+
+// fencePath returns the path named in the info string of a fence, if any.
+func fencePath(fence string) string {
+	fields := strings.Fields(strings.TrimLeft(fence, "`~"))
+	for n, f := range fields {
+		if _, path, ok := strings.Cut(f, ":"); ok && n == 0 {
+			return path
+		}
+		if n > 0 && strings.ContainsAny(f, "./") {
+			return strings.Trim(f, `"'`)
+		}
+	}
+	return ""
+}
+
+// Apply returns content, the current content of the file, with the edit
+// applied. Content is empty for a file that doesn't exist yet.
+func (e Edit) Apply(content string) (string, error) {
+	if e.Delete {
+		return "", nil
+	}
+
+	lines := splitLines(content)
+	delta := 0
+	for n, c := range e.changes {
+		hint := c.hint
+		if hint >= 0 {
+			hint += delta
+		}
+		at, ok := c.find(lines, hint)
+		if !ok {
+			return "", fmt.Errorf("change %d to %s doesn't match the file", n+1, e.Path)
+		}
+		lines = slices.Replace(lines, at, at+len(c.old), c.new...)
+		delta += len(c.new) - len(c.old)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// find returns where in lines the change goes: the match of c.old closest to
+// hint, or the first match when hint is unknown. Lines that only differ in
+// trailing whitespace match when nothing matches exactly.
+func (c change) find(lines []string, hint int) (int, bool) {
+	if len(c.old) == 0 {
+		if hint < 0 || hint > len(lines) {
+			return len(lines), true
+		}
+		return hint, true
+	}
+
+	for _, trim := range []bool{false, true} {
+		best := -1
+		for i := 0; i+len(c.old) <= len(lines); i++ {
+			if !linesEqual(lines[i:i+len(c.old)], c.old, trim) {
+				continue
+			}
+			if best < 0 || hint >= 0 && abs(i-hint) < abs(best-hint) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return best, true
+		}
+	}
+	return 0, false
+}
+
+func linesEqual(a, b []string, trim bool) bool {
+	for i := range a {
+		x, y := a[i], b[i]
+		if trim {
+			x, y = strings.TrimRight(x, " \t\r"), strings.TrimRight(y, " \t\r")
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLines returns the lines of text, without their line breaks.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
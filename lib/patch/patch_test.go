@@ -0,0 +1,164 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const source = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`
+
+func TestParse_UnifiedDiff(t *testing.T) {
+	answer := "Here is the change:\n\n```diff\n" +
+		"--- a/main.go\n" +
+		"+++ b/main.go\n" +
+		"@@ -5,3 +5,4 @@\n" +
+		" func main() {\n" +
+		" \tfmt.Println(\"hello\")\n" +
+		"+\tfmt.Println(\"world\")\n" +
+		" }\n" +
+		"```\n\nThat's it."
+
+	edits := Parse(answer)
+	require.Len(t, edits, 1)
+	assert.Equal(t, "main.go", edits[0].Path)
+	assert.False(t, edits[0].Delete)
+
+	got, err := edits[0].Apply(source)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n\tfmt.Println(\"world\")\n}\n", got)
+}
+
+func TestParse_UnifiedDiffWrongLineNumbers(t *testing.T) {
+	// The blank context line has lost its leading space, and the header
+	// points far off.
+	answer := "--- main.go\n+++ main.go\n@@ -40,4 +40,4 @@\n package main\n\n-import \"fmt\"\n+import \"os\"\n\nThat should do.\n"
+
+	edits := Parse(answer)
+	require.Len(t, edits, 1)
+	got, err := edits[0].Apply(source)
+	require.NoError(t, err)
+	assert.Contains(t, got, "import \"os\"\n")
+	assert.NotContains(t, got, "import \"fmt\"")
+}
+
+func TestParse_UnifiedDiffNewAndDeletedFiles(t *testing.T) {
+	answer := "--- /dev/null\n+++ b/docs/NOTES.md\n@@ -0,0 +1,2 @@\n+# Notes\n+\n" +
+		"--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n"
+
+	edits := Parse(answer)
+	require.Len(t, edits, 2)
+
+	assert.Equal(t, "docs/NOTES.md", edits[0].Path)
+	got, err := edits[0].Apply("")
+	require.NoError(t, err)
+	assert.Equal(t, "# Notes\n\n", got)
+
+	assert.Equal(t, "old.txt", edits[1].Path)
+	assert.True(t, edits[1].Delete)
+}
+
+func TestParse_SearchReplace(t *testing.T) {
+	answer := "Update the greeting:\n\n" +
+		"main.go\n" +
+		"```go\n" +
+		"<<<<<<< SEARCH\n" +
+		"\tfmt.Println(\"hello\")\n" +
+		"=======\n" +
+		"\tfmt.Println(\"hello, world\")\n" +
+		">>>>>>> REPLACE\n" +
+		"<<<<<<< SEARCH\n" +
+		"import \"fmt\"\n" +
+		"=======\n" +
+		"import (\n\t\"fmt\"\n)\n" +
+		">>>>>>> REPLACE\n" +
+		"```\n\n" +
+		"```python tools/run.py\n" +
+		"<<<<<<< SEARCH\n" +
+		"=======\n" +
+		"print('run')\n" +
+		">>>>>>> REPLACE\n" +
+		"```\n"
+
+	edits := Parse(answer)
+	require.Len(t, edits, 2)
+
+	assert.Equal(t, "main.go", edits[0].Path)
+	got, err := edits[0].Apply(source)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nimport (\n\t\"fmt\"\n)\n\nfunc main() {\n\tfmt.Println(\"hello, world\")\n}\n", got)
+
+	assert.Equal(t, "tools/run.py", edits[1].Path)
+	got, err = edits[1].Apply("")
+	require.NoError(t, err)
+	assert.Equal(t, "print('run')\n", got)
+}
+
+func TestParse_SearchReplaceWithoutPath(t *testing.T) {
+	answer := "Do this:\n<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE\n"
+	assert.Empty(t, Parse(answer))
+}
+
+func TestParse_NoEdits(t *testing.T) {
+	assert.Empty(t, Parse("Just use `strings.Cut`.\n\n```go\nfmt.Println()\n```\n"))
+}
+
+func TestEdit_ApplyTrailingWhitespace(t *testing.T) {
+	edit := Edit{Path: "a.txt", changes: []change{{old: []string{"one"}, new: []string{"uno"}, hint: -1}}}
+	got, err := edit.Apply("zero\none  \r\ntwo\n")
+	require.NoError(t, err)
+	assert.Equal(t, "zero\nuno\ntwo\n", got)
+}
+
+func TestEdit_ApplyPicksMatchClosestToHint(t *testing.T) {
+	edit := Edit{Path: "a.txt", changes: []change{{old: []string{"x"}, new: []string{"y"}, hint: 3}}}
+	got, err := edit.Apply("x\na\nb\nx\nc\n")
+	require.NoError(t, err)
+	assert.Equal(t, "x\na\nb\ny\nc\n", got)
+}
+
+func TestEdit_ApplyMismatch(t *testing.T) {
+	edit := Edit{Path: "a.txt", changes: []change{
+		{old: []string{"a"}, new: []string{"b"}, hint: -1},
+		{old: []string{"missing"}, new: nil, hint: -1},
+	}}
+	_, err := edit.Apply("a\n")
+	assert.EqualError(t, err, "change 2 to a.txt doesn't match the file")
+}
+
+func TestDiff(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n"
+
+	assert.Equal(t, "--- a/n.txt\n+++ b/n.txt\n"+
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n"+
+		"@@ -14,3 +14,4 @@\n 14\n 15\n 16\n+17\n", Diff("a/n.txt", "b/n.txt", old, new))
+}
+
+func TestDiff_NewAndDeletedFiles(t *testing.T) {
+	assert.Equal(t, "--- /dev/null\n+++ b/n.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n", Diff(DevNull, "b/n.txt", "", "a\nb\n"))
+	assert.Equal(t, "--- a/n.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n", Diff("a/n.txt", DevNull, "a\n", ""))
+}
+
+func TestDiff_Equal(t *testing.T) {
+	assert.Empty(t, Diff("a/n.txt", "b/n.txt", "same\n", "same\n"))
+}
+
+func TestDiff_RoundTrip(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	new := "a\nB\nc\nd\nx\ny\ne\nf\nh\ni\n"
+
+	edits := Parse(Diff("a/f", "b/f", old, new))
+	require.Len(t, edits, 1)
+	got, err := edits[0].Apply(old)
+	require.NoError(t, err)
+	assert.Equal(t, new, got)
+}
@@ -0,0 +1,70 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dtrugman/qory/lib/message"
+)
+
+// forkTitleSuffix marks the titles of forks.
+const forkTitleSuffix = " (fork)"
+
+// Lineage records where a forked session branched off.
+type Lineage struct {
+	Parent string `json:"parent"`
+	Turn   int    `json:"turn"`
+}
+
+// Turns returns the number of turns (questions asked) in the session.
+func (s *Session) Turns() int {
+	n := 0
+	for _, m := range s.Messages {
+		if m.Role == message.RoleUser {
+			n++
+		}
+	}
+	return n
+}
+
+// Fork returns a new session holding the first turn turns of s (and its
+// system prompt), recording parentID as the session it branched off.
+// Turn 0 keeps only the system prompt. The fork's title is marked as such,
+// so that it can be told apart from its parent.
+func (s *Session) Fork(parentID string, turn int) (Session, error) {
+	if turn < 0 || turn > s.Turns() {
+		return Session{}, fmt.Errorf("invalid turn %d: session has %d turns", turn, s.Turns())
+	}
+
+	end := len(s.Messages)
+	seen := 0
+	for i, m := range s.Messages {
+		if m.Role != message.RoleUser {
+			continue
+		}
+		if seen == turn {
+			end = i
+			break
+		}
+		seen++
+	}
+
+	fork := NewSession()
+	fork.Title = forkTitle(s.Title)
+	fork.Params = s.Params
+	fork.Messages = append(fork.Messages, s.Messages[:end]...)
+	fork.ForkedFrom = &Lineage{Parent: parentID, Turn: turn}
+	if s.Summary != nil && s.Summary.Through <= end {
+		summary := *s.Summary
+		fork.Summary = &summary
+	}
+	return fork, nil
+}
+
+// forkTitle returns the title of a fork of a session titled title.
+func forkTitle(title string) string {
+	if title == "" || strings.HasSuffix(title, forkTitleSuffix) {
+		return title
+	}
+	return title + forkTitleSuffix
+}
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeForkSession() Session {
+	s := NewSession()
+	s.Title = "title"
+	s.Params.Model = "gpt-4o"
+	s.AddMessage(message.NewSystemMessage("system"))
+	s.AddMessage(message.NewUserMessage("q1"))
+	s.AddMessage(message.NewAssistantMessage("a1"))
+	s.AddMessage(message.NewUserMessage("q2"))
+	s.AddMessage(message.NewAssistantMessage("a2"))
+	return s
+}
+
+func TestFork_KeepsRequestedTurns(t *testing.T) {
+	s := makeForkSession()
+	require.Equal(t, 2, s.Turns())
+
+	fork, err := s.Fork("parent", 1)
+	require.NoError(t, err)
+	assert.Equal(t, s.Messages[:3], fork.Messages)
+	assert.Equal(t, &Lineage{Parent: "parent", Turn: 1}, fork.ForkedFrom)
+	assert.Equal(t, "title (fork)", fork.Title)
+	assert.Equal(t, "gpt-4o", fork.Params.Model)
+
+	fork, err = s.Fork("parent", 0)
+	require.NoError(t, err)
+	assert.Equal(t, s.Messages[:1], fork.Messages)
+
+	fork, err = s.Fork("parent", 2)
+	require.NoError(t, err)
+	assert.Equal(t, s.Messages, fork.Messages)
+}
+
+func TestFork_MarksTitle(t *testing.T) {
+	s := makeForkSession()
+	fork, err := s.Fork("parent", 1)
+	require.NoError(t, err)
+
+	again, err := fork.Fork("fork", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "title (fork)", again.Title, "forks of forks are marked once")
+
+	s.Title = ""
+	fork, err = s.Fork("parent", 1)
+	require.NoError(t, err)
+	assert.Empty(t, fork.Title)
+}
+
+func TestFork_DoesNotShareMessages(t *testing.T) {
+	s := makeForkSession()
+	fork, err := s.Fork("parent", 1)
+	require.NoError(t, err)
+
+	fork.AddMessage(message.NewUserMessage("other"))
+	assert.Equal(t, "q2", s.Messages[3].Content)
+}
+
+func TestFork_RejectsInvalidTurn(t *testing.T) {
+	s := makeForkSession()
+	_, err := s.Fork("parent", 3)
+	assert.Error(t, err)
+	_, err = s.Fork("parent", -1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,239 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dtrugman/qory/lib/message"
+)
+
+const (
+	// indexDirName is hidden so that it is never mistaken for a session.
+	indexDirName = ".index.d"
+	indexVersion = 1
+
+	// legacyIndexFileName held the whole index in a single file, rewritten
+	// on every Store.
+	legacyIndexFileName = ".index"
+
+	indexDirPerm = 0700
+)
+
+// indexEntry holds what search needs to know about a session without loading
+// it: its metadata and, per role, how often each term occurs.
+type indexEntry struct {
+	Version   int                             `json:"version"`
+	ModTime   time.Time                       `json:"mod_time"`
+	Title     string                          `json:"title,omitempty"`
+	Models    []string                        `json:"models,omitempty"`
+	CreatedAt time.Time                       `json:"created_at"`
+	UpdatedAt time.Time                       `json:"updated_at"`
+	Terms     map[message.Role]map[string]int `json:"terms"`
+}
+
+// searchIndex is a term-frequency index over all stored sessions.
+//
+// It is a cache: Store keeps it current, and sync reconciles it with the
+// session files (by modification time) before every search, so deletions,
+// renames, cleanup and sessions written by older versions of qory never need
+// to touch it explicitly.
+//
+// Each session's entry is a file of its own in the index directory, replaced
+// atomically, so that storing a session costs the same however long the
+// history is, and concurrent qory processes never undo each other's updates.
+type searchIndex struct {
+	Sessions map[string]*indexEntry
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		Sessions: make(map[string]*indexEntry),
+	}
+}
+
+// newIndexEntry indexes s, whose file was last modified at modTime.
+func newIndexEntry(s Session, modTime time.Time) *indexEntry {
+	entry := &indexEntry{
+		Version:   indexVersion,
+		ModTime:   modTime,
+		Title:     s.Title,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+		Terms:     make(map[message.Role]map[string]int),
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range s.Messages {
+		if m.Model != "" && !seen[m.Model] {
+			seen[m.Model] = true
+			entry.Models = append(entry.Models, m.Model)
+		}
+
+		terms := entry.Terms[m.Role]
+		if terms == nil {
+			terms = make(map[string]int)
+			entry.Terms[m.Role] = terms
+		}
+		for _, tok := range tokenize(m.Content) {
+			terms[tok.term]++
+		}
+	}
+	if len(entry.Models) == 0 && s.Params.Model != "" {
+		entry.Models = []string{s.Params.Model}
+	}
+
+	return entry
+}
+
+func (m *Manager) indexDir() string {
+	return filepath.Join(m.dir, indexDirName)
+}
+
+// loadIndex reads the index from disk. Missing, unreadable or outdated
+// entries are not an error; they are left out and rebuilt by sync.
+func (m *Manager) loadIndex() *searchIndex {
+	idx := newSearchIndex()
+	files, err := os.ReadDir(m.indexDir())
+	if err != nil {
+		return idx
+	}
+
+	for _, file := range files {
+		// Hidden files are entries still being written.
+		if strings.HasPrefix(file.Name(), ".") || file.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(m.indexDir(), file.Name()))
+		if err != nil {
+			continue
+		}
+		entry := &indexEntry{}
+		if err := json.Unmarshal(b, entry); err != nil || entry.Version != indexVersion {
+			continue
+		}
+		idx.Sessions[file.Name()] = entry
+	}
+	return idx
+}
+
+// saveEntry atomically replaces the index entry of session id on disk.
+func (m *Manager) saveEntry(id string, entry *indexEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.indexDir(), indexDirPerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(m.indexDir(), "."+id+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(m.indexDir(), id))
+}
+
+// removeEntry removes the index entry of session id from disk.
+func (m *Manager) removeEntry(id string) error {
+	err := os.Remove(filepath.Join(m.indexDir(), id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// syncIndex brings idx up to date with the session files on disk, persisting
+// the entries that changed. Sessions that fail to load are left out.
+func (m *Manager) syncIndex(idx *searchIndex) error {
+	fileInfos, err := getDirFilesSortedByModTime(m.dir)
+	if err != nil {
+		return err
+	}
+
+	// Left behind by older versions of qory.
+	_ = os.Remove(filepath.Join(m.dir, legacyIndexFileName))
+
+	present := make(map[string]bool, len(fileInfos))
+	for _, info := range fileInfos {
+		present[info.name] = true
+		if entry, ok := idx.Sessions[info.name]; ok && entry.ModTime.Equal(info.modTime) {
+			continue
+		}
+
+		s, err := m.Load(info.name)
+		if err != nil {
+			continue
+		}
+		entry := newIndexEntry(s, info.modTime)
+		idx.Sessions[info.name] = entry
+		if err := m.saveEntry(info.name, entry); err != nil {
+			return err
+		}
+	}
+
+	for id := range idx.Sessions {
+		if !present[id] {
+			delete(idx.Sessions, id)
+			if err := m.removeEntry(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexSession records a freshly stored session in the index. Failures are
+// ignored: the next search re-indexes whatever is out of date.
+func (m *Manager) indexSession(id string, s Session) {
+	info, err := os.Stat(filepath.Join(m.dir, id))
+	if err != nil {
+		return
+	}
+	_ = m.saveEntry(id, newIndexEntry(s, info.ModTime()))
+}
+
+type token struct {
+	term       string
+	start, end int // byte offsets in the tokenized text
+}
+
+// tokenize splits text into lower-cased words made of letters and digits.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// alignRuneStart moves i back to the start of the UTF-8 sequence it points into.
+func alignRuneStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
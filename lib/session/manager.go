@@ -8,8 +8,11 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/dtrugman/qory/lib/generation"
 	"github.com/dtrugman/qory/lib/message"
 	"github.com/google/uuid"
 )
@@ -30,19 +33,39 @@ const (
 var (
 	ErrInvalidID = errors.New("invalid session id")
 	ErrNotFound  = errors.New("unknown session id")
+	ErrExists    = errors.New("session id already exists")
 )
 
 var (
 	validIDRegexp = regexp.MustCompile(ValidIDPattern)
 )
 
+// Session is a stored conversation. The on-disk schema is versioned; files
+// written before versioning was introduced (v0) are migrated on load.
 type Session struct {
+	Version   int       `json:"version"`
+	Title     string    `json:"title,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+
+	// ForkedFrom is set on sessions branched off another session.
+	ForkedFrom *Lineage `json:"forked_from,omitempty"`
+
+	// Params holds the generation parameters explicitly chosen for this
+	// session; they are reused when the session is continued.
+	Params generation.Params `json:"params,omitzero"`
+
+	// Summary condenses the oldest messages once the session outgrew the
+	// model's context window. The messages themselves are kept.
+	Summary *Summary `json:"summary,omitempty"`
+
 	Messages []message.Message `json:"messages"`
 }
 
 func NewSession() Session {
 	messages := make([]message.Message, 0)
 	return Session{
+		Version:  CurrentVersion,
 		Messages: messages,
 	}
 }
@@ -53,8 +76,14 @@ func (s *Session) AddMessage(m message.Message) {
 
 type SessionPreview struct {
 	Name      string
+	Title     string
+	Model     string
+	CreatedAt time.Time
 	UpdatedAt time.Time
 	Snippet   string
+
+	// ForkedFrom is set when the session was branched off another session.
+	ForkedFrom *Lineage
 }
 
 type fileInfo struct {
@@ -76,10 +105,10 @@ func (m *Manager) validID(id string) bool {
 	return validIDRegexp.MatchString(id)
 }
 
-func (m *Manager) loadSessionSnippet(filename string) (string, error) {
-	session, err := m.Load(filename)
+func (m *Manager) loadSessionPreview(info fileInfo) (SessionPreview, error) {
+	session, err := m.Load(info.name)
 	if err != nil {
-		return "", err
+		return SessionPreview{}, err
 	}
 
 	var lastUserFound bool = false
@@ -87,13 +116,13 @@ func (m *Manager) loadSessionSnippet(filename string) (string, error) {
 	for i := len(session.Messages) - 1; i >= 0; i-- {
 		if session.Messages[i].Role == message.RoleUser {
 			lastUserFound = true
-			lastUserContent = session.Messages[i].Content
+			lastUserContent = session.Messages[i].Text()
 			break
 		}
 	}
 
 	if !lastUserFound {
-		return "", fmt.Errorf("no user content")
+		return SessionPreview{}, fmt.Errorf("no user content")
 	}
 
 	content := lastUserContent
@@ -102,7 +131,20 @@ func (m *Manager) loadSessionSnippet(filename string) (string, error) {
 		content += "..."
 	}
 
-	return content, nil
+	updatedAt := session.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = info.modTime
+	}
+
+	return SessionPreview{
+		Name:       info.name,
+		Title:      session.Title,
+		Model:      session.LastModel(),
+		CreatedAt:  session.CreatedAt,
+		UpdatedAt:  updatedAt,
+		Snippet:    content,
+		ForkedFrom: session.ForkedFrom,
+	}, nil
 }
 
 func getDirFilesSortedByModTime(dir string) ([]fileInfo, error) {
@@ -113,6 +155,11 @@ func getDirFilesSortedByModTime(dir string) ([]fileInfo, error) {
 
 	fileInfos := make([]fileInfo, 0, len(files))
 	for _, file := range files {
+		// Hidden files hold bookkeeping such as the search index.
+		if strings.HasPrefix(file.Name(), ".") || file.IsDir() {
+			continue
+		}
+
 		info, err := file.Info()
 		if err != nil {
 			return nil, err
@@ -143,16 +190,11 @@ func (m *Manager) Enum(limit int) ([]SessionPreview, error) {
 
 	result := make([]SessionPreview, 0)
 	for _, info := range fileInfos {
-		snippet, err := m.loadSessionSnippet(info.name)
+		preview, err := m.loadSessionPreview(info)
 		if err != nil {
 			return nil, err
 		}
-
-		result = append(result, SessionPreview{
-			Name:      info.name,
-			UpdatedAt: info.modTime,
-			Snippet:   snippet,
-		})
+		result = append(result, preview)
 	}
 
 	return result, nil
@@ -215,8 +257,21 @@ func (m *Manager) Load(id string) (Session, error) {
 		}
 	}
 
-	err = json.Unmarshal(bytes, &session)
-	return session, err
+	if err = json.Unmarshal(bytes, &session); err != nil {
+		return Session{}, err
+	}
+
+	if session.Version != CurrentVersion {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return Session{}, err
+		}
+		if err := migrate(&session, stat.ModTime()); err != nil {
+			return Session{}, fmt.Errorf("session %s: %w", id, err)
+		}
+	}
+
+	return session, nil
 }
 
 func (m *Manager) Delete(id string) error {
@@ -233,11 +288,106 @@ func (m *Manager) Delete(id string) error {
 	return nil
 }
 
+// Rename moves the session stored as oldID to newID, and points its forks
+// at the new ID. It never overwrites an existing session.
+func (m *Manager) Rename(oldID, newID string) error {
+	if !m.validID(oldID) || !m.validID(newID) {
+		return ErrInvalidID
+	}
+
+	oldPath := filepath.Join(m.dir, oldID)
+	newPath := filepath.Join(m.dir, newID)
+
+	if err := move(oldPath, newPath); err != nil {
+		return err
+	}
+	return m.relinkForks(oldID, newID)
+}
+
+// linkFile is os.Link, replaced in tests by filesystems without hard links.
+var linkFile = os.Link
+
+// move moves the file at oldPath to newPath, failing with ErrExists rather
+// than replacing a file already there.
+func move(oldPath, newPath string) error {
+	// Link+remove rather than os.Rename, which silently replaces newPath.
+	err := linkFile(oldPath, newPath)
+	if err == nil {
+		return os.Remove(oldPath)
+	}
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if os.IsExist(err) {
+		return ErrExists
+	}
+	if !linkUnsupported(err) {
+		return err
+	}
+
+	// Some filesystems, such as FUSE and network mounts, have no hard links.
+	// Checking first leaves a window for another process to create newPath,
+	// which is as close as they get.
+	if _, err := os.Lstat(newPath); err == nil {
+		return ErrExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// linkUnsupported reports whether err says the filesystem can't hard link.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.EPERM)
+}
+
+// relinkForks points the sessions forked off oldID at newID. Their update
+// and modification times are kept, so that they don't become the last
+// session: they were relinked, not continued.
+func (m *Manager) relinkForks(oldID, newID string) error {
+	fileInfos, err := getDirFilesSortedByModTime(m.dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range fileInfos {
+		s, err := m.Load(info.name)
+		if err != nil || s.ForkedFrom == nil || s.ForkedFrom.Parent != oldID {
+			continue
+		}
+		s.ForkedFrom.Parent = newID
+		if err := m.write(info.name, s); err != nil {
+			return fmt.Errorf("relink fork %s: %w", info.name, err)
+		}
+		_ = os.Chtimes(filepath.Join(m.dir, info.name), info.modTime, info.modTime)
+	}
+	return nil
+}
+
+// Store persists session under id, stamping the schema version and the
+// creation/update timestamps, and records it in the search index.
 func (m *Manager) Store(id string, session Session) error {
 	if !m.validID(id) {
 		return ErrInvalidID
 	}
 
+	now := time.Now()
+	session.Version = CurrentVersion
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	session.UpdatedAt = now
+	return m.write(id, session)
+}
+
+// write persists session under id as it is, and records it in the search
+// index.
+func (m *Manager) write(id string, session Session) error {
 	b, err := json.Marshal(session)
 	if err != nil {
 		return fmt.Errorf("encode: %v", err)
@@ -249,5 +399,6 @@ func (m *Manager) Store(id string, session Session) error {
 		return fmt.Errorf("write file: %v", err)
 	}
 
+	m.indexSession(id, session)
 	return nil
 }
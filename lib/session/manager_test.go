@@ -0,0 +1,131 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testID = "0c8e7b9a-3f52-4d1e-9a77-2b1f0e6c5d44"
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	return NewManager(t.TempDir())
+}
+
+func TestLoad_MigratesV0(t *testing.T) {
+	m := newTestManager(t)
+	path := filepath.Join(m.dir, testID)
+	require.NoError(t, os.WriteFile(path, []byte(`{"messages":[{"role":"user","content":"hi"}]}`), 0o600))
+	mtime := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+
+	s, err := m.Load(testID)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentVersion, s.Version)
+	assert.True(t, s.CreatedAt.Equal(mtime))
+	assert.True(t, s.UpdatedAt.Equal(mtime))
+	assert.Len(t, s.Messages, 1)
+}
+
+func TestLoad_RejectsNewerVersion(t *testing.T) {
+	m := newTestManager(t)
+	path := filepath.Join(m.dir, testID)
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":99,"messages":[]}`), 0o600))
+
+	_, err := m.Load(testID)
+	assert.Error(t, err)
+}
+
+func TestStore_StampsTimestamps(t *testing.T) {
+	m := newTestManager(t)
+	s := NewSession()
+	s.Title = "title"
+	s.AddMessage(message.NewUserMessage("hi"))
+	require.NoError(t, m.Store(testID, s))
+
+	loaded, err := m.Load(testID)
+	require.NoError(t, err)
+	assert.Equal(t, "title", loaded.Title)
+	assert.False(t, loaded.CreatedAt.IsZero())
+	assert.False(t, loaded.UpdatedAt.IsZero())
+
+	require.NoError(t, m.Store(testID, loaded))
+	again, err := m.Load(testID)
+	require.NoError(t, err)
+	assert.True(t, again.CreatedAt.Equal(loaded.CreatedAt))
+}
+
+func TestLastModel(t *testing.T) {
+	s := NewSession()
+	s.Params.Model = "fallback"
+	assert.Equal(t, "fallback", s.LastModel())
+
+	answer := message.NewAssistantMessage("a")
+	answer.Model = "gpt-4o"
+	s.AddMessage(answer)
+	assert.Equal(t, "gpt-4o", s.LastModel())
+}
+
+func TestRename(t *testing.T) {
+	m := newTestManager(t)
+	require.NoError(t, m.Store("old", NewSession()))
+
+	require.NoError(t, m.Rename("old", "new"))
+	_, err := m.Load("old")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = m.Load("new")
+	assert.NoError(t, err)
+}
+
+func TestRename_WithoutHardLinks(t *testing.T) {
+	linkFile = func(_, _ string) error { return &os.LinkError{Op: "link", Err: syscall.EOPNOTSUPP} }
+	t.Cleanup(func() { linkFile = os.Link })
+
+	m := newTestManager(t)
+	require.NoError(t, m.Store("old", NewSession()))
+	require.NoError(t, m.Store("taken", NewSession()))
+
+	require.NoError(t, m.Rename("old", "new"))
+	_, err := m.Load("old")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = m.Load("new")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, m.Rename("new", "taken"), ErrExists)
+	assert.ErrorIs(t, m.Rename("missing", "other"), ErrNotFound)
+}
+
+func TestRename_RelinksForks(t *testing.T) {
+	m := newTestManager(t)
+	parent := NewSession()
+	parent.AddMessage(message.NewUserMessage("hi"))
+	require.NoError(t, m.Store("old", parent))
+	fork, err := parent.Fork("old", 1)
+	require.NoError(t, err)
+	require.NoError(t, m.Store("child", fork))
+	stored, err := m.Load("child")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Rename("old", "new"))
+	child, err := m.Load("child")
+	require.NoError(t, err)
+	assert.Equal(t, &Lineage{Parent: "new", Turn: 1}, child.ForkedFrom)
+	assert.True(t, child.UpdatedAt.Equal(stored.UpdatedAt))
+}
+
+func TestRename_Errors(t *testing.T) {
+	m := newTestManager(t)
+	require.NoError(t, m.Store("a", NewSession()))
+	require.NoError(t, m.Store("b", NewSession()))
+
+	assert.ErrorIs(t, m.Rename("a", "b"), ErrExists)
+	assert.ErrorIs(t, m.Rename("missing", "c"), ErrNotFound)
+	assert.ErrorIs(t, m.Rename("a", "../c"), ErrInvalidID)
+}
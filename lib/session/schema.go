@@ -0,0 +1,48 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dtrugman/qory/lib/message"
+)
+
+// CurrentVersion is the session schema version written by Store.
+//
+//	v0: {"messages": [...]}, timestamps only available as the file mtime
+//	v1: adds version, title, created_at and updated_at
+const CurrentVersion = 1
+
+// migrate upgrades a session loaded from disk to CurrentVersion in place.
+// modTime is the file's modification time, used to backfill timestamps that
+// older schemas did not record.
+func migrate(s *Session, modTime time.Time) error {
+	if s.Version > CurrentVersion {
+		return fmt.Errorf("schema v%d is newer than supported v%d, please upgrade qory", s.Version, CurrentVersion)
+	}
+
+	if s.Version == 0 {
+		s.CreatedAt = modTime
+		for _, m := range s.Messages {
+			if !m.Time.IsZero() && m.Time.Before(s.CreatedAt) {
+				s.CreatedAt = m.Time
+			}
+		}
+		s.UpdatedAt = modTime
+		s.Version = 1
+	}
+
+	return nil
+}
+
+// LastModel returns the model that produced the latest answer, falling back
+// to the model recorded in the session parameters.
+func (s *Session) LastModel() string {
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		m := s.Messages[i]
+		if m.Role == message.RoleAssistant && m.Model != "" {
+			return m.Model
+		}
+	}
+	return s.Params.Model
+}
@@ -0,0 +1,304 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dtrugman/qory/lib/message"
+)
+
+const (
+	searchSnippetChars  = 160
+	searchSnippetBefore = 60
+)
+
+var ErrEmptyQuery = errors.New("empty search query")
+
+// SearchOptions describes a search across stored sessions.
+type SearchOptions struct {
+	// Query holds words that must all appear in a session. With Regex set it
+	// is a regular expression instead.
+	Query string
+	Regex bool
+
+	// Roles restricts matching to messages from these roles; empty means all.
+	Roles []message.Role
+
+	// Model, when set, restricts results to sessions that used a model whose
+	// name contains it (case-insensitive).
+	Model string
+
+	// Since and Until bound the sessions' last update time; zero means unbounded.
+	Since time.Time
+	Until time.Time
+
+	// Limit caps the number of results; 0 means no limit.
+	Limit int
+}
+
+// SearchResult is a matching session, with a snippet of its best-matching
+// message. Highlights are byte ranges of the matches within Snippet.
+type SearchResult struct {
+	ID         string
+	Title      string
+	Model      string
+	UpdatedAt  time.Time
+	Score      float64
+	Snippet    string
+	Highlights [][2]int
+}
+
+// matcher finds the matches of a query within a message.
+type matcher func(content string) [][2]int
+
+// Search returns the sessions matching opts, best match first.
+//
+// Word queries are answered from the search index, loading only the sessions
+// that make it into the results. Regex queries have to scan every session
+// that passes the metadata filters.
+func (m *Manager) Search(opts SearchOptions) ([]SearchResult, error) {
+	if strings.TrimSpace(opts.Query) == "" {
+		return nil, ErrEmptyQuery
+	}
+
+	idx := m.loadIndex()
+	if err := m.syncIndex(idx); err != nil {
+		return nil, fmt.Errorf("update search index: %w", err)
+	}
+
+	var results []SearchResult
+	var match matcher
+	if opts.Regex {
+		re, err := regexp.Compile(opts.Query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		match = func(content string) [][2]int {
+			var ranges [][2]int
+			for _, loc := range re.FindAllStringIndex(content, -1) {
+				if loc[1] > loc[0] {
+					ranges = append(ranges, [2]int{loc[0], loc[1]})
+				}
+			}
+			return ranges
+		}
+		results = m.scoreByScan(idx, opts, match)
+	} else {
+		terms := uniqueTerms(opts.Query)
+		if len(terms) == 0 {
+			return nil, ErrEmptyQuery
+		}
+		match = termMatcher(terms)
+		results = scoreByIndex(idx, opts, terms)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].UpdatedAt.After(results[j].UpdatedAt)
+	})
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+
+	for i := range results {
+		s, err := m.Load(results[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("load session %s: %w", results[i].ID, err)
+		}
+		results[i].Snippet, results[i].Highlights = bestSnippet(s, opts.Roles, match)
+	}
+
+	return results, nil
+}
+
+// candidate reports whether entry passes the metadata filters of opts.
+func (opts SearchOptions) candidate(entry *indexEntry) bool {
+	if !opts.Since.IsZero() && entry.UpdatedAt.Before(opts.Since) {
+		return false
+	}
+	if !opts.Until.IsZero() && entry.UpdatedAt.After(opts.Until) {
+		return false
+	}
+	if opts.Model != "" {
+		model := strings.ToLower(opts.Model)
+		return slices.ContainsFunc(entry.Models, func(m string) bool {
+			return strings.Contains(strings.ToLower(m), model)
+		})
+	}
+	return true
+}
+
+func (opts SearchOptions) includesRole(role message.Role) bool {
+	return len(opts.Roles) == 0 || slices.Contains(opts.Roles, role)
+}
+
+func newSearchResult(id string, entry *indexEntry, score float64) SearchResult {
+	result := SearchResult{
+		ID:        id,
+		Title:     entry.Title,
+		UpdatedAt: entry.UpdatedAt,
+		Score:     score,
+	}
+	if len(entry.Models) > 0 {
+		result.Model = entry.Models[len(entry.Models)-1]
+	}
+	return result
+}
+
+// scoreByIndex ranks sessions containing every term with TF-IDF, giving a
+// bonus to terms that also appear in the session title.
+func scoreByIndex(idx *searchIndex, opts SearchOptions, terms []string) []SearchResult {
+	counts := make(map[string]map[string]int) // session -> term -> count
+	docFreq := make(map[string]int)
+	for id, entry := range idx.Sessions {
+		if !opts.candidate(entry) {
+			continue
+		}
+		tf := make(map[string]int, len(terms))
+		for role, roleTerms := range entry.Terms {
+			if !opts.includesRole(role) {
+				continue
+			}
+			for _, term := range terms {
+				tf[term] += roleTerms[term]
+			}
+		}
+		complete := true
+		for _, term := range terms {
+			if tf[term] == 0 {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			continue
+		}
+		counts[id] = tf
+		for _, term := range terms {
+			docFreq[term]++
+		}
+	}
+
+	total := float64(len(idx.Sessions))
+	var results []SearchResult
+	for id, tf := range counts {
+		entry := idx.Sessions[id]
+		titleTerms := make(map[string]bool)
+		for _, tok := range tokenize(entry.Title) {
+			titleTerms[tok.term] = true
+		}
+
+		score := 0.0
+		for _, term := range terms {
+			idf := math.Log(1 + total/float64(docFreq[term]))
+			score += (1 + math.Log(float64(tf[term]))) * idf
+			if titleTerms[term] {
+				score += idf
+			}
+		}
+		results = append(results, newSearchResult(id, entry, score))
+	}
+	return results
+}
+
+// scoreByScan loads every candidate session and ranks them by match count.
+func (m *Manager) scoreByScan(idx *searchIndex, opts SearchOptions, match matcher) []SearchResult {
+	var results []SearchResult
+	for id, entry := range idx.Sessions {
+		if !opts.candidate(entry) {
+			continue
+		}
+		s, err := m.Load(id)
+		if err != nil {
+			continue
+		}
+		matches := 0
+		for _, msg := range s.Messages {
+			if opts.includesRole(msg.Role) {
+				matches += len(match(msg.Content))
+			}
+		}
+		if matches > 0 {
+			results = append(results, newSearchResult(id, entry, float64(matches)))
+		}
+	}
+	return results
+}
+
+func uniqueTerms(query string) []string {
+	var terms []string
+	for _, tok := range tokenize(query) {
+		if !slices.Contains(terms, tok.term) {
+			terms = append(terms, tok.term)
+		}
+	}
+	return terms
+}
+
+func termMatcher(terms []string) matcher {
+	return func(content string) [][2]int {
+		var ranges [][2]int
+		for _, tok := range tokenize(content) {
+			if slices.Contains(terms, tok.term) {
+				ranges = append(ranges, [2]int{tok.start, tok.end})
+			}
+		}
+		return ranges
+	}
+}
+
+// bestSnippet cuts a single-line excerpt around the first match of the
+// message with the most matches.
+func bestSnippet(s Session, roles []message.Role, match matcher) (string, [][2]int) {
+	opts := SearchOptions{Roles: roles}
+
+	var content string
+	var ranges [][2]int
+	for _, msg := range s.Messages {
+		if !opts.includesRole(msg.Role) {
+			continue
+		}
+		if r := match(msg.Content); len(r) > len(ranges) {
+			content, ranges = msg.Content, r
+		}
+	}
+	if len(ranges) == 0 {
+		return "", nil
+	}
+
+	start := alignRuneStart(content, max(0, ranges[0][0]-searchSnippetBefore))
+	end := min(len(content), start+searchSnippetChars)
+	end = max(alignRuneStart(content, end), ranges[0][1])
+
+	var sb strings.Builder
+	offset := -start
+	if start > 0 {
+		sb.WriteString("...")
+		offset += 3
+	}
+	sb.WriteString(strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, content[start:end]))
+	if end < len(content) {
+		sb.WriteString("...")
+	}
+
+	var highlights [][2]int
+	for _, r := range ranges {
+		if r[0] >= start && r[1] <= end {
+			highlights = append(highlights, [2]int{r[0] + offset, r[1] + offset})
+		}
+	}
+	return sb.String(), highlights
+}
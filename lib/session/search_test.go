@@ -0,0 +1,166 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func storeConversation(t *testing.T, m *Manager, id, title, model, question, answer string) {
+	t.Helper()
+	s := NewSession()
+	s.Title = title
+	s.AddMessage(message.NewUserMessage(question))
+	reply := message.NewAssistantMessage(answer)
+	reply.Model = model
+	s.AddMessage(reply)
+	require.NoError(t, m.Store(id, s))
+}
+
+func resultIDs(results []SearchResult) []string {
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func newSearchManager(t *testing.T) *Manager {
+	t.Helper()
+	m := newTestManager(t)
+	storeConversation(t, m, "nginx", "Nginx reverse proxy", "gpt-4o",
+		"How do I configure nginx as a reverse proxy?", "Use proxy_pass in a location block. Nginx will forward requests.")
+	storeConversation(t, m, "python", "", "gpt-4o-mini",
+		"How do I reverse a list in Python?", "Use reversed() or list[::-1].")
+	storeConversation(t, m, "mixed", "", "gpt-4o-mini",
+		"Write a python script that reloads nginx", "Call subprocess.run(['nginx', '-s', 'reload']).")
+	return m
+}
+
+func TestSearch_RequiresAllTerms(t *testing.T) {
+	m := newSearchManager(t)
+
+	results, err := m.Search(SearchOptions{Query: "nginx python"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mixed"}, resultIDs(results))
+}
+
+func TestSearch_RanksTitleMatchesHigher(t *testing.T) {
+	m := newSearchManager(t)
+
+	results, err := m.Search(SearchOptions{Query: "NGINX"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nginx", "mixed"}, resultIDs(results))
+}
+
+func TestSearch_HighlightsMatches(t *testing.T) {
+	m := newSearchManager(t)
+
+	results, err := m.Search(SearchOptions{Query: "reversed"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	r := results[0]
+	require.NotEmpty(t, r.Highlights)
+	h := r.Highlights[0]
+	assert.Equal(t, "reversed", r.Snippet[h[0]:h[1]])
+	assert.Equal(t, "gpt-4o-mini", r.Model)
+}
+
+func TestSearch_FiltersByRole(t *testing.T) {
+	m := newSearchManager(t)
+
+	results, err := m.Search(SearchOptions{Query: "subprocess", Roles: []message.Role{message.RoleUser}})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, err = m.Search(SearchOptions{Query: "subprocess", Roles: []message.Role{message.RoleAssistant}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mixed"}, resultIDs(results))
+}
+
+func TestSearch_FiltersByModelAndDate(t *testing.T) {
+	m := newSearchManager(t)
+
+	results, err := m.Search(SearchOptions{Query: "how", Model: "MINI"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"python"}, resultIDs(results))
+
+	results, err = m.Search(SearchOptions{Query: "how", Since: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestSearch_Regex(t *testing.T) {
+	m := newSearchManager(t)
+
+	results, err := m.Search(SearchOptions{Query: `proxy_\w+`, Regex: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"nginx"}, resultIDs(results))
+	h := results[0].Highlights[0]
+	assert.Equal(t, "proxy_pass", results[0].Snippet[h[0]:h[1]])
+
+	_, err = m.Search(SearchOptions{Query: `(`, Regex: true})
+	assert.Error(t, err)
+}
+
+func TestSearch_EmptyQuery(t *testing.T) {
+	m := newSearchManager(t)
+	_, err := m.Search(SearchOptions{Query: " !? "})
+	assert.ErrorIs(t, err, ErrEmptyQuery)
+}
+
+func TestSearch_IndexFollowsDiskChanges(t *testing.T) {
+	m := newSearchManager(t)
+
+	// Sessions written without going through Store (e.g. by older versions).
+	path := filepath.Join(m.dir, "legacy")
+	require.NoError(t, os.WriteFile(path, []byte(`{"messages":[{"role":"user","content":"kubernetes ingress"}]}`), 0o600))
+	require.NoError(t, m.Delete("nginx"))
+	require.NoError(t, m.Rename("mixed", "renamed"))
+
+	results, err := m.Search(SearchOptions{Query: "kubernetes"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"legacy"}, resultIDs(results))
+
+	results, err = m.Search(SearchOptions{Query: "nginx"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"renamed"}, resultIDs(results))
+}
+
+func TestSearch_IndexEntriesAreSeparate(t *testing.T) {
+	m := newSearchManager(t)
+	legacy := filepath.Join(m.dir, legacyIndexFileName)
+	require.NoError(t, os.WriteFile(legacy, []byte(`{"version":1,"sessions":{}}`), 0o600))
+
+	// A damaged entry only costs re-indexing its own session.
+	require.NoError(t, os.WriteFile(filepath.Join(m.dir, indexDirName, "nginx"), []byte("{"), 0o600))
+	before, err := os.ReadFile(filepath.Join(m.dir, indexDirName, "mixed"))
+	require.NoError(t, err)
+
+	results, err := m.Search(SearchOptions{Query: "nginx"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"nginx", "mixed"}, resultIDs(results))
+
+	after, err := os.ReadFile(filepath.Join(m.dir, indexDirName, "mixed"))
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+	_, err = os.Stat(legacy)
+	assert.True(t, os.IsNotExist(err), "the single-file index of older versions is removed")
+}
+
+func TestEnum_SkipsIndex(t *testing.T) {
+	m := newSearchManager(t)
+	_, err := os.Stat(filepath.Join(m.dir, indexDirName))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(m.dir, legacyIndexFileName), []byte("{}"), 0o600))
+
+	previews, err := m.Enum(0)
+	require.NoError(t, err)
+	assert.Len(t, previews, 3)
+}
@@ -0,0 +1,42 @@
+package session
+
+import (
+	"github.com/dtrugman/qory/lib/message"
+)
+
+const summaryPrefix = "Summary of the earlier part of this conversation:\n\n"
+
+// Summary stands in for the oldest messages of a session when it is sent to
+// the model.
+type Summary struct {
+	Text string `json:"text"`
+
+	// Through is the number of leading messages the summary replaces. A
+	// leading system prompt is never summarized and is always sent as is.
+	Through int `json:"through"`
+}
+
+// Context splits the conversation as it should be sent to the model: fixed
+// holds the system prompt and the summary (as a system message), if any, and
+// turns holds the messages the summary does not cover.
+func (s *Session) Context() (fixed, turns []message.Message) {
+	start := 0
+	if len(s.Messages) > 0 && s.Messages[0].Role == message.RoleSystem {
+		fixed = append(fixed, s.Messages[0])
+		start = 1
+	}
+	if s.Summary != nil && s.Summary.Through >= start && s.Summary.Through <= len(s.Messages) {
+		fixed = append(fixed, message.NewSystemMessage(summaryPrefix+s.Summary.Text))
+		start = s.Summary.Through
+	}
+	return fixed, s.Messages[start:]
+}
+
+// Rewind cuts the session down to its first n messages, discarding the
+// summary if it covers any of the removed ones.
+func (s *Session) Rewind(n int) {
+	s.Messages = s.Messages[:n]
+	if s.Summary != nil && s.Summary.Through > n {
+		s.Summary = nil
+	}
+}
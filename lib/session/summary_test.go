@@ -0,0 +1,54 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_WithoutSummary(t *testing.T) {
+	s := makeForkSession()
+
+	fixed, turns := s.Context()
+	assert.Equal(t, s.Messages[:1], fixed)
+	assert.Equal(t, s.Messages[1:], turns)
+}
+
+func TestContext_SummaryReplacesOldestMessages(t *testing.T) {
+	s := makeForkSession()
+	s.Summary = &Summary{Text: "q1 was answered", Through: 3}
+
+	fixed, turns := s.Context()
+	require.Len(t, fixed, 2)
+	assert.Equal(t, s.Messages[0], fixed[0])
+	assert.Equal(t, message.RoleSystem, fixed[1].Role)
+	assert.Contains(t, fixed[1].Content, "q1 was answered")
+	assert.Equal(t, s.Messages[3:], turns)
+}
+
+func TestRewind_DropsStaleSummary(t *testing.T) {
+	s := makeForkSession()
+	s.Summary = &Summary{Text: "q1 was answered", Through: 3}
+
+	s.Rewind(3)
+	assert.NotNil(t, s.Summary)
+
+	s.Rewind(2)
+	assert.Nil(t, s.Summary)
+	assert.Len(t, s.Messages, 2)
+}
+
+func TestFork_KeepsSummaryOfKeptMessages(t *testing.T) {
+	s := makeForkSession()
+	s.Summary = &Summary{Text: "q1 was answered", Through: 3}
+
+	fork, err := s.Fork("parent", 2)
+	require.NoError(t, err)
+	assert.Equal(t, s.Summary, fork.Summary)
+
+	fork, err = s.Fork("parent", 0)
+	require.NoError(t, err)
+	assert.Nil(t, fork.Summary)
+}
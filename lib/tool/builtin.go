@@ -0,0 +1,286 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dtrugman/qory/lib/input"
+)
+
+const (
+	// maxReadBytes bounds the files read_file and grep look into.
+	maxReadBytes = 16 << 20
+
+	// maxMatches bounds the lines grep reports.
+	maxMatches = 200
+
+	// maxMatchLen cuts matching lines short, as minified files would
+	// otherwise fill the result with a single line.
+	maxMatchLen = 300
+
+	// commandTimeout bounds how long a shell command may run.
+	commandTimeout = 2 * time.Minute
+)
+
+func readFile(Options) Tool {
+	return Tool{
+		Name: "read_file",
+		Description: "Read a text file of the project, or a range of its lines. Ignored and hidden files can't be read. " +
+			"Paths are relative to the project root.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path":      map[string]any{"type": "string", "description": "Path of the file"},
+				"from_line": map[string]any{"type": "integer", "description": "First line to read, counting from 1"},
+				"to_line":   map[string]any{"type": "integer", "description": "Last line to read"},
+			},
+			"required": []string{"path"},
+		},
+		Run: func(_ context.Context, args json.RawMessage) (string, error) {
+			var a struct {
+				Path     string `json:"path"`
+				FromLine int    `json:"from_line"`
+				ToLine   int    `json:"to_line"`
+			}
+			if err := decode(args, &a); err != nil {
+				return "", err
+			}
+			path, err := resolveUnignored(a.Path)
+			if err != nil {
+				return "", err
+			}
+			content, err := input.ReadFile(path, &input.Budget{Remaining: maxReadBytes})
+			if err != nil {
+				return "", err
+			}
+			text := string(content)
+			if a.FromLine > 0 || a.ToLine > 0 {
+				lines := input.Lines{From: max(a.FromLine, 1), To: a.ToLine}
+				if text, err = lines.Slice(text); err != nil {
+					return "", err
+				}
+			}
+			return truncate(text), nil
+		},
+	}
+}
+
+func listDirectory(Options) Tool {
+	return Tool{
+		Name:        "list_directory",
+		Description: "List the entries of a directory of the project; directories end with a slash. Paths are relative to the project root.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{"type": "string", "description": "Path of the directory, the project root if empty"},
+			},
+		},
+		Run: func(_ context.Context, args json.RawMessage) (string, error) {
+			var a struct {
+				Path string `json:"path"`
+			}
+			if err := decode(args, &a); err != nil {
+				return "", err
+			}
+			path, err := resolve(a.Path)
+			if err != nil {
+				return "", err
+			}
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return "", err
+			}
+
+			var out strings.Builder
+			for _, e := range entries {
+				out.WriteString(e.Name())
+				if e.IsDir() {
+					out.WriteString("/")
+				}
+				out.WriteString("\n")
+			}
+			if out.Len() == 0 {
+				return "The directory is empty.", nil
+			}
+			return truncate(out.String()), nil
+		},
+	}
+}
+
+func grep(Options) Tool {
+	return Tool{
+		Name: "grep",
+		Description: "Search the text files of the project for lines matching a regular expression (RE2 syntax). " +
+			"Ignored, hidden and binary files are skipped. Reports matches as path:line:text.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"pattern": map[string]any{"type": "string", "description": "Regular expression to look for"},
+				"path":    map[string]any{"type": "string", "description": "File or directory to search, the project root if empty"},
+				"include": map[string]any{"type": "string", "description": "Only search files whose name matches this glob, e.g. *.go"},
+			},
+			"required": []string{"pattern"},
+		},
+		Run: func(_ context.Context, args json.RawMessage) (string, error) {
+			var a struct {
+				Pattern string `json:"pattern"`
+				Path    string `json:"path"`
+				Include string `json:"include"`
+			}
+			if err := decode(args, &a); err != nil {
+				return "", err
+			}
+			re, err := regexp.Compile(a.Pattern)
+			if err != nil {
+				return "", err
+			}
+			if _, err := filepath.Match(a.Include, ""); err != nil {
+				return "", fmt.Errorf("invalid include glob %q: %w", a.Include, err)
+			}
+			path, err := resolve(a.Path)
+			if err != nil {
+				return "", err
+			}
+			files, err := searchedFiles(path)
+			if err != nil {
+				return "", err
+			}
+
+			var out strings.Builder
+			matches := 0
+			for _, f := range files {
+				if a.Include != "" {
+					if ok, _ := filepath.Match(a.Include, filepath.Base(f.Path)); !ok {
+						continue
+					}
+				}
+				for i, line := range strings.Split(string(f.Content), "\n") {
+					if !re.MatchString(line) {
+						continue
+					}
+					if matches == maxMatches {
+						fmt.Fprintf(&out, "[stopped after %d matches]\n", maxMatches)
+						return truncate(out.String()), nil
+					}
+					if len(line) > maxMatchLen {
+						line = strings.ToValidUTF8(line[:maxMatchLen], "") + "..."
+					}
+					fmt.Fprintf(&out, "%s:%d:%s\n", filepath.ToSlash(f.Path), i+1, line)
+					matches++
+				}
+			}
+			if matches == 0 {
+				return "No matches.", nil
+			}
+			return truncate(out.String()), nil
+		},
+	}
+}
+
+// resolveUnignored resolves path like resolve, refusing the files grep would
+// skip as ignored or hidden.
+func resolveUnignored(path string) (string, error) {
+	rel, err := resolve(path)
+	if err != nil {
+		return "", err
+	}
+	skipped, err := input.Skipped(".", rel)
+	if err != nil {
+		return "", err
+	}
+	if skipped {
+		return "", fmt.Errorf("%s is ignored or hidden", path)
+	}
+	return rel, nil
+}
+
+// searchedFiles returns the file at path, unless it is ignored or hidden, or
+// the text files under it when it is a directory.
+func searchedFiles(path string) ([]input.File, error) {
+	budget := &input.Budget{Remaining: maxReadBytes}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if skipped, err := input.Skipped(".", path); err != nil || skipped {
+			return nil, err
+		}
+		content, err := input.ReadFile(path, budget)
+		if err != nil {
+			return nil, err
+		}
+		return []input.File{{Path: path, Content: content}}, nil
+	}
+	files, _, err := input.Expand(path, budget)
+	return files, err
+}
+
+func runCommand(opts Options) Tool {
+	return Tool{
+		Name: "run_command",
+		Description: "Run a shell command in the project root and return its combined output and exit status. " +
+			"The user confirms every command before it runs.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{"type": "string", "description": "Command line for sh -c"},
+			},
+			"required": []string{"command"},
+		},
+		Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var a struct {
+				Command string `json:"command"`
+			}
+			if err := decode(args, &a); err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(a.Command) == "" {
+				return "", errors.New("empty command")
+			}
+			if opts.Confirm == nil {
+				return "", errors.New("commands can't be confirmed here")
+			}
+			// Quoted, so control characters can't disguise what runs.
+			ok, err := opts.Confirm(fmt.Sprintf("Run %q?", a.Command))
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "The user declined to run this command.", nil
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+			defer cancel()
+
+			var output bytes.Buffer
+			cmd := exec.CommandContext(ctx, "sh", "-c", a.Command)
+			cmd.Stdout = &output
+			cmd.Stderr = &output
+			err = cmd.Run()
+
+			result := strings.TrimRight(truncate(output.String()), "\n")
+			var exitErr *exec.ExitError
+			switch {
+			case ctx.Err() == context.DeadlineExceeded:
+				result += fmt.Sprintf("\n[timed out after %s]", commandTimeout)
+			case errors.As(err, &exitErr):
+				result += fmt.Sprintf("\n[exit status %d]", exitErr.ExitCode())
+			case err != nil:
+				return "", err
+			default:
+				result += "\n[exit status 0]"
+			}
+			return strings.TrimLeft(result, "\n"), nil
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// maxOutput caps what a single call hands back to the model.
+const maxOutput = 32 << 10
+
+// Tool is a local capability the model may call while answering.
+type Tool struct {
+	// Name identifies the tool to the model.
+	Name        string
+	Description string
+
+	// Parameters is the JSON Schema of the arguments object.
+	Parameters map[string]any
+
+	// Run performs a call with the arguments the model passed, and returns
+	// the result to show the model. Errors are shown to the model too.
+	Run func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// Options configure the built-in tools.
+type Options struct {
+	// Confirm asks the user a yes or no question. Tools with side effects
+	// ask it before every call, and can't be used without it.
+	Confirm func(question string) (bool, error)
+}
+
+// builtins maps the names --tools accepts to the built-in tools.
+var builtins = map[string]func(Options) Tool{
+	"read":  readFile,
+	"list":  listDirectory,
+	"grep":  grep,
+	"shell": runCommand,
+}
+
+// Names returns the names of the built-in tools, sorted.
+func Names() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Builtins returns the built-in tools with the given names, in that order.
+func Builtins(names []string, opts Options) ([]Tool, error) {
+	var tools []Tool
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		build, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q (available: %s)", name, strings.Join(Names(), ", "))
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		tools = append(tools, build(opts))
+	}
+	return tools, nil
+}
+
+// Find returns the tool called name among tools.
+func Find(tools []Tool, name string) (Tool, bool) {
+	i := slices.IndexFunc(tools, func(t Tool) bool { return t.Name == name })
+	if i < 0 {
+		return Tool{}, false
+	}
+	return tools[i], true
+}
+
+// decode parses the arguments of a call into v.
+func decode(args json.RawMessage, v any) error {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// resolve returns path, relative to the working directory, after checking it
+// doesn't lead out of the working directory: the file tools only expose the
+// project qory runs in.
+func resolve(path string) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	if realWD, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = realWD
+	}
+
+	rel, err := filepath.Rel(wd, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory", path)
+	}
+	return rel, nil
+}
+
+// truncate cuts output down to maxOutput, saying so.
+func truncate(output string) string {
+	if len(output) <= maxOutput {
+		return output
+	}
+	return strings.ToValidUTF8(output[:maxOutput], "") + fmt.Sprintf("\n[output truncated at %d KiB]", maxOutput>>10)
+}
@@ -0,0 +1,157 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// project creates a small project in a temporary directory and makes it the
+// working directory.
+func project(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":        "package main\n\n// TODO: flags\nfunc main() {}\n",
+		"lib/util.go":    "package lib\n\n// TODO: tests\n",
+		"lib/notes.md":   "TODO nothing\n",
+		"vendor/x.go":    "// TODO: ignored\n",
+		".gitignore":     "vendor/\n",
+		"assets/bin.dat": "TODO\x00",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	t.Chdir(dir)
+	return dir
+}
+
+func run(t *testing.T, tool Tool, args string) (string, error) {
+	t.Helper()
+	return tool.Run(context.Background(), json.RawMessage(args))
+}
+
+func TestBuiltins(t *testing.T) {
+	tools, err := Builtins([]string{"grep", "read", "grep"}, Options{})
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+	assert.Equal(t, "grep", tools[0].Name)
+	assert.Equal(t, "read_file", tools[1].Name)
+
+	_, ok := Find(tools, "read_file")
+	assert.True(t, ok)
+	_, ok = Find(tools, "run_command")
+	assert.False(t, ok)
+
+	_, err = Builtins([]string{"write"}, Options{})
+	assert.EqualError(t, err, `unknown tool "write" (available: grep, list, read, shell)`)
+}
+
+func TestReadFile(t *testing.T) {
+	project(t)
+	read := readFile(Options{})
+
+	out, err := run(t, read, `{"path": "main.go"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\n// TODO: flags\nfunc main() {}\n", out)
+
+	out, err = run(t, read, `{"path": "main.go", "from_line": 3, "to_line": 3}`)
+	require.NoError(t, err)
+	assert.Equal(t, "// TODO: flags\n", out)
+
+	_, err = run(t, read, `{"path": "../outside.txt"}`)
+	assert.Error(t, err)
+
+	_, err = run(t, read, `{"path": "assets/bin.dat"}`)
+	assert.Error(t, err)
+
+	for _, path := range []string{"vendor/x.go", ".gitignore"} {
+		_, err = run(t, read, fmt.Sprintf(`{"path": %q}`, path))
+		assert.ErrorContains(t, err, "is ignored or hidden", path)
+	}
+}
+
+func TestResolve_StaysInWorkingDirectory(t *testing.T) {
+	dir := project(t)
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+
+	_, err := resolve(filepath.Join(outside, "secret"))
+	assert.ErrorContains(t, err, "is outside the working directory")
+	_, err = resolve("link/secret")
+	assert.ErrorContains(t, err, "is outside the working directory")
+
+	rel, err := resolve(filepath.Join(dir, "lib", "util.go"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("lib", "util.go"), rel)
+}
+
+func TestListDirectory(t *testing.T) {
+	project(t)
+
+	out, err := run(t, listDirectory(Options{}), `{}`)
+	require.NoError(t, err)
+	assert.Equal(t, ".gitignore\nassets/\nlib/\nmain.go\nvendor/\n", out)
+}
+
+func TestGrep(t *testing.T) {
+	project(t)
+	g := grep(Options{})
+
+	out, err := run(t, g, `{"pattern": "TODO:"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "lib/util.go:3:// TODO: tests\nmain.go:3:// TODO: flags\n", out)
+
+	out, err = run(t, g, `{"pattern": "TODO", "path": "lib", "include": "*.md"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "lib/notes.md:1:TODO nothing\n", out)
+
+	out, err = run(t, g, `{"pattern": "TODO", "path": "vendor/x.go"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "No matches.", out, "ignored files are skipped even when named")
+
+	out, err = run(t, g, `{"pattern": "FIXME"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "No matches.", out)
+
+	_, err = run(t, g, `{"pattern": "("}`)
+	assert.Error(t, err)
+}
+
+func TestRunCommand(t *testing.T) {
+	project(t)
+	var asked []string
+	answer := true
+	shell := runCommand(Options{Confirm: func(q string) (bool, error) {
+		asked = append(asked, q)
+		return answer, nil
+	}})
+
+	out, err := run(t, shell, `{"command": "cat main.go | wc -l; exit 3"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "4\n[exit status 3]", out)
+	assert.Equal(t, []string{`Run "cat main.go | wc -l; exit 3"?`}, asked)
+
+	answer = false
+	out, err = run(t, shell, `{"command": "rm main.go"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "The user declined to run this command.", out)
+	assert.FileExists(t, "main.go")
+
+	asked = nil
+	_, err = run(t, shell, `{"command": "rm -rf lib\u001b[2K\rls"}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`Run "rm -rf lib\x1b[2K\rls"?`}, asked)
+
+	_, err = run(t, runCommand(Options{}), `{"command": "true"}`)
+	assert.Error(t, err)
+}
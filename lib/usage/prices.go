@@ -0,0 +1,78 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/dtrugman/qory/lib/util"
+)
+
+const tokensPerUnit = 1_000_000
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Prices maps model names to their price. Keys may either be a bare model
+// name ("gpt-4o") or include a provider prefix ("openai/gpt-4o").
+type Prices map[string]Price
+
+// DefaultPrices returns the built-in price table. It is a best-effort
+// snapshot; users can override or extend it with `qory config prices set`.
+func DefaultPrices() Prices {
+	return Prices{
+		"gpt-4o":            {Input: 2.50, Output: 10.00},
+		"gpt-4o-mini":       {Input: 0.15, Output: 0.60},
+		"gpt-4.1":           {Input: 2.00, Output: 8.00},
+		"gpt-4.1-mini":      {Input: 0.40, Output: 1.60},
+		"gpt-4.1-nano":      {Input: 0.10, Output: 0.40},
+		"o3":                {Input: 2.00, Output: 8.00},
+		"o3-mini":           {Input: 1.10, Output: 4.40},
+		"o4-mini":           {Input: 1.10, Output: 4.40},
+		"claude-sonnet-4-0": {Input: 3.00, Output: 15.00},
+		"claude-opus-4-0":   {Input: 15.00, Output: 75.00},
+		"claude-3-5-haiku":  {Input: 0.80, Output: 4.00},
+	}
+}
+
+// ParsePrices decodes a user price table from JSON, e.g.
+//
+//	{"gpt-4o": {"input": 2.5, "output": 10}}
+func ParsePrices(raw string) (Prices, error) {
+	var prices Prices
+	if err := json.Unmarshal([]byte(raw), &prices); err != nil {
+		return nil, fmt.Errorf("invalid price table: %w", err)
+	}
+	for model, price := range prices {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("invalid price table: negative price for %q", model)
+		}
+	}
+	return prices, nil
+}
+
+// Merge returns a copy of p with the entries of overrides applied on top.
+func (p Prices) Merge(overrides Prices) Prices {
+	return util.MergeMaps(p, overrides)
+}
+
+// Lookup finds the price for model (see util.LookupModel).
+func (p Prices) Lookup(model string) (Price, bool) {
+	return util.LookupModel(p, model)
+}
+
+// Cost estimates the cost of u in USD. Reasoning tokens are already part of
+// the completion count and are billed as output. ok is false when the model
+// has no known price.
+func (p Prices) Cost(model string, u message.Usage) (cost float64, ok bool) {
+	price, ok := p.Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	cost = float64(u.PromptTokens)*price.Input/tokensPerUnit +
+		float64(u.CompletionTokens)*price.Output/tokensPerUnit
+	return cost, true
+}
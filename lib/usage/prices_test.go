@@ -0,0 +1,49 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrices_LookupStripsProviderPrefix(t *testing.T) {
+	prices := Prices{"gpt-4o": {Input: 1, Output: 2}}
+
+	price, ok := prices.Lookup("openai/gpt-4o")
+	require.True(t, ok)
+	assert.Equal(t, Price{Input: 1, Output: 2}, price)
+
+	_, ok = prices.Lookup("openai/unknown")
+	assert.False(t, ok)
+}
+
+func TestPrices_LookupPrefersExactMatch(t *testing.T) {
+	prices := Prices{
+		"gpt-4o":       {Input: 1, Output: 2},
+		"azure/gpt-4o": {Input: 3, Output: 4},
+	}
+
+	price, ok := prices.Lookup("azure/gpt-4o")
+	require.True(t, ok)
+	assert.Equal(t, Price{Input: 3, Output: 4}, price)
+}
+
+func TestPrices_Cost(t *testing.T) {
+	prices := Prices{"m": {Input: 2, Output: 8}}
+
+	cost, ok := prices.Cost("m", message.Usage{PromptTokens: 500_000, CompletionTokens: 250_000})
+	require.True(t, ok)
+	assert.InDelta(t, 3.0, cost, 1e-9)
+}
+
+func TestParsePrices_RejectsNegative(t *testing.T) {
+	_, err := ParsePrices(`{"m": {"input": -1, "output": 1}}`)
+	assert.Error(t, err)
+}
+
+func TestParsePrices_RejectsMalformed(t *testing.T) {
+	_, err := ParsePrices(`["m"]`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dtrugman/qory/lib/message"
+)
+
+const dayFormat = "2006-01-02"
+
+// GroupBy selects the dimension a usage report is aggregated on.
+type GroupBy string
+
+const (
+	GroupByDay     GroupBy = "day"
+	GroupByModel   GroupBy = "model"
+	GroupBySession GroupBy = "session"
+)
+
+// ParseGroupBy validates a user-supplied grouping.
+func ParseGroupBy(value string) (GroupBy, error) {
+	switch by := GroupBy(value); by {
+	case GroupByDay, GroupByModel, GroupBySession:
+		return by, nil
+	default:
+		return "", fmt.Errorf("invalid grouping %q (expected day, model or session)", value)
+	}
+}
+
+// Record is the usage of a single assistant response.
+type Record struct {
+	SessionID string
+	Model     string
+	Time      time.Time
+	Usage     message.Usage
+}
+
+// Row is one line of an aggregated usage report.
+type Row struct {
+	Key      string
+	Requests int
+	Usage    message.Usage
+	Cost     float64
+
+	// Unpriced counts the requests whose model had no known price and
+	// therefore do not contribute to Cost.
+	Unpriced int
+}
+
+func (by GroupBy) key(r Record) string {
+	switch by {
+	case GroupByModel:
+		return r.Model
+	case GroupBySession:
+		return r.SessionID
+	default:
+		return r.Time.Local().Format(dayFormat)
+	}
+}
+
+// Aggregate groups records by the given dimension and estimates their cost.
+// Rows are ordered chronologically for GroupByDay and by descending cost
+// (then token count) otherwise.
+func Aggregate(records []Record, by GroupBy, prices Prices) []Row {
+	rows := make(map[string]*Row)
+	for _, r := range records {
+		key := by.key(r)
+		row, ok := rows[key]
+		if !ok {
+			row = &Row{Key: key}
+			rows[key] = row
+		}
+
+		row.Requests++
+		row.Usage.Add(r.Usage)
+		if cost, ok := prices.Cost(r.Model, r.Usage); ok {
+			row.Cost += cost
+		} else {
+			row.Unpriced++
+		}
+	}
+
+	result := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, *row)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if by == GroupByDay {
+			return a.Key < b.Key
+		}
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		ta := a.Usage.PromptTokens + a.Usage.CompletionTokens
+		tb := b.Usage.PromptTokens + b.Usage.CompletionTokens
+		if ta != tb {
+			return ta > tb
+		}
+		return a.Key < b.Key
+	})
+
+	return result
+}
+
+// Total sums all rows into a single row keyed "total".
+func Total(rows []Row) Row {
+	total := Row{Key: "total"}
+	for _, row := range rows {
+		total.Requests += row.Requests
+		total.Usage.Add(row.Usage)
+		total.Cost += row.Cost
+		total.Unpriced += row.Unpriced
+	}
+	return total
+}
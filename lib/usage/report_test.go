@@ -0,0 +1,77 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func record(session, model string, day int, prompt, completion int64) Record {
+	return Record{
+		SessionID: session,
+		Model:     model,
+		Time:      time.Date(2024, 5, day, 12, 0, 0, 0, time.Local),
+		Usage:     message.Usage{PromptTokens: prompt, CompletionTokens: completion},
+	}
+}
+
+func TestAggregate_ByDayIsChronological(t *testing.T) {
+	records := []Record{
+		record("a", "m", 3, 10, 10),
+		record("b", "m", 1, 10, 10),
+		record("c", "m", 3, 5, 5),
+	}
+
+	rows := Aggregate(records, GroupByDay, Prices{})
+	require.Len(t, rows, 2)
+	assert.Equal(t, "2024-05-01", rows[0].Key)
+	assert.Equal(t, "2024-05-03", rows[1].Key)
+	assert.Equal(t, 2, rows[1].Requests)
+	assert.Equal(t, int64(15), rows[1].Usage.PromptTokens)
+}
+
+func TestAggregate_ByModelOrdersByCost(t *testing.T) {
+	prices := Prices{"cheap": {Input: 1, Output: 1}, "pricey": {Input: 100, Output: 100}}
+	records := []Record{
+		record("a", "cheap", 1, 1000, 1000),
+		record("b", "pricey", 1, 100, 100),
+	}
+
+	rows := Aggregate(records, GroupByModel, prices)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "pricey", rows[0].Key)
+	assert.Equal(t, "cheap", rows[1].Key)
+}
+
+func TestAggregate_CountsUnpricedRequests(t *testing.T) {
+	records := []Record{
+		record("a", "known", 1, 1_000_000, 0),
+		record("a", "unknown", 1, 1_000_000, 0),
+	}
+
+	rows := Aggregate(records, GroupBySession, Prices{"known": {Input: 2}})
+	require.Len(t, rows, 1)
+	assert.InDelta(t, 2.0, rows[0].Cost, 1e-9)
+	assert.Equal(t, 1, rows[0].Unpriced)
+}
+
+func TestTotal_SumsRows(t *testing.T) {
+	rows := []Row{
+		{Key: "a", Requests: 1, Usage: message.Usage{PromptTokens: 1}, Cost: 1},
+		{Key: "b", Requests: 2, Usage: message.Usage{PromptTokens: 2}, Cost: 2, Unpriced: 1},
+	}
+
+	total := Total(rows)
+	assert.Equal(t, 3, total.Requests)
+	assert.Equal(t, int64(3), total.Usage.PromptTokens)
+	assert.InDelta(t, 3.0, total.Cost, 1e-9)
+	assert.Equal(t, 1, total.Unpriced)
+}
+
+func TestParseGroupBy_RejectsUnknown(t *testing.T) {
+	_, err := ParseGroupBy("week")
+	assert.Error(t, err)
+}
@@ -0,0 +1,31 @@
+package util
+
+import "strings"
+
+// MergeMaps returns a copy of base with the entries of overrides applied on
+// top.
+func MergeMaps[M ~map[K]V, K comparable, V any](base, overrides M) M {
+	merged := make(M, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// LookupModel finds the entry of model in a table keyed by model names. An
+// exact match wins; otherwise the provider prefix is stripped
+// ("openai/gpt-4o" → "gpt-4o").
+func LookupModel[V any](m map[string]V, model string) (V, bool) {
+	if v, ok := m[model]; ok {
+		return v, true
+	}
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		v, ok := m[model[i+1:]]
+		return v, ok
+	}
+	var zero V
+	return zero, false
+}
@@ -0,0 +1,68 @@
+package window
+
+import (
+	"github.com/dtrugman/qory/lib/message"
+)
+
+const (
+	// bytesPerToken is a rough average for English prose; code and other
+	// languages need more tokens per byte, which the reserve absorbs.
+	bytesPerToken = 4
+
+	// messageOverhead accounts for the role and framing tokens every message
+	// costs on top of its content.
+	messageOverhead = 4
+
+	// imageTokens approximates what an attached image costs; providers charge
+	// by resolution, up to about this much for a detailed image.
+	imageTokens = 1000
+
+	// maxReserve caps the room left for the answer when no token limit is set.
+	maxReserve = 4096
+)
+
+// Estimate approximates the number of prompt tokens messages cost. It does
+// not need a tokenizer and is only meant for budgeting.
+func Estimate(messages []message.Message) int {
+	n := 0
+	for _, m := range messages {
+		n += messageOverhead + (len(m.Content)+bytesPerToken-1)/bytesPerToken
+		n += len(m.Images) * imageTokens
+		for _, call := range m.ToolCalls {
+			n += messageOverhead + (len(call.Name)+len(call.Arguments)+bytesPerToken-1)/bytesPerToken
+		}
+	}
+	return n
+}
+
+// Budget returns how many prompt tokens fit a context of size tokens while
+// leaving room for an answer of up to maxTokens (0 if unlimited).
+func Budget(size int, maxTokens int64) int {
+	reserve := min(size/4, maxReserve)
+	if maxTokens > 0 {
+		reserve = int(min(maxTokens, int64(size)/2))
+	}
+	return size - reserve
+}
+
+// Trim returns how many leading messages of turns must be dropped for fixed
+// followed by the rest of turns to fit budget. Only whole turns are dropped,
+// and never the latest question, so the result may still exceed budget.
+func Trim(fixed, turns []message.Message, budget int) int {
+	last := len(turns) - 1
+	for last > 0 && turns[last].Role != message.RoleUser {
+		last--
+	}
+
+	total := Estimate(fixed) + Estimate(turns)
+	drop := 0
+	for total > budget && drop < last {
+		next := drop + 1
+		for next < last && turns[next].Role != message.RoleUser {
+			next++
+		}
+		total -= Estimate(turns[drop:next])
+		drop = next
+	}
+	return drop
+}
@@ -0,0 +1,56 @@
+package window
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dtrugman/qory/lib/message"
+	"github.com/stretchr/testify/assert"
+)
+
+// words returns content costing n tokens by Estimate, overhead excluded.
+func words(n int) string {
+	return strings.Repeat("abcd", n)
+}
+
+func TestEstimate(t *testing.T) {
+	msgs := []message.Message{
+		message.NewUserMessage(words(10)),
+		message.NewAssistantMessage("abcde"),
+	}
+	assert.Equal(t, 10+messageOverhead+2+messageOverhead, Estimate(msgs))
+
+	msgs[0].Images = []message.Image{{Path: "a.png"}, {Path: "b.png"}}
+	assert.Equal(t, 10+messageOverhead+2+messageOverhead+2*imageTokens, Estimate(msgs))
+}
+
+func TestBudget(t *testing.T) {
+	assert.Equal(t, 128_000-maxReserve, Budget(128_000, 0))
+	assert.Equal(t, 6_000, Budget(8_000, 0))
+	assert.Equal(t, 127_000, Budget(128_000, 1_000))
+	assert.Equal(t, 4_000, Budget(8_000, 100_000))
+}
+
+func TestTrim_DropsWholeOldestTurns(t *testing.T) {
+	fixed := []message.Message{message.NewSystemMessage(words(6))}
+	turns := []message.Message{
+		message.NewUserMessage(words(6)),
+		message.NewAssistantMessage(words(6)),
+		message.NewUserMessage(words(6)),
+		message.NewAssistantMessage(words(6)),
+		message.NewUserMessage(words(6)),
+	}
+
+	assert.Equal(t, 0, Trim(fixed, turns, 60))
+	assert.Equal(t, 2, Trim(fixed, turns, 59))
+	assert.Equal(t, 4, Trim(fixed, turns, 39))
+}
+
+func TestTrim_KeepsLatestQuestion(t *testing.T) {
+	turns := []message.Message{
+		message.NewUserMessage(words(100)),
+		message.NewAssistantMessage(words(100)),
+		message.NewUserMessage(words(100)),
+	}
+	assert.Equal(t, 2, Trim(nil, turns, 10))
+}
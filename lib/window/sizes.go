@@ -0,0 +1,57 @@
+package window
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dtrugman/qory/lib/util"
+)
+
+// Sizes maps model names to the size of their context window in tokens. Keys
+// may either be a bare model name ("gpt-4o") or include a provider prefix
+// ("openai/gpt-4o").
+type Sizes map[string]int
+
+// DefaultSizes returns the built-in context size table. Users can override or
+// extend it with `qory config context-sizes set`.
+func DefaultSizes() Sizes {
+	return Sizes{
+		"gpt-4o":            128_000,
+		"gpt-4o-mini":       128_000,
+		"gpt-4.1":           1_047_576,
+		"gpt-4.1-mini":      1_047_576,
+		"gpt-4.1-nano":      1_047_576,
+		"o3":                200_000,
+		"o3-mini":           200_000,
+		"o4-mini":           200_000,
+		"claude-sonnet-4-0": 200_000,
+		"claude-opus-4-0":   200_000,
+		"claude-3-5-haiku":  200_000,
+	}
+}
+
+// ParseSizes decodes a user context size table from JSON, e.g.
+//
+//	{"llama3": 8192}
+func ParseSizes(raw string) (Sizes, error) {
+	var sizes Sizes
+	if err := json.Unmarshal([]byte(raw), &sizes); err != nil {
+		return nil, fmt.Errorf("invalid context size table: %w", err)
+	}
+	for model, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid context size table: non-positive size for %q", model)
+		}
+	}
+	return sizes, nil
+}
+
+// Merge returns a copy of s with the entries of overrides applied on top.
+func (s Sizes) Merge(overrides Sizes) Sizes {
+	return util.MergeMaps(s, overrides)
+}
+
+// Lookup finds the context size of model (see util.LookupModel).
+func (s Sizes) Lookup(model string) (int, bool) {
+	return util.LookupModel(s, model)
+}
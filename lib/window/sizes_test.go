@@ -0,0 +1,34 @@
+package window
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizes_LookupStripsProviderPrefix(t *testing.T) {
+	sizes := Sizes{"gpt-4o": 128_000}
+
+	size, ok := sizes.Lookup("openai/gpt-4o")
+	require.True(t, ok)
+	assert.Equal(t, 128_000, size)
+
+	_, ok = sizes.Lookup("openai/unknown")
+	assert.False(t, ok)
+}
+
+func TestSizes_Merge(t *testing.T) {
+	merged := Sizes{"a": 1, "b": 2}.Merge(Sizes{"b": 3, "c": 4})
+	assert.Equal(t, Sizes{"a": 1, "b": 3, "c": 4}, merged)
+}
+
+func TestParseSizes_RejectsNonPositive(t *testing.T) {
+	_, err := ParseSizes(`{"m": 0}`)
+	assert.Error(t, err)
+}
+
+func TestParseSizes_RejectsMalformed(t *testing.T) {
+	_, err := ParseSizes(`{"m": "big"}`)
+	assert.Error(t, err)
+}